@@ -0,0 +1,67 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	h "github.com/ernestio/api-gateway/helpers"
+)
+
+// setupAuthzPolicy : loads the authorization policy file if any, and
+// reloads it every time the process receives a SIGHUP
+func setupAuthzPolicy() {
+	path := os.Getenv("AUTHZ_POLICY")
+	if path == "" {
+		return
+	}
+
+	p, err := h.LoadAuthzPolicy(path)
+	if err != nil {
+		panic(err.Error())
+	}
+	h.SetAuthzPolicy(p)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+
+	go func() {
+		for range sig {
+			p, err := h.LoadAuthzPolicy(path)
+			if err != nil {
+				h.L.Error("Could not reload the authorization policy, keeping the current one: " + err.Error())
+				continue
+			}
+			h.SetAuthzPolicy(p)
+			h.L.Info("Authorization policy reloaded from " + path)
+		}
+	}()
+}
+
+// ValidatePolicy : reports the problems found on an authorization
+// policy file, returning the process exit code
+func ValidatePolicy(path string) int {
+	p, err := h.LoadAuthzPolicy(path)
+	if p == nil {
+		fmt.Println(err.Error())
+		return 1
+	}
+
+	problems := p.Validate()
+	for _, v := range problems {
+		fmt.Println(v)
+	}
+
+	if len(problems) > 0 {
+		return 1
+	}
+
+	fmt.Println("Authorization policy is valid")
+
+	return 0
+}
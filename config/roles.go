@@ -0,0 +1,31 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package config
+
+import (
+	"strconv"
+	"time"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+)
+
+// setupRoleSweeper : periodically deletes the roles that have expired
+func setupRoleSweeper() {
+	c := models.Config{}
+	interval := c.GetRoleSweepInterval()
+
+	go func() {
+		for range time.Tick(interval) {
+			swept, err := models.SweepExpiredRoles()
+			if err != nil {
+				h.L.Error("Could not delete the expired roles: " + err.Error())
+			}
+			if swept > 0 {
+				h.L.Info(strconv.Itoa(swept) + " expired roles deleted")
+			}
+		}
+	}()
+}
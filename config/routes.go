@@ -34,15 +34,26 @@ func Route() *echo.Echo {
 
 func setupRoot(e *echo.Echo) {
 	e.POST("/auth/", controllers.AuthenticateHandler)
+	e.POST("/auth/refresh/", controllers.RefreshHandler)
+	e.POST("/auth/reset/", controllers.RequestPasswordResetHandler)
+	e.POST("/auth/reset/confirm/", controllers.ResetPasswordHandler)
+	e.GET("/auth/oidc/", controllers.OIDCLoginHandler)
+	e.GET("/auth/oidc/callback/", controllers.OIDCCallbackHandler)
+	e.GET("/auth/jwks/", controllers.GetJWKSHandler)
 	e.GET("/status/", controllers.GetStatusHandler)
 }
 
 func setupAPI(e *echo.Echo) {
 	api := e.Group("/api")
-	api.Use(middleware.JWT([]byte(controllers.Secret)))
+	api.Use(controllers.ValidateToken)
+	api.Use(controllers.CheckRevocation)
+	api.Use(controllers.Audit)
 
 	ss := api.Group("/session")
 	ss.GET("/", controllers.GetSessionsHandler)
+	ss.DELETE("/", controllers.DeleteSessionHandler)
+	ss.GET("/active/", controllers.ListSessionsHandler)
+	ss.DELETE("/:session/", controllers.RevokeSessionHandler)
 
 	// Setup user routes
 	u := api.Group("/users")
@@ -51,6 +62,26 @@ func setupAPI(e *echo.Echo) {
 	u.POST("/", controllers.CreateUserHandler)
 	u.PUT("/:user/", controllers.UpdateUserHandler)
 	u.DELETE("/:user/", controllers.DeleteUserHandler)
+	u.POST("/:user/revoke/", controllers.RevokeUserTokensHandler)
+	u.GET("/:user/tokens/", controllers.GetTokensHandler)
+	u.POST("/:user/tokens/", controllers.CreateTokenHandler)
+	u.DELETE("/:user/tokens/:token/", controllers.DeleteTokenHandler)
+	u.GET("/:user/ldap/sync/", controllers.LDAPSyncPlanHandler)
+	u.POST("/:user/mfa/", controllers.EnrollMFAHandler)
+	u.POST("/:user/mfa/verify/", controllers.VerifyMFAHandler)
+	u.DELETE("/:user/mfa/", controllers.DisableMFAHandler)
+	u.POST("/:user/mfa/reset/", controllers.ResetMFAHandler)
+
+	// Setup signing key routes
+	k := api.Group("/keys")
+	k.GET("/", controllers.GetKeysHandler)
+	k.POST("/", controllers.RotateKeyHandler)
+	k.DELETE("/:key/", controllers.DeleteKeyHandler)
+
+	// Setup login lockout routes
+	lo := api.Group("/lockouts")
+	lo.GET("/", controllers.GetLockoutsHandler)
+	lo.DELETE("/:lockout/", controllers.DeleteLockoutHandler)
 
 	// Setup roles routes
 	r := api.Group("/roles")
@@ -60,6 +91,39 @@ func setupAPI(e *echo.Echo) {
 	r.DELETE("/", controllers.DeleteRoleHandler)
 	r.DELETE("/:role/", controllers.DeleteRoleByIDHandler)
 
+	// Setup custom roles routes
+	cr := api.Group("/custom_roles")
+	cr.GET("/", controllers.GetCustomRolesHandler)
+	cr.GET("/:custom_role/", controllers.GetCustomRoleHandler)
+	cr.POST("/", controllers.CreateCustomRoleHandler)
+	cr.PUT("/:custom_role/", controllers.UpdateCustomRoleHandler)
+	cr.DELETE("/:custom_role/", controllers.DeleteCustomRoleHandler)
+
+	// Setup team routes
+	t := api.Group("/teams")
+	t.GET("/", controllers.GetTeamsHandler)
+	t.GET("/:team/", controllers.GetTeamHandler)
+	t.POST("/", controllers.CreateTeamHandler)
+	t.PUT("/:team/", controllers.UpdateTeamHandler)
+	t.DELETE("/:team/", controllers.DeleteTeamHandler)
+
+	// Setup audit routes
+	api.GET("/audit/", controllers.GetAuditHandler)
+	as := api.Group("/audit/sinks")
+	as.GET("/", controllers.GetAuditSinksHandler)
+	as.POST("/", controllers.CreateAuditSinkHandler)
+	as.DELETE("/:audit_sink/", controllers.DeleteAuditSinkHandler)
+
+	// Setup change freeze routes
+	fz := api.Group("/freezes")
+	fz.GET("/", controllers.GetFreezesHandler)
+	fz.POST("/", controllers.CreateFreezeHandler)
+	fz.DELETE("/:freeze/", controllers.DeleteFreezeHandler)
+
+	// Setup authorization routes
+	az := api.Group("/authz")
+	az.GET("/explain/", controllers.ExplainAuthzHandler)
+
 	// Setup logger routes
 	l := api.Group("/loggers")
 	l.GET("/", controllers.GetLoggersHandler)
@@ -73,6 +137,7 @@ func setupAPI(e *echo.Echo) {
 	d.POST("/", controllers.CreateDatacenterHandler)
 	d.PUT("/:project/", controllers.UpdateDatacenterHandler)
 	d.DELETE("/:project/", controllers.DeleteDatacenterHandler)
+	d.POST("/:project/rename/", controllers.RenameDatacenterHandler)
 
 	// Setup env routes
 	d.GET("/:project/envs/", controllers.GetEnvsHandler)
@@ -80,6 +145,11 @@ func setupAPI(e *echo.Echo) {
 	d.PUT("/:project/envs/:env/", controllers.UpdateEnvHandler)
 	d.GET("/:project/envs/:env/", controllers.GetEnvHandler)
 	d.DELETE("/:project/envs/:env/", controllers.DeleteEnvHandler)
+	d.POST("/:project/envs/:env/rename/", controllers.RenameEnvHandler)
+	d.GET("/:project/envs/:env/lock/", controllers.GetEnvLocksHandler)
+	d.POST("/:project/envs/:env/lock/", controllers.LockEnvHandler)
+	d.DELETE("/:project/envs/:env/lock/", controllers.UnlockEnvHandler)
+	d.POST("/:project/envs/:env/extend/", controllers.ExtendEnvHandler)
 
 	// Setup build routes
 	d.GET("/:project/envs/:env/builds/", controllers.GetBuildsHandler)
@@ -87,6 +157,8 @@ func setupAPI(e *echo.Echo) {
 	d.GET("/:project/envs/:env/builds/:build/", controllers.GetBuildHandler)
 	d.GET("/:project/envs/:env/builds/:build/mapping/", controllers.GetBuildMappingHandler)
 	d.GET("/:project/envs/:env/builds/:build/definition/", controllers.GetBuildDefinitionHandler)
+	d.GET("/:project/envs/:env/promotions/", controllers.GetPromotionsHandler)
+	d.GET("/:project/envs/:env/schedules/runs/", controllers.GetScheduleRunsHandler)
 	d.POST("/:project/envs/:env/actions/", controllers.ActionHandler)
 	d.POST("/:project/envs/:env/diff/", controllers.GetDiffHandler)
 	d.DELETE("/:project/envs/:env/actions/force/", controllers.ForceEnvDeletionHandler)
@@ -99,6 +171,7 @@ func setupAPI(e *echo.Echo) {
 	// Setup reports
 	rep := api.Group("/reports")
 	rep.GET("/usage/", controllers.GetUsageReportHandler)
+	rep.GET("/expiring/", controllers.GetExpiringReportHandler)
 
 	// Setup notifications
 	not := api.Group("/notifications")
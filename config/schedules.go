@@ -0,0 +1,35 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package config
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/ernestio/api-gateway/controllers/schedules"
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+)
+
+// setupScheduler : periodically runs the environment schedules that are
+// due, and expires the environments reaching their ttl
+func setupScheduler() {
+	c := models.Config{}
+	interval := c.GetSchedulerInterval()
+	warning := c.GetExpiryWarning()
+
+	go func() {
+		last := time.Now()
+		for now := range time.Tick(interval) {
+			if ran := schedules.Run(last, now); ran > 0 {
+				h.L.Info(strconv.Itoa(ran) + " environment schedules run")
+			}
+			if ran := schedules.Expire(now, warning); ran > 0 {
+				h.L.Info(strconv.Itoa(ran) + " environment expiries run")
+			}
+			last = now
+		}
+	}()
+}
@@ -23,4 +23,48 @@ func Setup() {
 	if controllers.Secret, err = c.GetJWTToken(); err != nil {
 		panic(err.Error())
 	}
+
+	controllers.Keys = models.NewKeyring(controllers.Secret)
+	if err = controllers.Keys.Load(); err != nil {
+		log.Println("Could not load signing keys, using the jwt secret: " + err.Error())
+	}
+	if err = controllers.Keys.Subscribe(); err != nil {
+		panic(err.Error())
+	}
+	if err = models.SubscribeRevocations(); err != nil {
+		panic(err.Error())
+	}
+
+	if controllers.TrustedProxies, err = c.GetTrustedProxies(); err != nil {
+		panic(err.Error())
+	}
+
+	controllers.Throttle = models.NewLoginThrottle()
+	if err = controllers.Throttle.Subscribe(); err != nil {
+		panic(err.Error())
+	}
+
+	controllers.ResetThrottle = models.NewPasswordResetThrottle()
+	if err = controllers.ResetThrottle.Subscribe(); err != nil {
+		panic(err.Error())
+	}
+
+	controllers.Mail = &models.NotificationMailer{}
+
+	if models.Passwords, err = models.NewPasswordPolicy(); err != nil {
+		panic(err.Error())
+	}
+
+	models.AuditSinks = models.NewAuditDispatcher(c.GetAuditBufferSize())
+	models.AuditSinks.SpoolDir = c.GetAuditSpoolDir()
+	if err = models.AuditSinks.Load(); err != nil {
+		log.Println("Could not load the audit sinks: " + err.Error())
+	}
+	if err = models.AuditSinks.Subscribe(); err != nil {
+		log.Println("Could not subscribe to audit sink changes: " + err.Error())
+	}
+
+	setupAuthzPolicy()
+	setupRoleSweeper()
+	setupScheduler()
 }
@@ -26,16 +26,20 @@ func ActionHandler(c echo.Context) error {
 	}
 
 	switch action.Type {
+	case "clone":
+		st, b = envs.Clone(au, envName(c), action, justification(c))
 	case "import":
-		st, b = builds.Import(au, envName(c), action)
+		st, b = builds.Import(au, envName(c), action, justification(c))
+	case "promote":
+		st, b = builds.Promote(au, envName(c), action, justification(c))
 	case "reset":
 		st, b = envs.Reset(au, envName(c), action)
 	case "sync":
-		st, b = envs.Sync(au, envName(c), action)
+		st, b = envs.Sync(au, envName(c), action, justification(c))
 	case "resolve":
 		st, b = envs.Resolve(au, envName(c), action)
 	case "review":
-		st, b = builds.Review(au, envName(c), action)
+		st, b = builds.Review(au, envName(c), action, justification(c))
 	case "validate":
 		st, b = builds.Validate(au, envName(c), action)
 	default:
@@ -0,0 +1,272 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ernestio/api-gateway/controllers/audit"
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+	"github.com/labstack/echo"
+	"github.com/nu7hatch/gouuid"
+	"github.com/sirupsen/logrus"
+)
+
+// auditSnapshots : gets the current state of the resources that can be
+// snapshotted by their type, before and after they are changed
+var auditSnapshots = map[string]func(id string) (interface{}, error){
+	"project": func(id string) (interface{}, error) {
+		var d models.Project
+		err := d.FindByName(id)
+		return d, err
+	},
+	"env": func(id string) (interface{}, error) {
+		var e models.Env
+		err := e.FindByName(id)
+		return e, err
+	},
+	"user": func(id string) (interface{}, error) {
+		var u models.User
+		err := u.FindByUserName(id, &u)
+		return u, err
+	},
+	"role": func(id string) (interface{}, error) {
+		var r models.Role
+		err := r.FindByID(id, &r)
+		return r, err
+	},
+	"team": func(id string) (interface{}, error) {
+		var t models.Team
+		err := t.FindByName(id)
+		return t, err
+	},
+	"custom_role": func(id string) (interface{}, error) {
+		var r models.CustomRole
+		err := r.FindByName(id)
+		return r, err
+	},
+	"policy": func(id string) (interface{}, error) {
+		var p models.Policy
+		err := p.GetByName(id, &p)
+		return p, err
+	},
+	"notification": func(id string) (interface{}, error) {
+		var n models.Notification
+		err := n.FindByName(id, &n)
+		return n, err
+	},
+}
+
+// auditResponseWriter keeps a copy of the response body
+type auditResponseWriter struct {
+	http.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w *auditResponseWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// Audit : records who changed what on every POST, PUT and DELETE
+// request, with a redacted snapshot of the resource before and after
+func Audit(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		method := c.Request().Method
+		if method != echo.POST && method != echo.PUT && method != echo.DELETE {
+			return next(c)
+		}
+
+		au := AuthenticatedUser(c)
+		resourceType, resourceID, created := auditResource(c)
+
+		entry := models.AuditEntry{
+			RequestID:    auditRequestID(c),
+			Actor:        au.Username,
+			Action:       method + " " + c.Path(),
+			ResourceType: resourceType,
+			ResourceID:   resourceID,
+			IP:           clientIP(c),
+			Timestamp:    time.Now().Unix(),
+		}
+
+		if method != echo.POST {
+			entry.Before = auditSnapshot(resourceType, resourceID)
+		}
+
+		body := new(bytes.Buffer)
+		c.Response().Writer = &auditResponseWriter{ResponseWriter: c.Response().Writer, body: body}
+
+		err := next(c)
+
+		entry.Status = c.Response().Status
+		if err != nil {
+			entry.Status = http.StatusInternalServerError
+			if he, ok := err.(*echo.HTTPError); ok {
+				entry.Status = he.Code
+			}
+		}
+		if created && entry.Status < 300 {
+			entry.ResourceID = createdID(resourceID, body.Bytes())
+		}
+		if method != echo.DELETE && entry.Status < 300 {
+			if entry.After = auditSnapshot(resourceType, entry.ResourceID); entry.After == nil {
+				entry.After = models.AuditSnapshot(body.Bytes())
+			}
+		}
+
+		// the audit store must never slow down nor fail the request
+		go func() {
+			if err := entry.Save(); err != nil {
+				h.L.WithFields(logrus.Fields{
+					"request_id": entry.RequestID,
+					"actor":      entry.Actor,
+					"action":     entry.Action,
+				}).Error("Could not save the audit entry: " + err.Error())
+			}
+			models.AuditSinks.Publish(entry)
+		}()
+
+		return err
+	}
+}
+
+// GetAuditHandler : responds to GET /audit/ with the audit entries
+// matching the given filters
+func GetAuditHandler(c echo.Context) error {
+	au := AuthenticatedUser(c)
+	st, b := h.IsAuthorized(&au, "audit/list")
+	if st == 200 {
+		st, b = audit.List(au, c.QueryParam("user"), c.QueryParam("resource_type"), c.QueryParam("resource_id"),
+			c.QueryParam("from"), c.QueryParam("to"), c.QueryParam("page"), c.QueryParam("per_page"))
+	}
+
+	return h.Respond(c, st, b)
+}
+
+// GetAuditSinksHandler : responds to GET /audit/sinks/ with a list of
+// all audit sinks
+func GetAuditSinksHandler(c echo.Context) (err error) {
+	return genericList(c, "audit_sink", audit.ListSinks)
+}
+
+// CreateAuditSinkHandler : responds to POST /audit/sinks/ by creating an
+// audit sink
+func CreateAuditSinkHandler(c echo.Context) (err error) {
+	return genericCreate(c, "audit_sink", audit.CreateSink)
+}
+
+// DeleteAuditSinkHandler : responds to DELETE /audit/sinks/:audit_sink/
+// by deleting an existing audit sink
+func DeleteAuditSinkHandler(c echo.Context) (err error) {
+	return genericDelete(c, "audit_sink", audit.DeleteSink)
+}
+
+// auditResource : gets the type and id of the resource a request acts
+// on from its route, and whether the request creates it. Routes ending
+// on a collection, as in /projects/:project/envs/, act on the collection
+// items, while any other route acts on its last parameter
+func auditResource(c echo.Context) (string, string, bool) {
+	var ids []string
+	var resourceType string
+
+	path := c.Path()
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	for _, s := range segments {
+		if strings.HasPrefix(s, ":") {
+			resourceType = s[1:]
+			ids = append(ids, c.Param(s[1:]))
+		}
+	}
+
+	if last := segments[len(segments)-1]; !strings.HasPrefix(last, ":") {
+		if item := collectionItem(c, path); item != "" {
+			return item, strings.Join(ids, "/"), c.Request().Method == echo.POST
+		}
+	}
+
+	return resourceType, strings.Join(ids, "/"), false
+}
+
+// collectionItem : gets the parameter naming the items of a collection
+// route, if any route is defined for them
+func collectionItem(c echo.Context, path string) string {
+	for _, r := range c.Echo().Routes() {
+		if !strings.HasPrefix(r.Path, path+":") {
+			continue
+		}
+
+		item := strings.TrimPrefix(r.Path, path+":")
+		return strings.Split(item, "/")[0]
+	}
+
+	return ""
+}
+
+// createdID : gets the id of a created resource from the response, below
+// the ids of its parents
+func createdID(parent string, body []byte) string {
+	var created map[string]interface{}
+
+	if err := json.Unmarshal(body, &created); err != nil {
+		return parent
+	}
+
+	var id string
+	switch v := created["name"].(type) {
+	case string:
+		id = v
+	default:
+		if n, ok := created["id"].(float64); ok {
+			id = strconv.Itoa(int(n))
+		}
+	}
+
+	if id == "" {
+		return parent
+	}
+
+	if parent == "" || strings.Contains(id, "/") {
+		return id
+	}
+
+	return parent + "/" + id
+}
+
+func auditSnapshot(resourceType, id string) interface{} {
+	snapshot, ok := auditSnapshots[resourceType]
+	if !ok || id == "" {
+		return nil
+	}
+
+	v, err := snapshot(id)
+	if err != nil {
+		return nil
+	}
+
+	return models.AuditSnapshot(v)
+}
+
+// auditRequestID : gets the id of the request, generating one if the
+// client didn't send any
+func auditRequestID(c echo.Context) string {
+	id := c.Request().Header.Get(echo.HeaderXRequestID)
+	if id == "" {
+		if u, err := uuid.NewV4(); err == nil {
+			id = u.String()
+		}
+	}
+
+	c.Response().Header().Set(echo.HeaderXRequestID, id)
+
+	return id
+}
@@ -0,0 +1,43 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package audit
+
+import (
+	"encoding/json"
+	"net/http"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+)
+
+// CreateSink : responds to POST /audit/sinks/ by creating an audit sink
+// on the data store, and exporting the audit entries to it
+func CreateSink(au models.User, body []byte) (int, []byte) {
+	var s models.AuditSink
+	var err error
+
+	if s.Map(body) != nil {
+		return 400, models.NewJSONError("Invalid input")
+	}
+
+	if err = s.Validate(); err != nil {
+		return http.StatusBadRequest, models.NewJSONError(err.Error())
+	}
+
+	if err = s.Save(); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	if err = models.AuditSinks.Reload(); err != nil {
+		h.L.Error("Could not reload the audit sinks: " + err.Error())
+	}
+
+	if body, err = json.Marshal(s); err != nil {
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	return http.StatusOK, body
+}
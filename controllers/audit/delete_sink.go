@@ -0,0 +1,28 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package audit
+
+import (
+	"net/http"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+)
+
+// DeleteSink : responds to DELETE /audit/sinks/:audit_sink: by deleting
+// an existing audit sink
+func DeleteSink(au models.User, sink string) (int, []byte) {
+	var s models.AuditSink
+
+	if err := s.Delete(sink); err != nil {
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	if err := models.AuditSinks.Reload(); err != nil {
+		h.L.Error("Could not reload the audit sinks: " + err.Error())
+	}
+
+	return http.StatusOK, models.NewJSONError("Audit sink successfully deleted")
+}
@@ -0,0 +1,87 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package audit
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+)
+
+const (
+	// DefaultPerPage : entries returned per page when not specified
+	DefaultPerPage = 50
+	// MaxPerPage : maximum entries returned per page
+	MaxPerPage = 500
+)
+
+// List : responds to GET /audit/ with a page of the audit entries
+// matching the given user, resource and time range
+func List(au models.User, user, resourceType, resourceID, from, to, page, perPage string) (int, []byte) {
+	var a models.AuditEntry
+	var err error
+
+	f := models.AuditFilter{
+		Actor:        user,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Page:         1,
+		PerPage:      DefaultPerPage,
+	}
+
+	if f.From, err = parseTime(from); err != nil {
+		return 400, models.NewJSONError("From must be a RFC3339 time or a unix timestamp")
+	}
+
+	if f.To, err = parseTime(to); err != nil {
+		return 400, models.NewJSONError("To must be a RFC3339 time or a unix timestamp")
+	}
+
+	if page != "" {
+		if f.Page, err = strconv.Atoi(page); err != nil || f.Page < 1 {
+			return 400, models.NewJSONError("Page must be a positive number")
+		}
+	}
+
+	if perPage != "" {
+		if f.PerPage, err = strconv.Atoi(perPage); err != nil || f.PerPage < 1 || f.PerPage > MaxPerPage {
+			return 400, models.NewJSONError("Per page must be a number between 1 and " + strconv.Itoa(MaxPerPage))
+		}
+	}
+
+	p, err := a.Find(f)
+	if err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	body, err := json.Marshal(p)
+	if err != nil {
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	return http.StatusOK, body
+}
+
+func parseTime(v string) (int64, error) {
+	if v == "" {
+		return 0, nil
+	}
+
+	if ts, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return ts, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return 0, err
+	}
+
+	return t.Unix(), nil
+}
@@ -0,0 +1,30 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package audit
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ernestio/api-gateway/models"
+)
+
+// ListSinks : responds to GET /audit/sinks/ with a list of all
+// audit sinks
+func ListSinks(au models.User) (int, []byte) {
+	var s models.AuditSink
+	var sinks []models.AuditSink
+
+	if err := s.FindAll(&sinks); err != nil {
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	body, err := json.Marshal(sinks)
+	if err != nil {
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	return http.StatusOK, body
+}
@@ -5,18 +5,48 @@
 package controllers
 
 import (
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/ernestio/api-gateway/helpers"
 	h "github.com/ernestio/api-gateway/helpers"
 	"github.com/ernestio/api-gateway/models"
 	"github.com/labstack/echo"
+	"github.com/nu7hatch/gouuid"
+	"github.com/sirupsen/logrus"
 )
 
-// Secret : TODO
+// Secret : legacy secret, used to verify tokens issued without a key id
 var Secret string
 
+// Keys : keyring used to sign and verify authentication tokens
+var Keys = models.NewKeyring("")
+
+// Throttle : tracks failed login attempts
+var Throttle = models.NewLoginThrottle()
+
+// ResetThrottle : tracks password reset requests
+var ResetThrottle = models.NewPasswordResetThrottle()
+
+// OverrideHeader : header carrying the justification to change a locked
+// or frozen environment
+const OverrideHeader = "X-Override-Justification"
+
+// justification : gets the justification given to override the locks
+// and freezes on a change
+func justification(c echo.Context) string {
+	return c.Request().Header.Get(OverrideHeader)
+}
+
+// RefreshRequest : payload accepted by the refresh endpoint
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" form:"refresh_token"`
+}
+
 // AuthenticatedUser : Get the authenticated user from the JWT Token
 func AuthenticatedUser(c echo.Context) models.User {
 	var u models.User
@@ -25,16 +55,48 @@ func AuthenticatedUser(c echo.Context) models.User {
 
 	claims, ok := user.Claims.(jwt.MapClaims)
 	if ok {
+		admin, _ := claims["admin"].(bool)
 		u.Username = claims["username"].(string)
-		u.Admin = helpers.Bool(claims["admin"].(bool))
+		u.Admin = helpers.Bool(admin)
 	}
 
+	// api tokens act with the current rights of their holder, and scoped
+	// tokens never grant admin permissions
+	if t, ok := c.Get("api_token").(*models.APIToken); ok {
+		holder, _ := c.Get("api_token_user").(*models.User)
+		u.Scope = t
+		u.Admin = helpers.Bool(holder != nil && holder.IsAdmin() && !t.IsScoped())
+	}
+
+	// roles are looked up once per request
+	u.CacheGrants()
+
 	return u
 }
 
+// throttled : checks if the throttle rejects an attempt for the given
+// username from the client ip, setting when to retry it
+func throttled(c echo.Context, t *models.LoginThrottle, username, msg string) bool {
+	wait := t.Check(username, clientIP(c))
+	if wait <= 0 {
+		return false
+	}
+
+	retry := int(math.Ceil(wait.Seconds()))
+	h.L.WithFields(logrus.Fields{
+		"username":    username,
+		"ip":          clientIP(c),
+		"retry_after": retry,
+	}).Warning(msg)
+	c.Response().Header().Set("Retry-After", strconv.Itoa(retry))
+
+	return true
+}
+
 // AuthenticateHandler manages user authentication
 func AuthenticateHandler(c echo.Context) error {
 	var u models.User
+	var existing models.User
 
 	err := c.Bind(&u)
 	if err != nil {
@@ -47,21 +109,363 @@ func AuthenticateHandler(c echo.Context) error {
 		return echo.NewHTTPError(400, err.Error())
 	}
 
-	res, err := u.Authenticate()
-	if err != nil {
-		h.L.Error(err.Error())
-		return echo.NewHTTPError(400, err.Error())
+	if throttled(c, Throttle, u.Username, "Login attempt rejected by the login throttle") {
+		return echo.NewHTTPError(http.StatusTooManyRequests, "Too many failed login attempts, please try again later")
+	}
+
+	ferr := u.FindByUserName(u.Username, &existing)
+	if ferr == nil && existing.IsServiceAccount() {
+		h.L.Error("Service account tried to authenticate with a password (" + u.Username + ")")
+		return echo.NewHTTPError(403, "Service accounts can't log in with a password, please use an api token")
 	}
 
-	if !res.OK {
-		h.L.Error(res.Message + " (" + u.Username + ")")
-		return echo.NewHTTPError(403, res.Message)
+	if ferr == nil && existing.IsOIDC() {
+		h.L.Error("OIDC user tried to authenticate with a password (" + u.Username + ")")
+		return echo.NewHTTPError(403, "Please log in through your identity provider")
 	}
 
+	if existing.IsLDAP() || (ferr != nil && models.LDAPEnabled()) {
+		if existing, err = ldapAuthenticate(c, u); err != nil {
+			return err
+		}
+		ferr = nil
+	} else {
+		var res *models.AuthResponse
+
+		if ferr == nil && u.Password != nil && models.IsRecoveryCode(u.VerificationCode) {
+			res, err = existing.AuthenticateWithRecoveryCode(*u.Password, u.VerificationCode)
+		} else {
+			res, err = u.Authenticate()
+		}
+		if err != nil {
+			h.L.Error(err.Error())
+			return echo.NewHTTPError(400, err.Error())
+		}
+
+		if !res.OK {
+			h.L.Error(res.Message + " (" + u.Username + ")")
+			Throttle.Fail(u.Username, clientIP(c))
+			return echo.NewHTTPError(403, res.Message)
+		}
+
+		// the authentication service can't tell a code was already
+		// used, so the accepted time steps are tracked here
+		if ferr == nil && existing.IsMFAEnabled() && existing.MFASecret != "" && !models.IsRecoveryCode(u.VerificationCode) {
+			if !existing.AcceptTOTP(u.VerificationCode) {
+				h.L.Error("Verification code replayed (" + u.Username + ")")
+				Throttle.Fail(u.Username, clientIP(c))
+				return echo.NewHTTPError(403, "Provided credentials are not valid")
+			}
+
+			if err := existing.SaveMFA(); err != nil {
+				h.L.Error(err.Error())
+				return echo.NewHTTPError(500, "Could not generate the authentication token")
+			}
+		}
+	}
+
+	Throttle.Succeed(u.Username)
+
 	if err := h.ValidCliVersion(c.Request()); err != nil {
 		h.L.Error(err.Error())
 		return echo.NewHTTPError(403, err.Error())
 	}
 
-	return c.JSON(http.StatusOK, map[string]string{"token": res.Token})
+	if ferr != nil {
+		h.L.Error(ferr.Error())
+		return echo.NewHTTPError(403, "Provided credentials are not valid")
+	}
+
+	if existing.IsDisabled() {
+		h.L.Error("Disabled user tried to authenticate (" + u.Username + ")")
+		return echo.NewHTTPError(403, "Your account has been disabled, please contact your admin")
+	}
+
+	tokens, err := startSession(c, existing)
+	if err != nil {
+		h.L.Error(err.Error())
+		return echo.NewHTTPError(500, "Could not generate the authentication token")
+	}
+
+	return c.JSON(http.StatusOK, tokens)
+}
+
+// RefreshHandler : exchanges a valid refresh token for a new access
+// and refresh token pair
+func RefreshHandler(c echo.Context) error {
+	var req RefreshRequest
+	var u models.User
+	var r models.Revocation
+
+	if err := c.Bind(&req); err != nil || req.RefreshToken == "" {
+		return echo.NewHTTPError(400, "A refresh token must be provided")
+	}
+
+	token, err := jwt.Parse(req.RefreshToken, Keys.Keyfunc)
+	if err != nil || !token.Valid {
+		return echo.NewHTTPError(401, "Invalid refresh token")
+	}
+
+	claims, _ := token.Claims.(jwt.MapClaims)
+	if claimString(claims, "type") != "refresh" {
+		return echo.NewHTTPError(401, "Invalid refresh token")
+	}
+
+	username := claimString(claims, "username")
+	jti := claimString(claims, "jti")
+	sid := claimString(claims, "sid")
+	iat := claimIssuedAt(claims)
+
+	revoked, err := r.IsRevoked(username, iat, jti, sid)
+	if err != nil {
+		h.L.Error(err.Error())
+		return echo.NewHTTPError(500, "Could not validate the refresh token")
+	}
+
+	if revoked {
+		// a refresh token can only be used once, so reusing a revoked
+		// one means it has leaked and the whole session is revoked
+		var sr models.Revocation
+		if err := sr.RevokeToken(username, sid, claimInt(claims, "exp")); err != nil {
+			h.L.Error(err.Error())
+		}
+		return echo.NewHTTPError(401, "Refresh token has been revoked")
+	}
+
+	if err := u.FindByUserName(username, &u); err != nil {
+		return echo.NewHTTPError(401, "Invalid refresh token")
+	}
+
+	if u.IsDisabled() {
+		return echo.NewHTTPError(403, "Your account has been disabled, please contact your admin")
+	}
+
+	if err := r.RevokeToken(username, jti, claimInt(claims, "exp")); err != nil {
+		h.L.Error(err.Error())
+		return echo.NewHTTPError(500, "Could not refresh the authentication token")
+	}
+
+	tokens, err := issueTokens(u, sid)
+	if err != nil {
+		h.L.Error(err.Error())
+		return echo.NewHTTPError(500, "Could not generate the authentication token")
+	}
+
+	if sid != "" {
+		var s models.Session
+		conf := models.Config{}
+		if err := s.Extend(sid, time.Now().Add(conf.GetRefreshTokenTTL()).Unix()); err != nil {
+			h.L.Warning("Could not update session " + sid + ": " + err.Error())
+		}
+	}
+
+	return c.JSON(http.StatusOK, tokens)
+}
+
+// ValidateToken : middleware verifying the bearer token signature with
+// the keyring and storing it on the request context
+func ValidateToken(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		auth := c.Request().Header.Get(echo.HeaderAuthorization)
+		if len(auth) <= 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+			return echo.NewHTTPError(http.StatusBadRequest, "Missing or malformed jwt")
+		}
+
+		token, err := jwt.Parse(auth[7:], Keys.Keyfunc)
+		if err != nil || !token.Valid {
+			return echo.ErrUnauthorized
+		}
+
+		c.Set("user", token)
+
+		return next(c)
+	}
+}
+
+// CheckRevocation : middleware rejecting tokens that can't access the
+// api or that have been revoked, or api tokens that no longer exist
+func CheckRevocation(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var r models.Revocation
+
+		token, ok := c.Get("user").(*jwt.Token)
+		if !ok {
+			return echo.ErrUnauthorized
+		}
+
+		// refresh, login state and password reset tokens are signed with
+		// the same keys, but can't be used to access the api
+		claims, ok := token.Claims.(jwt.MapClaims)
+		if !ok {
+			return echo.ErrUnauthorized
+		}
+
+		switch claimString(claims, "type") {
+		case "", "access", "api":
+		default:
+			return echo.ErrUnauthorized
+		}
+
+		revoked, err := r.IsRevokedCached(claimString(claims, "username"), claimIssuedAt(claims), claimString(claims, "jti"), claimString(claims, "sid"))
+		if err != nil {
+			h.L.Error(err.Error())
+			return echo.NewHTTPError(500, "Could not validate the authentication token")
+		}
+
+		if revoked {
+			return echo.NewHTTPError(401, "Authentication token has been revoked")
+		}
+
+		if claimString(claims, "type") == "api" {
+			var t models.APIToken
+			var holder models.User
+
+			if err := t.FindByTokenID(claimString(claims, "jti")); err != nil || t.IsExpired() {
+				return echo.NewHTTPError(401, "Api token has been revoked or is expired")
+			}
+
+			// api tokens outlive the access tokens, so the holder is loaded
+			// on every request in case it was deleted, disabled or demoted
+			if err := holder.FindByUserName(t.Username, &holder); err != nil {
+				if err == h.ErrNotFound {
+					return echo.NewHTTPError(401, "Api token has been revoked or is expired")
+				}
+				h.L.Error(err.Error())
+				return echo.NewHTTPError(500, "Could not validate the authentication token")
+			}
+
+			if holder.IsDisabled() {
+				return echo.NewHTTPError(401, "Api token has been revoked or is expired")
+			}
+
+			c.Set("api_token", &t)
+			c.Set("api_token_user", &holder)
+		}
+
+		if sid := claimString(claims, "sid"); sid != "" {
+			var s models.Session
+			if err := s.Touch(sid); err != nil {
+				h.L.Debug("Could not update session " + sid + ": " + err.Error())
+			}
+		}
+
+		return next(c)
+	}
+}
+
+// startSession : issues the tokens of a new session for the given user,
+// recording the client it was started from
+func startSession(c echo.Context, u models.User) (map[string]string, error) {
+	conf := models.Config{}
+	now := time.Now()
+	sid := newTokenID()
+
+	tokens, err := issueTokens(u, sid)
+	if err != nil {
+		return nil, err
+	}
+
+	s := models.Session{
+		SessionID:     sid,
+		Username:      u.Username,
+		UserAgent:     c.Request().UserAgent(),
+		ClientVersion: h.CliVersion(c.Request()),
+		IP:            clientIP(c),
+		IssuedAt:      now.Unix(),
+		IssuedAtMs:    models.UnixMillis(now),
+		LastSeen:      now.Unix(),
+		ExpiresAt:     now.Add(conf.GetRefreshTokenTTL()).Unix(),
+	}
+
+	// sessions are revoked by their id, so the tokens are still
+	// returned when the session could not be recorded
+	if err := s.Save(); err != nil {
+		h.L.Error("Could not record session " + sid + ": " + err.Error())
+	}
+
+	return tokens, nil
+}
+
+// issueTokens : generates a new access and refresh token pair for the
+// given user. A new session is started if no session id is provided
+func issueTokens(u models.User, sid string) (map[string]string, error) {
+	c := models.Config{}
+	now := time.Now()
+
+	if sid == "" {
+		sid = newTokenID()
+	}
+
+	at, err := Keys.Sign(jwt.MapClaims{
+		"type":     "access",
+		"jti":      newTokenID(),
+		"sid":      sid,
+		"username": u.Username,
+		"admin":    u.IsAdmin(),
+		"iat":      now.Unix(),
+		"iat_ms":   models.UnixMillis(now),
+		"exp":      now.Add(c.GetAccessTokenTTL()).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rt, err := Keys.Sign(jwt.MapClaims{
+		"type":     "refresh",
+		"jti":      newTokenID(),
+		"sid":      sid,
+		"username": u.Username,
+		"iat":      now.Unix(),
+		"iat_ms":   models.UnixMillis(now),
+		"exp":      now.Add(c.GetRefreshTokenTTL()).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{"token": at, "refresh_token": rt}, nil
+}
+
+// signAPIToken : generates the jwt representation of an api token. Its
+// admin rights are taken from the holder on every request, so they are
+// not part of the claims
+func signAPIToken(t *models.APIToken) (string, error) {
+	claims := jwt.MapClaims{
+		"type":     "api",
+		"jti":      t.TokenID,
+		"username": t.Username,
+		"iat":      t.CreatedAt,
+		"iat_ms":   models.UnixMillis(time.Now()),
+	}
+
+	if t.ExpiresAt > 0 {
+		claims["exp"] = t.ExpiresAt
+	}
+
+	return Keys.Sign(claims)
+}
+
+func newTokenID() string {
+	id, _ := uuid.NewV4()
+	return id.String()
+}
+
+func claimString(claims jwt.MapClaims, key string) string {
+	v, _ := claims[key].(string)
+	return v
+}
+
+// claimIssuedAt : gets when a token was issued, in milliseconds. Tokens
+// signed before the milliseconds were added only hold the second
+func claimIssuedAt(claims jwt.MapClaims) int64 {
+	if ms := claimInt(claims, "iat_ms"); ms > 0 {
+		return ms
+	}
+
+	return claimInt(claims, "iat") * 1000
+}
+
+func claimInt(claims jwt.MapClaims, key string) int64 {
+	v, _ := claims[key].(float64)
+	return int64(v)
 }
@@ -0,0 +1,23 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package controllers
+
+import (
+	"github.com/ernestio/api-gateway/controllers/authz"
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/labstack/echo"
+)
+
+// ExplainAuthzHandler : responds to GET /authz/explain/ with the
+// authorization decision of a user and the checks that produced it
+func ExplainAuthzHandler(c echo.Context) error {
+	au := AuthenticatedUser(c)
+	st, b := h.IsAuthorized(&au, "authz/explain")
+	if st == 200 {
+		st, b = authz.Explain(au, c.QueryParam("user"), c.QueryParam("endpoint"), c.QueryParam("resource_type"), c.QueryParam("resource_id"))
+	}
+
+	return h.Respond(c, st, b)
+}
@@ -0,0 +1,63 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package authz
+
+import (
+	"encoding/json"
+	"net/http"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+)
+
+// Explain : responds to GET /authz/explain/ with the authorization
+// decision of a user on an endpoint and the checks that produced it.
+// Users other than admins can only explain their own access
+func Explain(au models.User, username, endpoint, resourceType, resourceID string) (int, []byte) {
+	var u models.User
+
+	if username == "" {
+		username = au.Username
+	}
+
+	if endpoint == "" {
+		return 400, models.NewJSONError("Endpoint is empty")
+	}
+
+	if !h.IsPermission(endpoint) && !isResource(endpoint) {
+		return 400, models.NewJSONError("Endpoint '" + endpoint + "' is not a known permission or resource")
+	}
+
+	if h.IsPermission(endpoint) && (resourceType == "" || resourceID == "") {
+		return 400, models.NewJSONError("Resource type and resource id are required to explain a permission")
+	}
+
+	if !au.IsAdmin() && username != au.Username {
+		return 403, models.NewJSONError("You're not authorized to perform this action")
+	}
+
+	if username == au.Username {
+		u = au
+	} else if err := u.FindByUserName(username, &u); err != nil {
+		return 404, models.NewJSONError("Specified user not found")
+	}
+
+	body, err := json.Marshal(models.ExplainAuthorization(&u, endpoint, resourceType, resourceID))
+	if err != nil {
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	return http.StatusOK, body
+}
+
+func isResource(endpoint string) bool {
+	for _, r := range h.Resources {
+		if r == endpoint {
+			return true
+		}
+	}
+
+	return false
+}
@@ -77,6 +77,17 @@ func GetBuildDefinitionHandler(c echo.Context) error {
 	return h.Respond(c, st, b)
 }
 
+// GetPromotionsHandler : gets the promotions from and to an environment
+func GetPromotionsHandler(c echo.Context) error {
+	au := AuthenticatedUser(c)
+	st, b := h.IsAuthorized(&au, "builds/promotions")
+	if st == 200 {
+		st, b = builds.Promotions(au, envName(c))
+	}
+
+	return h.Respond(c, st, b)
+}
+
 // CreateBuildHandler : Will receive a env application
 func CreateBuildHandler(c echo.Context) error {
 	au := AuthenticatedUser(c)
@@ -91,7 +102,7 @@ func CreateBuildHandler(c echo.Context) error {
 	}
 
 	dry := c.QueryParam("dry")
-	st, b = builds.Create(au, &definition, raw, dry)
+	st, b = builds.Create(au, &definition, raw, dry, justification(c))
 
 	return h.Respond(c, st, b)
 }
@@ -17,7 +17,7 @@ import (
 )
 
 // Create : Creates an environment build
-func Create(au models.User, definition *definition.Definition, raw []byte, dry string) (int, []byte) {
+func Create(au models.User, definition *definition.Definition, raw []byte, dry, justification string) (int, []byte) {
 	var e models.Env
 	var m models.Mapping
 	var validation *validation.Validation
@@ -34,7 +34,7 @@ func Create(au models.User, definition *definition.Definition, raw []byte, dry s
 
 	if st, _ := h.IsAuthorizedToResource(&au, h.UpdateEnv, e.GetType(), e.Name); st != 200 {
 		// Try submission
-		return Submission(au, &e, definition, raw, dry)
+		return Submission(au, &e, definition, raw, dry, justification)
 	}
 
 	err = m.Apply(definition, au)
@@ -52,6 +52,15 @@ func Create(au models.User, definition *definition.Definition, raw []byte, dry s
 		return http.StatusOK, res
 	}
 
+	o, err := e.CheckLocks(au, justification, true)
+	if err != nil {
+		if _, ok := err.(*models.LockedError); ok {
+			return http.StatusLocked, models.NewJSONError(err.Error())
+		}
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Couldn't check the environment locks")
+	}
+
 	if h.Licensed() == nil {
 		validation, err = m.Validate(e.Name)
 		if err != nil {
@@ -88,6 +97,8 @@ func Create(au models.User, definition *definition.Definition, raw []byte, dry s
 		return 500, models.NewJSONError("Couldn't call build.create")
 	}
 
+	o.Record(b.ID)
+
 	br := models.BuildDetails{
 		ID:         b.ID,
 		Status:     b.Status,
@@ -12,7 +12,7 @@ import (
 )
 
 // Delete : Deletes an environment by name, generating a delete build
-func Delete(au models.User, name string) (int, []byte) {
+func Delete(au models.User, name, justification string) (int, []byte) {
 	var e models.Env
 	var m models.Mapping
 
@@ -30,6 +30,15 @@ func Delete(au models.User, name string) (int, []byte) {
 		return st, res
 	}
 
+	o, err := e.CheckLocks(au, justification, false)
+	if err != nil {
+		if _, ok := err.(*models.LockedError); ok {
+			return http.StatusLocked, models.NewJSONError(err.Error())
+		}
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Couldn't check the environment locks")
+	}
+
 	err = m.Delete(name, au)
 	if err != nil {
 		h.L.Error(err.Error())
@@ -56,5 +65,7 @@ func Delete(au models.User, name string) (int, []byte) {
 		return 500, models.NewJSONError("Couldn't call build.delete")
 	}
 
+	o.Record(b.ID)
+
 	return http.StatusOK, []byte(`{"id":"` + b.ID + `"}`)
 }
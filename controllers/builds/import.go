@@ -13,7 +13,7 @@ import (
 )
 
 // Import : Imports an environment
-func Import(au models.User, env string, action *models.Action) (int, []byte) {
+func Import(au models.User, env string, action *models.Action, justification string) (int, []byte) {
 	var e models.Env
 	var m models.Mapping
 
@@ -31,6 +31,15 @@ func Import(au models.User, env string, action *models.Action) (int, []byte) {
 		return st, res
 	}
 
+	o, err := e.CheckLocks(au, justification, false)
+	if err != nil {
+		if _, ok := err.(*models.LockedError); ok {
+			return http.StatusLocked, models.NewJSONError(err.Error())
+		}
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Couldn't check the environment locks")
+	}
+
 	err = m.Import(env, action.Options.Filters, au)
 	if err != nil {
 		h.L.Error(err.Error())
@@ -57,6 +66,8 @@ func Import(au models.User, env string, action *models.Action) (int, []byte) {
 		return 500, models.NewJSONError(`"Couldn't call build.import"`)
 	}
 
+	o.Record(b.ID)
+
 	action.ResourceID = b.ID
 	action.ResourceType = "build"
 	action.Status = "in_progress"
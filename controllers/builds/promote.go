@@ -0,0 +1,168 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package builds
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+	"github.com/ernestio/mapping/definition"
+	"github.com/ghodss/yaml"
+)
+
+// Promote : applies the definition of a build on another environment,
+// with the overrides stored on the target environment followed by the
+// given ones. Environments accepting submissions get the definition
+// submitted for approval
+func Promote(au models.User, env string, action *models.Action, justification string) (int, []byte) {
+	var e models.Env
+	var t models.Env
+	var b models.Build
+	var def definition.Definition
+
+	if !models.IsAlphaNumeric(env) {
+		return 404, models.NewJSONError("Environment name contains invalid characters")
+	}
+
+	if err := e.FindByName(env); err != nil {
+		h.L.Error(err.Error())
+		return 404, models.NewJSONError("Environment not found")
+	}
+
+	if st, res := h.IsAuthorizedToResource(&au, h.GetEnv, e.GetType(), e.Name); st != 200 {
+		return st, res
+	}
+
+	if action.Options.BuildID != "" {
+		if err := b.FindByID(action.Options.BuildID); err != nil || b.EnvironmentID != e.ID {
+			return 404, models.NewJSONError("Build not found")
+		}
+	} else if err := b.FindLastByName(e.Name); err != nil {
+		return 404, models.NewJSONError("Environment has no build to promote")
+	}
+
+	project := action.Options.Project
+	if project == "" {
+		project = e.GetProject()
+	}
+
+	name := action.Options.Name
+	if name == "" {
+		name = strings.TrimPrefix(e.Name, e.GetProject()+models.EnvNameSeparator)
+	}
+
+	target := project + models.EnvNameSeparator + name
+	if target == e.Name {
+		return 400, models.NewJSONError("An environment can't be promoted onto itself")
+	}
+
+	if !models.IsAlphaNumeric(target) {
+		return 404, models.NewJSONError("Target environment name contains invalid characters")
+	}
+
+	if err := t.FindByName(target); err != nil {
+		return 404, models.NewJSONError("Target environment not found")
+	}
+
+	raw, err := b.GetDefinition()
+	if err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Could not get the build definition")
+	}
+
+	if err = yaml.Unmarshal(raw, &def); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("The build definition is not valid")
+	}
+
+	if def, err = t.PromoteDefinition(def, action.Options.Overrides); err != nil {
+		return 400, models.NewJSONError(err.Error())
+	}
+
+	if raw, err = yaml.Marshal(def); err != nil {
+		return 500, models.NewJSONError("The build definition is not valid")
+	}
+
+	p := models.Promotion{
+		SourceEnv:   e.Name,
+		SourceBuild: b.ID,
+		TargetEnv:   t.Name,
+		Type:        "apply",
+		UserID:      au.ID,
+		Username:    au.Username,
+		CreatedAt:   time.Now().UTC(),
+	}
+
+	var st int
+	var res []byte
+
+	if submissions, _ := t.Options["submissions"].(bool); submissions {
+		p.Type = "submission"
+		st, res = Submission(au, &t, &def, raw, "false", justification)
+	} else {
+		st, res = Create(au, &def, raw, "false", justification)
+	}
+
+	if st != http.StatusOK {
+		return st, res
+	}
+
+	var br models.BuildDetails
+	if err = json.Unmarshal(res, &br); err != nil {
+		return 500, models.NewJSONError("Internal error")
+	}
+	p.TargetBuild = br.ID
+
+	if err = p.Save(); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Build created, but the promotion could not be recorded")
+	}
+
+	action.ResourceType = "build"
+	action.ResourceID = br.ID
+	action.Status = "in_progress"
+	if p.Type == "submission" {
+		action.Status = "submitted"
+	}
+
+	data, err := json.Marshal(action)
+	if err != nil {
+		return 500, models.NewJSONError("could not process promote request")
+	}
+
+	return http.StatusOK, data
+}
+
+// Promotions : responds to GET /projects/:project/envs/:env/promotions/
+// with the promotions from and to an environment
+func Promotions(au models.User, env string) (int, []byte) {
+	var e models.Env
+	var p models.Promotion
+	var promotions []models.Promotion
+
+	if err := e.FindByName(env); err != nil {
+		return 404, models.NewJSONError("Environment not found")
+	}
+
+	if st, res := h.IsAuthorizedToResource(&au, h.GetEnv, e.GetType(), e.Name); st != 200 {
+		return st, res
+	}
+
+	if err := p.FindByEnv(e.Name, &promotions); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal error")
+	}
+
+	data, err := json.Marshal(promotions)
+	if err != nil {
+		return 500, models.NewJSONError("Internal error")
+	}
+
+	return http.StatusOK, data
+}
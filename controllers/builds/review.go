@@ -13,7 +13,7 @@ import (
 )
 
 // Review : Resolves a build that is queued pending approval
-func Review(au models.User, env string, action *models.Action) (int, []byte) {
+func Review(au models.User, env string, action *models.Action, justification string) (int, []byte) {
 	var e models.Env
 
 	if !models.IsAlphaNumeric(env) {
@@ -30,10 +30,20 @@ func Review(au models.User, env string, action *models.Action) (int, []byte) {
 		return st, res
 	}
 
+	o, err := e.CheckLocks(au, justification, true)
+	if err != nil {
+		if _, ok := err.(*models.LockedError); ok {
+			return http.StatusLocked, models.NewJSONError(err.Error())
+		}
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Couldn't check the environment locks")
+	}
+
 	id, err := e.RequestReview(au, action.Options.Resolution)
 	if err != nil {
 		return 500, models.NewJSONError(err.Error())
 	}
+	o.Record(id)
 
 	action.Status = "done"
 
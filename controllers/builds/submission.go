@@ -17,7 +17,7 @@ import (
 )
 
 // Submission : Submits an environment build for approval
-func Submission(au models.User, e *models.Env, definition *definition.Definition, raw []byte, dry string) (int, []byte) {
+func Submission(au models.User, e *models.Env, definition *definition.Definition, raw []byte, dry, justification string) (int, []byte) {
 	var m models.Mapping
 	var validation *validation.Validation
 
@@ -34,6 +34,19 @@ func Submission(au models.User, e *models.Env, definition *definition.Definition
 		return st, res
 	}
 
+	// submissions are applied once reviewed, which checks the freezes
+	var o *models.LockOverride
+	if dry != "true" {
+		var err error
+		if o, err = e.CheckLocks(au, justification, false); err != nil {
+			if _, ok := err.(*models.LockedError); ok {
+				return http.StatusLocked, models.NewJSONError(err.Error())
+			}
+			h.L.Error(err.Error())
+			return 500, models.NewJSONError("Couldn't check the environment locks")
+		}
+	}
+
 	err := m.Submission(definition, au)
 	if err != nil {
 		h.L.Error(err.Error())
@@ -83,6 +96,8 @@ func Submission(au models.User, e *models.Env, definition *definition.Definition
 		return 500, models.NewJSONError("could not create the build")
 	}
 
+	o.Record(b.ID)
+
 	br := models.BuildDetails{
 		ID:         b.ID,
 		Status:     "submitted",
@@ -0,0 +1,67 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package controllers
+
+import (
+	"net"
+	"strings"
+
+	"github.com/labstack/echo"
+)
+
+// TrustedProxies : proxies the client ip is taken from the forwarded
+// headers of, the peer address is used for any other request
+var TrustedProxies []*net.IPNet
+
+// clientIP : gets the ip of the client making a request. Forwarded
+// headers are only followed through trusted proxies, as anyone else can
+// set them to any address
+func clientIP(c echo.Context) string {
+	req := c.Request()
+
+	ip, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		ip = req.RemoteAddr
+	}
+
+	if !trustedProxy(ip) {
+		return ip
+	}
+
+	if xff := req.Header.Get(echo.HeaderXForwardedFor); xff != "" {
+		// each proxy appends the address it got the request from, so the
+		// client is the last hop that is not a trusted proxy
+		hops := strings.Split(xff, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip = strings.TrimSpace(hops[i])
+			if !trustedProxy(ip) {
+				break
+			}
+		}
+
+		return ip
+	}
+
+	if xrip := req.Header.Get(echo.HeaderXRealIP); xrip != "" {
+		return xrip
+	}
+
+	return ip
+}
+
+func trustedProxy(ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+
+	for _, n := range TrustedProxies {
+		if n.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
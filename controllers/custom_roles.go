@@ -0,0 +1,40 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package controllers
+
+import (
+	"github.com/ernestio/api-gateway/controllers/customroles"
+	"github.com/labstack/echo"
+)
+
+// GetCustomRolesHandler : responds to GET /custom_roles/ with all the
+// roles that can be assigned
+func GetCustomRolesHandler(c echo.Context) error {
+	return genericList(c, "custom_role", customroles.List)
+}
+
+// GetCustomRoleHandler : responds to GET /custom_roles/:custom_role/
+// with the role permissions
+func GetCustomRoleHandler(c echo.Context) error {
+	return genericGet(c, "custom_role", customroles.Get)
+}
+
+// CreateCustomRoleHandler : responds to POST /custom_roles/ by creating
+// a custom role
+func CreateCustomRoleHandler(c echo.Context) error {
+	return genericCreate(c, "custom_role", customroles.Create)
+}
+
+// UpdateCustomRoleHandler : responds to PUT /custom_roles/:custom_role/
+// by updating a custom role
+func UpdateCustomRoleHandler(c echo.Context) error {
+	return genericUpdate(c, "custom_role", customroles.Update)
+}
+
+// DeleteCustomRoleHandler : responds to DELETE /custom_roles/:custom_role/
+// by deleting a custom role
+func DeleteCustomRoleHandler(c echo.Context) error {
+	return genericDelete(c, "custom_role", customroles.Delete)
+}
@@ -0,0 +1,44 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package customroles
+
+import (
+	"net/http"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+)
+
+// Delete : responds to DELETE /custom_roles/:custom_role/ by deleting
+// a custom role that is not assigned to anybody
+func Delete(au models.User, name string) (int, []byte) {
+	var r models.CustomRole
+	var grant models.Role
+	var grants []models.Role
+
+	if _, ok := models.BuiltinRoles[name]; ok {
+		return 400, models.NewJSONError("Built in roles can't be deleted")
+	}
+
+	if err := r.FindByName(name); err != nil {
+		return 404, models.NewJSONError("Role not found")
+	}
+
+	if err := grant.FindAllByRole(name, &grants); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	if len(grants) > 0 {
+		return 409, models.NewJSONError("Role is still assigned, please remove its assignments first")
+	}
+
+	if err := r.Delete(); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	return http.StatusOK, []byte(`{"status": "Role successfully deleted"}`)
+}
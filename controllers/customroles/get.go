@@ -0,0 +1,31 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package customroles
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ernestio/api-gateway/models"
+)
+
+// Get : responds to GET /custom_roles/:custom_role/ with the role
+// permissions
+func Get(au models.User, name string) (int, []byte) {
+	var r models.CustomRole
+
+	if permissions, ok := models.BuiltinRoles[name]; ok {
+		r = models.CustomRole{Name: name, Description: "Built in role", Permissions: permissions}
+	} else if err := r.FindByName(name); err != nil {
+		return 404, models.NewJSONError("Role not found")
+	}
+
+	body, err := json.Marshal(r)
+	if err != nil {
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	return http.StatusOK, body
+}
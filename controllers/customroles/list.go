@@ -0,0 +1,43 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package customroles
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+)
+
+// List : responds to GET /custom_roles/ with the built in roles and all
+// the custom roles
+func List(au models.User) (int, []byte) {
+	var r models.CustomRole
+	var custom []models.CustomRole
+
+	if err := r.FindAll(&custom); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	roles := []models.CustomRole{
+		{Name: models.OwnerRole, Description: "Built in role", Permissions: models.BuiltinRoles[models.OwnerRole]},
+		{Name: models.ReaderRole, Description: "Built in role", Permissions: models.BuiltinRoles[models.ReaderRole]},
+		{Name: models.DenyRole, Description: "Built in role", Permissions: models.BuiltinRoles[models.DenyRole]},
+	}
+
+	sort.Slice(custom, func(i, j int) bool {
+		return custom[i].Name < custom[j].Name
+	})
+
+	body, err := json.Marshal(append(roles, custom...))
+	if err != nil {
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	return http.StatusOK, body
+}
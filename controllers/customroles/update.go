@@ -0,0 +1,51 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package customroles
+
+import (
+	"encoding/json"
+	"net/http"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+)
+
+// Update : responds to PUT /custom_roles/:custom_role/ by replacing the
+// permissions of a custom role
+func Update(au models.User, name string, body []byte) (int, []byte) {
+	var r models.CustomRole
+	var existing models.CustomRole
+
+	if r.Map(body) != nil {
+		return 400, models.NewJSONError("Invalid input")
+	}
+
+	if r.Name != "" && r.Name != name {
+		return 400, models.NewJSONError("Role name does not match payload name")
+	}
+	r.Name = name
+
+	if err := r.Validate(); err != nil {
+		h.L.Error(err.Error())
+		return http.StatusBadRequest, models.NewJSONError(err.Error())
+	}
+
+	if err := existing.FindByName(name); err != nil {
+		return 404, models.NewJSONError("Role not found")
+	}
+
+	r.ID = existing.ID
+	if err := r.Save(); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	body, err := json.Marshal(r)
+	if err != nil {
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	return http.StatusOK, body
+}
@@ -87,6 +87,82 @@ func UpdateEnvHandler(c echo.Context) error {
 	return h.Respond(c, st, b)
 }
 
+// RenameEnvHandler : Renames an env
+func RenameEnvHandler(c echo.Context) error {
+	au := AuthenticatedUser(c)
+	st, b := h.IsAuthorized(&au, "envs/rename")
+	if st != 200 {
+		return h.Respond(c, st, b)
+	}
+
+	st = 500
+	b = []byte("Invalid input")
+	body, err := h.GetRequestBody(c)
+	if err == nil {
+		st, b = envs.Rename(au, envName(c), body, justification(c))
+	}
+
+	return h.Respond(c, st, b)
+}
+
+// ExtendEnvHandler : Pushes back the expiry of an env
+func ExtendEnvHandler(c echo.Context) error {
+	au := AuthenticatedUser(c)
+	st, b := h.IsAuthorized(&au, "envs/extend")
+	if st != 200 {
+		return h.Respond(c, st, b)
+	}
+
+	st = 500
+	b = []byte("Invalid input")
+	body, err := h.GetRequestBody(c)
+	if err == nil {
+		st, b = envs.Extend(au, envName(c), body)
+	}
+
+	return h.Respond(c, st, b)
+}
+
+// GetEnvLocksHandler : gets the locks on an env
+func GetEnvLocksHandler(c echo.Context) error {
+	au := AuthenticatedUser(c)
+	st, b := h.IsAuthorized(&au, "envs/locks")
+	if st == 200 {
+		st, b = envs.Locks(au, envName(c))
+	}
+
+	return h.Respond(c, st, b)
+}
+
+// LockEnvHandler : Locks an env
+func LockEnvHandler(c echo.Context) error {
+	au := AuthenticatedUser(c)
+	st, b := h.IsAuthorized(&au, "envs/lock")
+	if st != 200 {
+		return h.Respond(c, st, b)
+	}
+
+	st = 500
+	b = []byte("Invalid input")
+	body, err := h.GetRequestBody(c)
+	if err == nil {
+		st, b = envs.Lock(au, envName(c), body)
+	}
+
+	return h.Respond(c, st, b)
+}
+
+// UnlockEnvHandler : Unlocks an env
+func UnlockEnvHandler(c echo.Context) error {
+	au := AuthenticatedUser(c)
+	st, b := h.IsAuthorized(&au, "envs/unlock")
+	if st == 200 {
+		st, b = envs.Unlock(au, envName(c))
+	}
+
+	return h.Respond(c, st, b)
+}
+
 // DeleteEnvHandler : Deletes a env by name
 func DeleteEnvHandler(c echo.Context) error {
 	au := AuthenticatedUser(c)
@@ -95,7 +171,7 @@ func DeleteEnvHandler(c echo.Context) error {
 		return h.Respond(c, st, b)
 	}
 
-	st, b = builds.Delete(au, envName(c))
+	st, b = builds.Delete(au, envName(c), justification(c))
 
 	return h.Respond(c, st, b)
 }
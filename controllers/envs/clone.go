@@ -0,0 +1,210 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package envs
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/ernestio/api-gateway/controllers/builds"
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+	"github.com/ernestio/mapping/definition"
+	"github.com/ghodss/yaml"
+)
+
+// Clone : creates a copy of an environment, with the same options,
+// schedules and credentials, on the same or another project of the same
+// provider type. Members are copied if requested, and the latest build
+// definition can be applied to the new environment. The definition is
+// checked before creating the environment; if applying it fails anyway,
+// the environment is kept and the action status is set to failed
+func Clone(au models.User, env string, action *models.Action, justification string) (int, []byte) {
+	var e models.Env
+	var p models.Project
+	var existing models.Env
+	var def *definition.Definition
+	var raw []byte
+
+	if !models.IsAlphaNumeric(env) {
+		return 404, models.NewJSONError("Environment name contains invalid characters")
+	}
+
+	if err := e.FindByName(env); err != nil {
+		h.L.Error(err.Error())
+		return 404, models.NewJSONError("Environment not found")
+	}
+
+	// the clone gets a copy of the environment credentials
+	if st, res := h.IsAuthorizedToResource(&au, h.UpdateEnv, e.GetType(), e.Name); st != 200 {
+		return st, res
+	}
+
+	project := action.Options.Project
+	if project == "" {
+		project = e.GetProject()
+	}
+
+	if err := p.FindByName(project); err != nil {
+		return 404, models.NewJSONError("Specified project does not exist")
+	}
+
+	if st, res := h.IsAuthorizedToResource(&au, h.UpdateProject, p.GetType(), p.Name); st != 200 {
+		return st, res
+	}
+
+	if p.Type != e.Type {
+		return 400, models.NewJSONError("Environments can only be cloned into projects of the same provider type")
+	}
+
+	c := models.Env{
+		Name:        action.Options.Name,
+		ProjectID:   p.ID,
+		Type:        p.Type,
+		Options:     e.Options,
+		Schedules:   e.Schedules,
+		Credentials: e.Credentials,
+	}
+
+	if err := c.Validate(); err != nil {
+		return http.StatusBadRequest, models.NewJSONError(err.Error())
+	}
+
+	c.Name = p.Name + models.EnvNameSeparator + c.Name
+	if err := existing.FindByName(c.Name); err == nil {
+		return 409, models.NewJSONError("Specified environment already exists")
+	}
+
+	if action.Options.Apply {
+		var st int
+		var res []byte
+		if def, raw, st, res = cloneDefinition(&e, &c); st != http.StatusOK {
+			return st, res
+		}
+	}
+
+	if err := c.Save(); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	if err := au.SetOwner(&c); err != nil {
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	if action.Options.Members {
+		if err := cloneMembers(&e, &c); err != nil {
+			h.L.Error(err.Error())
+			return 500, models.NewJSONError("Environment cloned, but its members could not be copied")
+		}
+	}
+
+	action.ResourceType = c.GetType()
+	action.ResourceID = c.Name
+	action.Status = "done"
+
+	if action.Options.Apply {
+		id, err := cloneBuild(au, def, raw, justification)
+		if err != nil {
+			action.Status = "failed"
+			action.Error = "Environment cloned, but its definition could not be applied: " + err.Error()
+		} else {
+			action.ResourceType = "build"
+			action.ResourceID = id
+			action.Status = "in_progress"
+		}
+	}
+
+	data, err := json.Marshal(action)
+	if err != nil {
+		return 500, models.NewJSONError("could not process clone request")
+	}
+
+	return http.StatusOK, data
+}
+
+// cloneMembers : grants the roles on an environment on its clone
+func cloneMembers(e, c *models.Env) error {
+	var r models.Role
+	var roles []models.Role
+
+	if err := r.FindAllByResource(e.Name, e.GetType(), &roles); err != nil {
+		return err
+	}
+
+	for _, v := range roles {
+		if !v.IsActive() {
+			continue
+		}
+
+		v.ID = 0
+		v.ResourceID = c.Name
+
+		if current, err := v.GetExisting(); err != nil {
+			return err
+		} else if current != nil {
+			continue
+		}
+
+		if err := v.Save(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// cloneDefinition : gets the latest build definition of an environment,
+// renamed after its clone
+func cloneDefinition(e, c *models.Env) (*definition.Definition, []byte, int, []byte) {
+	var b models.Build
+	var def definition.Definition
+
+	if err := b.FindLastByName(e.Name); err != nil {
+		return nil, nil, 404, models.NewJSONError("Environment has no build to apply")
+	}
+
+	raw, err := b.GetDefinition()
+	if err != nil {
+		h.L.Error(err.Error())
+		return nil, nil, 500, models.NewJSONError("Environment definition could not be loaded")
+	}
+
+	if err = yaml.Unmarshal(raw, &def); err != nil {
+		h.L.Error(err.Error())
+		return nil, nil, 400, models.NewJSONError("Environment definition is not valid")
+	}
+
+	def["project"] = c.GetProject()
+	def["name"] = strings.TrimPrefix(c.Name, c.GetProject()+models.EnvNameSeparator)
+
+	if raw, err = yaml.Marshal(def); err != nil {
+		return nil, nil, 400, models.NewJSONError("Environment definition is not valid")
+	}
+
+	return &def, raw, http.StatusOK, nil
+}
+
+// cloneBuild : applies a definition on a clone
+func cloneBuild(au models.User, def *definition.Definition, raw []byte, justification string) (string, error) {
+	var br models.BuildDetails
+	var e models.Error
+
+	st, res := builds.Create(au, def, raw, "false", justification)
+	if st != http.StatusOK {
+		if err := json.Unmarshal(res, &e); err != nil || e.Message == "" {
+			e.Message = http.StatusText(st)
+		}
+		return "", errors.New(e.Message)
+	}
+
+	if err := json.Unmarshal(res, &br); err != nil {
+		return "", err
+	}
+
+	return br.ID, nil
+}
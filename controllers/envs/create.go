@@ -7,6 +7,7 @@ package envs
 import (
 	"encoding/json"
 	"net/http"
+	"time"
 
 	h "github.com/ernestio/api-gateway/helpers"
 	"github.com/ernestio/api-gateway/models"
@@ -30,6 +31,18 @@ func Create(au models.User, project string, body []byte) (int, []byte) {
 		return http.StatusBadRequest, models.NewJSONError(err.Error())
 	}
 
+	if _, err = e.GetSchedules(); err != nil {
+		return http.StatusBadRequest, models.NewJSONError(err.Error())
+	}
+
+	if _, err = e.GetPromotionOverrides(); err != nil {
+		return http.StatusBadRequest, models.NewJSONError(err.Error())
+	}
+
+	if err = e.SetExpiry(time.Now()); err != nil {
+		return http.StatusBadRequest, models.NewJSONError(err.Error())
+	}
+
 	err = p.FindByName(project)
 	if err != nil {
 		return 404, models.NewJSONError("Specified project does not exist")
@@ -0,0 +1,80 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package envs
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+)
+
+// DefaultExpiringDays : period the expiring environments are listed for
+// when none is given
+const DefaultExpiringDays = 7
+
+// expiring : environment expiring soon
+type expiring struct {
+	Name      string `json:"name"`
+	Project   string `json:"project"`
+	Status    string `json:"status"`
+	TTL       string `json:"ttl,omitempty"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// Expiring : responds to GET /reports/expiring/ with the environments
+// the user can read that expire in the next days, soonest first
+func Expiring(au models.User, days string) (int, []byte) {
+	var e models.Env
+	var envs []models.Env
+	list := []expiring{}
+
+	n := DefaultExpiringDays
+	if days != "" {
+		var err error
+		if n, err = strconv.Atoi(days); err != nil || n < 1 {
+			return http.StatusBadRequest, models.NewJSONError("Invalid days parameter")
+		}
+	}
+
+	if err := e.FindAll(au, &envs); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	now := time.Now()
+	for _, v := range envs {
+		if !v.ExpiresWithin(now, time.Duration(n)*24*time.Hour) {
+			continue
+		}
+
+		if st, _ := h.IsAuthorizedToResource(&au, h.GetEnv, v.GetType(), v.Name); st != 200 {
+			continue
+		}
+
+		list = append(list, expiring{
+			Name:      v.Name,
+			Project:   v.GetProject(),
+			Status:    v.Status,
+			TTL:       v.TTL,
+			ExpiresAt: v.ExpiresAt,
+		})
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].ExpiresAt < list[j].ExpiresAt
+	})
+
+	body, err := json.Marshal(list)
+	if err != nil {
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	return http.StatusOK, body
+}
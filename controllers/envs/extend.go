@@ -0,0 +1,68 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package envs
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+)
+
+// Extend : responds to POST /projects/:project/envs/:env/extend/ by
+// pushing the environment expiry back by the given ttl, or by its own
+// ttl when none is given
+func Extend(au models.User, env string, body []byte) (int, []byte) {
+	var e models.Env
+	var input struct {
+		TTL string `json:"ttl"`
+	}
+
+	if len(body) > 0 && json.Unmarshal(body, &input) != nil {
+		return 400, models.NewJSONError("Invalid input")
+	}
+
+	if err := e.FindByName(env); err != nil {
+		return 404, models.NewJSONError("Environment not found")
+	}
+
+	if st, res := h.IsAuthorizedToResource(&au, h.UpdateEnv, e.GetType(), e.Name); st != 200 {
+		return st, res
+	}
+
+	if e.ExpiresAt == 0 {
+		return http.StatusBadRequest, models.NewJSONError("Environment has no expiry")
+	}
+
+	if input.TTL == "" {
+		input.TTL = e.TTL
+	}
+
+	d, err := models.ParseTTL(input.TTL)
+	if err != nil || d == 0 {
+		return http.StatusBadRequest, models.NewJSONError("Environment ttl is not a valid duration")
+	}
+
+	e.Extend(time.Now(), d)
+
+	if err = e.Save(); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	if err = e.Redact(); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	return http.StatusOK, data
+}
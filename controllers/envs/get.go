@@ -51,17 +51,21 @@ func Get(au models.User, name string) (int, []byte) {
 	computedRoles := make(map[string]models.Role, 0)
 	if err := r.FindAllByResource(p.Name, p.GetType(), &pRoles); err == nil {
 		for _, v := range pRoles {
-			computedRoles[v.UserID] = v
+			computedRoles[v.Principal()] = v
 		}
 	}
 	if err := r.FindAllByResource(e.GetID(), e.GetType(), &roles); err == nil {
 		for _, v := range roles {
-			computedRoles[v.UserID] = v
+			computedRoles[v.Principal()] = v
 		}
 	}
 
 	for _, v := range computedRoles {
-		e.Members = append(e.Members, v)
+		if v.TeamID != "" {
+			e.TeamMembers = append(e.TeamMembers, v)
+		} else {
+			e.Members = append(e.Members, v)
+		}
 	}
 
 	err = e.Redact()
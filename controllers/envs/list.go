@@ -7,6 +7,7 @@ package envs
 import (
 	"encoding/json"
 	"net/http"
+	"sync"
 
 	h "github.com/ernestio/api-gateway/helpers"
 	"github.com/ernestio/api-gateway/models"
@@ -17,7 +18,6 @@ import (
 func List(au models.User, project *string) (int, []byte) {
 	var body []byte
 	var err error
-	var r models.Role
 	var p models.Project
 
 	query := make(map[string]interface{}, 0)
@@ -42,24 +42,26 @@ func List(au models.User, project *string) (int, []byte) {
 		return 404, models.NewJSONError("Environment not found")
 	}
 
-	pcache := make(map[int][]models.Role)
-
+	// members are looked up for all the listed environments at once,
+	// rather than once per environment
+	var e models.Env
+	var pIDs, eIDs []string
+	seen := make(map[string]bool)
 	for i := range envs {
-		var roles []models.Role
+		if !seen[envs[i].GetProject()] {
+			seen[envs[i].GetProject()] = true
+			pIDs = append(pIDs, envs[i].GetProject())
+		}
+		eIDs = append(eIDs, envs[i].GetID())
+	}
+	pRoles := rolesByResource(p.GetType(), pIDs)
+	eRoles := rolesByResource(e.GetType(), eIDs)
 
+	for i := range envs {
 		computedRoles := make(map[string]models.Role, 0)
 
-		if pcache[envs[i].ProjectID] == nil {
-			var pRoles []models.Role
-
-			err = r.FindAllByResource(envs[i].GetProject(), p.GetType(), &pRoles)
-			if err == nil {
-				pcache[envs[i].ProjectID] = pRoles
-			}
-		}
-
-		for _, v := range pcache[envs[i].ProjectID] {
-			computedRoles[v.UserID] = v
+		for _, v := range pRoles[envs[i].GetProject()] {
+			computedRoles[v.Principal()] = v
 		}
 
 		err = envs[i].Redact()
@@ -67,14 +69,16 @@ func List(au models.User, project *string) (int, []byte) {
 			return 500, models.NewJSONError(err.Error())
 		}
 
-		if err = r.FindAllByResource(envs[i].GetID(), envs[i].GetType(), &roles); err == nil {
-			for _, v := range roles {
-				computedRoles[v.UserID] = v
-			}
+		for _, v := range eRoles[envs[i].GetID()] {
+			computedRoles[v.Principal()] = v
 		}
 
 		for _, v := range computedRoles {
-			envs[i].Members = append(envs[i].Members, v)
+			if v.TeamID != "" {
+				envs[i].TeamMembers = append(envs[i].TeamMembers, v)
+			} else {
+				envs[i].Members = append(envs[i].Members, v)
+			}
 		}
 
 		envs[i].Project, envs[i].Name = getProjectEnv(envs[i].Name)
@@ -87,3 +91,34 @@ func List(au models.User, project *string) (int, []byte) {
 
 	return http.StatusOK, body
 }
+
+// rolesByResource : gets the roles on a list of resources of the same
+// type, grouped by resource id. The role store is queried by resource,
+// so the lookups are sent at once rather than one after another
+func rolesByResource(resourceType string, ids []string) map[string][]models.Role {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	grouped := make(map[string][]models.Role)
+
+	for _, id := range ids {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+
+			var r models.Role
+			var roles []models.Role
+
+			if err := r.FindAllByResource(id, resourceType, &roles); err != nil {
+				h.L.Warning(err.Error())
+				return
+			}
+
+			mu.Lock()
+			grouped[id] = roles
+			mu.Unlock()
+		}(id)
+	}
+	wg.Wait()
+
+	return grouped
+}
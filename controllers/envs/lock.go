@@ -0,0 +1,56 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package envs
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+)
+
+// Lock : responds to POST /projects/:project/envs/:env/lock/ by locking
+// an environment, blocking any change on it until it is unlocked or the
+// lock expires
+func Lock(au models.User, env string, body []byte) (int, []byte) {
+	var e models.Env
+	var l models.EnvLock
+	var err error
+
+	if l.Map(body) != nil {
+		return 400, models.NewJSONError("Invalid input")
+	}
+
+	if err = l.Validate(); err != nil {
+		return http.StatusBadRequest, models.NewJSONError(err.Error())
+	}
+
+	if err = e.FindByName(env); err != nil {
+		return 404, models.NewJSONError("Environment not found")
+	}
+
+	if st, res := h.IsAuthorizedToResource(&au, h.UpdateEnv, e.GetType(), e.Name); st != 200 {
+		return st, res
+	}
+
+	l.SetExpiry()
+	l.ID = 0
+	l.Env = e.Name
+	l.Username = au.Username
+	l.CreatedAt = time.Now().Unix()
+
+	if err = l.Save(); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	if body, err = json.Marshal(l); err != nil {
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	return http.StatusOK, body
+}
@@ -0,0 +1,45 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package envs
+
+import (
+	"encoding/json"
+	"net/http"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+)
+
+// Locks : responds to GET /projects/:project/envs/:env/lock/ with the
+// locks on an environment that have not expired
+func Locks(au models.User, env string) (int, []byte) {
+	var e models.Env
+	var l models.EnvLock
+
+	if err := e.FindByName(env); err != nil {
+		return 404, models.NewJSONError("Environment not found")
+	}
+
+	if st, res := h.IsAuthorizedToResource(&au, h.GetEnv, e.GetType(), e.Name); st != 200 {
+		return st, res
+	}
+
+	locks, err := l.FindActiveByEnv(e.Name)
+	if err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	if locks == nil {
+		locks = []models.EnvLock{}
+	}
+
+	body, err := json.Marshal(locks)
+	if err != nil {
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	return http.StatusOK, body
+}
@@ -0,0 +1,83 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package envs
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+)
+
+// Rename : responds to POST /projects/:project/envs/:env/rename/ by
+// renaming an environment, along with its roles, notifications and
+// policy attachments
+func Rename(au models.User, env string, body []byte, justification string) (int, []byte) {
+	var e models.Env
+	var n models.Env
+	var existing models.Env
+
+	if n.Map(body) != nil {
+		return 400, models.NewJSONError("Invalid input")
+	}
+
+	if err := n.Validate(); err != nil {
+		return http.StatusBadRequest, models.NewJSONError(err.Error())
+	}
+
+	if strings.Contains(n.Name, models.EnvNameSeparator) {
+		return http.StatusBadRequest, models.NewJSONError("Environment name does not support char '" + models.EnvNameSeparator + "' as part of its name")
+	}
+
+	if err := e.FindByName(env); err != nil {
+		return 404, models.NewJSONError("Environment not found")
+	}
+
+	if st, res := h.IsAuthorizedToResource(&au, h.UpdateEnv, e.GetType(), e.Name); st != 200 {
+		return st, res
+	}
+
+	name := e.GetProject() + models.EnvNameSeparator + n.Name
+	if err := existing.FindByName(name); err == nil {
+		return 409, models.NewJSONError("Specified environment already exists")
+	}
+
+	if e.Status == "in_progress" {
+		return 409, models.NewJSONError("Environment can't be renamed while a build is in progress")
+	}
+
+	o, err := e.CheckLocks(au, justification, false)
+	if err != nil {
+		if _, ok := err.(*models.LockedError); ok {
+			return http.StatusLocked, models.NewJSONError(err.Error())
+		}
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Couldn't check the environment locks")
+	}
+
+	if err = models.RenameEnv(&e, name); err != nil {
+		h.L.Error(err.Error())
+		if _, ok := err.(*models.RollbackError); ok {
+			return 500, models.NewJSONError("Environment could not be renamed, and some of the changes could not be undone")
+		}
+		return 500, models.NewJSONError("Environment could not be renamed, no changes were made")
+	}
+
+	o.Record("")
+
+	if err := e.Redact(); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	return http.StatusOK, data
+}
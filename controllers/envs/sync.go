@@ -13,7 +13,7 @@ import (
 )
 
 // Sync : Syncs an environment
-func Sync(au models.User, env string, action *models.Action) (int, []byte) {
+func Sync(au models.User, env string, action *models.Action, justification string) (int, []byte) {
 	var e models.Env
 
 	if !models.IsAlphaNumeric(env) {
@@ -26,15 +26,26 @@ func Sync(au models.User, env string, action *models.Action) (int, []byte) {
 		return 404, models.NewJSONError("Environment not found")
 	}
 
-	if st, res := h.IsAuthorizedToResource(&au, h.UpdateEnv, e.GetType(), e.Name); st != 200 {
+	if st, res := h.IsAuthorizedToResource(&au, h.SyncEnv, e.GetType(), e.Name); st != 200 {
 		return st, res
 	}
 
+	o, err := e.CheckLocks(au, justification, false)
+	if err != nil {
+		if _, ok := err.(*models.LockedError); ok {
+			return http.StatusLocked, models.NewJSONError(err.Error())
+		}
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Couldn't check the environment locks")
+	}
+
 	id, err := e.RequestSync(au)
 	if err != nil {
 		return 500, models.NewJSONError(err.Error())
 	}
 
+	o.Record(id)
+
 	action.ResourceType = "build"
 	action.ResourceID = id
 	action.Status = "syncing"
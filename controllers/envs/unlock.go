@@ -0,0 +1,34 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package envs
+
+import (
+	"net/http"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+)
+
+// Unlock : responds to DELETE /projects/:project/envs/:env/lock/ by
+// removing all the locks on an environment
+func Unlock(au models.User, env string) (int, []byte) {
+	var e models.Env
+	var l models.EnvLock
+
+	if err := e.FindByName(env); err != nil {
+		return 404, models.NewJSONError("Environment not found")
+	}
+
+	if st, res := h.IsAuthorizedToResource(&au, h.UpdateEnv, e.GetType(), e.Name); st != 200 {
+		return st, res
+	}
+
+	if err := l.DeleteByEnv(e.Name); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	return http.StatusOK, []byte(`{"status": "Environment successfully unlocked"}`)
+}
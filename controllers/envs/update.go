@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"strings"
+	"time"
 
 	h "github.com/ernestio/api-gateway/helpers"
 	"github.com/ernestio/api-gateway/models"
@@ -37,6 +38,14 @@ func Update(au models.User, name string, body []byte) (int, []byte) {
 		return http.StatusBadRequest, models.NewJSONError(err.Error())
 	}
 
+	if _, err = input.GetSchedules(); err != nil {
+		return http.StatusBadRequest, models.NewJSONError(err.Error())
+	}
+
+	if _, err = input.GetPromotionOverrides(); err != nil {
+		return http.StatusBadRequest, models.NewJSONError(err.Error())
+	}
+
 	if input.Name != name {
 		return 400, models.NewJSONError("Environment name does not match payload name")
 	}
@@ -56,17 +65,21 @@ func Update(au models.User, name string, body []byte) (int, []byte) {
 
 	if err = r.FindAllByResource(p.Name, p.GetType(), &pRoles); err == nil {
 		for _, v := range pRoles {
-			computedRoles[v.UserID] = v
+			computedRoles[v.Principal()] = v
 		}
 	}
 	if err = r.FindAllByResource(e.GetID(), e.GetType(), &roles); err == nil {
 		for _, v := range roles {
-			computedRoles[v.UserID] = v
+			computedRoles[v.Principal()] = v
 		}
 	}
 
 	for _, v := range computedRoles {
-		e.Members = append(e.Members, v)
+		if v.TeamID != "" {
+			e.TeamMembers = append(e.TeamMembers, v)
+		} else {
+			e.Members = append(e.Members, v)
+		}
 	}
 
 	if st, res := h.IsAuthorizedToResource(&au, h.UpdateEnv, input.GetType(), name); st != 200 {
@@ -77,6 +90,28 @@ func Update(au models.User, name string, body []byte) (int, []byte) {
 	e.Schedules = input.Schedules
 	e.Credentials = input.Credentials
 
+	// the expiry is only changed when the update sets it, so clients
+	// sending the environment without it don't remove it
+	var fields map[string]json.RawMessage
+	_ = json.Unmarshal(body, &fields)
+	_, ttl := fields["ttl"]
+	_, expiresAt := fields["expires_at"]
+
+	if ttl || expiresAt {
+		if ttl {
+			e.TTL = input.TTL
+		}
+		e.ExpiresAt = input.ExpiresAt
+		if ttl || input.ExpiresAt == 0 {
+			err = e.SetExpiry(time.Now())
+		} else {
+			err = (&models.Env{ExpiresAt: input.ExpiresAt}).SetExpiry(time.Now())
+		}
+		if err != nil {
+			return http.StatusBadRequest, models.NewJSONError(err.Error())
+		}
+	}
+
 	if err = e.Save(); err != nil {
 		return 500, models.NewJSONError(err.Error())
 	}
@@ -99,7 +134,7 @@ func Update(au models.User, name string, body []byte) (int, []byte) {
 			}
 
 			if !au.IsAdmin() {
-				if ok := au.IsOwner(ir.ResourceType, ir.ResourceID); !ok {
+				if ok := au.CanGrant(&ir); !ok {
 					return 403, models.NewJSONError("You're not authorized to perform this action")
 				}
 			}
@@ -121,7 +156,7 @@ func Update(au models.User, name string, body []byte) (int, []byte) {
 				}
 
 				if !au.IsAdmin() {
-					if ok := au.IsOwner(ir.ResourceType, ir.ResourceID); !ok {
+					if ok := au.CanGrant(&ir); !ok {
 						return 403, models.NewJSONError("You're not authorized to perform this action")
 					}
 				}
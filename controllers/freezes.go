@@ -0,0 +1,28 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package controllers
+
+import (
+	"github.com/ernestio/api-gateway/controllers/freezes"
+	"github.com/labstack/echo"
+)
+
+// GetFreezesHandler : responds to GET /freezes/ with a list of all
+// change freezes
+func GetFreezesHandler(c echo.Context) (err error) {
+	return genericList(c, "freeze", freezes.List)
+}
+
+// CreateFreezeHandler : responds to POST /freezes/ by creating a change
+// freeze
+func CreateFreezeHandler(c echo.Context) (err error) {
+	return genericCreate(c, "freeze", freezes.Create)
+}
+
+// DeleteFreezeHandler : responds to DELETE /freezes/:freeze/ by ending
+// a change freeze
+func DeleteFreezeHandler(c echo.Context) (err error) {
+	return genericDelete(c, "freeze", freezes.Delete)
+}
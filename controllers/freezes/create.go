@@ -0,0 +1,47 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package freezes
+
+import (
+	"encoding/json"
+	"net/http"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+)
+
+// Create : responds to POST /freezes/ by creating a change freeze,
+// blocking applies by non admin users while it is in effect
+func Create(au models.User, body []byte) (int, []byte) {
+	var f models.Freeze
+	var existing models.Freeze
+	var err error
+
+	if f.Map(body) != nil {
+		return 400, models.NewJSONError("Invalid input")
+	}
+
+	if err = f.Validate(); err != nil {
+		return http.StatusBadRequest, models.NewJSONError(err.Error())
+	}
+
+	if err = existing.FindByName(f.Name); err == nil {
+		return 409, models.NewJSONError("Specified freeze already exists")
+	}
+
+	f.ID = 0
+	f.Username = au.Username
+
+	if err = f.Save(); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	if body, err = json.Marshal(f); err != nil {
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	return http.StatusOK, body
+}
@@ -0,0 +1,29 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package freezes
+
+import (
+	"net/http"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+)
+
+// Delete : responds to DELETE /freezes/:freeze/ by ending a change
+// freeze
+func Delete(au models.User, name string) (int, []byte) {
+	var f models.Freeze
+
+	if err := f.FindByName(name); err != nil {
+		return 404, models.NewJSONError("Freeze not found")
+	}
+
+	if err := f.Delete(name); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	return http.StatusOK, models.NewJSONError("Freeze successfully deleted")
+}
@@ -0,0 +1,29 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package freezes
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ernestio/api-gateway/models"
+)
+
+// List : responds to GET /freezes/ with a list of all change freezes
+func List(au models.User) (int, []byte) {
+	var f models.Freeze
+	var freezes []models.Freeze
+
+	if err := f.FindAll(&freezes); err != nil {
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	body, err := json.Marshal(freezes)
+	if err != nil {
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	return http.StatusOK, body
+}
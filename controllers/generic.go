@@ -1,6 +1,8 @@
 package controllers
 
 import (
+	"strings"
+
 	h "github.com/ernestio/api-gateway/helpers"
 	"github.com/ernestio/api-gateway/models"
 	"github.com/labstack/echo"
@@ -14,7 +16,7 @@ type delete func(models.User, string) (int, []byte)
 
 func genericList(c echo.Context, entity string, fn list) error {
 	au := AuthenticatedUser(c)
-	st, b := h.IsAuthorized(&au, entity+"s/list")
+	st, b := h.IsAuthorized(&au, plural(entity)+"/list")
 	if st == 200 {
 		st, b = fn(au)
 	}
@@ -24,7 +26,7 @@ func genericList(c echo.Context, entity string, fn list) error {
 
 func genericGet(c echo.Context, entity string, fn get) error {
 	au := AuthenticatedUser(c)
-	st, b := h.IsAuthorized(&au, entity+"s/get")
+	st, b := h.IsAuthorized(&au, plural(entity)+"/get")
 	if st == 200 {
 		g := c.Param(entity)
 		st, b = fn(au, g)
@@ -35,7 +37,7 @@ func genericGet(c echo.Context, entity string, fn get) error {
 
 func genericCreate(c echo.Context, entity string, fn create) error {
 	au := AuthenticatedUser(c)
-	st, b := h.IsAuthorized(&au, entity+"s/create")
+	st, b := h.IsAuthorized(&au, plural(entity)+"/create")
 	if st != 200 {
 		return h.Respond(c, st, b)
 	}
@@ -52,7 +54,7 @@ func genericCreate(c echo.Context, entity string, fn create) error {
 
 func genericUpdate(c echo.Context, entity string, fn update) error {
 	au := AuthenticatedUser(c)
-	st, b := h.IsAuthorized(&au, entity+"s/update")
+	st, b := h.IsAuthorized(&au, plural(entity)+"/update")
 	if st != 200 {
 		return h.Respond(c, st, b)
 	}
@@ -71,7 +73,7 @@ func genericUpdate(c echo.Context, entity string, fn update) error {
 
 func genericDelete(c echo.Context, entity string, fn delete) error {
 	au := AuthenticatedUser(c)
-	st, b := h.IsAuthorized(&au, entity+"s/delete")
+	st, b := h.IsAuthorized(&au, plural(entity)+"/delete")
 	if st == 200 {
 		g := c.Param(entity)
 		st, b = fn(au, g)
@@ -79,3 +81,12 @@ func genericDelete(c echo.Context, entity string, fn delete) error {
 
 	return h.Respond(c, st, b)
 }
+
+// plural : gets the name of the resources of an entity
+func plural(entity string) string {
+	if strings.HasSuffix(entity, "y") {
+		return strings.TrimSuffix(entity, "y") + "ies"
+	}
+
+	return entity + "s"
+}
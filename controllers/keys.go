@@ -0,0 +1,61 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/ernestio/api-gateway/controllers/keys"
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/labstack/echo"
+)
+
+// GetKeysHandler : responds to GET /keys/ with the signing keys in use
+func GetKeysHandler(c echo.Context) error {
+	au := AuthenticatedUser(c)
+	st, b := h.IsAuthorized(&au, "keys/list")
+	if st == 200 {
+		st, b = keys.List(Keys)
+	}
+
+	return h.Respond(c, st, b)
+}
+
+// RotateKeyHandler : responds to POST /keys/ by rotating the active
+// signing key
+func RotateKeyHandler(c echo.Context) error {
+	au := AuthenticatedUser(c)
+	st, b := h.IsAuthorized(&au, "keys/rotate")
+	if st != 200 {
+		return h.Respond(c, st, b)
+	}
+
+	st = 500
+	b = []byte("Invalid input")
+	body, err := h.GetRequestBody(c)
+	if err == nil {
+		st, b = keys.Rotate(au, Keys, body)
+	}
+
+	return h.Respond(c, st, b)
+}
+
+// DeleteKeyHandler : responds to DELETE /keys/:key/ by retiring a
+// signing key
+func DeleteKeyHandler(c echo.Context) error {
+	au := AuthenticatedUser(c)
+	st, b := h.IsAuthorized(&au, "keys/delete")
+	if st == 200 {
+		st, b = keys.Delete(au, Keys, c.Param("key"))
+	}
+
+	return h.Respond(c, st, b)
+}
+
+// GetJWKSHandler : responds to GET /auth/jwks/ with the public keys
+// tokens can be verified with
+func GetJWKSHandler(c echo.Context) error {
+	return c.JSON(http.StatusOK, Keys.JWKS())
+}
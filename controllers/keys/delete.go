@@ -0,0 +1,28 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package keys
+
+import (
+	"net/http"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+	"github.com/sirupsen/logrus"
+)
+
+// Delete : responds to DELETE /keys/:key/ by retiring a signing key,
+// which invalidates all tokens it signed
+func Delete(au models.User, keyring *models.Keyring, kid string) (int, []byte) {
+	if err := keyring.Retire(kid); err != nil {
+		return 400, models.NewJSONError(err.Error())
+	}
+
+	h.L.WithFields(logrus.Fields{
+		"kid":      kid,
+		"username": au.Username,
+	}).Info("Signing key retired")
+
+	return http.StatusOK, []byte(`{"status": "Signing key successfully retired"}`)
+}
@@ -0,0 +1,27 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package keys
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ernestio/api-gateway/models"
+)
+
+// List : responds to GET /keys/ with the signing keys in use
+func List(keyring *models.Keyring) (int, []byte) {
+	keys := keyring.List()
+	if keys == nil {
+		keys = []models.SigningKey{}
+	}
+
+	body, err := json.Marshal(keys)
+	if err != nil {
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	return http.StatusOK, body
+}
@@ -0,0 +1,52 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package keys
+
+import (
+	"encoding/json"
+	"net/http"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+	"github.com/sirupsen/logrus"
+)
+
+// Rotate : responds to POST /keys/ by generating a new signing key.
+// Tokens signed by previous keys are still accepted
+func Rotate(au models.User, keyring *models.Keyring, body []byte) (int, []byte) {
+	var req struct {
+		Algorithm string `json:"algorithm"`
+	}
+
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			return 400, models.NewJSONError("Invalid input")
+		}
+	}
+
+	if req.Algorithm == "" {
+		c := models.Config{}
+		req.Algorithm = c.GetSigningAlgorithm()
+	}
+
+	key, err := keyring.Rotate(req.Algorithm)
+	if err != nil {
+		h.L.Error(err.Error())
+		return 400, models.NewJSONError(err.Error())
+	}
+
+	h.L.WithFields(logrus.Fields{
+		"kid":       key.KID,
+		"algorithm": key.Algorithm,
+		"username":  au.Username,
+	}).Info("Signing key rotated")
+
+	body, err = json.Marshal(key)
+	if err != nil {
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	return http.StatusOK, body
+}
@@ -0,0 +1,75 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package controllers
+
+import (
+	"github.com/ernestio/api-gateway/controllers/users"
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+	"github.com/labstack/echo"
+	"github.com/sirupsen/logrus"
+)
+
+// LDAPSyncPlanHandler : responds to GET /users/:user/ldap/sync/ with the
+// role changes the next login of an ldap user would apply
+func LDAPSyncPlanHandler(c echo.Context) error {
+	au := AuthenticatedUser(c)
+	st, b := h.IsAuthorized(&au, "users/ldap_sync")
+	if st == 200 {
+		st, b = users.LDAPSyncPlan(au, c.Param("user"))
+	}
+
+	return h.Respond(c, st, b)
+}
+
+// ldapAuthenticate : verifies the user credentials against the ldap
+// directory, provisioning the user and syncing its roles
+func ldapAuthenticate(c echo.Context, u models.User) (models.User, error) {
+	var existing models.User
+
+	d, err := models.NewLDAPDirectory()
+	if err != nil {
+		h.L.Error(err.Error())
+		return existing, echo.NewHTTPError(403, "Provided credentials are not valid")
+	}
+
+	password := ""
+	if u.Password != nil {
+		password = *u.Password
+	}
+
+	id, err := d.Authenticate(u.Username, password)
+	if err == models.ErrInvalidCredentials {
+		h.L.Error("Invalid ldap credentials (" + u.Username + ")")
+		Throttle.Fail(u.Username, clientIP(c))
+		return existing, echo.NewHTTPError(403, err.Error())
+	}
+	if err != nil {
+		h.L.Error(err.Error())
+		return existing, echo.NewHTTPError(503, "Could not reach the ldap directory")
+	}
+
+	if err := u.FindOrProvision(u.Username, "ldap", &existing); err != nil {
+		h.L.Error(err.Error())
+		return existing, provisionError(err, "Provided credentials are not valid")
+	}
+
+	changes, err := models.PlanGroupSync(existing.Username, id.Groups, d.Mappings)
+	if err == nil {
+		err = models.ApplyGroupSync(changes)
+	}
+	if err != nil {
+		h.L.Error(err.Error())
+		return existing, echo.NewHTTPError(500, "Could not synchronize your group memberships")
+	}
+
+	h.L.WithFields(logrus.Fields{
+		"username": existing.Username,
+		"dn":       id.DN,
+		"changes":  len(changes),
+	}).Info("LDAP user logged in")
+
+	return existing, nil
+}
@@ -0,0 +1,35 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package controllers
+
+import (
+	"github.com/ernestio/api-gateway/controllers/lockouts"
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/labstack/echo"
+)
+
+// GetLockoutsHandler : responds to GET /lockouts/ with the usernames
+// and ips with failed login attempts
+func GetLockoutsHandler(c echo.Context) error {
+	au := AuthenticatedUser(c)
+	st, b := h.IsAuthorized(&au, "lockouts/list")
+	if st == 200 {
+		st, b = lockouts.List(Throttle)
+	}
+
+	return h.Respond(c, st, b)
+}
+
+// DeleteLockoutHandler : responds to DELETE /lockouts/:lockout/ by
+// clearing a lockout
+func DeleteLockoutHandler(c echo.Context) error {
+	au := AuthenticatedUser(c)
+	st, b := h.IsAuthorized(&au, "lockouts/delete")
+	if st == 200 {
+		st, b = lockouts.Delete(au, Throttle, c.Param("lockout"))
+	}
+
+	return h.Respond(c, st, b)
+}
@@ -0,0 +1,21 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package lockouts
+
+import (
+	"net/http"
+
+	"github.com/ernestio/api-gateway/models"
+)
+
+// Delete : responds to DELETE /lockouts/:lockout/ by clearing the
+// failed login attempts of a username or ip
+func Delete(au models.User, throttle *models.LoginThrottle, id string) (int, []byte) {
+	if err := throttle.Clear(id, au.Username); err != nil {
+		return 404, models.NewJSONError(err.Error())
+	}
+
+	return http.StatusOK, []byte(`{"status": "Lockout successfully cleared"}`)
+}
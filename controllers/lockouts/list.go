@@ -0,0 +1,23 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package lockouts
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ernestio/api-gateway/models"
+)
+
+// List : responds to GET /lockouts/ with the usernames and ips with
+// failed login attempts
+func List(throttle *models.LoginThrottle) (int, []byte) {
+	body, err := json.Marshal(throttle.List())
+	if err != nil {
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	return http.StatusOK, body
+}
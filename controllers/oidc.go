@@ -0,0 +1,176 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package controllers
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+	"github.com/labstack/echo"
+	"github.com/sirupsen/logrus"
+)
+
+// oidcStateCookie : cookie binding a login to the browser it was
+// started from
+const oidcStateCookie = "ernest_oidc_state"
+
+// OIDCLoginHandler : responds to GET /auth/oidc/ by redirecting the
+// user to the configured identity provider
+func OIDCLoginHandler(c echo.Context) error {
+	p, err := models.NewOIDCProvider()
+	if err != nil {
+		h.L.Error(err.Error())
+		return echo.NewHTTPError(404, "OIDC login is not available")
+	}
+
+	nonce := newTokenID()
+
+	// the state is signed so no login attempts need to be stored
+	state, err := Keys.Sign(jwt.MapClaims{
+		"type":  "oidc_state",
+		"nonce": nonce,
+		"exp":   time.Now().Add(10 * time.Minute).Unix(),
+	})
+	if err != nil {
+		h.L.Error(err.Error())
+		return echo.NewHTTPError(500, "Could not start the OIDC login")
+	}
+
+	// the callback only accepts the state of a login started from the
+	// same browser, so nobody can be logged in as someone else
+	c.SetCookie(oidcCookie(c, stateHash(state), 600))
+
+	return c.Redirect(http.StatusFound, p.AuthURL(state, nonce))
+}
+
+// OIDCCallbackHandler : responds to GET /auth/oidc/callback/ by
+// verifying the identity provider response and issuing ernest tokens
+func OIDCCallbackHandler(c echo.Context) error {
+	var u models.User
+	var existing models.User
+
+	if e := c.QueryParam("error"); e != "" {
+		h.L.Error("OIDC provider returned an error: " + e)
+		return echo.NewHTTPError(401, "Identity provider login failed")
+	}
+
+	nonce, err := oidcNonce(c.QueryParam("state"))
+	if err != nil {
+		return echo.NewHTTPError(400, err.Error())
+	}
+
+	cookie, err := c.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(stateHash(c.QueryParam("state")))) != 1 {
+		h.L.Warning("OIDC callback rejected, the login was not started from the same browser")
+		return echo.NewHTTPError(400, "Invalid or expired login state")
+	}
+	c.SetCookie(oidcCookie(c, "", -1))
+
+	p, err := models.NewOIDCProvider()
+	if err != nil {
+		h.L.Error(err.Error())
+		return echo.NewHTTPError(404, "OIDC login is not available")
+	}
+
+	raw, err := p.Exchange(c.QueryParam("code"))
+	if err != nil {
+		h.L.Error(err.Error())
+		return echo.NewHTTPError(401, "Identity provider login failed")
+	}
+
+	id, err := p.Verify(raw, nonce)
+	if err != nil {
+		h.L.Error(err.Error())
+		return echo.NewHTTPError(401, err.Error())
+	}
+
+	if err := u.FindOrProvision(id.Username, "oidc", &existing); err != nil {
+		h.L.Error(err.Error())
+		return provisionError(err, "Your identity can't be linked to an ernest user, please contact your admin")
+	}
+
+	if existing.IsDisabled() {
+		h.L.Error("Disabled user tried to authenticate (" + existing.Username + ")")
+		return echo.NewHTTPError(403, "Your account has been disabled, please contact your admin")
+	}
+
+	changes, err := models.PlanGroupSync(existing.Username, id.Groups, p.Mappings)
+	if err == nil {
+		err = models.ApplyGroupSync(changes)
+	}
+	if err != nil {
+		h.L.Error(err.Error())
+		return echo.NewHTTPError(500, "Could not synchronize your group memberships")
+	}
+
+	h.L.WithFields(logrus.Fields{
+		"username": existing.Username,
+		"subject":  id.Subject,
+		"changes":  len(changes),
+	}).Info("OIDC user logged in")
+
+	tokens, err := startSession(c, existing)
+	if err != nil {
+		h.L.Error(err.Error())
+		return echo.NewHTTPError(500, "Could not generate the authentication token")
+	}
+
+	return c.JSON(http.StatusOK, tokens)
+}
+
+// provisionError : responds to a federated user that can't be found or
+// provisioned, without rejecting its identity when the store failed
+func provisionError(err error, msg string) *echo.HTTPError {
+	switch err.(type) {
+	case *models.ModelError, *echo.HTTPError:
+		return echo.NewHTTPError(500, "Could not load your user, please try again later")
+	}
+
+	return echo.NewHTTPError(403, msg)
+}
+
+// oidcNonce : validates a signed login state and returns its nonce
+func oidcNonce(state string) (string, error) {
+	token, err := jwt.Parse(state, Keys.Keyfunc)
+	if err != nil || !token.Valid {
+		return "", errors.New("Invalid or expired login state")
+	}
+
+	claims, _ := token.Claims.(jwt.MapClaims)
+	if claimString(claims, "type") != "oidc_state" || claimString(claims, "nonce") == "" {
+		return "", errors.New("Invalid or expired login state")
+	}
+
+	return claimString(claims, "nonce"), nil
+}
+
+// oidcCookie : builds the cookie binding a login to the browser, which
+// is removed with a negative max age
+func oidcCookie(c echo.Context, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/auth/oidc/",
+		MaxAge:   maxAge,
+		Secure:   c.IsTLS(),
+		HttpOnly: true,
+		// lax, as the identity provider redirects back with a top level
+		// navigation from another site
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// stateHash : hashes a login state to store it on the browser
+func stateHash(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,84 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/ernestio/api-gateway/controllers/users"
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+	"github.com/labstack/echo"
+)
+
+// Mail : delivers password reset tokens through the notification
+// service, resets are disabled when it is not set
+var Mail models.Mailer
+
+// PasswordResetRequest : payload accepted by the password reset
+// endpoints
+type PasswordResetRequest struct {
+	Username string `json:"username" form:"username"`
+	Token    string `json:"token" form:"token"`
+	Password string `json:"password" form:"password"`
+}
+
+// RequestPasswordResetHandler : responds to POST /auth/reset/ by
+// sending a password reset token to the user
+func RequestPasswordResetHandler(c echo.Context) error {
+	var req PasswordResetRequest
+
+	if err := c.Bind(&req); err != nil || req.Username == "" {
+		return h.Respond(c, 400, models.NewJSONError("A username must be provided"))
+	}
+
+	// every request counts as an attempt, so resets can't be used to
+	// flood a user inbox or to probe for usernames
+	if throttled(c, ResetThrottle, req.Username, "Password reset rejected by the reset throttle") {
+		return h.Respond(c, http.StatusTooManyRequests, models.NewJSONError("Too many requests, please try again later"))
+	}
+	ResetThrottle.Fail(req.Username, clientIP(c))
+
+	st, b := users.RequestPasswordReset(req.Username, signPasswordReset, Mail)
+
+	return h.Respond(c, st, b)
+}
+
+// ResetPasswordHandler : responds to POST /auth/reset/confirm/ by
+// setting a new password with a password reset token
+func ResetPasswordHandler(c echo.Context) error {
+	var req PasswordResetRequest
+
+	if err := c.Bind(&req); err != nil || req.Token == "" {
+		return h.Respond(c, 400, models.NewJSONError("A password reset token must be provided"))
+	}
+
+	token, err := jwt.Parse(req.Token, Keys.Keyfunc)
+	if err != nil || !token.Valid {
+		return h.Respond(c, 400, models.NewJSONError("Invalid or expired password reset token"))
+	}
+
+	claims, _ := token.Claims.(jwt.MapClaims)
+	if claimString(claims, "type") != "password_reset" {
+		return h.Respond(c, 400, models.NewJSONError("Invalid or expired password reset token"))
+	}
+
+	st, b := users.ResetPassword(claimString(claims, "username"), claimString(claims, "jti"), req.Password)
+
+	return h.Respond(c, st, b)
+}
+
+// signPasswordReset : generates the jwt representation of a password
+// reset
+func signPasswordReset(r *models.PasswordReset) (string, error) {
+	return Keys.Sign(jwt.MapClaims{
+		"type":     "password_reset",
+		"jti":      r.TokenID,
+		"username": r.Username,
+		"iat":      r.CreatedAt,
+		"exp":      r.ExpiresAt,
+	})
+}
@@ -45,7 +45,7 @@ func GetPolicyDocumentsHandler(c echo.Context) (err error) {
 	au := AuthenticatedUser(c)
 	name := c.Param("policy")
 
-	st, b := h.IsAuthorized(&au, "policys/list")
+	st, b := h.IsAuthorized(&au, "policies/list")
 	if st == 200 {
 		st, b = policies.ListDocuments(au, name)
 	}
@@ -59,7 +59,7 @@ func GetPolicyDocumentHandler(c echo.Context) error {
 	name := c.Param("policy")
 	revision := c.Param("revision")
 
-	st, b := h.IsAuthorized(&au, "policys/get")
+	st, b := h.IsAuthorized(&au, "policies/get")
 	if st == 200 {
 		st, b = policies.GetDocument(au, name, revision)
 	}
@@ -73,7 +73,7 @@ func CreatePolicyDocumentHandler(c echo.Context) (err error) {
 	au := AuthenticatedUser(c)
 	name := c.Param("policy")
 
-	st, b := h.IsAuthorized(&au, "policys/create")
+	st, b := h.IsAuthorized(&au, "policies/create")
 	if st != 200 {
 		return h.Respond(c, st, b)
 	}
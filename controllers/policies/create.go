@@ -33,6 +33,10 @@ func Create(au models.User, body []byte) (int, []byte) {
 		return 409, models.NewJSONError("policy already exists")
 	}
 
+	if st, res := authorizeEnvs(au, l.Environments, nil); st != 200 {
+		return st, res
+	}
+
 	if err = l.Save(); err != nil {
 		return 400, models.NewJSONError(err.Error())
 	}
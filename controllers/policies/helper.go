@@ -0,0 +1,37 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package policies
+
+import (
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+)
+
+// authorizeEnvs : checks the user can update every environment being
+// attached to a policy, as the roles on a policy are inherited by its
+// environments
+func authorizeEnvs(au models.User, envs, attached []string) (int, []byte) {
+	for _, env := range envs {
+		if contains(attached, env) {
+			continue
+		}
+
+		if st, res := h.IsAuthorizedToResource(&au, h.UpdateEnv, "environment", env); st != 200 {
+			return st, res
+		}
+	}
+
+	return 200, nil
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+
+	return false
+}
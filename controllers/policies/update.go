@@ -36,6 +36,10 @@ func Update(au models.User, name string, body []byte) (int, []byte) {
 		return st, res
 	}
 
+	if st, res := authorizeEnvs(au, d.Environments, existing.Environments); st != 200 {
+		return st, res
+	}
+
 	existing.Environments = d.Environments
 
 	if len(existing.Environments) == 0 {
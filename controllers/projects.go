@@ -6,6 +6,7 @@ package controllers
 
 import (
 	"github.com/ernestio/api-gateway/controllers/projects"
+	h "github.com/ernestio/api-gateway/helpers"
 	"github.com/labstack/echo"
 )
 
@@ -38,3 +39,22 @@ func UpdateDatacenterHandler(c echo.Context) (err error) {
 func DeleteDatacenterHandler(c echo.Context) error {
 	return genericDelete(c, "project", projects.Delete)
 }
+
+// RenameDatacenterHandler : responds to POST /projects/:project/rename/
+// by renaming an existing project
+func RenameDatacenterHandler(c echo.Context) error {
+	au := AuthenticatedUser(c)
+	st, b := h.IsAuthorized(&au, "projects/rename")
+	if st != 200 {
+		return h.Respond(c, st, b)
+	}
+
+	st = 500
+	b = []byte("Invalid input")
+	body, err := h.GetRequestBody(c)
+	if err == nil {
+		st, b = projects.Rename(au, c.Param("project"), body, justification(c))
+	}
+
+	return h.Respond(c, st, b)
+}
@@ -25,7 +25,7 @@ func Get(au models.User, project string) (int, []byte) {
 
 	if st, res := h.IsAuthorizedToResource(&au, h.GetProject, d.GetType(), project); st != 200 {
 		if d.GetType() == "project" {
-			envs, err := r.FindAllIDsByUserAndType(au.Username, "environment")
+			envs, err := au.GrantedIDs("environment")
 			if err != nil {
 				return 500, models.NewJSONError(err.Error())
 			}
@@ -62,7 +62,7 @@ func Get(au models.User, project string) (int, []byte) {
 	}
 
 	if err := r.FindAllByResource(d.GetID(), d.GetType(), &roles); err == nil {
-		d.Members = roles
+		d.Members, d.TeamMembers = models.SplitGrants(roles)
 	}
 
 	err = d.Redact()
@@ -29,7 +29,7 @@ func List(au models.User) (int, []byte) {
 		}
 
 		if err := r.FindAllByResource(projects[i].GetID(), projects[i].GetType(), &roles); err == nil {
-			projects[i].Members = roles
+			projects[i].Members, projects[i].TeamMembers = models.SplitGrants(roles)
 		}
 	}
 
@@ -0,0 +1,86 @@
+package projects
+
+import (
+	"encoding/json"
+	"net/http"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+)
+
+// Rename : responds to POST /projects/:project/rename/ by renaming a
+// project and its environments, along with their roles, notifications
+// and policy attachments
+func Rename(au models.User, project string, body []byte, justification string) (int, []byte) {
+	var d models.Project
+	var n models.Project
+	var existing models.Project
+
+	if n.Map(body) != nil {
+		return 400, models.NewJSONError("Invalid input")
+	}
+
+	if err := d.FindByName(project); err != nil {
+		return 404, models.NewJSONError("Project not found")
+	}
+
+	n.Type = d.Type
+	if err := n.Validate(); err != nil {
+		return http.StatusBadRequest, models.NewJSONError(err.Error())
+	}
+
+	if st, res := h.IsAuthorizedToResource(&au, h.UpdateProject, d.GetType(), d.Name); st != 200 {
+		return st, res
+	}
+
+	if err := existing.FindByName(n.Name); err == nil {
+		return 409, models.NewJSONError("Specified project already exists")
+	}
+
+	envs, err := d.Envs()
+	if err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	var overrides []*models.LockOverride
+	for _, e := range envs {
+		if e.Status == "in_progress" {
+			return 409, models.NewJSONError("Project can't be renamed while a build is in progress on " + e.Name)
+		}
+
+		o, err := e.CheckLocks(au, justification, false)
+		if err != nil {
+			if _, ok := err.(*models.LockedError); ok {
+				return http.StatusLocked, models.NewJSONError(e.Name + ": " + err.Error())
+			}
+			h.L.Error(err.Error())
+			return 500, models.NewJSONError("Couldn't check the environment locks")
+		}
+		overrides = append(overrides, o)
+	}
+
+	if err = models.RenameProject(&d, n.Name); err != nil {
+		h.L.Error(err.Error())
+		if _, ok := err.(*models.RollbackError); ok {
+			return 500, models.NewJSONError("Project could not be renamed, and some of the changes could not be undone")
+		}
+		return 500, models.NewJSONError("Project could not be renamed, no changes were made")
+	}
+
+	for _, o := range overrides {
+		o.Record("")
+	}
+
+	if err = d.Redact(); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	data, err := json.Marshal(d)
+	if err != nil {
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	return http.StatusOK, data
+}
@@ -40,7 +40,7 @@ func Update(au models.User, project string, body []byte) (int, []byte) {
 	}
 
 	if err = r.FindAllByResource(existing.GetID(), existing.GetType(), &roles); err == nil {
-		existing.Members = roles
+		existing.Members, existing.TeamMembers = models.SplitGrants(roles)
 	}
 
 	existing.Credentials = d.Credentials
@@ -65,7 +65,7 @@ func Update(au models.User, project string, body []byte) (int, []byte) {
 	for _, r := range d.Members {
 		if r.ID == 0 {
 			if !au.IsAdmin() {
-				if ok := au.IsOwner(r.ResourceType, r.ResourceID); !ok {
+				if ok := au.CanGrant(&r); !ok {
 					return 403, models.NewJSONError("You're not authorized to perform this action")
 				}
 			}
@@ -83,7 +83,7 @@ func Update(au models.User, project string, body []byte) (int, []byte) {
 			// update role
 			if r.ID == er.ID && r.Role != er.Role {
 				if !au.IsAdmin() {
-					if ok := au.IsOwner(r.ResourceType, r.ResourceID); !ok {
+					if ok := au.CanGrant(&r); !ok {
 						return 403, models.NewJSONError("You're not authorized to perform this action")
 					}
 				}
@@ -5,13 +5,19 @@
 package controllers
 
 import (
+	"github.com/ernestio/api-gateway/controllers/envs"
 	"github.com/ernestio/api-gateway/controllers/usages"
+	h "github.com/ernestio/api-gateway/helpers"
 	"github.com/labstack/echo"
 )
 
 // GetUsageReportHandler : ...
 func GetUsageReportHandler(c echo.Context) (err error) {
 	au := AuthenticatedUser(c)
+	if st, b := h.IsAuthorized(&au, "usages/report"); st != 200 {
+		return h.Respond(c, st, b)
+	}
+
 	f := c.QueryParam("from")
 	t := c.QueryParam("to")
 
@@ -19,3 +25,15 @@ func GetUsageReportHandler(c echo.Context) (err error) {
 
 	return c.JSONBlob(s, b)
 }
+
+// GetExpiringReportHandler : responds to GET /reports/expiring/ with the
+// environments expiring in the next days
+func GetExpiringReportHandler(c echo.Context) (err error) {
+	au := AuthenticatedUser(c)
+	st, b := h.IsAuthorized(&au, "envs/expiring")
+	if st == 200 {
+		st, b = envs.Expiring(au, c.QueryParam("days"))
+	}
+
+	return h.Respond(c, st, b)
+}
@@ -28,19 +28,40 @@ func Create(au models.User, body []byte) (int, []byte) {
 		return 404, models.NewJSONError("Specified resource not found")
 	}
 
-	if !d.UserExists() {
+	if d.TeamID != "" {
+		if !d.TeamExists() {
+			return 404, models.NewJSONError("Specified team not found")
+		}
+	} else if !d.UserExists() {
 		return 404, models.NewJSONError("Specified user not found")
 	}
 
+	if !models.RoleExists(d.Role) {
+		return 404, models.NewJSONError("Specified role not found")
+	}
+
 	if !au.IsAdmin() {
 		if ok := au.IsOwner(d.ResourceType, d.ResourceID); !ok {
 			return 403, models.NewJSONError("You're not authorized to perform this action")
 		}
 	}
 
-	existing, err := d.Get(d.UserID, d.ResourceID, d.ResourceType)
-	if err == nil && existing != nil {
-		d.ID = existing.ID
+	d.SetExpiry()
+	if d.IsExpired() {
+		return http.StatusBadRequest, models.NewJSONError("Role has already expired")
+	}
+
+	if !au.CanGrant(&d) {
+		return 403, models.NewJSONError("Role can't outlast the role you own the resource with")
+	}
+
+	// time bound roles are granted apart from the permanent one, which
+	// is still in place once they expire
+	if !d.IsTimeBound() {
+		existing, err := d.GetExisting()
+		if err == nil && existing != nil {
+			d.ID = existing.ID
+		}
 	}
 
 	if err = d.Save(); err != nil {
@@ -28,8 +28,12 @@ func Delete(au models.User, body []byte) (int, []byte) {
 		}
 	}
 
-	existing, err := d.Get(d.UserID, d.ResourceID, d.ResourceType)
-	if !(err != nil || existing != nil) {
+	existing, err := d.FindAllExisting()
+	if err != nil {
+		return 500, models.NewJSONError(err.Error())
+	}
+
+	if len(existing) == 0 {
 		return 409, models.NewJSONError("Specified role does not exists")
 	}
 
@@ -42,7 +46,7 @@ func Delete(au models.User, body []byte) (int, []byte) {
 		}
 
 		for _, r := range roles {
-			if r.Role == "owner" && r.UserID != d.UserID {
+			if r.Role == "owner" && r.IsActive() && r.Principal() != d.Principal() {
 				owner = true
 			}
 		}
@@ -52,8 +56,10 @@ func Delete(au models.User, body []byte) (int, []byte) {
 		}
 	}
 
-	if err := existing.Delete(); err != nil {
-		return 500, models.NewJSONError(err.Error())
+	for _, v := range existing {
+		if err := v.Delete(); err != nil {
+			return 500, models.NewJSONError(err.Error())
+		}
 	}
 
 	return http.StatusOK, []byte(`{"status": "Role successfully deleted"}`)
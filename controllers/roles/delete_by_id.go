@@ -26,7 +26,7 @@ func DeleteByID(au models.User, id string) (int, []byte) {
 		}
 
 		for _, v := range roles {
-			if v.Role == "owner" && v.UserID != existing.UserID {
+			if v.Role == "owner" && v.IsActive() && v.Principal() != existing.Principal() {
 				owner = true
 			}
 		}
@@ -0,0 +1,23 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package controllers
+
+import (
+	"github.com/ernestio/api-gateway/controllers/schedules"
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/labstack/echo"
+)
+
+// GetScheduleRunsHandler : gets the history of an environment schedule
+// runs
+func GetScheduleRunsHandler(c echo.Context) error {
+	au := AuthenticatedUser(c)
+	st, b := h.IsAuthorized(&au, "schedules/runs")
+	if st == 200 {
+		st, b = schedules.Runs(au, envName(c))
+	}
+
+	return h.Respond(c, st, b)
+}
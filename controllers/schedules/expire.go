@@ -0,0 +1,92 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package schedules
+
+import (
+	"time"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+	"github.com/sirupsen/logrus"
+)
+
+// Expire : warns the owners of the environments expiring within the
+// warning period, and destroys the expired ones. Each expiry is only
+// warned about and destroyed once
+func Expire(now time.Time, warning time.Duration) int {
+	var e models.Env
+	var envs []models.Env
+	var ran int
+
+	if err := e.FindAll(Scheduler, &envs); err != nil {
+		h.L.Error("Could not get the environment expiries: " + err.Error())
+		return 0
+	}
+
+	for i := range envs {
+		var s models.Schedule
+
+		switch {
+		case envs[i].IsExpired(now):
+			s = models.Schedule{Name: models.ExpiryDestroy, Action: models.ScheduleDestroy}
+		case envs[i].ExpiresWithin(now, warning):
+			s = models.Schedule{Name: models.ExpiryWarning, Action: models.ScheduleWarn}
+		default:
+			continue
+		}
+
+		run := models.ScheduleRun{
+			Env:         envs[i].Name,
+			Schedule:    s.Name,
+			Action:      s.Action,
+			ScheduledAt: envs[i].ExpiresAt,
+		}
+
+		if done, err := run.Exists(); err != nil || done {
+			continue
+		}
+
+		claimed, err := run.Claim()
+		if err != nil {
+			h.L.Error("Could not claim the expiry of " + envs[i].Name + ": " + err.Error())
+			continue
+		}
+
+		if !claimed {
+			continue
+		}
+
+		if s.Action == models.ScheduleWarn {
+			warn(&envs[i], &run)
+		} else {
+			execute(&envs[i], s, &run)
+		}
+		ran++
+	}
+
+	return ran
+}
+
+// warn : warns the environment owners it is about to expire, recording
+// how it went
+func warn(e *models.Env, run *models.ScheduleRun) {
+	run.Status = "done"
+	run.StartedAt = time.Now().Unix()
+	if err := e.RequestExpiryWarning(); err != nil {
+		run.Status = "failed"
+		run.Error = err.Error()
+	}
+	run.FinishedAt = time.Now().Unix()
+
+	h.L.WithFields(logrus.Fields{
+		"env":        e.Name,
+		"expires_at": e.ExpiresAt,
+		"status":     run.Status,
+	}).Info("Environment expiry warning")
+
+	if err := run.Save(); err != nil {
+		h.L.Error("Could not save the schedule run: " + err.Error())
+	}
+}
@@ -0,0 +1,178 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package schedules
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ernestio/api-gateway/controllers/builds"
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+	"github.com/ernestio/mapping/definition"
+	"github.com/ghodss/yaml"
+	"github.com/sirupsen/logrus"
+)
+
+// Scheduler : user the scheduled actions are run as
+var Scheduler = models.User{Username: "scheduler", Admin: h.Bool(true)}
+
+// Run : runs the environment schedules due after from and up to to.
+// Schedules missed for more than one time are only run once
+func Run(from, to time.Time) int {
+	var e models.Env
+	var envs []models.Env
+	var ran int
+
+	if err := e.FindAll(Scheduler, &envs); err != nil {
+		h.L.Error("Could not get the environment schedules: " + err.Error())
+		return 0
+	}
+
+	for i := range envs {
+		if len(envs[i].Schedules) == 0 {
+			continue
+		}
+
+		schedules, err := envs[i].GetSchedules()
+		if err != nil {
+			h.L.Warning("Skipping the schedules of " + envs[i].Name + ": " + err.Error())
+			continue
+		}
+
+		for _, s := range schedules {
+			due := s.Due(from, to)
+			if len(due) == 0 {
+				continue
+			}
+
+			run := models.ScheduleRun{
+				Env:         envs[i].Name,
+				Schedule:    s.Name,
+				Action:      s.Action,
+				ScheduledAt: due[len(due)-1].Unix(),
+			}
+
+			claimed, err := run.Claim()
+			if err != nil {
+				h.L.Error("Could not claim the " + s.Name + " schedule of " + envs[i].Name + ": " + err.Error())
+				continue
+			}
+
+			if claimed {
+				execute(&envs[i], s, &run)
+				ran++
+			}
+		}
+	}
+
+	return ran
+}
+
+// execute : runs a schedule action, recording how it went
+func execute(e *models.Env, s models.Schedule, run *models.ScheduleRun) {
+	var err error
+
+	run.Status = "running"
+	run.StartedAt = time.Now().Unix()
+	if err = run.Save(); err != nil {
+		h.L.Error("Could not save the schedule run: " + err.Error())
+	}
+
+	if err = checkLocks(e, s.Action); err == nil {
+		switch s.Action {
+		case models.ScheduleSync:
+			run.BuildID, err = e.RequestScheduledSync(Scheduler, s.Resolution)
+		case models.ScheduleApply:
+			run.BuildID, err = apply(e)
+		case models.ScheduleDestroy:
+			run.BuildID, err = buildID(builds.Delete(Scheduler, e.Name, ""))
+		case models.SchedulePowerOn, models.SchedulePowerOff:
+			run.BuildID, err = e.RequestPower(Scheduler, s.Action, s.Instances)
+		}
+	}
+
+	run.Status = "done"
+	if err != nil {
+		run.Status = "failed"
+		run.Error = err.Error()
+	}
+	run.FinishedAt = time.Now().Unix()
+
+	h.L.WithFields(logrus.Fields{
+		"env":      e.Name,
+		"schedule": s.Name,
+		"action":   s.Action,
+		"status":   run.Status,
+	}).Info("Environment schedule run")
+
+	if err = run.Save(); err != nil {
+		h.L.Error("Could not save the schedule run: " + err.Error())
+	}
+}
+
+// checkLocks : checks the environment is not locked. Scheduled applies
+// are also held during a freeze, even though the scheduler is an admin
+func checkLocks(e *models.Env, action string) error {
+	var f models.Freeze
+
+	if _, err := e.CheckLocks(Scheduler, "", false); err != nil {
+		return err
+	}
+
+	if action != models.ScheduleApply {
+		return nil
+	}
+
+	freeze, err := f.FindActive()
+	if err != nil {
+		return err
+	}
+
+	if freeze != nil {
+		return errors.New("Changes are frozen: " + freeze.Name)
+	}
+
+	return nil
+}
+
+// apply : applies the definition of the latest build of an environment
+func apply(e *models.Env) (string, error) {
+	var b models.Build
+	var def definition.Definition
+
+	if err := b.FindLastByName(e.Name); err != nil {
+		return "", errors.New("Environment has no build to apply")
+	}
+
+	raw, err := b.GetDefinition()
+	if err != nil {
+		return "", err
+	}
+
+	if err = yaml.Unmarshal(raw, &def); err != nil {
+		return "", err
+	}
+
+	return buildID(builds.Create(Scheduler, &def, raw, "false", ""))
+}
+
+// buildID : gets the id of the build created by a request, or its error
+func buildID(st int, res []byte) (string, error) {
+	var r struct {
+		ID      string `json:"id"`
+		Message string `json:"message"`
+	}
+
+	_ = json.Unmarshal(res, &r)
+
+	if st != http.StatusOK {
+		return "", errors.New(r.Message)
+	}
+
+	return r.ID, nil
+}
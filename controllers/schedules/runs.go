@@ -0,0 +1,41 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package schedules
+
+import (
+	"encoding/json"
+	"net/http"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+)
+
+// Runs : responds to GET /projects/:project/envs/:env/schedules/runs/
+// with the history of the environment schedule runs
+func Runs(au models.User, env string) (int, []byte) {
+	var e models.Env
+	var r models.ScheduleRun
+	var runs []models.ScheduleRun
+
+	if err := e.FindByName(env); err != nil {
+		return 404, models.NewJSONError("Environment not found")
+	}
+
+	if st, res := h.IsAuthorizedToResource(&au, h.GetEnv, e.GetType(), e.Name); st != 200 {
+		return st, res
+	}
+
+	if err := r.FindByEnv(e.Name, &runs); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal error")
+	}
+
+	data, err := json.Marshal(runs)
+	if err != nil {
+		return 500, models.NewJSONError("Internal error")
+	}
+
+	return http.StatusOK, data
+}
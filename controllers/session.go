@@ -7,11 +7,79 @@ package controllers
 import (
 	"net/http"
 
+	"github.com/dgrijalva/jwt-go"
+	"github.com/ernestio/api-gateway/controllers/sessions"
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
 	"github.com/labstack/echo"
 )
 
-// GetSessionsHandler : TODO
+// GetSessionsHandler : responds to GET /session/ with the
+// authenticated user
 func GetSessionsHandler(c echo.Context) error {
 	au := AuthenticatedUser(c)
 	return c.JSON(http.StatusOK, au)
 }
+
+// ListSessionsHandler : responds to GET /session/active/ with the
+// active sessions of a user
+func ListSessionsHandler(c echo.Context) error {
+	au := AuthenticatedUser(c)
+	claims, _ := c.Get("user").(*jwt.Token).Claims.(jwt.MapClaims)
+
+	st, b := h.IsAuthorized(&au, "sessions/list")
+	if st == 200 {
+		st, b = sessions.List(au, c.QueryParam("username"), claimString(claims, "sid"))
+	}
+
+	return h.Respond(c, st, b)
+}
+
+// RevokeSessionHandler : responds to DELETE /session/:session/ by
+// revoking one of the active sessions
+func RevokeSessionHandler(c echo.Context) error {
+	au := AuthenticatedUser(c)
+
+	st, b := h.IsAuthorized(&au, "sessions/revoke")
+	if st == 200 {
+		st, b = sessions.Delete(au, c.Param("session"))
+	}
+
+	return h.Respond(c, st, b)
+}
+
+// DeleteSessionHandler : responds to DELETE /session/ by revoking
+// the session the current token belongs to
+func DeleteSessionHandler(c echo.Context) error {
+	var r models.Revocation
+
+	au := AuthenticatedUser(c)
+	conf := models.Config{}
+
+	claims, _ := c.Get("user").(*jwt.Token).Claims.(jwt.MapClaims)
+
+	id := claimString(claims, "sid")
+	if id == "" {
+		id = claimString(claims, "jti")
+	}
+
+	if id == "" {
+		return h.Respond(c, 400, models.NewJSONError("Current token can't be revoked, please wait until it expires"))
+	}
+
+	exp := claimInt(claims, "iat") + int64(conf.GetRefreshTokenTTL().Seconds())
+
+	if err := r.RevokeToken(au.Username, id, exp); err != nil {
+		h.L.Error(err.Error())
+		return h.Respond(c, 500, models.NewJSONError("Internal server error"))
+	}
+
+	var s models.Session
+	if s.FindBySessionID(id) == nil {
+		if err := s.Delete(); err != nil {
+			h.L.Error(err.Error())
+		}
+	}
+
+	return h.Respond(c, http.StatusOK, []byte(`{"status": "Session successfully revoked"}`))
+}
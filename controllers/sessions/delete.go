@@ -0,0 +1,38 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sessions
+
+import (
+	"net/http"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+)
+
+// Delete : responds to DELETE /session/:session/ by revoking a session
+// of the authenticated user, or of any user for admins
+func Delete(au models.User, id string) (int, []byte) {
+	var s models.Session
+	var r models.Revocation
+
+	if err := s.FindBySessionID(id); err != nil {
+		return 404, models.NewJSONError("Session not found")
+	}
+
+	if !au.IsAdmin() && au.Username != s.Username {
+		return 404, models.NewJSONError("Session not found")
+	}
+
+	if err := r.RevokeToken(s.Username, s.SessionID, s.ExpiresAt); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	if err := s.Delete(); err != nil {
+		h.L.Error(err.Error())
+	}
+
+	return http.StatusOK, []byte(`{"status": "Session successfully revoked"}`)
+}
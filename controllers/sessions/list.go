@@ -0,0 +1,52 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sessions
+
+import (
+	"encoding/json"
+	"net/http"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+)
+
+// List : responds to GET /session/active/ with the active sessions of
+// the authenticated user, or of any user for admins
+func List(au models.User, user, current string) (int, []byte) {
+	var s models.Session
+	var sessions []models.Session
+
+	if user == "" {
+		user = au.Username
+	}
+
+	if !models.IsAlphaNumeric(user) {
+		return 404, models.NewJSONError("Username contains invalid characters")
+	}
+
+	if !au.IsAdmin() && au.Username != user {
+		return 403, models.NewJSONError("You're not allowed to perform this action, please contact your admin")
+	}
+
+	if err := s.FindActiveByUsername(user, &sessions); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].SessionID == current
+	}
+
+	if sessions == nil {
+		sessions = []models.Session{}
+	}
+
+	body, err := json.Marshal(sessions)
+	if err != nil {
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	return http.StatusOK, body
+}
@@ -0,0 +1,38 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package controllers
+
+import (
+	"github.com/ernestio/api-gateway/controllers/teams"
+	"github.com/labstack/echo"
+)
+
+// GetTeamsHandler : responds to GET /teams/ with all the teams
+func GetTeamsHandler(c echo.Context) error {
+	return genericList(c, "team", teams.List)
+}
+
+// GetTeamHandler : responds to GET /teams/:team/ with the team
+// members
+func GetTeamHandler(c echo.Context) error {
+	return genericGet(c, "team", teams.Get)
+}
+
+// CreateTeamHandler : responds to POST /teams/ by creating a team
+func CreateTeamHandler(c echo.Context) error {
+	return genericCreate(c, "team", teams.Create)
+}
+
+// UpdateTeamHandler : responds to PUT /teams/:team/ by updating a
+// team
+func UpdateTeamHandler(c echo.Context) error {
+	return genericUpdate(c, "team", teams.Update)
+}
+
+// DeleteTeamHandler : responds to DELETE /teams/:team/ by deleting a
+// team
+func DeleteTeamHandler(c echo.Context) error {
+	return genericDelete(c, "team", teams.Delete)
+}
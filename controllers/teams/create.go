@@ -0,0 +1,74 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package teams
+
+import (
+	"encoding/json"
+	"net/http"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+)
+
+// Create : responds to POST /teams/ by creating a team
+func Create(au models.User, body []byte) (int, []byte) {
+	var t models.Team
+	var existing models.Team
+
+	if t.Map(body) != nil {
+		return 400, models.NewJSONError("Invalid input")
+	}
+
+	if err := t.Validate(); err != nil {
+		h.L.Error(err.Error())
+		return http.StatusBadRequest, models.NewJSONError(err.Error())
+	}
+
+	if st, res := validateMembers(&t); st != http.StatusOK {
+		return st, res
+	}
+
+	if err := existing.FindByName(t.Name); err == nil {
+		return 409, models.NewJSONError("Specified team already exists")
+	}
+
+	t.ID = 0
+	if err := t.Save(); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	body, err := json.Marshal(t)
+	if err != nil {
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	return http.StatusOK, body
+}
+
+// validateMembers : checks all the team members are existing users,
+// removing any duplicates
+func validateMembers(t *models.Team) (int, []byte) {
+	members := []string{}
+	seen := make(map[string]bool)
+
+	for _, m := range t.Members {
+		if seen[m] {
+			continue
+		}
+		seen[m] = true
+
+		var u models.User
+		if err := u.FindByUserName(m, &u); err != nil {
+			return 404, models.NewJSONError("Specified user '" + m + "' not found")
+		}
+
+		members = append(members, m)
+	}
+
+	t.Members = members
+
+	return http.StatusOK, nil
+}
@@ -0,0 +1,43 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package teams
+
+import (
+	"net/http"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+)
+
+// Delete : responds to DELETE /teams/:team/ by deleting a team and all
+// the roles assigned to it
+func Delete(au models.User, name string) (int, []byte) {
+	var t models.Team
+	var grant models.Role
+	var grants []models.Role
+
+	if err := t.FindByName(name); err != nil {
+		return 404, models.NewJSONError("Team not found")
+	}
+
+	if err := grant.FindAllByTeam(name, &grants); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	for _, g := range grants {
+		if err := g.Delete(); err != nil {
+			h.L.Error(err.Error())
+			return 500, models.NewJSONError("Internal server error")
+		}
+	}
+
+	if err := t.Delete(); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	return http.StatusOK, []byte(`{"status": "Team successfully deleted"}`)
+}
@@ -0,0 +1,28 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package teams
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ernestio/api-gateway/models"
+)
+
+// Get : responds to GET /teams/:team/ with the team members
+func Get(au models.User, name string) (int, []byte) {
+	var t models.Team
+
+	if err := t.FindByName(name); err != nil {
+		return 404, models.NewJSONError("Team not found")
+	}
+
+	body, err := json.Marshal(t)
+	if err != nil {
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	return http.StatusOK, body
+}
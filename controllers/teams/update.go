@@ -0,0 +1,55 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package teams
+
+import (
+	"encoding/json"
+	"net/http"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+)
+
+// Update : responds to PUT /teams/:team/ by replacing the members and
+// description of a team
+func Update(au models.User, name string, body []byte) (int, []byte) {
+	var t models.Team
+	var existing models.Team
+
+	if t.Map(body) != nil {
+		return 400, models.NewJSONError("Invalid input")
+	}
+
+	if t.Name != "" && t.Name != name {
+		return 400, models.NewJSONError("Team name does not match payload name")
+	}
+	t.Name = name
+
+	if err := t.Validate(); err != nil {
+		h.L.Error(err.Error())
+		return http.StatusBadRequest, models.NewJSONError(err.Error())
+	}
+
+	if err := existing.FindByName(name); err != nil {
+		return 404, models.NewJSONError("Team not found")
+	}
+
+	if st, res := validateMembers(&t); st != http.StatusOK {
+		return st, res
+	}
+
+	t.ID = existing.ID
+	if err := t.Save(); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	body, err := json.Marshal(t)
+	if err != nil {
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	return http.StatusOK, body
+}
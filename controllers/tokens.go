@@ -0,0 +1,54 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package controllers
+
+import (
+	"github.com/ernestio/api-gateway/controllers/tokens"
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/labstack/echo"
+)
+
+// GetTokensHandler : responds to GET /users/:user/tokens/ with a list
+// of the user api tokens
+func GetTokensHandler(c echo.Context) error {
+	au := AuthenticatedUser(c)
+	st, b := h.IsAuthorized(&au, "tokens/list")
+	if st == 200 {
+		st, b = tokens.List(au, c.Param("user"))
+	}
+
+	return h.Respond(c, st, b)
+}
+
+// CreateTokenHandler : responds to POST /users/:user/tokens/ by creating
+// a new api token
+func CreateTokenHandler(c echo.Context) error {
+	au := AuthenticatedUser(c)
+	st, b := h.IsAuthorized(&au, "tokens/create")
+	if st != 200 {
+		return h.Respond(c, st, b)
+	}
+
+	st = 500
+	b = []byte("Invalid input")
+	body, err := h.GetRequestBody(c)
+	if err == nil {
+		st, b = tokens.Create(au, c.Param("user"), body, signAPIToken)
+	}
+
+	return h.Respond(c, st, b)
+}
+
+// DeleteTokenHandler : responds to DELETE /users/:user/tokens/:token/
+// by deleting an existing api token
+func DeleteTokenHandler(c echo.Context) error {
+	au := AuthenticatedUser(c)
+	st, b := h.IsAuthorized(&au, "tokens/delete")
+	if st == 200 {
+		st, b = tokens.Delete(au, c.Param("user"), c.Param("token"))
+	}
+
+	return h.Respond(c, st, b)
+}
@@ -0,0 +1,93 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package tokens
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+	"github.com/nu7hatch/gouuid"
+)
+
+// Signer : generates the signed representation of an api token
+type Signer func(*models.APIToken) (string, error)
+
+// Create : responds to POST /users/:user/tokens/ by creating an api
+// token for an existing user
+func Create(au models.User, user string, body []byte, sign Signer) (int, []byte) {
+	var t models.APIToken
+	var existing models.User
+
+	if st, res := canManage(au, user, &existing); st != 200 {
+		return st, res
+	}
+
+	if t.Map(body) != nil {
+		return 400, models.NewJSONError("Invalid input")
+	}
+
+	if err := t.Validate(); err != nil {
+		h.L.Error(err.Error())
+		return http.StatusBadRequest, models.NewJSONError(err.Error())
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	now := time.Now()
+
+	t.ID = 0
+	t.TokenID = id.String()
+	t.Username = existing.Username
+	t.CreatedAt = now.Unix()
+	t.ExpiresAt = 0
+	t.Token = ""
+
+	if t.TTL != "" {
+		ttl, _ := time.ParseDuration(t.TTL)
+		t.ExpiresAt = now.Add(ttl).Unix()
+	}
+
+	if err := t.Save(); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	// the signed token is only returned once and never stored
+	if t.Token, err = sign(&t); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	if body, err = json.Marshal(t); err != nil {
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	return http.StatusOK, body
+}
+
+// canManage : checks if the authenticated user can manage the api
+// tokens of the given user, loading it on the given struct
+func canManage(au models.User, user string, existing *models.User) (int, []byte) {
+	if !models.IsAlphaNumeric(user) {
+		return 404, models.NewJSONError("Username contains invalid characters")
+	}
+
+	if !au.IsAdmin() && au.Username != user {
+		return 403, models.NewJSONError("You're not allowed to perform this action, please contact your admin")
+	}
+
+	if err := au.FindByUserName(user, existing); err != nil {
+		return 404, models.NewJSONError("User not found")
+	}
+
+	return 200, nil
+}
@@ -0,0 +1,34 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package tokens
+
+import (
+	"net/http"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+)
+
+// Delete : responds to DELETE /users/:user/tokens/:token/ by deleting
+// an existing api token, which revokes it immediately
+func Delete(au models.User, user, token string) (int, []byte) {
+	var t models.APIToken
+	var existing models.User
+
+	if st, res := canManage(au, user, &existing); st != 200 {
+		return st, res
+	}
+
+	if err := t.FindByID(token); err != nil || t.Username != existing.Username {
+		return 404, models.NewJSONError("Token not found")
+	}
+
+	if err := t.Delete(); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	return http.StatusOK, []byte(`{"status": "Token successfully deleted"}`)
+}
@@ -0,0 +1,39 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package tokens
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ernestio/api-gateway/models"
+)
+
+// List : responds to GET /users/:user/tokens/ with all api tokens
+// of a user
+func List(au models.User, user string) (int, []byte) {
+	var t models.APIToken
+	var tokens []models.APIToken
+	var existing models.User
+
+	if st, res := canManage(au, user, &existing); st != 200 {
+		return st, res
+	}
+
+	if err := t.FindByUsername(existing.Username, &tokens); err != nil {
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	for i := range tokens {
+		tokens[i].Token = ""
+	}
+
+	body, err := json.Marshal(tokens)
+	if err != nil {
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	return http.StatusOK, body
+}
@@ -5,7 +5,11 @@
 package controllers
 
 import (
+	"net/http"
+
 	"github.com/ernestio/api-gateway/controllers/users"
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
 	"github.com/labstack/echo"
 )
 
@@ -39,3 +43,85 @@ func UpdateUserHandler(c echo.Context) error {
 func DeleteUserHandler(c echo.Context) error {
 	return genericDelete(c, "user", users.Delete)
 }
+
+// RevokeUserTokensHandler : responds to POST /users/:id:/revoke/ by
+// revoking all tokens issued to an existing user
+func RevokeUserTokensHandler(c echo.Context) error {
+	au := AuthenticatedUser(c)
+	st, b := h.IsAuthorized(&au, "users/revoke")
+	if st == 200 {
+		st, b = users.Revoke(au, c.Param("user"))
+	}
+
+	return h.Respond(c, st, b)
+}
+
+// EnrollMFAHandler : responds to POST /users/:user/mfa/ by starting
+// the mfa enrollment of the authenticated user
+func EnrollMFAHandler(c echo.Context) error {
+	au := AuthenticatedUser(c)
+	st, b := h.IsAuthorized(&au, "users/mfa")
+	if st == 200 {
+		st, b = users.EnrollMFA(au, c.Param("user"))
+	}
+
+	return h.Respond(c, st, b)
+}
+
+// VerifyMFAHandler : responds to POST /users/:user/mfa/verify/ by
+// completing the mfa enrollment of the authenticated user
+func VerifyMFAHandler(c echo.Context) error {
+	au := AuthenticatedUser(c)
+	st, b := h.IsAuthorized(&au, "users/mfa")
+	if st != 200 {
+		return h.Respond(c, st, b)
+	}
+
+	if throttled(c, Throttle, c.Param("user"), "MFA verification rejected by the login throttle") {
+		return h.Respond(c, http.StatusTooManyRequests, models.NewJSONError("Too many failed verification attempts, please try again later"))
+	}
+
+	st = 500
+	b = []byte("Invalid input")
+	body, err := h.GetRequestBody(c)
+	if err == nil {
+		st, b = users.VerifyMFA(au, c.Param("user"), body, Throttle, clientIP(c))
+	}
+
+	return h.Respond(c, st, b)
+}
+
+// DisableMFAHandler : responds to DELETE /users/:user/mfa/ by switching
+// mfa off for the authenticated user
+func DisableMFAHandler(c echo.Context) error {
+	au := AuthenticatedUser(c)
+	st, b := h.IsAuthorized(&au, "users/mfa")
+	if st != 200 {
+		return h.Respond(c, st, b)
+	}
+
+	if throttled(c, Throttle, c.Param("user"), "MFA verification rejected by the login throttle") {
+		return h.Respond(c, http.StatusTooManyRequests, models.NewJSONError("Too many failed verification attempts, please try again later"))
+	}
+
+	st = 500
+	b = []byte("Invalid input")
+	body, err := h.GetRequestBody(c)
+	if err == nil {
+		st, b = users.DisableMFA(au, c.Param("user"), body, Throttle, clientIP(c))
+	}
+
+	return h.Respond(c, st, b)
+}
+
+// ResetMFAHandler : responds to POST /users/:user/mfa/reset/ by
+// switching mfa off for any user
+func ResetMFAHandler(c echo.Context) error {
+	au := AuthenticatedUser(c)
+	st, b := h.IsAuthorized(&au, "users/mfa_reset")
+	if st == 200 {
+		st, b = users.ResetMFA(au, c.Param("user"))
+	}
+
+	return h.Respond(c, st, b)
+}
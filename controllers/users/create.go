@@ -24,11 +24,19 @@ func Create(au models.User, body []byte) (int, []byte) {
 		return 400, models.NewJSONError(err.Error())
 	}
 
+	if u.Password != nil {
+		if err := models.Passwords.Validate(*u.Password); err != nil {
+			return 400, models.NewJSONError(err.Error())
+		}
+	}
+
 	if err := existing.FindByUserName(u.Username, &existing); err == nil {
 		return 409, models.NewJSONError(`Specified user already exists`)
 	}
 
-	u.Type = "local"
+	if !u.IsServiceAccount() {
+		u.Type = "local"
+	}
 
 	if err := u.Save(); err != nil {
 		h.L.Error(err.Error())
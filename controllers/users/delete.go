@@ -3,12 +3,79 @@ package users
 import (
 	"net/http"
 
+	h "github.com/ernestio/api-gateway/helpers"
 	"github.com/ernestio/api-gateway/models"
 )
 
 // Delete : responds to DELETE /users/:id: by deleting an
-// existing user
+// existing user, logging it out, removing it from its teams and deleting
+// its roles, api tokens and sessions
 func Delete(au models.User, user string) (int, []byte) {
+	var existing models.User
+	var t models.Team
+	var teams []models.Team
+	var r models.Role
+	var roles []models.Role
+	var tokens models.APIToken
+	var s models.Session
+	var sessions []models.Session
+	var rv models.Revocation
+
+	if err := au.FindByID(user, &existing); err != nil {
+		return 404, models.NewJSONError("User not found")
+	}
+
+	// its tokens are revoked first, so it is logged out even if anything
+	// else fails
+	if err := rv.RevokeAll(existing.Username); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Error revoking user tokens")
+	}
+
+	// a user created later with the same name must not join its teams
+	if err := t.FindByMember(existing.Username, &teams); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	for _, v := range teams {
+		v.RemoveMember(existing.Username)
+		if err := v.Save(); err != nil {
+			h.L.Error(err.Error())
+			return 500, models.NewJSONError("Internal server error")
+		}
+	}
+
+	// a user created later with the same name must not get its roles
+	if err := r.FindAllByUser(existing.Username, &roles); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	for _, v := range roles {
+		if err := v.Delete(); err != nil {
+			h.L.Error(err.Error())
+			return 500, models.NewJSONError("Internal server error")
+		}
+	}
+
+	if err := tokens.DeleteByUsername(existing.Username); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	if err := s.FindByUsername(existing.Username, &sessions); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	for _, v := range sessions {
+		if err := v.Delete(); err != nil {
+			h.L.Error(err.Error())
+			return 500, models.NewJSONError("Internal server error")
+		}
+	}
+
 	if err := au.Delete(user); err != nil {
 		return 404, models.NewJSONError("User not found")
 	}
@@ -0,0 +1,58 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package users
+
+import (
+	"encoding/json"
+	"net/http"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+)
+
+// LDAPSyncPlan : responds to GET /users/:user/ldap/sync/ with the
+// changes a group sync would apply, without applying them
+func LDAPSyncPlan(au models.User, user string) (int, []byte) {
+	var res struct {
+		Username string              `json:"username"`
+		DN       string              `json:"dn"`
+		Groups   []string            `json:"groups"`
+		Changes  []models.RoleChange `json:"changes"`
+	}
+
+	if !models.IsAlphaNumeric(user) {
+		return 404, models.NewJSONError("Username contains invalid characters")
+	}
+
+	d, err := models.NewLDAPDirectory()
+	if err != nil {
+		return 400, models.NewJSONError(err.Error())
+	}
+
+	id, err := d.Lookup(user)
+	if err == models.ErrInvalidCredentials {
+		return 404, models.NewJSONError("User not found on the ldap directory")
+	}
+	if err != nil {
+		h.L.Error(err.Error())
+		return 503, models.NewJSONError("Could not reach the ldap directory")
+	}
+
+	res.Username = id.Username
+	res.DN = id.DN
+	res.Groups = id.Groups
+
+	if res.Changes, err = models.PlanGroupSync(user, id.Groups, d.Mappings); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	body, err := json.Marshal(res)
+	if err != nil {
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	return http.StatusOK, body
+}
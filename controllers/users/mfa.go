@@ -0,0 +1,206 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package users
+
+import (
+	"encoding/json"
+	"net/http"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+	"github.com/sirupsen/logrus"
+)
+
+// MFARequest : payload accepted by the mfa verification endpoints
+type MFARequest struct {
+	VerificationCode string `json:"verification_code"`
+}
+
+// EnrollMFA : responds to POST /users/:user/mfa/ by generating a new
+// mfa secret. MFA is not switched on until the secret is verified
+func EnrollMFA(au models.User, user string) (int, []byte) {
+	var existing models.User
+
+	if st, res := findMFAUser(au, user, &existing); st != 200 {
+		return st, res
+	}
+
+	if existing.IsMFAEnabled() {
+		return 409, models.NewJSONError("MFA is already enabled, please disable it first")
+	}
+
+	secret, err := models.NewTOTPSecret()
+	if err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	existing.MFA = h.Bool(false)
+	existing.MFASecret = secret
+
+	if err := existing.SaveMFA(); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"secret":      secret,
+		"otpauth_uri": models.OTPAuthURI(existing.Username, secret),
+	})
+	if err != nil {
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	return http.StatusOK, body
+}
+
+// VerifyMFA : responds to POST /users/:user/mfa/verify/ by switching
+// mfa on once a valid verification code is provided, and returns the
+// user recovery codes. Invalid codes count as failed login attempts
+func VerifyMFA(au models.User, user string, body []byte, throttle *models.LoginThrottle, ip string) (int, []byte) {
+	var existing models.User
+	var req MFARequest
+
+	if err := json.Unmarshal(body, &req); err != nil {
+		return 400, models.NewJSONError("Invalid input")
+	}
+
+	if st, res := findMFAUser(au, user, &existing); st != 200 {
+		return st, res
+	}
+
+	if existing.IsMFAEnabled() {
+		return 409, models.NewJSONError("MFA is already enabled")
+	}
+
+	if existing.MFASecret == "" {
+		return 400, models.NewJSONError("MFA enrollment has not been started")
+	}
+
+	if !existing.AcceptTOTP(req.VerificationCode) {
+		throttle.Fail(existing.Username, ip)
+		return 400, models.NewJSONError("Invalid verification code")
+	}
+
+	codes, hashes, err := models.NewRecoveryCodes()
+	if err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	existing.MFA = h.Bool(true)
+	existing.MFARecoveryCodes = hashes
+
+	if err := existing.SaveMFA(); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	h.L.WithFields(logrus.Fields{
+		"username": existing.Username,
+	}).Info("MFA enabled")
+
+	body, err = json.Marshal(map[string][]string{"recovery_codes": codes})
+	if err != nil {
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	return http.StatusOK, body
+}
+
+// DisableMFA : responds to DELETE /users/:user/mfa/ by switching mfa
+// off, given a valid verification or recovery code. Invalid codes count
+// as failed login attempts
+func DisableMFA(au models.User, user string, body []byte, throttle *models.LoginThrottle, ip string) (int, []byte) {
+	var existing models.User
+	var req MFARequest
+
+	if err := json.Unmarshal(body, &req); err != nil {
+		return 400, models.NewJSONError("Invalid input")
+	}
+
+	if st, res := findMFAUser(au, user, &existing); st != 200 {
+		return st, res
+	}
+
+	if !existing.IsMFAEnabled() {
+		return 400, models.NewJSONError("MFA is not enabled")
+	}
+
+	if !existing.AcceptTOTP(req.VerificationCode) && !existing.HasRecoveryCode(req.VerificationCode) {
+		throttle.Fail(existing.Username, ip)
+		return 400, models.NewJSONError("Invalid verification code")
+	}
+
+	if err := resetMFA(&existing); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	h.L.WithFields(logrus.Fields{
+		"username": existing.Username,
+	}).Info("MFA disabled")
+
+	return http.StatusOK, []byte(`{"status": "MFA successfully disabled"}`)
+}
+
+// ResetMFA : responds to POST /users/:user/mfa/reset/ by switching mfa
+// off for a user who lost access to its authenticator
+func ResetMFA(au models.User, user string) (int, []byte) {
+	var existing models.User
+
+	if !au.IsAdmin() {
+		return 403, models.NewJSONError("You're not allowed to perform this action, please contact your admin")
+	}
+
+	if !models.IsAlphaNumeric(user) {
+		return 404, models.NewJSONError("Username contains invalid characters")
+	}
+
+	if err := au.FindByUserName(user, &existing); err != nil {
+		return 404, models.NewJSONError("User not found")
+	}
+
+	if err := resetMFA(&existing); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	h.L.WithFields(logrus.Fields{
+		"username": existing.Username,
+		"admin":    au.Username,
+	}).Warning("MFA reset by an admin")
+
+	return http.StatusOK, []byte(`{"status": "MFA successfully reset"}`)
+}
+
+// findMFAUser : loads a local user managing its own mfa
+func findMFAUser(au models.User, user string, existing *models.User) (int, []byte) {
+	if !models.IsAlphaNumeric(user) {
+		return 404, models.NewJSONError("Username contains invalid characters")
+	}
+
+	if au.Username != user {
+		return 403, models.NewJSONError("MFA can only be managed by its own user")
+	}
+
+	if err := au.FindByUserName(user, existing); err != nil {
+		return 404, models.NewJSONError("User not found")
+	}
+
+	if existing.Type != "" && existing.Type != "local" {
+		return 400, models.NewJSONError("MFA can only be enabled for local users")
+	}
+
+	return 200, nil
+}
+
+func resetMFA(u *models.User) error {
+	u.MFA = h.Bool(false)
+	u.MFASecret = ""
+	u.MFARecoveryCodes = nil
+
+	return u.SaveMFA()
+}
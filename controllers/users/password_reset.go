@@ -0,0 +1,157 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package users
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+	"github.com/nu7hatch/gouuid"
+	"github.com/sirupsen/logrus"
+)
+
+// ResetSigner : generates the signed token sent to the user for the
+// given password reset
+type ResetSigner func(*models.PasswordReset) (string, error)
+
+// RequestPasswordReset : responds to POST /auth/reset/ by sending a
+// single use password reset token to the user email. The response is
+// the same whether the user exists or not
+func RequestPasswordReset(username string, sign ResetSigner, m models.Mailer) (int, []byte) {
+	var u models.User
+	var existing models.User
+
+	accepted := []byte(`{"status": "If the user exists, password reset instructions have been sent to its email"}`)
+
+	if m == nil {
+		return http.StatusNotImplemented, models.NewJSONError("Password resets are not enabled, please contact your admin")
+	}
+
+	if !models.IsAlphaNumeric(username) {
+		return 400, models.NewJSONError("Username contains invalid characters")
+	}
+
+	if err := u.FindByUserName(username, &existing); err != nil {
+		h.L.Warning("Password reset requested for an unknown user (" + username + ")")
+		return http.StatusAccepted, accepted
+	}
+
+	if !existing.IsLocal() || existing.IsDisabled() || existing.Email == "" {
+		h.L.Warning("Password reset requested for a user that can't reset its password (" + username + ")")
+		return http.StatusAccepted, accepted
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	c := models.Config{}
+	now := time.Now()
+
+	r := models.PasswordReset{
+		TokenID:   id.String(),
+		Username:  existing.Username,
+		CreatedAt: now.Unix(),
+		ExpiresAt: now.Add(c.GetPasswordResetTTL()).Unix(),
+	}
+
+	token, err := sign(&r)
+	if err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	if err := r.Save(); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	body := "A password reset has been requested for your ernest user " + existing.Username + ".\n\n"
+	if url := c.GetPasswordResetURL(); url != "" {
+		body = body + "Visit " + fmt.Sprintf(url, token) + " to choose a new password.\n\n"
+	} else {
+		body = body + "Use the following token to choose a new password:\n\n" + token + "\n\n"
+	}
+	body = body + "The reset expires in " + c.GetPasswordResetTTL().String() + " and can only be used once. If you didn't request it, you can ignore this message."
+
+	if err := m.Send(existing.Email, "Ernest password reset", body); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Could not send the password reset, please contact your admin")
+	}
+
+	h.L.WithFields(logrus.Fields{
+		"username": existing.Username,
+		"expires":  r.ExpiresAt,
+	}).Info("Password reset requested")
+
+	return http.StatusAccepted, accepted
+}
+
+// ResetPassword : responds to POST /auth/reset/confirm/ by setting a
+// new password with a password reset token, revoking all the sessions
+// of the user
+func ResetPassword(username, tokenID, password string) (int, []byte) {
+	var r models.PasswordReset
+	var rv models.Revocation
+	var existing models.User
+
+	invalid := models.NewJSONError("Invalid or expired password reset token")
+
+	if err := r.FindByTokenID(tokenID); err != nil || r.Username != username {
+		return 400, invalid
+	}
+
+	if r.IsExpired() {
+		if err := r.Delete(); err != nil {
+			h.L.Error(err.Error())
+		}
+		return 400, invalid
+	}
+
+	if err := existing.FindByUserName(r.Username, &existing); err != nil {
+		return 400, invalid
+	}
+
+	if !existing.IsLocal() || existing.IsDisabled() {
+		return 403, models.NewJSONError("Your account can't reset its password, please contact your admin")
+	}
+
+	u := models.User{Username: existing.Username, Password: &password}
+	if err := u.Validate(); err != nil {
+		return 400, models.NewJSONError(err.Error())
+	}
+
+	if err := models.Passwords.ValidateChange(&existing, password); err != nil {
+		return 400, models.NewJSONError(err.Error())
+	}
+
+	// the reset is consumed before changing the password, so it can't
+	// be used twice
+	if err := r.Delete(); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	if err := existing.SavePassword(password, models.Passwords.NextHistory(&existing)); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Error updating user")
+	}
+
+	if err := rv.RevokeAll(existing.Username); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Error revoking user tokens")
+	}
+
+	h.L.WithFields(logrus.Fields{
+		"username": existing.Username,
+	}).Info("Password reset")
+
+	return http.StatusOK, []byte(`{"status": "Password successfully reset"}`)
+}
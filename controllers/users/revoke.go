@@ -0,0 +1,38 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package users
+
+import (
+	"net/http"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+)
+
+// Revoke : responds to POST /users/:id:/revoke/ by revoking every
+// token issued to an existing user
+func Revoke(au models.User, user string) (int, []byte) {
+	var existing models.User
+	var r models.Revocation
+
+	if !models.IsAlphaNumeric(user) {
+		return 404, models.NewJSONError("Username contains invalid characters")
+	}
+
+	if !au.IsAdmin() && au.Username != user {
+		return 403, models.NewJSONError("You're not allowed to perform this action, please contact your admin")
+	}
+
+	if err := au.FindByUserName(user, &existing); err != nil {
+		return 404, models.NewJSONError("User not found")
+	}
+
+	if err := r.RevokeAll(existing.Username); err != nil {
+		h.L.Error(err.Error())
+		return 500, models.NewJSONError("Internal server error")
+	}
+
+	return http.StatusOK, []byte(`{"status": "User tokens successfully revoked"}`)
+}
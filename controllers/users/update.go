@@ -55,6 +55,22 @@ func Update(au models.User, user string, body []byte) (int, []byte) {
 	}
 
 	u.Username = existing.Username
+	u.Type = existing.Type
+	u.MFASecret = existing.MFASecret
+	u.MFARecoveryCodes = existing.MFARecoveryCodes
+	u.MFALastStep = existing.MFALastStep
+	u.PasswordHistory = existing.PasswordHistory
+
+	// mfa is switched on and off through the mfa endpoints, so it is
+	// never enabled without verifying a code first
+	if u.MFA != nil && *u.MFA != existing.IsMFAEnabled() {
+		return 400, models.NewJSONError("MFA can only be changed through /users/" + existing.Username + "/mfa/")
+	}
+	u.MFA = h.Bool(existing.IsMFAEnabled())
+
+	if existing.IsServiceAccount() && u.Password != nil {
+		return 400, models.NewJSONError("Service accounts can't have a password")
+	}
 
 	if !au.IsAdmin() && existing.Username != au.Username {
 		err := errors.New("You're not allowed to perform this action, please contact your admin")
@@ -69,8 +85,7 @@ func Update(au models.User, user string, body []byte) (int, []byte) {
 	}
 
 	if u.Password != nil {
-		err := u.Validate()
-		if err != nil {
+		if err := models.Passwords.ValidateChange(&existing, *u.Password); err != nil {
 			return 400, models.NewJSONError(err.Error())
 		}
 
@@ -82,27 +97,46 @@ func Update(au models.User, user string, body []byte) (int, []byte) {
 		}
 	}
 
+	if u.Password != nil {
+		u.PasswordHistory = models.Passwords.NextHistory(&existing)
+	}
+
+	// password resets are sent to the user email, so changing it takes
+	// the same credentials as changing the password
+	emailChanged := u.Email != "" && u.Email != existing.Email
+	if emailChanged && !au.IsAdmin() {
+		if u.OldPassword == nil || existing.Password == nil || !existing.ValidPassword(*u.OldPassword) {
+			err := errors.New("Provided credentials are not valid")
+			h.L.Error(err.Error())
+			return 403, models.NewJSONError(err.Error())
+		}
+	}
+
 	if err := u.Save(); err != nil {
 		h.L.Error(err.Error())
 		return 500, models.NewJSONError("Error updating user")
 	}
 
-	if existing.MFA == nil {
-		existing.MFA = h.Bool(false)
+	// Disabling a user or changing its email cuts any access granted by
+	// already issued tokens
+	if (u.IsDisabled() && !existing.IsDisabled()) || emailChanged {
+		var r models.Revocation
+		if err := r.RevokeAll(existing.Username); err != nil {
+			h.L.Error(err.Error())
+			return 500, models.NewJSONError("Error revoking user tokens")
+		}
 	}
 
-	if u.MFA != nil {
-		if *u.MFA && !*existing.MFA {
-			mfaSecret := u.MFASecret
-			u.Redact(au)
-			u.MFASecret = mfaSecret
-		} else {
-			u.Redact(au)
+	if u.IsDisabled() && !existing.IsDisabled() {
+		var t models.APIToken
+		if err := t.DeleteByUsername(existing.Username); err != nil {
+			h.L.Error(err.Error())
+			return 500, models.NewJSONError("Error deleting user api tokens")
 		}
-	} else {
-		u.Redact(au)
 	}
 
+	u.Redact(au)
+
 	body, err = json.Marshal(u)
 	if err != nil {
 		return 500, models.NewJSONError("Internal server error")
@@ -5,6 +5,9 @@ type User interface {
 	GetAdmin() bool
 	IsOwner(resourceType, resourceID string) bool
 	IsReader(resourceType, resourceID string) bool
+	Can(permission, resourceType, resourceID string) bool
+	IsScoped() bool
+	InScope(endpoint, resourceType, resourceID string) bool
 }
 
 var (
@@ -14,6 +17,8 @@ var (
 	AuthNonOwner = []byte(`{"message": "You don't have permissions to perform this action, please login as a resource owner"}`)
 	// AuthNonReadable : Response body for non authorized requests on admin resources
 	AuthNonReadable = []byte(`{"message": "You don't have permissions to perform this action, please contact the resource owner"}`)
+	// AuthOutOfScope : Response body for requests not allowed by the api token scope
+	AuthOutOfScope = []byte(`{"message": "The provided api token is not allowed to perform this action"}`)
 	// GetProject : ...
 	GetProject = "get_project"
 	// DeleteProject : ...
@@ -48,8 +53,30 @@ var (
 	DeletePolicy = "delete_policy"
 	// UpdatePolicy : ...
 	UpdatePolicy = "update_policy"
+	// Permissions : all the permissions resource authorization is checked against
+	Permissions = []string{
+		GetProject, DeleteProject, UpdateProject, DeleteEnv, DeleteEnvForce, UpdateEnv, GetEnv, SyncEnv,
+		ListBuilds, DeleteBuild, GetBuild, ResetBuild, SubmitBuild, DiffBuild, GetPolicy, DeletePolicy, UpdatePolicy,
+	}
+	// OwnerPermissions : permissions granted by the owner role
+	OwnerPermissions = Permissions
+	// ReaderPermissions : permissions granted by the reader role
+	ReaderPermissions = []string{
+		GetPolicy, GetProject, GetEnv, ListBuilds, GetBuild, DiffBuild, SubmitBuild,
+	}
 )
 
+// IsPermission : checks if the given string is a known permission
+func IsPermission(p string) bool {
+	for _, v := range Permissions {
+		if v == p {
+			return true
+		}
+	}
+
+	return false
+}
+
 // IsAuthorized : Validates if the given user has access to the given resource
 func IsAuthorized(au User, resource string) (int, []byte) {
 	st, res := IsLicensed(au, resource)
@@ -57,28 +84,14 @@ func IsAuthorized(au User, resource string) (int, []byte) {
 		return st, res
 	}
 
-	if au.GetAdmin() == true {
-		return 200, []byte("")
-	}
+	p := CurrentAuthzPolicy()
 
-	adminResources := map[string]int{
-		"loggers/create":            403,
-		"loggers/delete":            403,
-		"loggers/list":              403,
-		"notifications/add_env":     403,
-		"notifications/add_project": 403,
-		"notifications/create":      403,
-		"notifications/delete":      403,
-		"notifications/list":        403,
-		"notifications/rm_service":  403,
-		"notifications/update":      403,
-		"usages/report":             403,
-		"users/create":              403,
-		"users/delete":              403,
-		"roles/list":                403,
+	if au.IsScoped() && !p.InScope(resource) {
+		return 403, AuthOutOfScope
 	}
-	if st, ok := adminResources[resource]; ok {
-		return st, AuthNonAdmin
+
+	if !p.Allows(au.GetAdmin(), resource) {
+		return 403, AuthNonAdmin
 	}
 
 	return 200, []byte("")
@@ -86,24 +99,15 @@ func IsAuthorized(au User, resource string) (int, []byte) {
 
 // IsAuthorizedToResource : check  if the user is authorized to access a specific resource
 func IsAuthorizedToResource(au User, endpoint, resource, resourceID string) (int, []byte) {
-	ownedResources := map[string]int{
-		DeleteBuild:    403,
-		DeleteEnv:      403,
-		DeleteEnvForce: 403,
-		UpdateEnv:      403,
-		DeleteProject:  403,
-		UpdateProject:  403,
-		ResetBuild:     403,
-		SyncEnv:        403,
-		DeletePolicy:   403,
-		UpdatePolicy:   403,
+	if !au.InScope(endpoint, resource, resourceID) {
+		return 403, AuthOutOfScope
 	}
-	if st, ok := ownedResources[endpoint]; ok {
-		if !au.IsOwner(resource, resourceID) {
-			return st, AuthNonOwner
-		}
-		// TODO : Check if it's authorized by inheritance
 
+	if CurrentAuthzPolicy().IsOwned(endpoint) {
+		// roles are inherited down the resource hierarchy
+		if !au.Can(endpoint, resource, resourceID) {
+			return 403, AuthNonOwner
+		}
 	}
 
 	return IsAuthorizedToReadResource(au, endpoint, resource, resourceID)
@@ -111,27 +115,9 @@ func IsAuthorizedToResource(au User, endpoint, resource, resourceID string) (int
 
 // IsLicensed : checks if the action being performed is licensed
 func IsLicensed(au User, resource string) (int, []byte) {
-	licensedResources := map[string]int{
-		"notifications/add_env":     405,
-		"notifications/add_project": 405,
-		"notifications/create":      405,
-		"notifications/delete":      405,
-		"notifications/list":        405,
-		"notifications/rm_service":  405,
-		"notifications/update":      405,
-		"envs/sync":                 405,
-		"envs/resolve":              405,
-		"envs/submission":           405,
-		"envs/review":               405,
-		"policies/create":           405,
-		"policies/get":              405,
-		"policies/delete":           405,
-		"policies/list":             405,
-		"policies/update":           405,
-	}
-	if st, ok := licensedResources[resource]; ok {
+	if CurrentAuthzPolicy().IsLicensed(resource) {
 		if err := Licensed(); err != nil {
-			return st, ErrMessage(err.Error())
+			return 405, ErrMessage(err.Error())
 		}
 	}
 
@@ -140,21 +126,14 @@ func IsLicensed(au User, resource string) (int, []byte) {
 
 // IsAuthorizedToReadResource : check  if the user is authorized to read only access a specific resource
 func IsAuthorizedToReadResource(au User, endpoint, resource, resourceID string) (int, []byte) {
-	readableResources := map[string]int{
-		GetPolicy:   403,
-		GetProject:  403,
-		GetEnv:      403,
-		ListBuilds:  403,
-		GetBuild:    403,
-		DiffBuild:   403,
-		SubmitBuild: 403,
-		GetPolicy:   403,
+	if !au.InScope(endpoint, resource, resourceID) {
+		return 403, AuthOutOfScope
 	}
-	if st, ok := readableResources[endpoint]; ok {
-		if !au.IsReader(resource, resourceID) {
-			return st, AuthNonReadable
+
+	if CurrentAuthzPolicy().IsReadable(endpoint) {
+		if !au.Can(endpoint, resource, resourceID) {
+			return 403, AuthNonReadable
 		}
-		// TODO : Check if it's authorized by inheritance
 	}
 
 	return 200, []byte("")
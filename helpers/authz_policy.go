@@ -0,0 +1,330 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package helpers
+
+import (
+	"errors"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ghodss/yaml"
+)
+
+const (
+	// AuthzAllow : effect of the rules granting access
+	AuthzAllow = "allow"
+	// AuthzDeny : effect of the rules denying access, which override
+	// any rule granting it
+	AuthzDeny = "deny"
+	// PrincipalAdmin : rules applying to admin users
+	PrincipalAdmin = "admin"
+	// PrincipalUser : rules applying to non admin users
+	PrincipalUser = "user"
+	// PrincipalAll : rules applying to every user
+	PrincipalAll = "*"
+)
+
+// Resources : all the resources authorization is checked against
+var Resources = []string{
+	"audit/list", "audit_sinks/create", "audit_sinks/delete", "audit_sinks/list", "authz/explain",
+	"builds/create", "builds/definition", "builds/get", "builds/list", "builds/mapping", "builds/promotions",
+	"custom_roles/create", "custom_roles/delete", "custom_roles/get", "custom_roles/list", "custom_roles/update",
+	"envs/clone", "envs/create", "envs/delete", "envs/diff", "envs/expiring", "envs/extend", "envs/get",
+	"envs/import", "envs/lock", "envs/locks", "envs/promote", "envs/rename", "envs/reset", "envs/resolve",
+	"envs/review", "envs/search", "envs/submission", "envs/sync", "envs/unlock", "envs/update", "envs/validate",
+	"freezes/create", "freezes/delete", "freezes/list",
+	"keys/delete", "keys/list", "keys/rotate",
+	"lockouts/delete", "lockouts/list",
+	"loggers/create", "loggers/delete", "loggers/list",
+	"notifications/add_env", "notifications/add_project", "notifications/create", "notifications/delete",
+	"notifications/get", "notifications/list", "notifications/rm_service", "notifications/update",
+	"policies/create", "policies/delete", "policies/get", "policies/list", "policies/update",
+	"projects/create", "projects/delete", "projects/get", "projects/list", "projects/rename", "projects/update",
+	"roles/create", "roles/delete", "roles/get", "roles/list",
+	"schedules/runs",
+	"sessions/list", "sessions/revoke",
+	"teams/create", "teams/delete", "teams/get", "teams/list", "teams/update",
+	"tokens/create", "tokens/delete", "tokens/list",
+	"usages/report",
+	"users/create", "users/delete", "users/get", "users/ldap_sync", "users/list", "users/mfa",
+	"users/mfa_reset", "users/revoke", "users/update",
+}
+
+// DefaultAuthzPolicy : policy used when no policy file is configured
+var DefaultAuthzPolicy = AuthzPolicy{
+	Default: AuthzAllow,
+	Licensed: []string{
+		"notifications/add_env", "notifications/add_project", "notifications/create", "notifications/delete",
+		"notifications/list", "notifications/rm_service", "notifications/update",
+		"envs/sync", "envs/resolve", "envs/submission", "envs/review",
+		"policies/create", "policies/get", "policies/delete", "policies/list", "policies/update",
+	},
+	Scoped: []string{
+		"builds/create", "builds/definition", "builds/get", "builds/list", "builds/mapping", "builds/promotions",
+		"envs/clone", "envs/delete", "envs/diff", "envs/expiring", "envs/extend", "envs/get", "envs/import",
+		"envs/lock", "envs/locks", "envs/promote", "envs/reset", "envs/resolve", "envs/review", "envs/search",
+		"envs/submission", "envs/sync", "envs/unlock", "envs/update", "envs/validate",
+		"projects/get", "projects/list", "schedules/runs",
+	},
+	Owned: []string{
+		DeleteBuild, DeleteEnv, DeleteEnvForce, UpdateEnv, DeleteProject, UpdateProject,
+		ResetBuild, SyncEnv, DeletePolicy, UpdatePolicy,
+	},
+	Readable: []string{
+		GetPolicy, GetProject, GetEnv, ListBuilds, GetBuild, DiffBuild, SubmitBuild,
+	},
+	Rules: []AuthzRule{
+		{
+			Effect:     AuthzDeny,
+			Principals: []string{PrincipalUser},
+			Resources: []string{
+				"audit/list", "audit_sinks/create", "audit_sinks/delete", "audit_sinks/list",
+				"custom_roles/create", "custom_roles/delete", "custom_roles/update", "freezes/create", "freezes/delete",
+				"keys/delete", "keys/list", "keys/rotate", "lockouts/delete", "lockouts/list",
+				"loggers/create", "loggers/delete", "loggers/list",
+				"notifications/add_env", "notifications/add_project", "notifications/create", "notifications/delete",
+				"notifications/list", "notifications/rm_service", "notifications/update",
+				"teams/create", "teams/delete", "teams/update",
+				"usages/report", "users/create", "users/delete", "users/ldap_sync", "users/mfa_reset", "roles/list",
+			},
+		},
+	},
+}
+
+var authz = struct {
+	sync.RWMutex
+	policy *AuthzPolicy
+}{policy: &DefaultAuthzPolicy}
+
+// AuthzPolicy holds the rules resources are authorized with. A request
+// is denied if any rule denies it, allowed if any rule allows it, or
+// gets the default effect otherwise
+type AuthzPolicy struct {
+	Default  string      `json:"default"`
+	Licensed []string    `json:"licensed,omitempty"`
+	Scoped   []string    `json:"scoped,omitempty"`
+	Owned    []string    `json:"owned,omitempty"`
+	Readable []string    `json:"readable,omitempty"`
+	Rules    []AuthzRule `json:"rules"`
+}
+
+// AuthzRule allows or denies a set of resources to a set of principals.
+// Resources can be matched with a trailing wildcard, as in "users/*"
+type AuthzRule struct {
+	Effect     string   `json:"effect"`
+	Principals []string `json:"principals"`
+	Resources  []string `json:"resources"`
+}
+
+// LoadAuthzPolicy : loads and validates a yaml or json policy file
+func LoadAuthzPolicy(path string) (*AuthzPolicy, error) {
+	var p AuthzPolicy
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, errors.New("Could not parse the authorization policy: " + err.Error())
+	}
+
+	// permissions are checked against the built in roles unless the
+	// policy lists its own
+	if p.Owned == nil {
+		p.Owned = DefaultAuthzPolicy.Owned
+	}
+
+	if p.Readable == nil {
+		p.Readable = DefaultAuthzPolicy.Readable
+	}
+
+	if problems := p.Validate(); len(problems) > 0 {
+		return &p, errors.New("Invalid authorization policy: " + strings.Join(problems, ", "))
+	}
+
+	return &p, nil
+}
+
+// SetAuthzPolicy : replaces the policy resources are authorized with
+func SetAuthzPolicy(p *AuthzPolicy) {
+	authz.Lock()
+	defer authz.Unlock()
+
+	authz.policy = p
+}
+
+// CurrentAuthzPolicy : returns the policy resources are authorized with
+func CurrentAuthzPolicy() *AuthzPolicy {
+	authz.RLock()
+	defer authz.RUnlock()
+
+	return authz.policy
+}
+
+// Validate : returns every problem found on the policy, such as rules
+// referencing unknown resources or permissions, or permissions that are
+// neither owned nor readable
+func (p *AuthzPolicy) Validate() []string {
+	var problems []string
+
+	if p.Default != AuthzAllow && p.Default != AuthzDeny {
+		problems = append(problems, "default must be either 'allow' or 'deny'")
+	}
+
+	for _, r := range p.Licensed {
+		problems = append(problems, resourceProblems("licensed", r)...)
+	}
+
+	for _, r := range p.Scoped {
+		problems = append(problems, resourceProblems("scoped", r)...)
+	}
+
+	for _, v := range p.Owned {
+		if !IsPermission(v) {
+			problems = append(problems, "owned references unknown permission '"+v+"'")
+		}
+	}
+
+	for _, v := range p.Readable {
+		if !IsPermission(v) {
+			problems = append(problems, "readable references unknown permission '"+v+"'")
+		}
+	}
+
+	var unlisted []string
+	for _, v := range Permissions {
+		if !contains(p.Owned, v) && !contains(p.Readable, v) {
+			unlisted = append(unlisted, v)
+		}
+	}
+
+	if len(unlisted) > 0 {
+		problems = append(problems, "owned or readable must list the permissions '"+strings.Join(unlisted, "', '")+"'")
+	}
+
+	for i, rule := range p.Rules {
+		name := "rule " + strconv.Itoa(i+1)
+
+		if rule.Effect != AuthzAllow && rule.Effect != AuthzDeny {
+			problems = append(problems, name+" effect must be either 'allow' or 'deny'")
+		}
+
+		if len(rule.Principals) == 0 {
+			problems = append(problems, name+" has no principals")
+		}
+
+		for _, v := range rule.Principals {
+			if v != PrincipalAdmin && v != PrincipalUser && v != PrincipalAll {
+				problems = append(problems, name+" references unknown principal '"+v+"'")
+			}
+		}
+
+		if len(rule.Resources) == 0 {
+			problems = append(problems, name+" has no resources")
+		}
+
+		for _, r := range rule.Resources {
+			problems = append(problems, resourceProblems(name, r)...)
+		}
+	}
+
+	return problems
+}
+
+// Allows : checks if the policy rules allow the given resource
+func (p *AuthzPolicy) Allows(admin bool, resource string) bool {
+	allowed := p.Default == AuthzAllow
+
+	for _, rule := range p.Rules {
+		if !rule.appliesTo(admin) || !matchesAny(rule.Resources, resource) {
+			continue
+		}
+
+		if rule.Effect == AuthzDeny {
+			return false
+		}
+
+		allowed = true
+	}
+
+	return allowed
+}
+
+// IsLicensed : checks if the given resource requires a license
+func (p *AuthzPolicy) IsLicensed(resource string) bool {
+	return matchesAny(p.Licensed, resource)
+}
+
+// InScope : checks if the given resource can be accessed with a scoped
+// api token
+func (p *AuthzPolicy) InScope(resource string) bool {
+	return matchesAny(p.Scoped, resource)
+}
+
+// IsOwned : checks if the given permission requires an owner role
+func (p *AuthzPolicy) IsOwned(permission string) bool {
+	return contains(p.Owned, permission)
+}
+
+// IsReadable : checks if the given permission requires a reader role
+func (p *AuthzPolicy) IsReadable(permission string) bool {
+	return contains(p.Readable, permission)
+}
+
+func (r *AuthzRule) appliesTo(admin bool) bool {
+	for _, v := range r.Principals {
+		if v == PrincipalAll || (v == PrincipalAdmin && admin) || (v == PrincipalUser && !admin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resourceProblems : checks a resource pattern matches known resources
+func resourceProblems(name, pattern string) []string {
+	for _, r := range Resources {
+		if matches(pattern, r) {
+			return nil
+		}
+	}
+
+	return []string{name + " references unknown resource '" + pattern + "'"}
+}
+
+func matchesAny(patterns []string, resource string) bool {
+	for _, p := range patterns {
+		if matches(p, resource) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matches(pattern, resource string) bool {
+	if pattern == "*" {
+		return true
+	}
+
+	if strings.HasSuffix(pattern, "/*") {
+		return strings.HasPrefix(resource, strings.TrimSuffix(pattern, "*"))
+	}
+
+	return pattern == resource
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+
+	return false
+}
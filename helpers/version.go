@@ -12,27 +12,39 @@ import (
 // RequiredCliVersion : ..
 const RequiredCliVersion string = "2.2.0"
 
-// ValidCliVersion checks to see if the client version meets minimum
-// requirements
-func ValidCliVersion(r *http.Request) error {
+// CliVersion gets the ernest cli version from the request user agent,
+// if any
+func CliVersion(r *http.Request) string {
 	for _, v := range r.Header["User-Agent"] {
 		if strings.Contains(v, "Ernest/") {
 			parts := strings.Split(v, "/")
-			ernestVersion := parts[1]
-
-			rv, err := semver.Make(RequiredCliVersion)
-			if err != nil {
-				return err
-			}
-			ev, err := semver.Make(ernestVersion)
-			if err != nil {
-				return err
-			}
-			if ev.LT(rv) {
-				err := fmt.Sprintf("Ernest CLI %s is not supported by this server.\nPlease upgrade http://docs.ernest.io/downloads/", ernestVersion)
-				return errors.New(err)
-			}
+			return parts[1]
 		}
 	}
+
+	return ""
+}
+
+// ValidCliVersion checks to see if the client version meets minimum
+// requirements
+func ValidCliVersion(r *http.Request) error {
+	ernestVersion := CliVersion(r)
+	if ernestVersion == "" {
+		return nil
+	}
+
+	rv, err := semver.Make(RequiredCliVersion)
+	if err != nil {
+		return err
+	}
+	ev, err := semver.Make(ernestVersion)
+	if err != nil {
+		return err
+	}
+	if ev.LT(rv) {
+		err := fmt.Sprintf("Ernest CLI %s is not supported by this server.\nPlease upgrade http://docs.ernest.io/downloads/", ernestVersion)
+		return errors.New(err)
+	}
+
 	return nil
 }
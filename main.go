@@ -5,10 +5,16 @@
 package main
 
 import (
+	"os"
+
 	"github.com/ernestio/api-gateway/config"
 )
 
 func main() {
+	if len(os.Args) == 3 && os.Args[1] == "validate-policy" {
+		os.Exit(config.ValidatePolicy(os.Args[2]))
+	}
+
 	config.Setup()
 	config.Route()
 }
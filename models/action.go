@@ -13,9 +13,14 @@ type Action struct {
 	ResourceType string `json:"resource_type,omitempty"`
 	Error        string `json:"error,omitempty"`
 	Options      struct {
-		Filters     []string `json:"filters,omitempty"`
-		BuildID     string   `json:"build_id,omitempty"`
-		Environment string   `json:"environment,omitempty"`
-		Resolution  string   `json:"resolution,omitempty"`
+		Filters     []string               `json:"filters,omitempty"`
+		BuildID     string                 `json:"build_id,omitempty"`
+		Environment string                 `json:"environment,omitempty"`
+		Resolution  string                 `json:"resolution,omitempty"`
+		Name        string                 `json:"name,omitempty"`
+		Project     string                 `json:"project,omitempty"`
+		Members     bool                   `json:"members,omitempty"`
+		Apply       bool                   `json:"apply,omitempty"`
+		Overrides   map[string]interface{} `json:"overrides,omitempty"`
 	} `json:"options,omitempty"`
 }
@@ -0,0 +1,195 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/sirupsen/logrus"
+)
+
+// APIToken holds a long lived personal api token. Tokens can be limited
+// to a set of projects, environments and actions, an empty list means
+// the token is not limited on that dimension
+type APIToken struct {
+	ID           int      `json:"id"`
+	TokenID      string   `json:"token_id"`
+	Name         string   `json:"name"`
+	Username     string   `json:"username"`
+	Token        string   `json:"token,omitempty"`
+	Projects     []string `json:"projects,omitempty"`
+	Environments []string `json:"environments,omitempty"`
+	Actions      []string `json:"actions,omitempty"`
+	TTL          string   `json:"ttl,omitempty"`
+	ExpiresAt    int64    `json:"expires_at,omitempty"`
+	CreatedAt    int64    `json:"created_at"`
+}
+
+// Validate : validates the api token
+func (t *APIToken) Validate() error {
+	if t.Name == "" {
+		return errors.New("Token name is empty")
+	}
+
+	if !IsAlphaNumeric(t.Name) {
+		return errors.New("Token name contains invalid characters")
+	}
+
+	for _, p := range t.Projects {
+		if !IsAlphaNumeric(p) || strings.Contains(p, EnvNameSeparator) {
+			return errors.New("Token project '" + p + "' is not valid")
+		}
+	}
+
+	for _, e := range t.Environments {
+		if !IsAlphaNumeric(e) || !strings.Contains(e, EnvNameSeparator) {
+			return errors.New("Token environment '" + e + "' is not valid, environments must be specified as 'project/environment'")
+		}
+	}
+
+	for _, a := range t.Actions {
+		if !h.IsPermission(a) {
+			return errors.New("Token action '" + a + "' is not valid")
+		}
+	}
+
+	if t.TTL != "" {
+		if _, err := time.ParseDuration(t.TTL); err != nil {
+			return errors.New("Token ttl is not a valid duration")
+		}
+	}
+
+	return nil
+}
+
+// Map : maps an api token from a request's body and validates the input
+func (t *APIToken) Map(data []byte) error {
+	if err := json.Unmarshal(data, &t); err != nil {
+		h.L.WithFields(logrus.Fields{
+			"input": string(data),
+		}).Error("Couldn't unmarshal given input")
+		return NewError(InvalidInputCode, "Invalid input")
+	}
+
+	return nil
+}
+
+// FindByUsername : Searches for all api tokens of a user
+func (t *APIToken) FindByUsername(username string, tokens *[]APIToken) (err error) {
+	query := make(map[string]interface{})
+	query["username"] = username
+	return NewBaseModel(t.getStore()).FindBy(query, tokens)
+}
+
+// FindAll : Searches for all api tokens
+func (t *APIToken) FindAll(tokens *[]APIToken) (err error) {
+	query := make(map[string]interface{})
+	return NewBaseModel(t.getStore()).FindBy(query, tokens)
+}
+
+// FindByTokenID : Gets an api token by its token id
+func (t *APIToken) FindByTokenID(id string) (err error) {
+	query := make(map[string]interface{})
+	query["token_id"] = id
+	return NewBaseModel(t.getStore()).GetBy(query, t)
+}
+
+// FindByID : Gets an api token by its id
+func (t *APIToken) FindByID(id string) (err error) {
+	query := make(map[string]interface{})
+	if query["id"], err = strconv.Atoi(id); err != nil {
+		return err
+	}
+	return NewBaseModel(t.getStore()).GetBy(query, t)
+}
+
+// Save : calls api_token.set with the marshalled current api token
+func (t *APIToken) Save() (err error) {
+	return NewBaseModel(t.getStore()).Save(t)
+}
+
+// Delete : will delete an api token by its id
+func (t *APIToken) Delete() (err error) {
+	query := make(map[string]interface{})
+	query["id"] = t.ID
+	return NewBaseModel(t.getStore()).Delete(query)
+}
+
+// DeleteByUsername : deletes all the api tokens of a user
+func (t *APIToken) DeleteByUsername(username string) error {
+	var tokens []APIToken
+
+	if err := t.FindByUsername(username, &tokens); err != nil {
+		return err
+	}
+
+	for _, v := range tokens {
+		if err := v.Delete(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// IsExpired : checks if the token has expired
+func (t *APIToken) IsExpired() bool {
+	return t.ExpiresAt > 0 && t.ExpiresAt < time.Now().Unix()
+}
+
+// IsScoped : checks if the token is limited on any dimension
+func (t *APIToken) IsScoped() bool {
+	return len(t.Projects) > 0 || len(t.Environments) > 0 || len(t.Actions) > 0
+}
+
+// Allows : checks if the token allows the given action on a resource
+func (t *APIToken) Allows(action, resourceType, resourceID string) bool {
+	if len(t.Actions) > 0 && !contains(t.Actions, action) {
+		return false
+	}
+
+	return t.Covers(resourceType, resourceID)
+}
+
+// Covers : checks if a resource is inside the token scope
+func (t *APIToken) Covers(resourceType, resourceID string) bool {
+	if len(t.Projects) == 0 && len(t.Environments) == 0 {
+		return true
+	}
+
+	switch resourceType {
+	case "project":
+		return contains(t.Projects, resourceID)
+	case "environment", "build":
+		// builds are named after their environment, as project/env/build
+		parts := strings.Split(resourceID, EnvNameSeparator)
+		env := resourceID
+		if len(parts) > 2 {
+			env = strings.Join(parts[:2], EnvNameSeparator)
+		}
+		return contains(t.Environments, env) || contains(t.Projects, parts[0])
+	}
+
+	return false
+}
+
+func (t *APIToken) getStore() string {
+	return "api_token"
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
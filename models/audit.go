@@ -0,0 +1,161 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package models
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// AuditRedacted : value replacing the sensitive fields of the audited
+// snapshots
+const AuditRedacted = "[REDACTED]"
+
+// auditSensitive : fields never written to the audit log
+var auditSensitive = map[string]bool{
+	"password":           true,
+	"oldpassword":        true,
+	"salt":               true,
+	"password_history":   true,
+	"mfa_secret":         true,
+	"mfa_recovery_codes": true,
+	"verification_code":  true,
+	"credentials":        true,
+	"token":              true,
+	"secret":             true,
+	"client_secret":      true,
+}
+
+// AuditEntry holds a record of a request changing data
+type AuditEntry struct {
+	ID           int         `json:"id"`
+	RequestID    string      `json:"request_id"`
+	Actor        string      `json:"actor"`
+	Action       string      `json:"action"`
+	ResourceType string      `json:"resource_type"`
+	ResourceID   string      `json:"resource_id,omitempty"`
+	IP           string      `json:"ip"`
+	Status       int         `json:"status"`
+	Before       interface{} `json:"before,omitempty"`
+	After        interface{} `json:"after,omitempty"`
+	Timestamp    int64       `json:"timestamp"`
+}
+
+// AuditFilter holds the filters the audit log can be queried with
+type AuditFilter struct {
+	Actor        string
+	ResourceType string
+	ResourceID   string
+	From         int64
+	To           int64
+	Page         int
+	PerPage      int
+}
+
+// AuditPage holds a page of audit entries, newest first
+type AuditPage struct {
+	Total   int          `json:"total"`
+	Page    int          `json:"page"`
+	PerPage int          `json:"per_page"`
+	Entries []AuditEntry `json:"entries"`
+}
+
+// Save : calls audit.set with the marshalled current entry
+func (a *AuditEntry) Save() (err error) {
+	return NewBaseModel(a.getStore()).Save(a)
+}
+
+// Find : Searches for the audit entries matching the given filter, and
+// returns the requested page. Filtering and paging are done by the
+// store, which returns the newest entries first
+func (a *AuditEntry) Find(f AuditFilter) (*AuditPage, error) {
+	var count struct {
+		Total int `json:"total"`
+	}
+
+	p := AuditPage{Page: f.Page, PerPage: f.PerPage, Entries: []AuditEntry{}}
+
+	query := make(map[string]interface{})
+	if f.Actor != "" {
+		query["actor"] = f.Actor
+	}
+	if f.ResourceType != "" {
+		query["resource_type"] = f.ResourceType
+	}
+	if f.ResourceID != "" {
+		query["resource_id"] = f.ResourceID
+	}
+	if f.From > 0 {
+		query["from"] = f.From
+	}
+	if f.To > 0 {
+		query["to"] = f.To
+	}
+
+	if err := NewBaseModel(a.getStore()).CallStoreBy("count", query, &count); err != nil {
+		return nil, err
+	}
+	p.Total = count.Total
+
+	query["page"] = f.Page
+	query["per_page"] = f.PerPage
+	if err := NewBaseModel(a.getStore()).FindBy(query, &p.Entries); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(p.Entries, func(i, j int) bool {
+		return p.Entries[i].Timestamp > p.Entries[j].Timestamp
+	})
+
+	return &p, nil
+}
+
+// AuditSnapshot : converts a resource into a generic document with its
+// sensitive fields redacted
+func AuditSnapshot(v interface{}) interface{} {
+	var doc interface{}
+
+	if v == nil {
+		return nil
+	}
+
+	data, ok := v.([]byte)
+	if !ok {
+		var err error
+		if data, err = json.Marshal(v); err != nil {
+			return nil
+		}
+	}
+
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil
+	}
+
+	return redactAudit(doc)
+}
+
+func redactAudit(v interface{}) interface{} {
+	switch doc := v.(type) {
+	case map[string]interface{}:
+		for k, val := range doc {
+			if auditSensitive[strings.ToLower(k)] {
+				doc[k] = AuditRedacted
+				continue
+			}
+			doc[k] = redactAudit(val)
+		}
+	case []interface{}:
+		for i, val := range doc {
+			doc[i] = redactAudit(val)
+		}
+	}
+
+	return v
+}
+
+func (a *AuditEntry) getStore() string {
+	return "audit"
+}
@@ -0,0 +1,330 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/nats-io/go-nats"
+)
+
+var (
+	// auditRetryMin : wait before retrying a failed delivery
+	auditRetryMin = 100 * time.Millisecond
+	// auditRetryMax : longest wait between delivery retries
+	auditRetryMax = 30 * time.Second
+	// auditSpoolCheck : how often idle sinks check for spooled entries
+	auditSpoolCheck = time.Second
+	// auditSpoolMu : guards the spool files shared by the sinks being
+	// replaced and their replacements
+	auditSpoolMu sync.Mutex
+)
+
+// AuditSinks : dispatcher exporting the audit entries to the configured
+// sinks
+var AuditSinks = NewAuditDispatcher(1000)
+
+// AuditDispatcher exports the audit entries to the configured sinks.
+// Every sink has its own buffer, and entries are retried until the sink
+// accepts them, so they are delivered at least once. When a sink can't
+// keep up and its buffer is full, entries are spooled to disk and
+// delivered once it catches up, so requests are never blocked by a slow
+// sink. Entries still buffered when a sink is replaced are spooled too,
+// and delivered by its replacement
+type AuditDispatcher struct {
+	BufferSize int
+	SpoolDir   string
+	mu         sync.Mutex
+	sinks      []*auditSinkWorker
+}
+
+type auditSinkWorker struct {
+	sink    AuditSink
+	writer  auditWriter
+	entries chan AuditEntry
+	done    chan struct{}
+	stopped chan struct{}
+	spool   string
+	spooled int32
+}
+
+// NewAuditDispatcher : creates a dispatcher buffering up to the given
+// number of entries per sink
+func NewAuditDispatcher(size int) *AuditDispatcher {
+	if size < 1 {
+		size = 1
+	}
+
+	return &AuditDispatcher{
+		BufferSize: size,
+		SpoolDir:   filepath.Join(os.TempDir(), "ernest-audit"),
+	}
+}
+
+// Load : loads the audit sinks from the store, replacing the current ones
+func (d *AuditDispatcher) Load() error {
+	var s AuditSink
+	var sinks []AuditSink
+
+	if err := s.FindAll(&sinks); err != nil {
+		return err
+	}
+
+	d.Set(sinks)
+
+	return nil
+}
+
+// Reload : reloads the sinks and notifies all gateway instances
+func (d *AuditDispatcher) Reload() error {
+	if err := d.Load(); err != nil {
+		return err
+	}
+
+	return N.Publish("audit_sink.changed", []byte(`{}`))
+}
+
+// Subscribe : reloads the sinks every time they are changed through any
+// gateway instance
+func (d *AuditDispatcher) Subscribe() error {
+	_, err := N.Subscribe("audit_sink.changed", func(msg *nats.Msg) {
+		if err := d.Load(); err != nil {
+			h.L.Error("Could not reload the audit sinks: " + err.Error())
+		}
+	})
+
+	return err
+}
+
+// Set : replaces the current sinks with the given ones. Entries still
+// buffered on the replaced sinks are spooled, to be delivered by the new
+// sinks of the same type
+func (d *AuditDispatcher) Set(sinks []AuditSink) {
+	var workers []*auditSinkWorker
+
+	for _, s := range sinks {
+		w, err := newAuditWriter(s)
+		if err != nil {
+			h.L.Error("Could not set up the " + s.Type + " audit sink: " + err.Error())
+			continue
+		}
+
+		workers = append(workers, &auditSinkWorker{
+			sink:    s,
+			writer:  w,
+			entries: make(chan AuditEntry, d.BufferSize),
+			done:    make(chan struct{}),
+			stopped: make(chan struct{}),
+			spool:   filepath.Join(d.SpoolDir, s.Type+".spool"),
+			spooled: 1,
+		})
+	}
+
+	d.mu.Lock()
+	old := d.sinks
+	d.sinks = workers
+	d.mu.Unlock()
+
+	for _, w := range old {
+		close(w.done)
+	}
+
+	for _, w := range old {
+		<-w.stopped
+	}
+
+	for _, w := range workers {
+		go w.run()
+	}
+}
+
+// Publish : queues an entry on every sink without blocking
+func (d *AuditDispatcher) Publish(e AuditEntry) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, w := range d.sinks {
+		w.queue(e)
+	}
+}
+
+// Close : stops all the sinks
+func (d *AuditDispatcher) Close() {
+	d.Set(nil)
+}
+
+func (w *auditSinkWorker) queue(e AuditEntry) {
+	select {
+	case w.entries <- e:
+	default:
+		// the buffer is full, keep the entry until the sink catches up
+		w.save(e)
+	}
+}
+
+func (w *auditSinkWorker) run() {
+	defer close(w.stopped)
+	defer func() {
+		if err := w.writer.Close(); err != nil {
+			h.L.Error("Could not close the " + w.sink.Type + " audit sink: " + err.Error())
+		}
+	}()
+
+	for {
+		if atomic.SwapInt32(&w.spooled, 0) == 1 && !w.drain() {
+			w.stop()
+			return
+		}
+
+		select {
+		case <-w.done:
+			w.stop()
+			return
+		case e := <-w.entries:
+			if !w.deliver(e) {
+				w.save(e)
+				w.stop()
+				return
+			}
+		case <-time.After(auditSpoolCheck):
+		}
+	}
+}
+
+// deliver : writes an entry, retrying until it succeeds or the sink is
+// stopped
+func (w *auditSinkWorker) deliver(e AuditEntry) bool {
+	wait := auditRetryMin
+
+	for {
+		err := w.writer.Write(e)
+		if err == nil {
+			return true
+		}
+
+		h.L.Error("Could not export the audit entry to the " + w.sink.Type + " sink: " + err.Error())
+
+		select {
+		case <-w.done:
+			return false
+		case <-time.After(wait):
+		}
+
+		if wait *= 2; wait > auditRetryMax {
+			wait = auditRetryMax
+		}
+	}
+}
+
+// stop : spools the entries still buffered
+func (w *auditSinkWorker) stop() {
+	for {
+		select {
+		case e := <-w.entries:
+			w.save(e)
+		default:
+			return
+		}
+	}
+}
+
+// save : appends an entry to the sink spool
+func (w *auditSinkWorker) save(e AuditEntry) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	auditSpoolMu.Lock()
+	err = appendSpool(w.spool, append(data, '\n'))
+	auditSpoolMu.Unlock()
+
+	if err != nil {
+		h.L.Error("Could not spool the audit entry for the " + w.sink.Type + " sink, it is dropped: " + err.Error())
+		return
+	}
+
+	atomic.StoreInt32(&w.spooled, 1)
+}
+
+// drain : delivers the spooled entries. The spool is only removed once
+// they are all delivered, so entries are never lost if the gateway stops
+// half way. Returns false if the sink was stopped before
+func (w *auditSinkWorker) drain() bool {
+	draining := w.spool + ".draining"
+
+	auditSpoolMu.Lock()
+	if _, err := os.Stat(draining); os.IsNotExist(err) {
+		if err = os.Rename(w.spool, draining); err != nil {
+			auditSpoolMu.Unlock()
+			return true
+		}
+	}
+	data, err := ioutil.ReadFile(draining)
+	auditSpoolMu.Unlock()
+
+	if err != nil {
+		h.L.Error("Could not read the " + w.sink.Type + " audit sink spool: " + err.Error())
+		return true
+	}
+
+	lines := bytes.Split(data, []byte("\n"))
+	for i, line := range lines {
+		var e AuditEntry
+
+		if len(line) == 0 || json.Unmarshal(line, &e) != nil {
+			continue
+		}
+
+		if !w.deliver(e) {
+			// keep the entries left for the next sink of this type
+			auditSpoolMu.Lock()
+			err = appendSpool(w.spool, bytes.Join(lines[i:], []byte("\n")))
+			if err == nil {
+				err = os.Remove(draining)
+			}
+			auditSpoolMu.Unlock()
+			if err != nil {
+				h.L.Error("Could not spool the audit entries left for the " + w.sink.Type + " sink: " + err.Error())
+			}
+			return false
+		}
+	}
+
+	auditSpoolMu.Lock()
+	err = os.Remove(draining)
+	auditSpoolMu.Unlock()
+	if err != nil {
+		h.L.Error("Could not remove the " + w.sink.Type + " audit sink spool: " + err.Error())
+	}
+
+	return true
+}
+
+func appendSpool(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err = f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
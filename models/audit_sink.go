@@ -0,0 +1,100 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package models
+
+import (
+	"encoding/json"
+	"errors"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// AuditSinkFile : writes the audit entries as json lines on a rotating file
+	AuditSinkFile = "file"
+	// AuditSinkSyslog : sends the audit entries as RFC 5424 syslog messages
+	AuditSinkSyslog = "syslog"
+	// AuditSinkNats : publishes the audit entries on a nats subject
+	AuditSinkNats = "nats"
+)
+
+// AuditSink holds the configuration of a destination audit entries are
+// exported to
+type AuditSink struct {
+	Type     string `json:"type"`
+	Logfile  string `json:"logfile,omitempty"`
+	MaxSize  int    `json:"max_size,omitempty"`
+	MaxFiles int    `json:"max_files,omitempty"`
+	Hostname string `json:"hostname,omitempty"`
+	Port     int    `json:"port,omitempty"`
+	Protocol string `json:"protocol,omitempty"`
+	AppName  string `json:"app_name,omitempty"`
+	Subject  string `json:"subject,omitempty"`
+}
+
+// Validate : validates the audit sink
+func (s *AuditSink) Validate() error {
+	switch s.Type {
+	case AuditSinkFile:
+		if s.Logfile == "" {
+			return errors.New("Audit sink logfile is empty")
+		}
+		if s.MaxSize < 0 || s.MaxFiles < 0 {
+			return errors.New("Audit sink rotation settings can't be negative")
+		}
+	case AuditSinkSyslog:
+		if s.Hostname == "" || s.Port < 1 {
+			return errors.New("Audit sink hostname and port are required")
+		}
+		if s.Protocol != "" && s.Protocol != "udp" && s.Protocol != "tcp" {
+			return errors.New("Audit sink protocol must be udp or tcp")
+		}
+	case AuditSinkNats:
+		if s.Subject == "" {
+			return errors.New("Audit sink subject is empty")
+		}
+	case "":
+		return errors.New("Audit sink type is empty")
+	default:
+		return errors.New("Audit sink type must be file, syslog or nats")
+	}
+
+	return nil
+}
+
+// Map : maps an audit sink from a request's body
+func (s *AuditSink) Map(data []byte) error {
+	if err := json.Unmarshal(data, &s); err != nil {
+		h.L.WithFields(logrus.Fields{
+			"input": string(data),
+		}).Error("Couldn't unmarshal given input")
+		return NewError(InvalidInputCode, "Invalid input")
+	}
+
+	return nil
+}
+
+// FindAll : Searches for all audit sinks on the system
+func (s *AuditSink) FindAll(sinks *[]AuditSink) (err error) {
+	query := make(map[string]interface{})
+	return NewBaseModel(s.getStore()).FindBy(query, sinks)
+}
+
+// Save : calls audit_sink.set with the marshalled current sink
+func (s *AuditSink) Save() (err error) {
+	return NewBaseModel(s.getStore()).Save(s)
+}
+
+// Delete : will delete an audit sink by its type
+func (s *AuditSink) Delete(sink string) (err error) {
+	query := make(map[string]interface{})
+	query["type"] = sink
+	return NewBaseModel(s.getStore()).Delete(query)
+}
+
+func (s *AuditSink) getStore() string {
+	return "audit_sink"
+}
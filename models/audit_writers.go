@@ -0,0 +1,269 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// auditDefaultMaxSize : size in megabytes audit files are rotated at
+	auditDefaultMaxSize = 100
+	// auditDefaultMaxFiles : rotated audit files kept
+	auditDefaultMaxFiles = 5
+	// auditSyslogFacility : log audit facility, as defined by RFC 5424
+	auditSyslogFacility = 13
+	// auditSyslogEnterpriseID : private enterprise number used for the
+	// structured data id
+	auditSyslogEnterpriseID = "32473"
+)
+
+// auditWriter writes audit entries to a sink
+type auditWriter interface {
+	Write(e AuditEntry) error
+	Close() error
+}
+
+func newAuditWriter(s AuditSink) (auditWriter, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+
+	switch s.Type {
+	case AuditSinkFile:
+		return newAuditFileWriter(s), nil
+	case AuditSinkSyslog:
+		return newAuditSyslogWriter(s), nil
+	default:
+		return &auditNatsWriter{subject: s.Subject}, nil
+	}
+}
+
+// auditFileWriter appends the entries as json lines, rotating the file
+// when it grows over its max size
+type auditFileWriter struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+	file     *os.File
+	size     int64
+}
+
+func newAuditFileWriter(s AuditSink) *auditFileWriter {
+	w := auditFileWriter{
+		path:     s.Logfile,
+		maxSize:  int64(s.MaxSize) * 1024 * 1024,
+		maxFiles: s.MaxFiles,
+	}
+
+	if w.maxSize == 0 {
+		w.maxSize = auditDefaultMaxSize * 1024 * 1024
+	}
+	if w.maxFiles == 0 {
+		w.maxFiles = auditDefaultMaxFiles
+	}
+
+	return &w
+}
+
+func (w *auditFileWriter) Write(e AuditEntry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	if w.file == nil {
+		if err = w.open(); err != nil {
+			return err
+		}
+	}
+
+	if w.size > 0 && w.size+int64(len(line)) > w.maxSize {
+		if err = w.rotate(); err != nil {
+			return err
+		}
+		if err = w.open(); err != nil {
+			return err
+		}
+	}
+
+	n, err := w.file.Write(line)
+	w.size += int64(n)
+	if err != nil {
+		return err
+	}
+
+	return w.file.Sync()
+}
+
+func (w *auditFileWriter) open() error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	w.file = f
+	w.size = info.Size()
+
+	return nil
+}
+
+// rotate : renames the current file to path.1, shifting the older ones
+// and removing the ones over the max files
+func (w *auditFileWriter) rotate() error {
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	_ = os.Remove(w.path + "." + strconv.Itoa(w.maxFiles))
+	for i := w.maxFiles - 1; i > 0; i-- {
+		_ = os.Rename(w.path+"."+strconv.Itoa(i), w.path+"."+strconv.Itoa(i+1))
+	}
+
+	return os.Rename(w.path, w.path+".1")
+}
+
+func (w *auditFileWriter) Close() error {
+	if w.file == nil {
+		return nil
+	}
+
+	err := w.file.Close()
+	w.file = nil
+	w.size = 0
+
+	return err
+}
+
+// auditSyslogWriter sends the entries as RFC 5424 messages, framed with
+// octet counting over tcp
+type auditSyslogWriter struct {
+	protocol string
+	address  string
+	appName  string
+	hostname string
+	conn     net.Conn
+}
+
+func newAuditSyslogWriter(s AuditSink) *auditSyslogWriter {
+	w := auditSyslogWriter{
+		protocol: s.Protocol,
+		address:  net.JoinHostPort(s.Hostname, strconv.Itoa(s.Port)),
+		appName:  s.AppName,
+	}
+
+	if w.protocol == "" {
+		w.protocol = "udp"
+	}
+	if w.appName == "" {
+		w.appName = "api-gateway"
+	}
+	if w.hostname, _ = os.Hostname(); w.hostname == "" {
+		w.hostname = "-"
+	}
+
+	return &w
+}
+
+func (w *auditSyslogWriter) Write(e AuditEntry) error {
+	msg, err := w.format(e)
+	if err != nil {
+		return err
+	}
+
+	if w.conn == nil {
+		if w.conn, err = net.DialTimeout(w.protocol, w.address, 5*time.Second); err != nil {
+			w.conn = nil
+			return err
+		}
+	}
+
+	if w.protocol == "tcp" {
+		msg = strconv.Itoa(len(msg)) + " " + msg
+	}
+
+	_ = w.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	if _, err = w.conn.Write([]byte(msg)); err != nil {
+		_ = w.Close()
+		return err
+	}
+
+	return nil
+}
+
+// format : formats the entry as a RFC 5424 message, with the entry
+// fields as structured data and the entry itself as message
+func (w *auditSyslogWriter) format(e AuditEntry) (string, error) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+
+	// informational, or warning for the failed requests
+	severity := 6
+	if e.Status >= 400 {
+		severity = 4
+	}
+
+	sd := fmt.Sprintf(`[audit@%s requestId="%s" actor="%s" action="%s" resourceType="%s" resourceId="%s" ip="%s" status="%d"]`,
+		auditSyslogEnterpriseID, sdEscape(e.RequestID), sdEscape(e.Actor), sdEscape(e.Action),
+		sdEscape(e.ResourceType), sdEscape(e.ResourceID), sdEscape(e.IP), e.Status)
+
+	return fmt.Sprintf("<%d>1 %s %s %s %d audit %s %s",
+		auditSyslogFacility*8+severity, time.Unix(e.Timestamp, 0).UTC().Format(time.RFC3339),
+		w.hostname, w.appName, os.Getpid(), sd, body), nil
+}
+
+func (w *auditSyslogWriter) Close() error {
+	if w.conn == nil {
+		return nil
+	}
+
+	err := w.conn.Close()
+	w.conn = nil
+
+	return err
+}
+
+// sdEscape : escapes a structured data param value
+func sdEscape(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(v)
+}
+
+// auditNatsWriter publishes the entries on a nats subject
+type auditNatsWriter struct {
+	subject string
+}
+
+func (w *auditNatsWriter) Write(e AuditEntry) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	if N == nil {
+		return errors.New("Not connected to nats")
+	}
+
+	return N.Publish(w.subject, body)
+}
+
+func (w *auditNatsWriter) Close() error {
+	return nil
+}
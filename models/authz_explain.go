@@ -0,0 +1,195 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package models
+
+import (
+	"encoding/json"
+	"strings"
+
+	h "github.com/ernestio/api-gateway/helpers"
+)
+
+const (
+	// ExplainAdmin : step checking the admin flag of the user
+	ExplainAdmin = "admin"
+	// ExplainLicense : step checking the resource is licensed
+	ExplainLicense = "license"
+	// ExplainScope : step checking the api token scope
+	ExplainScope = "scope"
+	// ExplainPolicy : step checking the authorization policy
+	ExplainPolicy = "policy"
+	// ExplainRole : step checking a role on the resource itself
+	ExplainRole = "role"
+	// ExplainInheritedRole : step checking a role inherited from the
+	// project of the resource
+	ExplainInheritedRole = "inherited_role"
+	// ExplainNoMatch : step reached when no role applies
+	ExplainNoMatch = "no_match"
+)
+
+// AuthzExplanation holds an authorization decision and the chain of
+// checks that produced it
+type AuthzExplanation struct {
+	User         string      `json:"user"`
+	Endpoint     string      `json:"endpoint"`
+	ResourceType string      `json:"resource_type,omitempty"`
+	ResourceID   string      `json:"resource_id,omitempty"`
+	Decision     string      `json:"decision"`
+	Status       int         `json:"status"`
+	Message      string      `json:"message,omitempty"`
+	Chain        []AuthzStep `json:"chain"`
+}
+
+// AuthzStep holds a check taken to reach an authorization decision
+type AuthzStep struct {
+	Check  string `json:"check"`
+	Result string `json:"result,omitempty"`
+	Detail string `json:"detail"`
+	Roles  []Role `json:"roles,omitempty"`
+}
+
+// ExplainAuthorization : explains how the user is authorized on an api
+// resource, such as "envs/sync", or on a permission over a specific
+// resource, such as "sync_env" on an environment
+func ExplainAuthorization(u *User, endpoint, resourceType, resourceID string) *AuthzExplanation {
+	var st int
+	var res []byte
+
+	e := AuthzExplanation{
+		User:         u.Username,
+		Endpoint:     endpoint,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Chain:        []AuthzStep{},
+	}
+
+	// the decision always comes from the checks requests go through, so
+	// the chain can never disagree with it
+	if h.IsPermission(endpoint) {
+		st, res = h.IsAuthorizedToResource(u, endpoint, resourceType, resourceID)
+		e.explainPermission(u)
+	} else {
+		st, res = h.IsAuthorized(u, endpoint)
+		e.explainResource(u)
+	}
+
+	e.Status = st
+	e.Decision = h.AuthzAllow
+	if st != 200 {
+		e.Decision = h.AuthzDeny
+
+		var msg map[string]string
+		if err := json.Unmarshal(res, &msg); err == nil {
+			e.Message = msg["message"]
+		}
+	}
+
+	return &e
+}
+
+// explainResource : follows the checks of an api resource
+func (e *AuthzExplanation) explainResource(u *User) {
+	p := h.CurrentAuthzPolicy()
+
+	if p.IsLicensed(e.Endpoint) {
+		if err := h.Licensed(); err != nil {
+			e.add(ExplainLicense, h.AuthzDeny, "Resource requires the enterprise edition", nil)
+			return
+		}
+		e.add(ExplainLicense, h.AuthzAllow, "Resource requires the enterprise edition, which is running", nil)
+	}
+
+	if u.IsScoped() && !p.InScope(e.Endpoint) {
+		e.add(ExplainScope, h.AuthzDeny, "Resource can't be called with a scoped api token", nil)
+		return
+	}
+
+	e.add(ExplainAdmin, "", adminDetail(u), nil)
+
+	if p.Allows(u.IsAdmin(), e.Endpoint) {
+		e.add(ExplainPolicy, h.AuthzAllow, "Authorization policy allows the resource", nil)
+	} else {
+		e.add(ExplainPolicy, h.AuthzDeny, "Authorization policy denies the resource", nil)
+	}
+}
+
+// explainPermission : follows the checks of a permission on a resource
+func (e *AuthzExplanation) explainPermission(u *User) {
+	p := h.CurrentAuthzPolicy()
+
+	if !u.InScope(e.Endpoint, e.ResourceType, e.ResourceID) {
+		e.add(ExplainScope, h.AuthzDeny, "Resource is out of the api token scope", nil)
+		return
+	}
+
+	if !p.IsOwned(e.Endpoint) && !p.IsReadable(e.Endpoint) {
+		e.add(ExplainPolicy, h.AuthzAllow, "Permission doesn't require any role", nil)
+		return
+	}
+
+	if u.IsAdmin() {
+		e.add(ExplainAdmin, h.AuthzAllow, adminDetail(u), nil)
+		return
+	}
+	e.add(ExplainAdmin, "", adminDetail(u), nil)
+
+	res := u.ResolveRoles(e.ResourceType, e.ResourceID)
+	if len(res.Roles) == 0 {
+		e.add(ExplainNoMatch, h.AuthzDeny, "No role on "+e.ResourceType+" "+e.ResourceID+" or its parents", nil)
+		return
+	}
+
+	check := ExplainRole
+	detail := "Role on " + e.ResourceType + " " + e.ResourceID
+	if res.Inherited {
+		check = ExplainInheritedRole
+		detail = "Role inherited from " + joinResources(res.Resources)
+	}
+
+	if res.Denied {
+		e.add(check, h.AuthzDeny, "Deny grant on "+joinResources(res.Resources)+" stops every other role", res.Roles)
+		return
+	}
+
+	e.addRoles(check, detail, res.Roles)
+}
+
+func (e *AuthzExplanation) addRoles(check, detail string, roles []Role) {
+	for _, r := range roles {
+		if RoleGrants(r.Role, e.Endpoint) {
+			e.add(check, h.AuthzAllow, detail+" grants "+e.Endpoint, roles)
+			return
+		}
+	}
+
+	e.add(check, h.AuthzDeny, detail+" doesn't grant "+e.Endpoint, roles)
+}
+
+func (e *AuthzExplanation) add(check, result, detail string, roles []Role) {
+	e.Chain = append(e.Chain, AuthzStep{
+		Check:  check,
+		Result: result,
+		Detail: detail,
+		Roles:  roles,
+	})
+}
+
+func joinResources(resources []ResourceRef) string {
+	var names []string
+
+	for _, r := range resources {
+		names = append(names, r.String())
+	}
+
+	return strings.Join(names, ", ")
+}
+
+func adminDetail(u *User) string {
+	if u.IsAdmin() {
+		return "User is an admin"
+	}
+
+	return "User is not an admin"
+}
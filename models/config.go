@@ -2,8 +2,14 @@ package models
 
 import (
 	"errors"
+	"net"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
+
+	h "github.com/ernestio/api-gateway/helpers"
 )
 
 // Config : TODO
@@ -43,3 +49,131 @@ func (c *Config) GetNatsURI() string {
 func (c *Config) GetServerPort() (token string) {
 	return "8080"
 }
+
+// GetAccessTokenTTL : Gets the lifetime of the issued access tokens
+func (c *Config) GetAccessTokenTTL() time.Duration {
+	return c.getDuration("JWT_ACCESS_TTL", 15*time.Minute)
+}
+
+// GetRefreshTokenTTL : Gets the lifetime of the issued refresh tokens
+func (c *Config) GetRefreshTokenTTL() time.Duration {
+	return c.getDuration("JWT_REFRESH_TTL", 24*time.Hour)
+}
+
+// GetPasswordResetTTL : Gets the lifetime of password reset tokens
+func (c *Config) GetPasswordResetTTL() time.Duration {
+	return c.getDuration("PASSWORD_RESET_TTL", time.Hour)
+}
+
+// GetPasswordResetURL : Gets the url password reset tokens are sent
+// on, as a format string taking the token
+func (c *Config) GetPasswordResetURL() string {
+	return os.Getenv("PASSWORD_RESET_URL")
+}
+
+// GetRoleSweepInterval : Gets how often expired roles are deleted
+func (c *Config) GetRoleSweepInterval() time.Duration {
+	return c.getDuration("ROLE_SWEEP_INTERVAL", time.Minute)
+}
+
+// GetAuditBufferSize : Gets how many audit entries are buffered per sink
+func (c *Config) GetAuditBufferSize() int {
+	return c.getInt("AUDIT_BUFFER_SIZE", 1000)
+}
+
+// GetAuditSpoolDir : Gets where audit entries are spooled while their
+// sinks can't keep up
+func (c *Config) GetAuditSpoolDir() string {
+	if dir := os.Getenv("AUDIT_SPOOL_DIR"); dir != "" {
+		return dir
+	}
+
+	return filepath.Join(os.TempDir(), "ernest-audit")
+}
+
+// GetSchedulerInterval : Gets how often environment schedules are checked
+func (c *Config) GetSchedulerInterval() time.Duration {
+	return c.getDuration("SCHEDULER_INTERVAL", time.Minute)
+}
+
+// GetExpiryWarning : Gets how long before expiring the owners of an
+// environment are warned
+func (c *Config) GetExpiryWarning() time.Duration {
+	return c.getDuration("EXPIRY_WARNING", 72*time.Hour)
+}
+
+// GetOIDCCacheTTL : gets how long the OIDC provider metadata and
+// signing keys are cached
+func (c *Config) GetOIDCCacheTTL() time.Duration {
+	return c.getDuration("OIDC_CACHE_TTL", time.Hour)
+}
+
+// GetSigningAlgorithm : Gets the algorithm new signing keys are
+// generated with
+func (c *Config) GetSigningAlgorithm() string {
+	if alg := os.Getenv("JWT_SIGNING_ALG"); alg != "" {
+		return alg
+	}
+
+	return "HS256"
+}
+
+// GetTrustedProxies : Gets the addresses of the proxies trusted to
+// forward the client ip, as a comma separated list of ips or cidrs
+func (c *Config) GetTrustedProxies() ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+
+	for _, v := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+
+		if !strings.Contains(v, "/") {
+			if ip := net.ParseIP(v); ip != nil && ip.To4() != nil {
+				v = v + "/32"
+			} else {
+				v = v + "/128"
+			}
+		}
+
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, errors.New("Invalid trusted proxy '" + v + "'")
+		}
+
+		proxies = append(proxies, n)
+	}
+
+	return proxies, nil
+}
+
+func (c *Config) getDuration(key string, def time.Duration) time.Duration {
+	val := os.Getenv(key)
+	if val == "" {
+		return def
+	}
+
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		h.L.Warning("Invalid duration for " + key + ", using " + def.String())
+		return def
+	}
+
+	return d
+}
+
+func (c *Config) getInt(key string, def int) int {
+	val := os.Getenv(key)
+	if val == "" {
+		return def
+	}
+
+	i, err := strconv.Atoi(val)
+	if err != nil || i < 1 {
+		h.L.Warning("Invalid value for " + key + ", using " + strconv.Itoa(def))
+		return def
+	}
+
+	return i
+}
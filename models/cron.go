@@ -0,0 +1,185 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package models
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronMacros : shortcuts for the most common expressions
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var cronMonths = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+var cronDays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// Cron holds a parsed cron expression, with minute, hour, day of month,
+// month and day of week fields, evaluated on a time zone
+type Cron struct {
+	minutes  uint64
+	hours    uint64
+	days     uint64
+	months   uint64
+	weekdays uint64
+	anyDay   bool
+	anyWday  bool
+	location *time.Location
+}
+
+// ParseCron : parses a cron expression for the given time zone, UTC if
+// empty
+func ParseCron(expr, timezone string) (*Cron, error) {
+	var c Cron
+	var err error
+
+	if c.location, err = time.LoadLocation(timezone); err != nil {
+		return nil, errors.New("Unknown time zone " + timezone)
+	}
+
+	if m, ok := cronMacros[strings.TrimSpace(expr)]; ok {
+		expr = m
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, errors.New("Cron expression must have 5 fields")
+	}
+
+	if c.minutes, err = cronField(fields[0], 0, 59, nil); err != nil {
+		return nil, err
+	}
+	if c.hours, err = cronField(fields[1], 0, 23, nil); err != nil {
+		return nil, err
+	}
+	if c.days, err = cronField(fields[2], 1, 31, nil); err != nil {
+		return nil, err
+	}
+	if c.months, err = cronField(fields[3], 1, 12, cronMonths); err != nil {
+		return nil, err
+	}
+	if c.weekdays, err = cronField(fields[4], 0, 7, cronDays); err != nil {
+		return nil, err
+	}
+
+	// sunday can be both 0 and 7
+	if c.weekdays&(1<<7) != 0 {
+		c.weekdays |= 1
+	}
+
+	c.anyDay = fields[2] == "*"
+	c.anyWday = fields[4] == "*"
+
+	return &c, nil
+}
+
+// Matches : checks if the expression matches the minute of the given time
+func (c *Cron) Matches(t time.Time) bool {
+	t = t.In(c.location)
+
+	if c.minutes&(1<<uint(t.Minute())) == 0 || c.hours&(1<<uint(t.Hour())) == 0 || c.months&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+
+	day := c.days&(1<<uint(t.Day())) != 0
+	wday := c.weekdays&(1<<uint(t.Weekday())) != 0
+
+	// when both days are restricted, matching any of them is enough
+	if !c.anyDay && !c.anyWday {
+		return day || wday
+	}
+
+	return day && wday
+}
+
+// Next : gets the first time after the given one matching the expression,
+// looking up to a year ahead
+func (c *Cron) Next(after time.Time) (time.Time, bool) {
+	return c.NextUntil(after, after.AddDate(1, 0, 1))
+}
+
+// NextUntil : gets the first time after the given one matching the
+// expression, looking up to until
+func (c *Cron) NextUntil(after, until time.Time) (time.Time, bool) {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+
+	for ; !t.After(until); t = t.Add(time.Minute) {
+		if c.Matches(t) {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// cronField : parses a list of values, ranges and steps into a bit set
+func cronField(field string, min, max int, names []string) (uint64, error) {
+	var set uint64
+
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			s, err := strconv.Atoi(part[i+1:])
+			if err != nil || s < 1 {
+				return 0, errors.New("Invalid cron step " + part)
+			}
+			step = s
+			part = part[:i]
+		}
+
+		from, to := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+
+			var err error
+			if from, err = cronValue(bounds[0], names, min); err != nil {
+				return 0, err
+			}
+
+			to = from
+			if len(bounds) == 2 {
+				if to, err = cronValue(bounds[1], names, min); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				to = max
+			}
+		}
+
+		if from < min || to > max || from > to {
+			return 0, errors.New("Cron value out of range " + field)
+		}
+
+		for v := from; v <= to; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+
+	return set, nil
+}
+
+func cronValue(v string, names []string, min int) (int, error) {
+	for i, name := range names {
+		if strings.EqualFold(v, name) {
+			return i + min, nil
+		}
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, errors.New("Invalid cron value " + v)
+	}
+
+	return n, nil
+}
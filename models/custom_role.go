@@ -0,0 +1,150 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package models
+
+import (
+	"encoding/json"
+	"errors"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// OwnerRole : built in role granting every permission
+	OwnerRole = "owner"
+	// ReaderRole : built in role granting read only permissions
+	ReaderRole = "reader"
+	// DenyRole : built in role granting nothing, which stops any role
+	// being inherited from the parents of the resource
+	DenyRole = "deny"
+)
+
+// BuiltinRoles : permissions granted by the built in roles
+var BuiltinRoles = map[string][]string{
+	OwnerRole:  h.OwnerPermissions,
+	ReaderRole: h.ReaderPermissions,
+	DenyRole:   []string{},
+}
+
+// CustomRole holds an admin defined role, granting a set of permissions
+// on the resources it is assigned on
+type CustomRole struct {
+	ID          int      `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Permissions []string `json:"permissions"`
+}
+
+// Validate : validates the custom role
+func (r *CustomRole) Validate() error {
+	if r.Name == "" {
+		return errors.New("Role name is empty")
+	}
+
+	if !IsAlphaNumeric(r.Name) {
+		return errors.New("Role name contains invalid characters")
+	}
+
+	if _, ok := BuiltinRoles[r.Name]; ok {
+		return errors.New("Role '" + r.Name + "' is a built in role")
+	}
+
+	if len(r.Permissions) == 0 {
+		return errors.New("Role must grant at least one permission")
+	}
+
+	for _, p := range r.Permissions {
+		if !h.IsPermission(p) {
+			return errors.New("Role permission '" + p + "' is not valid")
+		}
+	}
+
+	return nil
+}
+
+// Map : maps a custom role from a request's body and validates the input
+func (r *CustomRole) Map(data []byte) error {
+	if err := json.Unmarshal(data, &r); err != nil {
+		h.L.WithFields(logrus.Fields{
+			"input": string(data),
+		}).Error("Couldn't unmarshal given input")
+		return NewError(InvalidInputCode, "Invalid input")
+	}
+
+	return nil
+}
+
+// FindAll : Searches for all custom roles on the system
+func (r *CustomRole) FindAll(roles *[]CustomRole) (err error) {
+	query := make(map[string]interface{})
+	return NewBaseModel(r.getStore()).FindBy(query, roles)
+}
+
+// FindByName : Gets a custom role by its name
+func (r *CustomRole) FindByName(name string) (err error) {
+	query := make(map[string]interface{})
+	query["name"] = name
+	return NewBaseModel(r.getStore()).GetBy(query, r)
+}
+
+// Save : calls custom_role.set with the marshalled current custom role
+func (r *CustomRole) Save() (err error) {
+	return NewBaseModel(r.getStore()).Save(r)
+}
+
+// Delete : will delete a custom role by its id
+func (r *CustomRole) Delete() (err error) {
+	query := make(map[string]interface{})
+	query["id"] = r.ID
+	return NewBaseModel(r.getStore()).Delete(query)
+}
+
+// Grants : checks if the custom role grants the given permission
+func (r *CustomRole) Grants(permission string) bool {
+	for _, p := range r.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *CustomRole) getStore() string {
+	return "custom_role"
+}
+
+// RoleExists : checks if the given role name is a built in or a custom
+// role
+func RoleExists(name string) bool {
+	var r CustomRole
+
+	if _, ok := BuiltinRoles[name]; ok {
+		return true
+	}
+
+	return r.FindByName(name) == nil
+}
+
+// RoleGrants : checks if the given role grants the given permission
+func RoleGrants(name, permission string) bool {
+	var r CustomRole
+
+	if permissions, ok := BuiltinRoles[name]; ok {
+		for _, p := range permissions {
+			if p == permission {
+				return true
+			}
+		}
+		return false
+	}
+
+	if err := r.FindByName(name); err != nil {
+		return false
+	}
+
+	return r.Grants(permission)
+}
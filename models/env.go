@@ -28,9 +28,12 @@ type Env struct {
 	Status      string                 `json:"status"`
 	Options     map[string]interface{} `json:"options,omitempty"`
 	Schedules   map[string]interface{} `json:"schedules,omitempty"`
+	TTL         string                 `json:"ttl,omitempty"`
+	ExpiresAt   int64                  `json:"expires_at,omitempty"`
 	Credentials map[string]interface{} `json:"credentials,omitempty"`
 	Builds      []Build                `json:"builds,omitempty"`
 	Members     []Role                 `json:"members,omitempty"`
+	TeamMembers []Role                 `json:"team_members,omitempty"`
 	CreatedAt   string                 `json:"created_at,omitempty"`
 	UpdatedAt   string                 `json:"updated_at,omitempty"`
 }
@@ -170,6 +173,53 @@ func (e *Env) RequestSync(au User) (string, error) {
 	return r.ID, nil
 }
 
+// RequestScheduledSync : calls environment.sync with the resolution to
+// apply if any change is found
+func (e *Env) RequestScheduledSync(au User, resolution string) (string, error) {
+	if resolution == "" {
+		return e.RequestSync(au)
+	}
+
+	return e.resolution(au, e.getStore()+".sync", resolution)
+}
+
+// RequestPower : calls environment.power_on or environment.power_off
+// for the given instance groups, or all of them if none given
+func (e *Env) RequestPower(au User, action string, instances []string) (string, error) {
+	req := map[string]interface{}{
+		"name":      e.Name,
+		"user_id":   au.ID,
+		"username":  au.Username,
+		"instances": instances,
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := N.Request(e.getStore()+"."+action, data, time.Second*5)
+	if err != nil {
+		h.L.Error(err.Error())
+		return "", err
+	}
+
+	var r struct {
+		ID    string `json:"id"`
+		Error string `json:"_error"`
+	}
+
+	if err = json.Unmarshal(resp.Data, &r); err != nil {
+		return "", err
+	}
+
+	if r.Error != "" {
+		return r.ID, errors.New(r.Error)
+	}
+
+	return r.ID, nil
+}
+
 // RequestResolve : calls environment.resolve with the given raw message
 func (e *Env) RequestResolve(au User, resolution string) (string, error) {
 	return e.resolution(au, e.getStore()+".resolve", resolution)
@@ -0,0 +1,174 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package models
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// ExpiryWarning : schedule name the expiry warnings are run with
+	ExpiryWarning = "expiry-warning"
+	// ExpiryDestroy : schedule name the expiry destroys are run with
+	ExpiryDestroy = "expiry"
+	// ScheduleWarn : warns the environment owners it is about to expire
+	ScheduleWarn = "warn"
+)
+
+// ParseTTL : parses a time to live, either as a go duration or as a
+// number of days, as in "7d"
+func ParseTTL(ttl string) (time.Duration, error) {
+	var d time.Duration
+	var err error
+
+	if strings.HasSuffix(ttl, "d") {
+		var days int
+		days, err = strconv.Atoi(strings.TrimSuffix(ttl, "d"))
+		d = time.Duration(days) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(ttl)
+	}
+
+	if err != nil || d < 0 {
+		return 0, errors.New("Environment ttl is not a valid duration")
+	}
+
+	return d, nil
+}
+
+// SetExpiry : sets when the environment expires from its ttl. A ttl of
+// zero removes the expiry
+func (e *Env) SetExpiry(now time.Time) error {
+	if e.TTL == "" {
+		if e.ExpiresAt != 0 && e.ExpiresAt <= now.Unix() {
+			return errors.New("Environment expires_at must be in the future")
+		}
+		return nil
+	}
+
+	d, err := ParseTTL(e.TTL)
+	if err != nil {
+		return err
+	}
+
+	e.ExpiresAt = 0
+	if d > 0 {
+		e.ExpiresAt = now.Add(d).Unix()
+	} else {
+		e.TTL = ""
+	}
+
+	return nil
+}
+
+// Extend : pushes the environment expiry back, counting from now if it
+// has already expired
+func (e *Env) Extend(now time.Time, d time.Duration) {
+	from := now.Unix()
+	if e.ExpiresAt > from {
+		from = e.ExpiresAt
+	}
+
+	e.ExpiresAt = from + int64(d/time.Second)
+}
+
+// IsExpired : checks if the environment has expired
+func (e *Env) IsExpired(now time.Time) bool {
+	return e.ExpiresAt != 0 && e.ExpiresAt <= now.Unix()
+}
+
+// ExpiresWithin : checks if the environment expires in the given period
+func (e *Env) ExpiresWithin(now time.Time, d time.Duration) bool {
+	return e.ExpiresAt != 0 && e.ExpiresAt <= now.Add(d).Unix()
+}
+
+// Owners : gets the principals owning the environment, directly or
+// through its project
+func (e *Env) Owners() ([]string, error) {
+	var r Role
+	var roles []Role
+	var owners []string
+
+	if err := r.FindAllByResource(e.GetProject(), "project", &roles); err != nil {
+		return nil, err
+	}
+
+	var envRoles []Role
+	if err := r.FindAllByResource(e.GetID(), e.GetType(), &envRoles); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for _, v := range append(roles, envRoles...) {
+		if v.Role != "owner" || seen[v.Principal()] {
+			continue
+		}
+		seen[v.Principal()] = true
+		owners = append(owners, v.Principal())
+	}
+
+	return owners, nil
+}
+
+// RequestExpiryWarning : asks the notification service to warn the
+// environment owners it is about to expire, by email and through the
+// notifications set up for the environment or its project
+func (e *Env) RequestExpiryWarning() error {
+	var n Notification
+
+	owners, err := e.Owners()
+	if err != nil {
+		return err
+	}
+
+	notifications, err := n.FindBySources(e.Name, e.GetProject())
+	if err != nil {
+		return err
+	}
+
+	msg := NotificationMessage{
+		Subject:       "Environment " + e.Name + " is about to expire",
+		Body:          "Environment " + e.Name + " expires at " + time.Unix(e.ExpiresAt, 0).UTC().Format(time.RFC1123) + ", and will be destroyed unless its expiry is extended.",
+		To:            ownerEmails(owners),
+		Notifications: notifications,
+	}
+
+	return msg.Send()
+}
+
+// ownerEmails : gets the email addresses of the given principals, with
+// teams standing for all of their members
+func ownerEmails(owners []string) []string {
+	var emails []string
+	var usernames []string
+
+	for _, o := range owners {
+		if !strings.HasPrefix(o, "team:") {
+			usernames = append(usernames, o)
+			continue
+		}
+
+		var t Team
+		if err := t.FindByName(strings.TrimPrefix(o, "team:")); err != nil {
+			continue
+		}
+		usernames = append(usernames, t.Members...)
+	}
+
+	seen := make(map[string]bool)
+	for _, username := range usernames {
+		var u User
+		if seen[username] || u.FindByUserName(username, &u) != nil || u.Email == "" {
+			continue
+		}
+		seen[username] = true
+		emails = append(emails, u.Email)
+	}
+
+	return emails
+}
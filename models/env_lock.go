@@ -0,0 +1,227 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/sirupsen/logrus"
+)
+
+// EnvLock holds a lock blocking any change on an environment
+type EnvLock struct {
+	ID        int    `json:"id"`
+	Env       string `json:"env"`
+	Reason    string `json:"reason"`
+	Username  string `json:"user_name"`
+	CreatedAt int64  `json:"created_at"`
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+	Duration  string `json:"duration,omitempty"`
+}
+
+// LockOverride holds the record of a change done on a locked or frozen
+// environment
+type LockOverride struct {
+	ID            int      `json:"id"`
+	Env           string   `json:"env"`
+	BuildID       string   `json:"build_id"`
+	Username      string   `json:"user_name"`
+	Justification string   `json:"justification"`
+	Locks         []string `json:"locks,omitempty"`
+	Freeze        string   `json:"freeze,omitempty"`
+	CreatedAt     int64    `json:"created_at"`
+}
+
+// LockedError : returned when a change is blocked by a lock or a freeze
+type LockedError struct {
+	Message string
+}
+
+func (e *LockedError) Error() string {
+	return e.Message
+}
+
+// Validate : validates the lock
+func (l *EnvLock) Validate() error {
+	if strings.TrimSpace(l.Reason) == "" {
+		return errors.New("Lock reason is empty")
+	}
+
+	if l.Duration != "" {
+		if l.ExpiresAt != 0 {
+			return errors.New("Lock duration and expires_at can't be both specified")
+		}
+
+		if d, err := time.ParseDuration(l.Duration); err != nil || d <= 0 {
+			return errors.New("Lock duration is not a valid duration")
+		}
+	}
+
+	if l.ExpiresAt != 0 && l.ExpiresAt <= time.Now().Unix() {
+		return errors.New("Lock expires_at must be in the future")
+	}
+
+	return nil
+}
+
+// Map : maps a lock from a request's body
+func (l *EnvLock) Map(data []byte) error {
+	if err := json.Unmarshal(data, &l); err != nil {
+		h.L.WithFields(logrus.Fields{
+			"input": string(data),
+		}).Error("Couldn't unmarshal given input")
+		return NewError(InvalidInputCode, "Invalid input")
+	}
+
+	return nil
+}
+
+// SetExpiry : sets when the lock expires from its duration
+func (l *EnvLock) SetExpiry() {
+	if l.Duration == "" {
+		return
+	}
+
+	d, _ := time.ParseDuration(l.Duration)
+	l.ExpiresAt = time.Now().Add(d).Unix()
+	l.Duration = ""
+}
+
+// IsActive : checks if the lock has not expired yet
+func (l *EnvLock) IsActive() bool {
+	return l.ExpiresAt == 0 || l.ExpiresAt > time.Now().Unix()
+}
+
+// FindByEnv : Searches for all the locks on an environment
+func (l *EnvLock) FindByEnv(env string) ([]EnvLock, error) {
+	var locks []EnvLock
+
+	query := make(map[string]interface{})
+	query["env"] = env
+	err := NewBaseModel(l.getStore()).FindBy(query, &locks)
+
+	return locks, err
+}
+
+// FindActiveByEnv : Searches for the locks on an environment that have
+// not expired
+func (l *EnvLock) FindActiveByEnv(env string) ([]EnvLock, error) {
+	var active []EnvLock
+
+	locks, err := l.FindByEnv(env)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range locks {
+		if v.IsActive() {
+			active = append(active, v)
+		}
+	}
+
+	return active, nil
+}
+
+// CanBeOverriddenBy : checks if the user is allowed to change the
+// environment while it is locked, which only admins and the user who
+// locked it are
+func (l *EnvLock) CanBeOverriddenBy(au User) bool {
+	return au.IsAdmin() || l.Username == au.Username
+}
+
+// Save : calls env_lock.set with the marshalled current lock
+func (l *EnvLock) Save() (err error) {
+	return NewBaseModel(l.getStore()).Save(l)
+}
+
+// DeleteByEnv : deletes all the locks on an environment
+func (l *EnvLock) DeleteByEnv(env string) (err error) {
+	query := make(map[string]interface{})
+	query["env"] = env
+	return NewBaseModel(l.getStore()).Delete(query)
+}
+
+func (l *EnvLock) getStore() string {
+	return "env_lock"
+}
+
+// CheckLocks : checks if the user can change the environment. Any change
+// is blocked while the environment is locked, and applies by non admin
+// users are blocked during a freeze. Users can still change it giving a
+// justification, and get the override to be recorded once the change is
+// done. Locks can only be overridden by admins and the users who set
+// them
+func (e *Env) CheckLocks(au User, justification string, apply bool) (*LockOverride, error) {
+	var l EnvLock
+	var f Freeze
+
+	o := LockOverride{
+		Env:           e.Name,
+		Username:      au.Username,
+		Justification: strings.TrimSpace(justification),
+		CreatedAt:     time.Now().Unix(),
+	}
+
+	locks, err := l.FindActiveByEnv(e.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	overridable := true
+	for _, v := range locks {
+		o.Locks = append(o.Locks, v.Reason+" ("+v.Username+")")
+		if !v.CanBeOverriddenBy(au) {
+			overridable = false
+		}
+	}
+
+	if apply && !au.IsAdmin() {
+		freeze, err := f.FindActive()
+		if err != nil {
+			return nil, err
+		}
+		if freeze != nil {
+			o.Freeze = freeze.Name
+		}
+	}
+
+	if len(o.Locks) == 0 && o.Freeze == "" {
+		return nil, nil
+	}
+
+	if o.Justification != "" && overridable {
+		return &o, nil
+	}
+
+	if len(o.Locks) > 0 {
+		return nil, &LockedError{Message: "Environment is locked: " + strings.Join(o.Locks, ", ")}
+	}
+
+	return nil, &LockedError{Message: "Changes are frozen: " + o.Freeze}
+}
+
+// Record : saves the override once the change has been done
+func (o *LockOverride) Record(buildID string) {
+	if o == nil {
+		return
+	}
+
+	o.BuildID = buildID
+	if err := NewBaseModel(o.getStore()).Save(o); err != nil {
+		h.L.WithFields(logrus.Fields{
+			"env":      o.Env,
+			"build_id": buildID,
+			"user":     o.Username,
+		}).Error("Could not record the lock override: " + err.Error())
+	}
+}
+
+func (o *LockOverride) getStore() string {
+	return "lock_override"
+}
@@ -0,0 +1,109 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/sirupsen/logrus"
+)
+
+// Freeze holds a window of time applies are blocked on every environment
+type Freeze struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Reason   string `json:"reason"`
+	StartsAt int64  `json:"starts_at"`
+	EndsAt   int64  `json:"ends_at"`
+	Username string `json:"user_name"`
+}
+
+// Validate : validates the freeze
+func (f *Freeze) Validate() error {
+	if f.Name == "" {
+		return errors.New("Freeze name is empty")
+	}
+
+	if !IsAlphaNumeric(f.Name) {
+		return errors.New("Freeze name contains invalid characters")
+	}
+
+	if f.StartsAt == 0 || f.EndsAt == 0 {
+		return errors.New("Freeze starts_at and ends_at are required")
+	}
+
+	if f.EndsAt <= f.StartsAt {
+		return errors.New("Freeze ends_at must be later than starts_at")
+	}
+
+	return nil
+}
+
+// Map : maps a freeze from a request's body
+func (f *Freeze) Map(data []byte) error {
+	if err := json.Unmarshal(data, &f); err != nil {
+		h.L.WithFields(logrus.Fields{
+			"input": string(data),
+		}).Error("Couldn't unmarshal given input")
+		return NewError(InvalidInputCode, "Invalid input")
+	}
+
+	return nil
+}
+
+// IsActive : checks if the freeze is in effect
+func (f *Freeze) IsActive() bool {
+	now := time.Now().Unix()
+	return f.StartsAt <= now && now < f.EndsAt
+}
+
+// FindAll : Searches for all freezes on the system
+func (f *Freeze) FindAll(freezes *[]Freeze) (err error) {
+	query := make(map[string]interface{})
+	return NewBaseModel(f.getStore()).FindBy(query, freezes)
+}
+
+// FindByName : Searches for a freeze by its name
+func (f *Freeze) FindByName(name string) (err error) {
+	query := make(map[string]interface{})
+	query["name"] = name
+	return NewBaseModel(f.getStore()).GetBy(query, f)
+}
+
+// FindActive : gets the freeze in effect, if any
+func (f *Freeze) FindActive() (*Freeze, error) {
+	var freezes []Freeze
+
+	if err := f.FindAll(&freezes); err != nil {
+		return nil, err
+	}
+
+	for i := range freezes {
+		if freezes[i].IsActive() {
+			return &freezes[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Save : calls freeze.set with the marshalled current freeze
+func (f *Freeze) Save() (err error) {
+	return NewBaseModel(f.getStore()).Save(f)
+}
+
+// Delete : will delete a freeze by its name
+func (f *Freeze) Delete(name string) (err error) {
+	query := make(map[string]interface{})
+	query["name"] = name
+	return NewBaseModel(f.getStore()).Delete(query)
+}
+
+func (f *Freeze) getStore() string {
+	return "freeze"
+}
@@ -0,0 +1,58 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package models
+
+import "sync"
+
+// grantCache holds the teams and active roles of a user, loaded on the
+// first authorization check and reused by every following check, so a
+// request only looks them up once. It also keeps the environments of the
+// policies looked up while resolving inherited roles, and the custom
+// roles looked up while checking permissions
+type grantCache struct {
+	once        sync.Once
+	teams       []string
+	roles       []Role
+	err         error
+	policies    map[string][]string
+	customRoles map[string]*CustomRole
+}
+
+// CacheGrants : makes the user load its roles once and reuse them for
+// the rest of its lifetime, which should not outlive a request
+func (u *User) CacheGrants() {
+	u.grants = &grantCache{
+		policies:    make(map[string][]string),
+		customRoles: make(map[string]*CustomRole),
+	}
+}
+
+func (c *grantCache) load(u *User) *grantCache {
+	c.once.Do(func() {
+		c.teams = u.findTeams()
+		c.roles, c.err = u.findGrants(c.teams)
+	})
+
+	return c
+}
+
+// roleGrants : checks if a role grants a permission, looking each custom
+// role up once. Without a cache custom roles are looked up every time
+func (c *grantCache) roleGrants(name, permission string) bool {
+	if _, ok := BuiltinRoles[name]; ok || c == nil {
+		return RoleGrants(name, permission)
+	}
+
+	r, ok := c.customRoles[name]
+	if !ok {
+		r = &CustomRole{}
+		if err := r.FindByName(name); err != nil {
+			r = nil
+		}
+		c.customRoles[name] = r
+	}
+
+	return r != nil && r.Grants(permission)
+}
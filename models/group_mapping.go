@@ -0,0 +1,148 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package models
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+const (
+	// RoleChangeAdd is used to grant a role on a group sync
+	RoleChangeAdd = "add"
+	// RoleChangeRemove is used to remove a role on a group sync
+	RoleChangeRemove = "remove"
+)
+
+// GroupMapping maps an external identity group onto a project or
+// environment role
+type GroupMapping struct {
+	Group        string `json:"group"`
+	ResourceType string `json:"resource_type"`
+	ResourceID   string `json:"resource_id"`
+	Role         string `json:"role"`
+}
+
+// RoleChange holds a role to be granted or removed by a group sync
+type RoleChange struct {
+	Action string `json:"action"`
+	Role   Role   `json:"role"`
+}
+
+// Validate : validates the group mapping
+func (m *GroupMapping) Validate() error {
+	if m.Group == "" {
+		return errors.New("Group mapping group is empty")
+	}
+
+	if m.ResourceType != "project" && m.ResourceType != "environment" {
+		return errors.New("Group mapping resource type accepted values are ['project', 'environment']")
+	}
+
+	if m.ResourceID == "" || !IsAlphaNumeric(m.ResourceID) {
+		return errors.New("Group mapping resource id is not valid")
+	}
+
+	if m.Role == "" {
+		return errors.New("Group mapping role is empty")
+	}
+
+	return nil
+}
+
+// ParseGroupMappings : parses and validates a json list of group mappings
+func ParseGroupMappings(data string) ([]GroupMapping, error) {
+	var mappings []GroupMapping
+
+	if data == "" {
+		return mappings, nil
+	}
+
+	if err := json.Unmarshal([]byte(data), &mappings); err != nil {
+		return nil, errors.New("Group mappings are not valid json")
+	}
+
+	for i := range mappings {
+		if err := mappings[i].Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return mappings, nil
+}
+
+// PlanGroupSync : calculates the role changes needed for a user to hold
+// the roles mapped to its groups. Only roles matching a mapping are ever
+// removed, so roles granted manually are kept
+func PlanGroupSync(username string, groups []string, mappings []GroupMapping) ([]RoleChange, error) {
+	var r Role
+	var existing []Role
+	var changes []RoleChange
+
+	if err := r.FindAllByUser(username, &existing); err != nil {
+		return nil, err
+	}
+
+	desired := make(map[string]bool)
+	managed := make(map[string]bool)
+
+	for _, m := range mappings {
+		key := m.ResourceType + ":" + m.ResourceID + ":" + m.Role
+		managed[key] = true
+		if contains(groups, m.Group) {
+			desired[key] = true
+		}
+	}
+
+	held := make(map[string]bool)
+
+	for _, role := range existing {
+		key := role.ResourceType + ":" + role.ResourceID + ":" + role.Role
+		held[key] = true
+		if managed[key] && !desired[key] {
+			changes = append(changes, RoleChange{Action: RoleChangeRemove, Role: role})
+		}
+	}
+
+	for _, m := range mappings {
+		key := m.ResourceType + ":" + m.ResourceID + ":" + m.Role
+		if desired[key] && !held[key] {
+			held[key] = true
+			changes = append(changes, RoleChange{
+				Action: RoleChangeAdd,
+				Role: Role{
+					UserID:       username,
+					ResourceType: m.ResourceType,
+					ResourceID:   m.ResourceID,
+					Role:         m.Role,
+				},
+			})
+		}
+	}
+
+	return changes, nil
+}
+
+// ApplyGroupSync : grants and removes the planned role changes
+func ApplyGroupSync(changes []RoleChange) error {
+	for i := range changes {
+		var err error
+
+		role := changes[i].Role
+
+		switch changes[i].Action {
+		case RoleChangeAdd:
+			err = role.Save()
+		case RoleChangeRemove:
+			err = role.Delete()
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
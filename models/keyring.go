@@ -0,0 +1,305 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package models
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/nats-io/go-nats"
+)
+
+// LegacyKID : key id the legacy secret is retired with
+const LegacyKID = "legacy"
+
+// KeyringReloadInterval : minimum time between reloads triggered by
+// tokens signed with an unknown key
+var KeyringReloadInterval = 10 * time.Second
+
+// Keyring holds the keys used to sign and verify authentication tokens.
+// The active key signs new tokens, while rotated keys are still accepted
+// until they are retired. Tokens without a key id are verified with the
+// legacy secret, until it is retired as any other key
+type Keyring struct {
+	mu            sync.RWMutex
+	legacy        []byte
+	legacyRetired bool
+	active        *SigningKey
+	keys          map[string]*SigningKey
+	reloaded      time.Time
+}
+
+// NewKeyring : creates a keyring falling back to the given secret
+func NewKeyring(legacy string) *Keyring {
+	return &Keyring{
+		legacy: []byte(legacy),
+		keys:   make(map[string]*SigningKey),
+	}
+}
+
+// Load : loads all non retired keys from the store
+func (k *Keyring) Load() error {
+	var sk SigningKey
+	var stored []SigningKey
+
+	if err := sk.FindAll(&stored); err != nil {
+		return err
+	}
+
+	keys := make(map[string]*SigningKey)
+	var active *SigningKey
+	var legacyRetired bool
+
+	for i := range stored {
+		key := &stored[i]
+		if key.KID == LegacyKID {
+			legacyRetired = key.Status == KeyRetired
+			continue
+		}
+
+		if key.Status == KeyRetired {
+			continue
+		}
+
+		if err := key.parse(); err != nil {
+			h.L.Error("Could not load signing key " + key.KID + ": " + err.Error())
+			continue
+		}
+
+		keys[key.KID] = key
+		if key.Status == KeyActive && (active == nil || key.CreatedAt > active.CreatedAt) {
+			active = key
+		}
+	}
+
+	k.mu.Lock()
+	k.keys = keys
+	k.active = active
+	k.legacyRetired = legacyRetired
+	k.reloaded = time.Now()
+	k.mu.Unlock()
+
+	return nil
+}
+
+// Subscribe : reloads the keyring every time keys are rotated by any
+// gateway instance
+func (k *Keyring) Subscribe() error {
+	_, err := N.Subscribe("signing_key.rotated", func(msg *nats.Msg) {
+		if err := k.Load(); err != nil {
+			h.L.Error("Could not reload signing keys: " + err.Error())
+		}
+	})
+
+	return err
+}
+
+// Sign : signs the given claims with the active key
+func (k *Keyring) Sign(claims jwt.MapClaims) (string, error) {
+	k.mu.RLock()
+	active := k.active
+	k.mu.RUnlock()
+
+	if active == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(k.legacy)
+	}
+
+	t := jwt.NewWithClaims(active.Method(), claims)
+	t.Header["kid"] = active.KID
+
+	return t.SignedString(active.signKey)
+}
+
+// Keyfunc : gets the key a token must be verified with
+func (k *Keyring) Keyfunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+
+	if kid == "" {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("Unexpected signing method")
+		}
+		k.mu.RLock()
+		retired := k.legacyRetired
+		k.mu.RUnlock()
+		if retired {
+			return nil, errors.New("Unknown signing key")
+		}
+		return k.legacy, nil
+	}
+
+	key := k.get(kid)
+	if key == nil && k.reloadable() {
+		// the key may have been rotated by another instance
+		if err := k.Load(); err != nil {
+			h.L.Error("Could not reload signing keys: " + err.Error())
+		}
+		key = k.get(kid)
+	}
+
+	if key == nil {
+		return nil, errors.New("Unknown signing key")
+	}
+
+	if t.Method.Alg() != key.Algorithm {
+		return nil, errors.New("Unexpected signing method")
+	}
+
+	return key.verifyKey, nil
+}
+
+// Rotate : generates a new active key, keeping the previous keys valid
+// to verify the tokens they already signed
+func (k *Keyring) Rotate(alg string) (*SigningKey, error) {
+	var key SigningKey
+
+	if err := key.Generate(alg); err != nil {
+		return nil, err
+	}
+
+	if err := key.Save(); err != nil {
+		return nil, err
+	}
+
+	for _, v := range k.List() {
+		if v.Status != KeyActive || v.KID == key.KID {
+			continue
+		}
+		v.Status = KeyVerify
+		v.RotatedAt = key.CreatedAt
+		if err := k.update(v); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := k.reload(); err != nil {
+		return nil, err
+	}
+
+	key.Redact()
+
+	return &key, nil
+}
+
+// Retire : stops accepting the tokens signed by the given key. The
+// legacy secret is retired with LegacyKID, once another key signs the new
+// tokens
+func (k *Keyring) Retire(kid string) error {
+	if kid == LegacyKID {
+		return k.retireLegacy()
+	}
+
+	key := k.get(kid)
+	if key == nil {
+		return errors.New("Signing key not found")
+	}
+
+	if key.Status == KeyActive {
+		return errors.New("The active signing key can't be retired, please rotate it first")
+	}
+
+	v := *key
+	v.Status = KeyRetired
+	if err := k.update(v); err != nil {
+		return err
+	}
+
+	return k.reload()
+}
+
+// List : lists the loaded keys, newest first and without key material
+func (k *Keyring) List() []SigningKey {
+	var keys []SigningKey
+
+	k.mu.RLock()
+	for _, v := range k.keys {
+		key := *v
+		key.Redact()
+		keys = append(keys, key)
+	}
+	k.mu.RUnlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt > keys[j].CreatedAt
+	})
+
+	return keys
+}
+
+// JWKS : gets the public asymmetric keys as a json web key set
+func (k *Keyring) JWKS() map[string][]map[string]string {
+	jwks := []map[string]string{}
+
+	for _, v := range k.List() {
+		if key := k.get(v.KID); key != nil {
+			if jwk := key.JWK(); jwk != nil {
+				jwks = append(jwks, jwk)
+			}
+		}
+	}
+
+	return map[string][]map[string]string{"keys": jwks}
+}
+
+// retireLegacy : stops accepting the tokens signed with the legacy secret
+func (k *Keyring) retireLegacy() error {
+	k.mu.RLock()
+	active := k.active
+	k.mu.RUnlock()
+
+	if active == nil {
+		return errors.New("The legacy secret can't be retired before a signing key is generated")
+	}
+
+	key := SigningKey{
+		KID:       LegacyKID,
+		Algorithm: "HS256",
+		Status:    KeyRetired,
+		RotatedAt: time.Now().Unix(),
+	}
+	if err := key.Save(); err != nil {
+		return err
+	}
+
+	return k.reload()
+}
+
+func (k *Keyring) get(kid string) *SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return k.keys[kid]
+}
+
+func (k *Keyring) reloadable() bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return time.Since(k.reloaded) > KeyringReloadInterval
+}
+
+// update : saves a key status keeping its stored key material
+func (k *Keyring) update(key SigningKey) error {
+	stored := k.get(key.KID)
+	if stored == nil {
+		return errors.New("Signing key not found")
+	}
+
+	key.Key = stored.Key
+
+	return key.Save()
+}
+
+// reload : reloads the keyring and notifies all gateway instances
+func (k *Keyring) reload() error {
+	if err := k.Load(); err != nil {
+		return err
+	}
+
+	return N.Publish("signing_key.rotated", []byte(`{}`))
+}
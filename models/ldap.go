@@ -0,0 +1,243 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package models
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/ldap.v2"
+)
+
+// ErrInvalidCredentials : returned when the directory rejects a user bind
+var ErrInvalidCredentials = errors.New("Provided credentials are not valid")
+
+// LDAPDirectory holds the configuration of an LDAP or Active Directory
+// server ldap users authenticate against
+type LDAPDirectory struct {
+	URL            string
+	BindDN         string
+	BindPassword   string
+	BaseDN         string
+	UserFilter     string
+	GroupFilter    string
+	GroupAttribute string
+	StartTLS       bool
+	Insecure       bool
+	Mappings       []GroupMapping
+}
+
+// LDAPIdentity holds a user found on the directory
+type LDAPIdentity struct {
+	DN       string   `json:"dn"`
+	Username string   `json:"username"`
+	Groups   []string `json:"groups"`
+}
+
+// LDAPEnabled : checks if an ldap directory has been configured
+func LDAPEnabled() bool {
+	return os.Getenv("LDAP_URL") != ""
+}
+
+// NewLDAPDirectory : loads the directory configuration from the environment
+func NewLDAPDirectory() (*LDAPDirectory, error) {
+	d := LDAPDirectory{
+		URL:            os.Getenv("LDAP_URL"),
+		BindDN:         os.Getenv("LDAP_BIND_DN"),
+		BindPassword:   os.Getenv("LDAP_BIND_PASSWORD"),
+		BaseDN:         os.Getenv("LDAP_BASE_DN"),
+		UserFilter:     os.Getenv("LDAP_USER_FILTER"),
+		GroupFilter:    os.Getenv("LDAP_GROUP_FILTER"),
+		GroupAttribute: os.Getenv("LDAP_GROUP_ATTRIBUTE"),
+		StartTLS:       os.Getenv("LDAP_START_TLS") == "true",
+		Insecure:       os.Getenv("LDAP_INSECURE_SKIP_VERIFY") == "true",
+	}
+
+	if d.URL == "" || d.BaseDN == "" {
+		return nil, errors.New("LDAP authentication is not configured")
+	}
+
+	if d.UserFilter == "" {
+		d.UserFilter = "(uid=%s)"
+	}
+
+	if d.GroupFilter == "" {
+		d.GroupFilter = "(member=%s)"
+	}
+
+	if d.GroupAttribute == "" {
+		d.GroupAttribute = "cn"
+	}
+
+	mappings, err := ParseGroupMappings(os.Getenv("LDAP_GROUP_MAPPINGS"))
+	if err != nil {
+		return nil, err
+	}
+	d.Mappings = mappings
+
+	return &d, nil
+}
+
+// Authenticate : verifies the user credentials with a bind as the user
+// and returns its directory identity
+func (d *LDAPDirectory) Authenticate(username, password string) (*LDAPIdentity, error) {
+	// an empty password would be an unauthenticated bind, which most
+	// directories accept for any existing dn
+	if password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	l, err := d.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer l.Close()
+
+	id, err := d.find(l, username)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := l.Bind(id.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	// groups are searched with the service account, as users are not
+	// always allowed to read group memberships
+	if err := d.bind(l); err != nil {
+		return nil, err
+	}
+
+	if id.Groups, err = d.groups(l, id.DN); err != nil {
+		return nil, err
+	}
+
+	return id, nil
+}
+
+// Lookup : finds a user and its groups on the directory without
+// verifying its credentials
+func (d *LDAPDirectory) Lookup(username string) (*LDAPIdentity, error) {
+	l, err := d.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer l.Close()
+
+	id, err := d.find(l, username)
+	if err != nil {
+		return nil, err
+	}
+
+	if id.Groups, err = d.groups(l, id.DN); err != nil {
+		return nil, err
+	}
+
+	return id, nil
+}
+
+func (d *LDAPDirectory) connect() (*ldap.Conn, error) {
+	var l *ldap.Conn
+
+	u, err := url.Parse(d.URL)
+	if err != nil {
+		return nil, errors.New("Invalid LDAP url")
+	}
+
+	tc := &tls.Config{ServerName: u.Hostname(), InsecureSkipVerify: d.Insecure}
+
+	switch u.Scheme {
+	case "ldaps":
+		host := u.Host
+		if u.Port() == "" {
+			host = host + ":636"
+		}
+		l, err = ldap.DialTLS("tcp", host, tc)
+	case "ldap":
+		host := u.Host
+		if u.Port() == "" {
+			host = host + ":389"
+		}
+		l, err = ldap.Dial("tcp", host)
+		if err == nil && d.StartTLS {
+			if err = l.StartTLS(tc); err != nil {
+				l.Close()
+			}
+		}
+	default:
+		return nil, errors.New("LDAP url scheme must be ldap or ldaps")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	l.SetTimeout(10 * time.Second)
+
+	if err := d.bind(l); err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// bind : binds as the configured service account, if any
+func (d *LDAPDirectory) bind(l *ldap.Conn) error {
+	if d.BindDN == "" {
+		return nil
+	}
+
+	return l.Bind(d.BindDN, d.BindPassword)
+}
+
+func (d *LDAPDirectory) find(l *ldap.Conn, username string) (*LDAPIdentity, error) {
+	res, err := l.Search(ldap.NewSearchRequest(
+		d.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		strings.Replace(d.UserFilter, "%s", ldap.EscapeFilter(username), -1),
+		[]string{"dn"},
+		nil,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(res.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+
+	return &LDAPIdentity{DN: res.Entries[0].DN, Username: username}, nil
+}
+
+func (d *LDAPDirectory) groups(l *ldap.Conn, dn string) ([]string, error) {
+	var groups []string
+
+	res, err := l.Search(ldap.NewSearchRequest(
+		d.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		strings.Replace(d.GroupFilter, "%s", ldap.EscapeFilter(dn), -1),
+		[]string{d.GroupAttribute},
+		nil,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range res.Entries {
+		if g := e.GetAttributeValue(d.GroupAttribute); g != "" {
+			groups = append(groups, g)
+		}
+	}
+
+	return groups, nil
+}
@@ -0,0 +1,294 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/nats-io/go-nats"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// LockoutUsername : lockouts tracked by username
+	LockoutUsername = "username"
+	// LockoutIP : lockouts tracked by client ip
+	LockoutIP = "ip"
+)
+
+// Lockout holds the failed login attempts of a username or client ip
+type Lockout struct {
+	ID          string `json:"id"`
+	Type        string `json:"type"`
+	Value       string `json:"value"`
+	Failures    int    `json:"failures"`
+	LastFailure int64  `json:"last_failure"`
+	LockedUntil int64  `json:"locked_until"`
+	Locked      bool   `json:"locked"`
+}
+
+// LoginThrottle tracks failed login attempts by username and client ip.
+// Every failure delays the next attempt exponentially, and reaching the
+// maximum number of failures locks logins out for a while. Attempts are
+// tracked in memory, and shared with the other gateway instances so they
+// all keep the same count
+type LoginThrottle struct {
+	mu              sync.Mutex
+	replica         string
+	MaxFailures     int
+	MaxIPFailures   int
+	Backoff         time.Duration
+	MaxBackoff      time.Duration
+	LockoutDuration time.Duration
+	Window          time.Duration
+	subject         string
+	attempts        map[string]*Lockout
+}
+
+// NewLoginThrottle : creates a login throttle with the configured limits
+func NewLoginThrottle() *LoginThrottle {
+	c := Config{}
+
+	return &LoginThrottle{
+		MaxFailures:     c.getInt("LOGIN_MAX_FAILURES", 5),
+		MaxIPFailures:   c.getInt("LOGIN_MAX_IP_FAILURES", 20),
+		Backoff:         c.getDuration("LOGIN_BACKOFF", time.Second),
+		MaxBackoff:      c.getDuration("LOGIN_MAX_BACKOFF", time.Minute),
+		LockoutDuration: c.getDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		Window:          c.getDuration("LOGIN_FAILURE_WINDOW", time.Hour),
+		subject:         "login_throttle.changed",
+		attempts:        make(map[string]*Lockout),
+		replica:         newReplicaID(),
+	}
+}
+
+// NewPasswordResetThrottle : creates a throttle for password reset
+// requests with the login limits. Its attempts are tracked apart from
+// the login ones, so requesting resets never locks a user out of login
+func NewPasswordResetThrottle() *LoginThrottle {
+	t := NewLoginThrottle()
+	t.subject = "password_reset_throttle.changed"
+
+	return t
+}
+
+// throttleEvent holds a change on the tracked attempts, shared with the
+// other gateway instances
+type throttleEvent struct {
+	Replica  string `json:"replica"`
+	Action   string `json:"action"`
+	Username string `json:"username,omitempty"`
+	IP       string `json:"ip,omitempty"`
+	ID       string `json:"id,omitempty"`
+}
+
+// Subscribe : applies the failed attempts, successful logins and cleared
+// lockouts tracked by any other gateway instance
+func (t *LoginThrottle) Subscribe() error {
+	_, err := N.Subscribe(t.subject, func(msg *nats.Msg) {
+		var e throttleEvent
+
+		if err := json.Unmarshal(msg.Data, &e); err != nil || e.Replica == t.replica {
+			return
+		}
+
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		switch e.Action {
+		case "fail":
+			t.prune()
+			t.fail(LockoutUsername, e.Username, t.MaxFailures, false)
+			t.fail(LockoutIP, e.IP, t.MaxIPFailures, false)
+		case "succeed":
+			delete(t.attempts, lockoutID(LockoutUsername, e.Username))
+		case "clear":
+			delete(t.attempts, e.ID)
+		}
+	})
+
+	return err
+}
+
+// Check : returns how long the given username and ip must wait before
+// their next login attempt
+func (t *LoginThrottle) Check(username, ip string) time.Duration {
+	var wait time.Duration
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+
+	for _, id := range []string{lockoutID(LockoutUsername, username), lockoutID(LockoutIP, ip)} {
+		if a, ok := t.attempts[id]; ok {
+			if d := time.Unix(a.LockedUntil, 0).Sub(now); d > wait {
+				wait = d
+			}
+		}
+	}
+
+	return wait
+}
+
+// Fail : records a failed login attempt for the given username and ip
+func (t *LoginThrottle) Fail(username, ip string) {
+	t.mu.Lock()
+	t.prune()
+	t.fail(LockoutUsername, username, t.MaxFailures, true)
+	t.fail(LockoutIP, ip, t.MaxIPFailures, true)
+	t.mu.Unlock()
+
+	t.announce(throttleEvent{Action: "fail", Username: username, IP: ip})
+}
+
+// Succeed : forgets the failed attempts of a username after a
+// successful login
+func (t *LoginThrottle) Succeed(username string) {
+	t.mu.Lock()
+	delete(t.attempts, lockoutID(LockoutUsername, username))
+	t.mu.Unlock()
+
+	t.announce(throttleEvent{Action: "succeed", Username: username})
+}
+
+// List : lists the tracked usernames and ips with their failures
+func (t *LoginThrottle) List() []Lockout {
+	list := []Lockout{}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.prune()
+
+	now := time.Now().Unix()
+	for _, a := range t.attempts {
+		l := *a
+		l.Locked = l.LockedUntil > now && t.isLockout(&l)
+		list = append(list, l)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+
+	return list
+}
+
+// Clear : forgets the failed attempts of a tracked username or ip
+func (t *LoginThrottle) Clear(id string, by string) error {
+	t.mu.Lock()
+	a, ok := t.attempts[id]
+	delete(t.attempts, id)
+	t.mu.Unlock()
+
+	if !ok {
+		return errors.New("Lockout not found")
+	}
+
+	t.announce(throttleEvent{Action: "clear", ID: id})
+
+	h.L.WithFields(logrus.Fields{
+		"type":       a.Type,
+		a.Type:       a.Value,
+		"failures":   a.Failures,
+		"cleared_by": by,
+	}).Warning("Login lockout cleared")
+
+	return nil
+}
+
+// fail : records a failed attempt, logging the lockouts it causes when
+// the attempt was made on this gateway instance
+func (t *LoginThrottle) fail(kind, value string, max int, local bool) {
+	if value == "" {
+		return
+	}
+
+	id := lockoutID(kind, value)
+	now := time.Now()
+
+	a, ok := t.attempts[id]
+	if !ok {
+		a = &Lockout{ID: id, Type: kind, Value: value}
+		t.attempts[id] = a
+	}
+
+	a.Failures++
+	a.LastFailure = now.Unix()
+
+	if a.Failures >= max {
+		a.LockedUntil = now.Add(t.LockoutDuration).Unix()
+
+		if !local {
+			return
+		}
+
+		h.L.WithFields(logrus.Fields{
+			"type":         kind,
+			kind:           value,
+			"failures":     a.Failures,
+			"locked_until": time.Unix(a.LockedUntil, 0).UTC().Format(time.RFC3339),
+		}).Warning("Login locked out after too many failed attempts")
+
+		return
+	}
+
+	backoff := t.Backoff << uint(a.Failures-1)
+	if backoff > t.MaxBackoff || backoff <= 0 {
+		backoff = t.MaxBackoff
+	}
+
+	a.LockedUntil = now.Add(backoff).Unix()
+}
+
+// isLockout : checks if the attempts reached the lockout threshold
+func (t *LoginThrottle) isLockout(a *Lockout) bool {
+	if a.Type == LockoutIP {
+		return a.Failures >= t.MaxIPFailures
+	}
+
+	return a.Failures >= t.MaxFailures
+}
+
+// prune : forgets the attempts not locked that failed outside the window
+func (t *LoginThrottle) prune() {
+	now := time.Now()
+
+	for id, a := range t.attempts {
+		if now.Unix() < a.LockedUntil {
+			continue
+		}
+
+		if now.Sub(time.Unix(a.LastFailure, 0)) > t.Window || t.isLockout(a) {
+			delete(t.attempts, id)
+		}
+	}
+}
+
+// announce : shares a change on the tracked attempts with the other
+// gateway instances
+func (t *LoginThrottle) announce(e throttleEvent) {
+	e.Replica = t.replica
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	if err = N.Publish(t.subject, data); err != nil {
+		h.L.Error("Could not share the login throttle change: " + err.Error())
+	}
+}
+
+func lockoutID(kind, value string) string {
+	return kind + ":" + strings.ToLower(value)
+}
@@ -0,0 +1,25 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package models
+
+// Mailer delivers notifications addressed to a single user
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// NotificationMailer delivers notifications by email through the
+// notification service
+type NotificationMailer struct{}
+
+// Send : requests the notification service to email the given address
+func (m *NotificationMailer) Send(to, subject, body string) error {
+	msg := NotificationMessage{
+		To:      []string{to},
+		Subject: subject,
+		Body:    body,
+	}
+
+	return msg.Send()
+}
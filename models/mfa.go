@@ -0,0 +1,135 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// MFAIssuer : issuer shown by authenticator apps
+	MFAIssuer = "Ernest"
+	// MFAPeriod : lifetime of a verification code
+	MFAPeriod = 30
+	// RecoveryCodeCount : number of recovery codes issued on enrollment
+	RecoveryCodeCount = 10
+)
+
+var recoveryCodeFormat = regexp.MustCompile(`^[a-z2-7]{5}-[a-z2-7]{5}$`)
+
+// NewTOTPSecret : generates a random base32 encoded totp secret
+func NewTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b), nil
+}
+
+// TOTPCode : calculates the verification code of a secret at a given time
+func TOTPCode(secret string, t time.Time) (string, error) {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(t.Unix()/MFAPeriod))
+
+	mac := hmac.New(sha1.New, key)
+	_, _ = mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%06d", code%1000000), nil
+}
+
+// TOTPStep : checks a verification code, accepting the previous and
+// next codes to allow for clock drift, and returns the time step it was
+// issued for
+func TOTPStep(secret, code string) (int64, bool) {
+	if secret == "" || len(code) != 6 {
+		return 0, false
+	}
+
+	now := time.Now()
+	for _, step := range []int{-1, 0, 1} {
+		t := now.Add(time.Duration(step*MFAPeriod) * time.Second)
+		c, err := TOTPCode(secret, t)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(c), []byte(code)) == 1 {
+			return t.Unix() / MFAPeriod, true
+		}
+	}
+
+	return 0, false
+}
+
+// OTPAuthURI : builds the uri authenticator apps are enrolled with
+func OTPAuthURI(account, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", MFAIssuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", "6")
+	v.Set("period", fmt.Sprintf("%d", MFAPeriod))
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + MFAIssuer + ":" + account,
+		RawQuery: v.Encode(),
+	}
+
+	return u.String()
+}
+
+// NewRecoveryCodes : generates a set of recovery codes, returning them
+// along with the hashes to be stored
+func NewRecoveryCodes() (codes []string, hashes []string, err error) {
+	enc := base32.StdEncoding.WithPadding(base32.NoPadding)
+
+	for i := 0; i < RecoveryCodeCount; i++ {
+		b := make([]byte, 7)
+		if _, err = rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+
+		c := strings.ToLower(enc.EncodeToString(b))[:10]
+		c = c[:5] + "-" + c[5:]
+
+		codes = append(codes, c)
+		hashes = append(hashes, hashRecoveryCode(c))
+	}
+
+	return codes, hashes, nil
+}
+
+// IsRecoveryCode : checks if a verification code is a recovery code
+func IsRecoveryCode(code string) bool {
+	return recoveryCodeFormat.MatchString(strings.ToLower(strings.TrimSpace(code)))
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return hex.EncodeToString(sum[:])
+}
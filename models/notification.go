@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"errors"
 	"strconv"
+	"time"
 
 	h "github.com/ernestio/api-gateway/helpers"
 	"github.com/sirupsen/logrus"
@@ -22,6 +23,16 @@ type Notification struct {
 	Sources []string `json:"sources"`
 }
 
+// NotificationMessage holds a message for the notification service to
+// deliver, through the given notifications or by email to the given
+// recipients
+type NotificationMessage struct {
+	Subject       string         `json:"subject"`
+	Body          string         `json:"body"`
+	To            []string       `json:"to,omitempty"`
+	Notifications []Notification `json:"notifications,omitempty"`
+}
+
 // Validate : validates the notification
 func (n *Notification) Validate() error {
 	if n.Name == "" {
@@ -84,3 +95,48 @@ func (n *Notification) Delete() (err error) {
 	query["id"] = n.ID
 	return NewBaseModel("notification").Delete(query)
 }
+
+// FindBySources : gets the notifications attached to any of the given
+// sources
+func (n *Notification) FindBySources(sources ...string) ([]Notification, error) {
+	var all []Notification
+	var found []Notification
+
+	if err := n.FindAll(&all); err != nil {
+		return nil, err
+	}
+
+	for _, v := range all {
+		for _, s := range v.Sources {
+			if contains(sources, s) {
+				found = append(found, v)
+				break
+			}
+		}
+	}
+
+	return found, nil
+}
+
+// Send : requests the notification service to deliver the message
+func (m *NotificationMessage) Send() error {
+	var res struct {
+		Error string `json:"_error"`
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	msg, err := N.Request("notification.send", data, 5*time.Second)
+	if err != nil {
+		return err
+	}
+
+	if json.Unmarshal(msg.Data, &res) == nil && res.Error != "" {
+		return errors.New(res.Error)
+	}
+
+	return nil
+}
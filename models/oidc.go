@@ -0,0 +1,381 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package models
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// OIDCProvider holds the configuration of an OpenID Connect identity
+// provider used for federated logins
+type OIDCProvider struct {
+	Issuer        string
+	ClientID      string
+	ClientSecret  string
+	RedirectURL   string
+	Scopes        []string
+	UsernameClaim string
+	GroupsClaim   string
+	Mappings      []GroupMapping
+	Discovery     OIDCDiscovery
+	cache         *oidcCache
+	client        *http.Client
+}
+
+// oidcKeyReload : shortest wait between key set reloads triggered by
+// tokens signed with an unknown key
+var oidcKeyReload = 10 * time.Second
+
+// oidcCache holds the metadata and signing keys fetched from a provider,
+// shared by all the logins until they expire
+type oidcCache struct {
+	mu           sync.Mutex
+	ttl          time.Duration
+	discovery    OIDCDiscovery
+	discoveredAt time.Time
+	keys         map[string]*rsa.PublicKey
+	keysLoadedAt time.Time
+}
+
+var (
+	oidcCachesMu sync.Mutex
+	oidcCaches   = make(map[string]*oidcCache)
+)
+
+// getOIDCCache : gets the cache of the given issuer
+func getOIDCCache(issuer string, ttl time.Duration) *oidcCache {
+	oidcCachesMu.Lock()
+	defer oidcCachesMu.Unlock()
+
+	c, ok := oidcCaches[issuer]
+	if !ok {
+		c = &oidcCache{}
+		oidcCaches[issuer] = c
+	}
+	c.ttl = ttl
+
+	return c
+}
+
+// OIDCDiscovery holds the provider metadata published on its well known
+// configuration endpoint
+type OIDCDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCIdentity holds the verified identity of a federated user
+type OIDCIdentity struct {
+	Subject  string
+	Username string
+	Groups   []string
+}
+
+type oidcKeySet struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	} `json:"keys"`
+}
+
+// NewOIDCProvider : loads the identity provider configuration from the
+// environment and fetches its metadata, unless it has been fetched
+// within the cache ttl
+func NewOIDCProvider() (*OIDCProvider, error) {
+	c := Config{}
+	p := OIDCProvider{
+		Issuer:        strings.TrimSuffix(os.Getenv("OIDC_ISSUER"), "/"),
+		ClientID:      os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret:  os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:   os.Getenv("OIDC_REDIRECT_URL"),
+		Scopes:        []string{"openid", "profile", "email"},
+		UsernameClaim: os.Getenv("OIDC_USERNAME_CLAIM"),
+		GroupsClaim:   os.Getenv("OIDC_GROUPS_CLAIM"),
+		client:        &http.Client{Timeout: 10 * time.Second},
+	}
+
+	if p.Issuer == "" || p.ClientID == "" {
+		return nil, errors.New("OIDC login is not configured")
+	}
+
+	if s := os.Getenv("OIDC_SCOPES"); s != "" {
+		p.Scopes = strings.Fields(s)
+	}
+
+	if p.UsernameClaim == "" {
+		p.UsernameClaim = "preferred_username"
+	}
+
+	if p.GroupsClaim == "" {
+		p.GroupsClaim = "groups"
+	}
+
+	mappings, err := ParseGroupMappings(os.Getenv("OIDC_GROUP_MAPPINGS"))
+	if err != nil {
+		return nil, err
+	}
+	p.Mappings = mappings
+
+	p.cache = getOIDCCache(p.Issuer, c.GetOIDCCacheTTL())
+
+	if p.Discovery, err = p.discover(); err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// discover : gets the provider metadata, fetching it again once it is
+// older than the cache ttl
+func (p *OIDCProvider) discover() (OIDCDiscovery, error) {
+	var d OIDCDiscovery
+
+	p.cache.mu.Lock()
+	defer p.cache.mu.Unlock()
+
+	if !p.cache.discoveredAt.IsZero() && time.Since(p.cache.discoveredAt) < p.cache.ttl {
+		return p.cache.discovery, nil
+	}
+
+	if err := p.getJSON(p.Issuer+"/.well-known/openid-configuration", &d); err != nil {
+		return d, errors.New("Could not load the OIDC provider configuration: " + err.Error())
+	}
+
+	if strings.TrimSuffix(d.Issuer, "/") != p.Issuer {
+		return d, errors.New("OIDC provider issuer does not match the configured issuer")
+	}
+
+	p.cache.discovery = d
+	p.cache.discoveredAt = time.Now()
+
+	return d, nil
+}
+
+// AuthURL : builds the url users are redirected to in order to log in
+// on the identity provider
+func (p *OIDCProvider) AuthURL(state, nonce string) string {
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", p.ClientID)
+	v.Set("redirect_uri", p.RedirectURL)
+	v.Set("scope", strings.Join(p.Scopes, " "))
+	v.Set("state", state)
+	v.Set("nonce", nonce)
+
+	sep := "?"
+	if strings.Contains(p.Discovery.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+
+	return p.Discovery.AuthorizationEndpoint + sep + v.Encode()
+}
+
+// Exchange : exchanges an authorization code for an id token
+func (p *OIDCProvider) Exchange(code string) (string, error) {
+	var res struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+
+	v := url.Values{}
+	v.Set("grant_type", "authorization_code")
+	v.Set("code", code)
+	v.Set("redirect_uri", p.RedirectURL)
+	v.Set("client_id", p.ClientID)
+	v.Set("client_secret", p.ClientSecret)
+
+	resp, err := p.client.PostForm(p.Discovery.TokenEndpoint, v)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return "", errors.New("Invalid response from the OIDC token endpoint")
+	}
+
+	if resp.StatusCode != http.StatusOK || res.Error != "" {
+		return "", errors.New("OIDC code exchange failed: " + res.Error)
+	}
+
+	if res.IDToken == "" {
+		return "", errors.New("OIDC provider did not return an id token")
+	}
+
+	return res.IDToken, nil
+}
+
+// Verify : validates an id token signature and claims, returning the
+// identity it holds
+func (p *OIDCProvider) Verify(raw, nonce string) (*OIDCIdentity, error) {
+	token, err := jwt.Parse(raw, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, errors.New("Unexpected signing method")
+		}
+		kid, _ := t.Header["kid"].(string)
+		return p.key(kid)
+	})
+	if err != nil || !token.Valid {
+		return nil, errors.New("Invalid id token")
+	}
+
+	claims, _ := token.Claims.(jwt.MapClaims)
+
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != p.Issuer {
+		return nil, errors.New("Invalid id token issuer")
+	}
+
+	if !p.validAudience(claims["aud"]) {
+		return nil, errors.New("Invalid id token audience")
+	}
+
+	if n, _ := claims["nonce"].(string); n == "" || n != nonce {
+		return nil, errors.New("Invalid id token nonce")
+	}
+
+	id := OIDCIdentity{}
+	id.Subject, _ = claims["sub"].(string)
+	id.Username, _ = claims[p.UsernameClaim].(string)
+	if id.Username == "" {
+		id.Username, _ = claims["email"].(string)
+	}
+
+	if id.Subject == "" || id.Username == "" {
+		return nil, errors.New("Id token does not identify a user")
+	}
+
+	switch groups := claims[p.GroupsClaim].(type) {
+	case []interface{}:
+		for _, g := range groups {
+			if s, ok := g.(string); ok {
+				id.Groups = append(id.Groups, s)
+			}
+		}
+	case string:
+		id.Groups = strings.Fields(groups)
+	}
+
+	return &id, nil
+}
+
+func (p *OIDCProvider) validAudience(aud interface{}) bool {
+	switch a := aud.(type) {
+	case string:
+		return a == p.ClientID
+	case []interface{}:
+		for _, v := range a {
+			if s, _ := v.(string); s == p.ClientID {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// key : gets a provider signing key by its id. The key set is reloaded
+// once it is older than the cache ttl, or when the key is unknown as the
+// provider may have rotated it, but never more than once every
+// oidcKeyReload so unknown keys can't flood the provider
+func (p *OIDCProvider) key(kid string) (*rsa.PublicKey, error) {
+	p.cache.mu.Lock()
+	defer p.cache.mu.Unlock()
+
+	age := time.Since(p.cache.keysLoadedAt)
+
+	if k, ok := p.cache.keys[kid]; ok && age < p.cache.ttl {
+		return k, nil
+	}
+
+	if p.cache.keys == nil || age >= oidcKeyReload {
+		if err := p.loadKeys(); err != nil {
+			return nil, err
+		}
+	}
+
+	if k, ok := p.cache.keys[kid]; ok {
+		return k, nil
+	}
+
+	// providers publishing a single key don't always set a key id
+	if kid == "" && len(p.cache.keys) == 1 {
+		for _, k := range p.cache.keys {
+			return k, nil
+		}
+	}
+
+	return nil, errors.New("Unknown id token signing key")
+}
+
+// loadKeys : fetches the provider key set, the cache must be locked
+func (p *OIDCProvider) loadKeys() error {
+	var set oidcKeySet
+
+	if err := p.getJSON(p.Discovery.JWKSURI, &set); err != nil {
+		return err
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	p.cache.keys = keys
+	p.cache.keysLoadedAt = time.Now()
+
+	return nil
+}
+
+func (p *OIDCProvider) getJSON(uri string, v interface{}) error {
+	resp, err := p.client.Get(uri)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("unexpected status " + resp.Status + " from " + uri)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,168 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package models
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Passwords : password policy new passwords are validated against
+var Passwords = &PasswordPolicy{MinLength: 8}
+
+// PasswordPolicy holds the rules passwords must follow
+type PasswordPolicy struct {
+	MinLength        int
+	RequireUppercase bool
+	RequireLowercase bool
+	RequireDigit     bool
+	RequireSymbol    bool
+	History          int
+	breached         map[string]bool
+}
+
+// NewPasswordPolicy : creates the configured password policy, loading
+// the breached password list if any
+func NewPasswordPolicy() (*PasswordPolicy, error) {
+	c := Config{}
+
+	p := PasswordPolicy{
+		MinLength:        c.getInt("PASSWORD_MIN_LENGTH", 8),
+		RequireUppercase: os.Getenv("PASSWORD_REQUIRE_UPPERCASE") == "true",
+		RequireLowercase: os.Getenv("PASSWORD_REQUIRE_LOWERCASE") == "true",
+		RequireDigit:     os.Getenv("PASSWORD_REQUIRE_DIGIT") == "true",
+		RequireSymbol:    os.Getenv("PASSWORD_REQUIRE_SYMBOL") == "true",
+		History:          c.getInt("PASSWORD_HISTORY", 0),
+	}
+
+	if path := os.Getenv("PASSWORD_BREACHED_LIST"); path != "" {
+		if err := p.LoadBreached(path); err != nil {
+			return nil, err
+		}
+	}
+
+	return &p, nil
+}
+
+// LoadBreached : loads a list of breached passwords, one per line
+func (p *PasswordPolicy) LoadBreached(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	p.breached = make(map[string]bool)
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if pw := strings.TrimSpace(s.Text()); pw != "" {
+			p.breached[strings.ToLower(pw)] = true
+		}
+	}
+
+	return s.Err()
+}
+
+// Validate : checks the given password against every rule of the
+// policy, returning all the rules it fails
+func (p *PasswordPolicy) Validate(password string) error {
+	if password == "" {
+		return errors.New("Password cannot be empty")
+	}
+
+	return joinFailures(p.failures(password))
+}
+
+// ValidateChange : checks a new password of the given user against
+// every rule of the policy, including its last used passwords
+func (p *PasswordPolicy) ValidateChange(u *User, password string) error {
+	if password == "" {
+		return errors.New("Password cannot be empty")
+	}
+
+	failures := p.failures(password)
+	if p.History > 0 && u.UsedPassword(password, p.History) {
+		failures = append(failures, "Password can't be any of the last "+strconv.Itoa(p.History)+" passwords")
+	}
+
+	return joinFailures(failures)
+}
+
+// NextHistory : returns the password history of the given user once its
+// current password is replaced
+func (p *PasswordPolicy) NextHistory(u *User) []string {
+	if p.History < 2 || u.Password == nil || *u.Password == "" {
+		return nil
+	}
+
+	history := append([]string{u.Salt + "$" + *u.Password}, u.PasswordHistory...)
+	if len(history) > p.History-1 {
+		history = history[:p.History-1]
+	}
+
+	return history
+}
+
+func (p *PasswordPolicy) failures(password string) []string {
+	var failures []string
+	var upper, lower, digit, symbol bool
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		failures = append(failures, "Minimum password length is "+strconv.Itoa(p.MinLength)+" characters")
+	}
+
+	printable := true
+	for _, r := range password {
+		switch {
+		case !unicode.IsPrint(r):
+			printable = false
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	if !printable {
+		failures = append(failures, "Password can only contain printable characters")
+	}
+	if p.RequireUppercase && !upper {
+		failures = append(failures, "Password must contain an uppercase letter")
+	}
+	if p.RequireLowercase && !lower {
+		failures = append(failures, "Password must contain a lowercase letter")
+	}
+	if p.RequireDigit && !digit {
+		failures = append(failures, "Password must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		failures = append(failures, "Password must contain a symbol")
+	}
+	if p.breached[strings.ToLower(password)] {
+		failures = append(failures, "Password has appeared in a data breach, please choose a different one")
+	}
+
+	return failures
+}
+
+func joinFailures(failures []string) error {
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, ", "))
+	}
+
+	return nil
+}
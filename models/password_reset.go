@@ -0,0 +1,47 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package models
+
+import (
+	"time"
+)
+
+// PasswordReset holds a pending password reset. The token sent to the
+// user is signed separately, this record makes it single use
+type PasswordReset struct {
+	ID        int    `json:"id"`
+	TokenID   string `json:"token_id"`
+	Username  string `json:"username"`
+	ExpiresAt int64  `json:"expires_at"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// FindByTokenID : Gets a password reset by its token id
+func (r *PasswordReset) FindByTokenID(id string) (err error) {
+	query := make(map[string]interface{})
+	query["token_id"] = id
+	return NewBaseModel(r.getStore()).GetBy(query, r)
+}
+
+// IsExpired : checks if the password reset has expired
+func (r *PasswordReset) IsExpired() bool {
+	return r.ExpiresAt <= time.Now().Unix()
+}
+
+// Save : calls password_reset.set with the marshalled current reset
+func (r *PasswordReset) Save() (err error) {
+	return NewBaseModel(r.getStore()).Save(r)
+}
+
+// Delete : will delete a password reset by its id
+func (r *PasswordReset) Delete() (err error) {
+	query := make(map[string]interface{})
+	query["id"] = r.ID
+	return NewBaseModel(r.getStore()).Delete(query)
+}
+
+func (r *PasswordReset) getStore() string {
+	return "password_reset"
+}
@@ -23,6 +23,7 @@ type Project struct {
 	Credentials  map[string]interface{} `json:"credentials,omitempty"`
 	Environments []string               `json:"environments,omitempty"`
 	Members      []Role                 `json:"members,omitempty"`
+	TeamMembers  []Role                 `json:"team_members,omitempty"`
 }
 
 // Validate the project
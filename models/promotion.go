@@ -0,0 +1,152 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// PromotionOverrides : environment option holding the overrides applied
+// on every definition promoted to it
+const PromotionOverrides = "promotion_overrides"
+
+// Promotion holds the record of a build definition promoted from an
+// environment to another
+type Promotion struct {
+	ID          int       `json:"id"`
+	SourceEnv   string    `json:"source_env"`
+	SourceBuild string    `json:"source_build"`
+	TargetEnv   string    `json:"target_env"`
+	TargetBuild string    `json:"target_build"`
+	Type        string    `json:"type"`
+	UserID      int       `json:"user_id"`
+	Username    string    `json:"user_name"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// FindByEnv : Searches for all promotions from or to an environment
+func (p *Promotion) FindByEnv(env string, promotions *[]Promotion) (err error) {
+	var from []Promotion
+
+	query := make(map[string]interface{})
+	query["target_env"] = env
+	if err = NewBaseModel(p.getStore()).FindBy(query, promotions); err != nil {
+		return err
+	}
+
+	query = make(map[string]interface{})
+	query["source_env"] = env
+	if err = NewBaseModel(p.getStore()).FindBy(query, &from); err != nil {
+		return err
+	}
+
+	*promotions = append(*promotions, from...)
+
+	return nil
+}
+
+// Save : calls promotion.set with the marshalled current promotion
+func (p *Promotion) Save() (err error) {
+	return NewBaseModel(p.getStore()).Save(p)
+}
+
+func (p *Promotion) getStore() string {
+	return "promotion"
+}
+
+// GetPromotionOverrides : gets the overrides applied on every definition
+// promoted to the environment
+func (e *Env) GetPromotionOverrides() (map[string]interface{}, error) {
+	v, ok := e.Options[PromotionOverrides]
+	if !ok || v == nil {
+		return nil, nil
+	}
+
+	overrides, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("Promotion overrides must be an object")
+	}
+
+	return overrides, nil
+}
+
+// PromoteDefinition : renames a definition after the environment, and
+// applies on it the environment promotion overrides followed by the given
+// ones
+func (e *Env) PromoteDefinition(def, overrides map[string]interface{}) (map[string]interface{}, error) {
+	stored, err := e.GetPromotionOverrides()
+	if err != nil {
+		return nil, err
+	}
+
+	def["project"] = e.GetProject()
+	def["name"] = strings.TrimPrefix(e.Name, e.GetProject()+EnvNameSeparator)
+	def = MergeDefinition(def, stored)
+
+	return MergeDefinition(def, overrides), nil
+}
+
+// MergeDefinition : applies a set of overrides on a definition. Nested
+// fields are merged, and lists of named items, as instances or networks,
+// are merged item by item matching them by name. Any other value is
+// replaced by its override
+func MergeDefinition(def, overrides map[string]interface{}) map[string]interface{} {
+	for k, v := range overrides {
+		switch o := v.(type) {
+		case map[string]interface{}:
+			if d, ok := def[k].(map[string]interface{}); ok {
+				def[k] = MergeDefinition(d, o)
+				continue
+			}
+		case []interface{}:
+			if d, ok := def[k].([]interface{}); ok && namedItems(o) {
+				def[k] = mergeNamedItems(d, o)
+				continue
+			}
+		}
+
+		def[k] = v
+	}
+
+	return def
+}
+
+// namedItems : checks if all items on a list have a name
+func namedItems(items []interface{}) bool {
+	for _, v := range items {
+		item, ok := v.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if _, ok := item["name"].(string); !ok {
+			return false
+		}
+	}
+
+	return len(items) > 0
+}
+
+func mergeNamedItems(items, overrides []interface{}) []interface{} {
+	for _, v := range overrides {
+		o := v.(map[string]interface{})
+		merged := false
+
+		for i, item := range items {
+			d, ok := item.(map[string]interface{})
+			if ok && d["name"] == o["name"] {
+				items[i] = MergeDefinition(d, o)
+				merged = true
+			}
+		}
+
+		if !merged {
+			items = append(items, o)
+		}
+	}
+
+	return items
+}
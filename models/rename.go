@@ -0,0 +1,375 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package models
+
+import (
+	"strconv"
+	"strings"
+
+	h "github.com/ernestio/api-gateway/helpers"
+)
+
+// renaming keeps track of the changes done while renaming a resource,
+// so they can be undone if any of them fails
+type renaming struct {
+	undo []func() error
+}
+
+// RollbackError : returned when a rename failed and some of the changes
+// already done could not be undone
+type RollbackError struct {
+	Err    error
+	Failed int
+}
+
+func (e *RollbackError) Error() string {
+	return e.Err.Error() + ", " + strconv.Itoa(e.Failed) + " changes could not be rolled back"
+}
+
+// RenameEnv : renames an environment, moving its roles, notification
+// sources, policy attachments, locks, api token scopes, schedule runs and
+// promotions to the new name. If any change fails the ones already done
+// are rolled back
+func RenameEnv(e *Env, name string) error {
+	var r renaming
+
+	if err := r.env(e, name); err != nil {
+		if failed := r.rollback(); failed > 0 {
+			return &RollbackError{Err: err, Failed: failed}
+		}
+		return err
+	}
+
+	return nil
+}
+
+// RenameProject : renames a project and all of its environments, moving
+// everything referring to them to the new names, as RenameEnv does. If any
+// change fails the ones already done are rolled back
+func RenameProject(p *Project, name string) error {
+	var r renaming
+
+	if err := r.project(p, name); err != nil {
+		if failed := r.rollback(); failed > 0 {
+			return &RollbackError{Err: err, Failed: failed}
+		}
+		return err
+	}
+
+	return nil
+}
+
+// do : applies a change, keeping how to undo it
+func (r *renaming) do(apply, undo func() error) error {
+	if err := apply(); err != nil {
+		return err
+	}
+
+	r.undo = append(r.undo, undo)
+
+	return nil
+}
+
+// rollback : undoes the applied changes, newest first, returning how
+// many of them could not be undone
+func (r *renaming) rollback() int {
+	var failed int
+
+	for i := len(r.undo) - 1; i >= 0; i-- {
+		if err := r.undo[i](); err != nil {
+			h.L.Error("Could not roll back a rename: " + err.Error())
+			failed++
+		}
+	}
+
+	r.undo = nil
+
+	return failed
+}
+
+func (r *renaming) project(p *Project, name string) error {
+	old := *p
+	renamed := *p
+	renamed.Name = name
+
+	envs, err := p.Envs()
+	if err != nil {
+		return err
+	}
+
+	if err = r.do(renamed.Save, old.Save); err != nil {
+		return err
+	}
+	p.Name = name
+
+	for i := range envs {
+		to := name + EnvNameSeparator + strings.TrimPrefix(envs[i].Name, old.Name+EnvNameSeparator)
+		if err = r.env(&envs[i], to); err != nil {
+			return err
+		}
+	}
+
+	if err = r.roles("project", old.Name, name); err != nil {
+		return err
+	}
+
+	if err = r.tokens(old.Name, name); err != nil {
+		return err
+	}
+
+	return r.sources(old.Name, name)
+}
+
+func (r *renaming) env(e *Env, name string) error {
+	old := *e
+	renamed := *e
+	renamed.Name = name
+
+	err := r.do(renamed.Save, old.Save)
+	if err != nil {
+		return err
+	}
+	e.Name = name
+
+	if err = r.roles("environment", old.Name, name); err != nil {
+		return err
+	}
+
+	if err = r.buildRoles(old.Name, name); err != nil {
+		return err
+	}
+
+	if err = r.sources(old.Name, name); err != nil {
+		return err
+	}
+
+	if err = r.locks(old.Name, name); err != nil {
+		return err
+	}
+
+	if err = r.tokens(old.Name, name); err != nil {
+		return err
+	}
+
+	if err = r.runs(old.Name, name); err != nil {
+		return err
+	}
+
+	if err = r.promotions(old.Name, name); err != nil {
+		return err
+	}
+
+	return r.policies(old.Name, name)
+}
+
+// roles : moves the roles granted on a resource
+func (r *renaming) roles(resourceType, from, to string) error {
+	var roles []Role
+
+	if err := (&Role{}).FindAllByResource(from, resourceType, &roles); err != nil {
+		return err
+	}
+
+	for _, v := range roles {
+		if err := r.moveRole(v, to); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// buildRoles : moves the roles granted on the builds of an environment
+func (r *renaming) buildRoles(from, to string) error {
+	var roles []Role
+
+	if err := (&Role{}).FindAllByResourceType("build", &roles); err != nil {
+		return err
+	}
+
+	for _, v := range roles {
+		if !strings.HasPrefix(v.ResourceID, from+"/") {
+			continue
+		}
+
+		if err := r.moveRole(v, to+strings.TrimPrefix(v.ResourceID, from)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *renaming) moveRole(v Role, to string) error {
+	old := v
+	moved := v
+	moved.ResourceID = to
+
+	return r.do(moved.Save, old.Save)
+}
+
+// sources : moves the notifications sent for a resource
+func (r *renaming) sources(from, to string) error {
+	var notifications []Notification
+
+	if err := (&Notification{}).FindAll(&notifications); err != nil {
+		return err
+	}
+
+	for _, n := range notifications {
+		sources, ok := replaceName(n.Sources, from, to)
+		if !ok {
+			continue
+		}
+
+		old := n
+		moved := n
+		moved.Sources = sources
+
+		if err := r.do(moved.Save, old.Save); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// locks : moves the locks set on an environment
+func (r *renaming) locks(from, to string) error {
+	locks, err := (&EnvLock{}).FindByEnv(from)
+	if err != nil {
+		return err
+	}
+
+	for _, l := range locks {
+		old := l
+		moved := l
+		moved.Env = to
+
+		if err := r.do(moved.Save, old.Save); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// tokens : moves the api tokens scoped to a project or environment
+func (r *renaming) tokens(from, to string) error {
+	var tokens []APIToken
+
+	if err := (&APIToken{}).FindAll(&tokens); err != nil {
+		return err
+	}
+
+	for _, t := range tokens {
+		projects, inProjects := replaceName(t.Projects, from, to)
+		envs, inEnvs := replaceName(t.Environments, from, to)
+		if !inProjects && !inEnvs {
+			continue
+		}
+
+		old := t
+		moved := t
+		moved.Projects = projects
+		moved.Environments = envs
+
+		if err := r.do(moved.Save, old.Save); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runs : moves the history of an environment schedules
+func (r *renaming) runs(from, to string) error {
+	var runs []ScheduleRun
+
+	if err := (&ScheduleRun{}).FindByEnv(from, &runs); err != nil {
+		return err
+	}
+
+	for _, v := range runs {
+		old := v
+		moved := v
+		moved.Env = to
+
+		if err := r.do(moved.Save, old.Save); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// promotions : moves the promotions from or to an environment
+func (r *renaming) promotions(from, to string) error {
+	var promotions []Promotion
+
+	if err := (&Promotion{}).FindByEnv(from, &promotions); err != nil {
+		return err
+	}
+
+	for _, p := range promotions {
+		old := p
+		moved := p
+		if moved.SourceEnv == from {
+			moved.SourceEnv = to
+		}
+		if moved.TargetEnv == from {
+			moved.TargetEnv = to
+		}
+
+		if err := r.do(moved.Save, old.Save); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// policies : moves the policies attached to an environment
+func (r *renaming) policies(from, to string) error {
+	var policies []Policy
+
+	if err := (&Policy{}).FindAll(&policies); err != nil {
+		return err
+	}
+
+	for _, p := range policies {
+		envs, ok := replaceName(p.Environments, from, to)
+		if !ok {
+			continue
+		}
+
+		old := p
+		moved := p
+		moved.Environments = envs
+
+		if err := r.do(moved.Save, old.Save); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// replaceName : gets a copy of a list of names with one of them
+// replaced, if found
+func replaceName(names []string, from, to string) ([]string, bool) {
+	var found bool
+
+	replaced := make([]string, len(names))
+	for i, v := range names {
+		replaced[i] = v
+		if v == from {
+			replaced[i] = to
+			found = true
+		}
+	}
+
+	return replaced, found
+}
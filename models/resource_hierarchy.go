@@ -0,0 +1,144 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package models
+
+import (
+	"strings"
+)
+
+// ResourceRef identifies a resource roles can be granted on
+type ResourceRef struct {
+	Type string `json:"resource_type"`
+	ID   string `json:"resource_id"`
+}
+
+// String : returns the resource as "type id"
+func (r ResourceRef) String() string {
+	return r.Type + " " + r.ID
+}
+
+// RoleResolution holds the roles applying to a user on a resource. Roles
+// are inherited down the resource hierarchy, project > environment >
+// build and policy > attached environments, and the roles granted on
+// the nearest resource take precedence over the ones of its parents
+type RoleResolution struct {
+	Resources []ResourceRef `json:"resources,omitempty"`
+	Roles     []Role        `json:"roles,omitempty"`
+	Inherited bool          `json:"inherited"`
+	Denied    bool          `json:"denied"`
+	grants    *grantCache
+}
+
+// Names : gets the names of the resolved roles
+func (r *RoleResolution) Names() []string {
+	var names []string
+
+	for _, v := range r.Roles {
+		names = append(names, v.Role)
+	}
+
+	return names
+}
+
+// Grants : checks if the resolved roles grant the given permission. A
+// deny grant never grants anything
+func (r *RoleResolution) Grants(permission string) bool {
+	return !r.Denied && rolesGrant(r.grants, r.Names(), permission)
+}
+
+// ResolveRoles : gets the roles applying to the user on a resource,
+// walking up its parents until a role is found
+func (u *User) ResolveRoles(resourceType, resourceID string) RoleResolution {
+	res := RoleResolution{grants: u.grants}
+
+	level := []ResourceRef{{Type: resourceType, ID: resourceID}}
+
+	for depth := 0; len(level) > 0; depth++ {
+		for _, r := range level {
+			if roles := u.ActiveRoles(r.Type, r.ID); len(roles) > 0 {
+				res.Resources = append(res.Resources, r)
+				res.Roles = append(res.Roles, roles...)
+			}
+		}
+
+		if len(res.Roles) > 0 {
+			res.Inherited = depth > 0
+			res.Denied = hasRole(res.Names(), DenyRole)
+			return res
+		}
+
+		level = u.resourceParents(level)
+	}
+
+	return res
+}
+
+// resourceParents : gets the resources the given ones inherit roles from
+func (u *User) resourceParents(resources []ResourceRef) []ResourceRef {
+	var parents []ResourceRef
+
+	for _, r := range resources {
+		parts := strings.Split(r.ID, "/")
+
+		switch r.Type {
+		case "build":
+			if len(parts) > 2 {
+				parents = append(parents, ResourceRef{Type: "environment", ID: parts[0] + "/" + parts[1]})
+			} else if len(parts) == 2 {
+				parents = append(parents, ResourceRef{Type: "project", ID: parts[0]})
+			}
+		case "environment":
+			parents = append(parents, ResourceRef{Type: "project", ID: parts[0]})
+			for _, p := range u.attachedPolicies(r.ID) {
+				parents = append(parents, ResourceRef{Type: "policy", ID: p})
+			}
+		}
+	}
+
+	return parents
+}
+
+// attachedPolicies : gets the policies the user holds a role on that
+// are attached to the given environment
+func (u *User) attachedPolicies(env string) []string {
+	var attached []string
+
+	names, err := u.GrantedIDs("policy")
+	if err != nil {
+		return nil
+	}
+
+	for _, name := range names {
+		for _, e := range u.policyEnvs(name) {
+			if e == env {
+				attached = append(attached, name)
+				break
+			}
+		}
+	}
+
+	return attached
+}
+
+// policyEnvs : gets the environments a policy is attached to
+func (u *User) policyEnvs(name string) []string {
+	var p Policy
+
+	if u.grants != nil {
+		if envs, ok := u.grants.policies[name]; ok {
+			return envs
+		}
+	}
+
+	if err := p.GetByName(name, &p); err != nil {
+		return nil
+	}
+
+	if u.grants != nil {
+		u.grants.policies[name] = p.Environments
+	}
+
+	return p.Environments
+}
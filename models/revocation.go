@@ -0,0 +1,239 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package models
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/nats-io/go-nats"
+)
+
+// RevocationCacheTTL : how long the revocations of a user are cached
+// before being fetched again. The cache is dropped as soon as any
+// gateway instance revokes a token of the user
+var RevocationCacheTTL = time.Minute
+
+var revocationCache = struct {
+	sync.Mutex
+	users map[string]cachedRevocations
+}{users: make(map[string]cachedRevocations)}
+
+type cachedRevocations struct {
+	revocations []Revocation
+	loadedAt    time.Time
+}
+
+// Revocation holds a revoked token, session or a revocation of every
+// token issued to a user before a given time
+type Revocation struct {
+	ID          int    `json:"id"`
+	TokenID     string `json:"token_id,omitempty"`
+	Username    string `json:"username"`
+	ExpiresAt   int64  `json:"expires_at"`
+	CreatedAt   int64  `json:"created_at"`
+	CreatedAtMs int64  `json:"created_at_ms,omitempty"`
+}
+
+// Validate : validates the revocation
+func (r *Revocation) Validate() error {
+	if r.Username == "" {
+		return errors.New("Revocation username is empty")
+	}
+
+	return nil
+}
+
+// FindByUsername : Searches for all revocations related to a user
+func (r *Revocation) FindByUsername(username string, revocations *[]Revocation) (err error) {
+	query := make(map[string]interface{})
+	query["username"] = username
+	return NewBaseModel(r.getStore()).FindBy(query, revocations)
+}
+
+// FindActiveByUsername : Searches for the revocations of a user that
+// have not expired yet. Expired revocations no longer apply to any
+// token, and revocations of all the user tokens are superseded by the
+// latest one, so they are deleted from the store
+func (r *Revocation) FindActiveByUsername(username string) ([]Revocation, error) {
+	var all []Revocation
+	var active []Revocation
+	var latest *Revocation
+
+	if err := r.FindByUsername(username, &all); err != nil {
+		return nil, err
+	}
+
+	for i := range all {
+		if all[i].TokenID == "" && (latest == nil || all[i].revokedBefore() > latest.revokedBefore()) {
+			latest = &all[i]
+		}
+	}
+
+	now := time.Now().Unix()
+	for i, v := range all {
+		superseded := v.TokenID == "" && &all[i] != latest
+		if !superseded && (v.ExpiresAt == 0 || v.ExpiresAt > now) {
+			active = append(active, v)
+			continue
+		}
+
+		if err := v.Delete(); err != nil {
+			h.L.Warning("Could not prune an expired revocation of " + username + ": " + err.Error())
+		}
+	}
+
+	return active, nil
+}
+
+// Save : calls revocation.set with the marshalled current revocation,
+// and lets every gateway instance know the user revocations changed
+func (r *Revocation) Save() (err error) {
+	if r.CreatedAt == 0 {
+		now := time.Now()
+		r.CreatedAt = now.Unix()
+		r.CreatedAtMs = UnixMillis(now)
+	}
+
+	if err = r.Validate(); err != nil {
+		return err
+	}
+
+	if err = NewBaseModel(r.getStore()).Save(r); err != nil {
+		return err
+	}
+
+	forgetRevocations(r.Username)
+	if err := N.Publish(r.getStore()+".created", []byte(r.Username)); err != nil {
+		h.L.Warning("Could not announce the revocation: " + err.Error())
+	}
+
+	return nil
+}
+
+// Delete : will delete a revocation by its id
+func (r *Revocation) Delete() (err error) {
+	query := make(map[string]interface{})
+	query["id"] = r.ID
+	return NewBaseModel(r.getStore()).Delete(query)
+}
+
+// SubscribeRevocations : drops the cached revocations of a user every
+// time any gateway instance revokes one of its tokens
+func SubscribeRevocations() error {
+	_, err := N.Subscribe("revocation.created", func(msg *nats.Msg) {
+		forgetRevocations(string(msg.Data))
+	})
+
+	return err
+}
+
+// RevokeToken : revokes a single token or session by its id until
+// the given expiry time
+func (r *Revocation) RevokeToken(username, id string, expiresAt int64) error {
+	r.Username = username
+	r.TokenID = id
+	r.ExpiresAt = expiresAt
+
+	return r.Save()
+}
+
+// RevokeAll : revokes every token issued to the given user up to now.
+// Api tokens may never expire, so neither does the revocation, until a
+// later one replaces it
+func (r *Revocation) RevokeAll(username string) error {
+	r.Username = username
+	r.ExpiresAt = 0
+
+	return r.Save()
+}
+
+// IsRevoked : checks if a token issued at the given time, in
+// milliseconds, and identified by any of the given ids has been revoked,
+// reading the revocations from the store
+func (r *Revocation) IsRevoked(username string, issuedAt int64, ids ...string) (bool, error) {
+	revocations, err := r.FindActiveByUsername(username)
+	if err != nil {
+		return false, err
+	}
+
+	return anyRevokes(revocations, issuedAt, ids...), nil
+}
+
+// IsRevokedCached : checks if a token has been revoked as IsRevoked
+// does, using the cached revocations of the user. If they can't be
+// fetched, the last ones fetched are used
+func (r *Revocation) IsRevokedCached(username string, issuedAt int64, ids ...string) (bool, error) {
+	revocationCache.Lock()
+	cached, ok := revocationCache.users[username]
+	revocationCache.Unlock()
+
+	if !ok || time.Since(cached.loadedAt) >= RevocationCacheTTL {
+		revocations, err := r.FindActiveByUsername(username)
+		if err != nil && !ok {
+			return false, err
+		}
+
+		if err != nil {
+			h.L.Warning("Could not fetch the revocations of " + username + ", using the cached ones: " + err.Error())
+		} else {
+			cached = cachedRevocations{revocations: revocations, loadedAt: time.Now()}
+			revocationCache.Lock()
+			revocationCache.users[username] = cached
+			revocationCache.Unlock()
+		}
+	}
+
+	return anyRevokes(cached.revocations, issuedAt, ids...), nil
+}
+
+func forgetRevocations(username string) {
+	revocationCache.Lock()
+	delete(revocationCache.users, username)
+	revocationCache.Unlock()
+}
+
+func anyRevokes(revocations []Revocation, issuedAt int64, ids ...string) bool {
+	for _, v := range revocations {
+		if v.revokes(issuedAt, ids...) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// revokes : checks if the revocation applies to a token issued at the
+// given time, in milliseconds, and identified by any of the given ids
+func (r *Revocation) revokes(issuedAt int64, ids ...string) bool {
+	if r.TokenID == "" {
+		return issuedAt < r.revokedBefore()
+	}
+
+	for _, id := range ids {
+		if id != "" && r.TokenID == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// revokedBefore : gets the time, in milliseconds, tokens issued before
+// are revoked. Revocations stored with a precision of seconds cover the
+// whole second they were created on
+func (r *Revocation) revokedBefore() int64 {
+	if r.CreatedAtMs > 0 {
+		return r.CreatedAtMs
+	}
+
+	return (r.CreatedAt + 1) * 1000
+}
+
+func (r *Revocation) getStore() string {
+	return "revocation"
+}
@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"errors"
 	"strconv"
+	"time"
 
 	h "github.com/ernestio/api-gateway/helpers"
 	"github.com/sirupsen/logrus"
@@ -17,19 +18,33 @@ import (
 type Role struct {
 	ID           uint   `json:"id"`
 	UserID       string `json:"user_id"`
+	TeamID       string `json:"team_id,omitempty"`
 	ResourceID   string `json:"resource_id"`
 	ResourceType string `json:"resource_type"`
 	Role         string `json:"role"`
+	StartsAt     int64  `json:"starts_at,omitempty"`
+	ExpiresAt    int64  `json:"expires_at,omitempty"`
+	Duration     string `json:"duration,omitempty"`
 }
 
 // Validate : validates the role
 func (l *Role) Validate() error {
-	if l.UserID == "" {
-		return errors.New("User is empty")
+	if l.UserID != "" && l.TeamID != "" {
+		return errors.New("A role can be assigned to either a user or a team")
 	}
 
-	if !IsAlphaNumeric(l.UserID) {
-		return errors.New("User ID contains invalid characters")
+	if l.TeamID != "" {
+		if !IsAlphaNumeric(l.TeamID) {
+			return errors.New("Team ID contains invalid characters")
+		}
+	} else {
+		if l.UserID == "" {
+			return errors.New("User is empty")
+		}
+
+		if !IsAlphaNumeric(l.UserID) {
+			return errors.New("User ID contains invalid characters")
+		}
 	}
 
 	if l.ResourceID == "" {
@@ -48,9 +63,58 @@ func (l *Role) Validate() error {
 		return errors.New("Role is empty")
 	}
 
+	if !IsAlphaNumeric(l.Role) {
+		return errors.New("Role contains invalid characters")
+	}
+
+	if l.Duration != "" {
+		if l.ExpiresAt != 0 {
+			return errors.New("Role duration and expires_at can't be both specified")
+		}
+
+		if d, err := time.ParseDuration(l.Duration); err != nil || d <= 0 {
+			return errors.New("Role duration is not a valid duration")
+		}
+	}
+
+	if l.ExpiresAt != 0 && l.ExpiresAt <= l.StartsAt {
+		return errors.New("Role expires_at must be later than starts_at")
+	}
+
 	return nil
 }
 
+// SetExpiry : sets when the role expires from its duration, counting
+// from the time the role starts
+func (l *Role) SetExpiry() {
+	if l.Duration == "" {
+		return
+	}
+
+	start := time.Now()
+	if l.StartsAt > start.Unix() {
+		start = time.Unix(l.StartsAt, 0)
+	}
+
+	d, _ := time.ParseDuration(l.Duration)
+	l.ExpiresAt = start.Add(d).Unix()
+	l.Duration = ""
+}
+
+// IsActive : checks if the role has started and has not expired yet
+func (l *Role) IsActive() bool {
+	if l.StartsAt > time.Now().Unix() {
+		return false
+	}
+
+	return !l.IsExpired()
+}
+
+// IsExpired : checks if the role has expired
+func (l *Role) IsExpired() bool {
+	return l.ExpiresAt > 0 && l.ExpiresAt <= time.Now().Unix()
+}
+
 // Map : maps a role from a request's body and validates the input
 func (l *Role) Map(data []byte) error {
 	if err := json.Unmarshal(data, &l); err != nil {
@@ -95,7 +159,16 @@ func (l *Role) FindAllByUserAndResource(u, r string, roles *[]Role) (err error)
 	return NewBaseModel("authorization").FindBy(query, roles)
 }
 
+// FindAllByTeam : Searches for all roles assigned to a team
+func (l *Role) FindAllByTeam(t string, roles *[]Role) (err error) {
+	query := make(map[string]interface{})
+	query["team_id"] = t
+
+	return NewBaseModel("authorization").FindBy(query, roles)
+}
+
 // FindAllIDsByUserAndType : Searches for all resource_ids by user and resource type
+// the user holds an active role on
 func (l *Role) FindAllIDsByUserAndType(u, r string) (ids []string, err error) {
 	var rs []Role
 
@@ -104,12 +177,44 @@ func (l *Role) FindAllIDsByUserAndType(u, r string) (ids []string, err error) {
 	}
 
 	for _, r := range rs {
-		ids = append(ids, r.ResourceID)
+		if r.IsActive() {
+			ids = append(ids, r.ResourceID)
+		}
 	}
 
 	return
 }
 
+// FindAllIDsByTeamAndType : Searches for all resource_ids by team and resource type
+// the team holds an active role on
+func (l *Role) FindAllIDsByTeamAndType(t, r string) (ids []string, err error) {
+	var rs []Role
+
+	query := make(map[string]interface{})
+	query["team_id"] = t
+	query["resource_type"] = r
+
+	if err = NewBaseModel("authorization").FindBy(query, &rs); err != nil {
+		return
+	}
+
+	for _, r := range rs {
+		if r.IsActive() {
+			ids = append(ids, r.ResourceID)
+		}
+	}
+
+	return
+}
+
+// FindAllByRole : Searches for all the grants of a role
+func (l *Role) FindAllByRole(role string, roles *[]Role) (err error) {
+	query := make(map[string]interface{})
+	query["role"] = role
+
+	return NewBaseModel("authorization").FindBy(query, roles)
+}
+
 // FindAllByResource : Searches for all roles on the system by user and resource type
 func (l *Role) FindAllByResource(id, r string, roles *[]Role) (err error) {
 	query := make(map[string]interface{})
@@ -119,25 +224,66 @@ func (l *Role) FindAllByResource(id, r string, roles *[]Role) (err error) {
 	return NewBaseModel("authorization").FindBy(query, roles)
 }
 
+// FindAllByResourceType : Searches for all roles on the system by resource type
+func (l *Role) FindAllByResourceType(r string, roles *[]Role) (err error) {
+	query := make(map[string]interface{})
+	query["resource_type"] = r
+
+	return NewBaseModel("authorization").FindBy(query, roles)
+}
+
 // Save : calls role.set with the marshalled current role
 func (l *Role) Save() (err error) {
 	return NewBaseModel("authorization").Save(l)
 }
 
-// Get : will delete a role by its type
-func (l *Role) Get(userID, resourceID, resourceType string) (role *Role, err error) {
-	var roles []Role
+// FindAllExisting : gets all the roles assigned to the same user or
+// team on the same resource, permanent and time bound
+func (l *Role) FindAllExisting() (roles []Role, err error) {
 	query := make(map[string]interface{})
-	query["resource_id"] = resourceID
-	query["resource_type"] = resourceType
-	query["user_id"] = userID
-	if err = NewBaseModel("authorization").FindBy(query, &roles); err != nil {
+	query["resource_id"] = l.ResourceID
+	query["resource_type"] = l.ResourceType
+	if l.TeamID != "" {
+		query["team_id"] = l.TeamID
+	} else {
+		query["user_id"] = l.UserID
+	}
+
+	err = NewBaseModel("authorization").FindBy(query, &roles)
+
+	return roles, err
+}
+
+// GetExisting : gets the permanent role already assigned to the same
+// user or team on the same resource, if any. Time bound roles are kept
+// as separate grants, so they never replace a permanent one
+func (l *Role) GetExisting() (role *Role, err error) {
+	roles, err := l.FindAllExisting()
+	if err != nil {
 		return nil, err
 	}
-	if len(roles) == 0 {
-		return nil, nil
+
+	for i := range roles {
+		if !roles[i].IsTimeBound() {
+			return &roles[i], nil
+		}
 	}
-	return &roles[0], nil
+
+	return nil, nil
+}
+
+// IsTimeBound : checks if the role is only granted for a period of time
+func (l *Role) IsTimeBound() bool {
+	return l.StartsAt != 0 || l.ExpiresAt != 0
+}
+
+// Principal : returns the user or team the role is assigned to
+func (l *Role) Principal() string {
+	if l.TeamID != "" {
+		return "team:" + l.TeamID
+	}
+
+	return l.UserID
 }
 
 // Delete : will delete a role by its type
@@ -148,6 +294,9 @@ func (l *Role) Delete() (err error) {
 	query["resource_type"] = l.ResourceType
 	query["user_id"] = l.UserID
 	query["role"] = l.Role
+	if l.TeamID != "" {
+		query["team_id"] = l.TeamID
+	}
 
 	return NewBaseModel("authorization").Delete(query)
 }
@@ -176,6 +325,94 @@ func (l *Role) ResourceExists() bool {
 	return false
 }
 
+// TeamExists : check if related team exists
+func (l *Role) TeamExists() bool {
+	var t Team
+	return t.FindByName(l.TeamID) == nil
+}
+
+// SweepExpiredRoles : deletes all the expired roles, announcing every
+// deleted role on authorization.expired. Each expired role is claimed
+// first, so only one gateway deletes and announces it
+func SweepExpiredRoles() (int, error) {
+	var r Role
+	var roles []Role
+	var swept int
+
+	if err := r.FindAll(&roles); err != nil {
+		return 0, err
+	}
+
+	for _, v := range roles {
+		if !v.IsExpired() {
+			continue
+		}
+
+		run := RoleExpiry{
+			RoleID:    v.ID,
+			ExpiresAt: v.ExpiresAt,
+		}
+
+		if done, err := run.Exists(); err != nil || done {
+			continue
+		}
+
+		claimed, err := run.Claim()
+		if err != nil {
+			return swept, err
+		}
+
+		if !claimed {
+			continue
+		}
+
+		run.StartedAt = time.Now().Unix()
+		if err := v.Delete(); err != nil {
+			run.Status = "failed"
+			run.Error = err.Error()
+			if serr := run.Save(); serr != nil {
+				h.L.Warning("Could not save the role expiry: " + serr.Error())
+			}
+			return swept, err
+		}
+		swept++
+
+		h.L.WithFields(logrus.Fields{
+			"principal":     v.Principal(),
+			"resource_type": v.ResourceType,
+			"resource_id":   v.ResourceID,
+			"role":          v.Role,
+		}).Info("Expired role deleted")
+
+		data, _ := json.Marshal(v)
+		if err := N.Publish("authorization.expired", data); err != nil {
+			h.L.Warning("Could not publish the expired role: " + err.Error())
+		}
+
+		run.Status = "done"
+		run.FinishedAt = time.Now().Unix()
+		if err := run.Save(); err != nil {
+			h.L.Warning("Could not save the role expiry: " + err.Error())
+		}
+	}
+
+	return swept, nil
+}
+
+// SplitGrants : separates the roles assigned to users from the roles
+// assigned to teams
+func SplitGrants(roles []Role) (users []Role, teams []Role) {
+	for _, r := range roles {
+		if r.TeamID != "" {
+			teams = append(teams, r)
+		} else {
+			users = append(users, r)
+		}
+	}
+
+	return users, teams
+}
+
 // UserExists : check if related user exists
 func (l *Role) UserExists() bool {
 	var r User
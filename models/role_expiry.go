@@ -0,0 +1,93 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package models
+
+// RoleExpiry holds the record of an expired role being deleted
+type RoleExpiry struct {
+	ID         int    `json:"id"`
+	RoleID     uint   `json:"role_id"`
+	ExpiresAt  int64  `json:"expires_at"`
+	StartedAt  int64  `json:"started_at,omitempty"`
+	FinishedAt int64  `json:"finished_at,omitempty"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	Replica    string `json:"replica"`
+}
+
+// Claim : claims the deletion of an expired role, so only one gateway
+// deletes and announces it. Every replica saves its claim, and the
+// deletion belongs to the first claim stored
+func (r *RoleExpiry) Claim() (bool, error) {
+	var claims []RoleExpiry
+
+	r.Replica = replicaID
+	r.Status = "claimed"
+	if err := r.Save(); err != nil {
+		return false, err
+	}
+
+	if err := r.find(&claims); err != nil {
+		return false, err
+	}
+
+	first := *r
+	for _, c := range claims {
+		if c.Status == "failed" {
+			continue
+		}
+		if c.ID < first.ID || (c.ID == first.ID && c.Replica < first.Replica) {
+			first = c
+		}
+	}
+
+	if first.Replica != replicaID {
+		// another gateway got it first
+		return false, r.Delete()
+	}
+
+	return true, nil
+}
+
+// Exists : checks if the deletion of an expired role has already been
+// claimed. Failed deletions don't count, so they are retried
+func (r *RoleExpiry) Exists() (bool, error) {
+	var claims []RoleExpiry
+
+	if err := r.find(&claims); err != nil {
+		return false, err
+	}
+
+	for _, v := range claims {
+		if v.Status != "failed" {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Save : calls role_expiry.set with the marshalled current record
+func (r *RoleExpiry) Save() (err error) {
+	return NewBaseModel(r.getStore()).Save(r)
+}
+
+// Delete : deletes the record
+func (r *RoleExpiry) Delete() (err error) {
+	query := make(map[string]interface{})
+	query["id"] = r.ID
+	return NewBaseModel(r.getStore()).Delete(query)
+}
+
+// find : gets the records of the same role expiry
+func (r *RoleExpiry) find(claims *[]RoleExpiry) error {
+	query := make(map[string]interface{})
+	query["role_id"] = r.RoleID
+	query["expires_at"] = r.ExpiresAt
+	return NewBaseModel(r.getStore()).FindBy(query, claims)
+}
+
+func (r *RoleExpiry) getStore() string {
+	return "role_expiry"
+}
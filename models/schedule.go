@@ -0,0 +1,226 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/nu7hatch/gouuid"
+)
+
+const (
+	// ScheduleSync : syncs the environment with its provider
+	ScheduleSync = "sync"
+	// ScheduleApply : applies the definition of the latest build
+	ScheduleApply = "apply"
+	// ScheduleDestroy : destroys the environment
+	ScheduleDestroy = "destroy"
+	// SchedulePowerOn : powers on the environment instances
+	SchedulePowerOn = "power_on"
+	// SchedulePowerOff : powers off the environment instances
+	SchedulePowerOff = "power_off"
+)
+
+// replicaID : identifies this gateway when claiming schedule runs
+var replicaID = newReplicaID()
+
+// Schedule holds an action to run on an environment at the times set by
+// a cron expression
+type Schedule struct {
+	Name       string   `json:"name"`
+	Action     string   `json:"action"`
+	Interval   string   `json:"interval"`
+	Timezone   string   `json:"timezone,omitempty"`
+	Resolution string   `json:"resolution,omitempty"`
+	Instances  []string `json:"instances,omitempty"`
+	cron       *Cron
+}
+
+// ScheduleRun holds the record of a schedule being run
+type ScheduleRun struct {
+	ID          int    `json:"id"`
+	Env         string `json:"env"`
+	Schedule    string `json:"schedule"`
+	Action      string `json:"action"`
+	ScheduledAt int64  `json:"scheduled_at"`
+	StartedAt   int64  `json:"started_at,omitempty"`
+	FinishedAt  int64  `json:"finished_at,omitempty"`
+	Status      string `json:"status"`
+	BuildID     string `json:"build_id,omitempty"`
+	Error       string `json:"error,omitempty"`
+	Replica     string `json:"replica"`
+}
+
+// GetSchedules : gets the environment schedules, sorted by name
+func (e *Env) GetSchedules() ([]Schedule, error) {
+	var schedules []Schedule
+
+	for name, v := range e.Schedules {
+		var s Schedule
+
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = json.Unmarshal(data, &s); err != nil {
+			return nil, errors.New("Schedule " + name + " is not valid")
+		}
+
+		s.Name = name
+		if err = s.Validate(); err != nil {
+			return nil, errors.New("Schedule " + name + ": " + err.Error())
+		}
+
+		schedules = append(schedules, s)
+	}
+
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].Name < schedules[j].Name
+	})
+
+	return schedules, nil
+}
+
+// Validate : validates the schedule
+func (s *Schedule) Validate() error {
+	var err error
+
+	switch s.Action {
+	case ScheduleSync, ScheduleApply, ScheduleDestroy, SchedulePowerOn, SchedulePowerOff:
+	default:
+		return errors.New("action must be one of sync, apply, destroy, power_on or power_off")
+	}
+
+	switch s.Resolution {
+	case "", "manual", "auto-accept", "auto-reject":
+	default:
+		return errors.New("resolution must be one of manual, auto-accept or auto-reject")
+	}
+
+	if s.cron, err = ParseCron(s.Interval, s.Timezone); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Due : gets the times the schedule was due at after from and up to to
+func (s *Schedule) Due(from, to time.Time) []time.Time {
+	var due []time.Time
+
+	for t, ok := s.cron.NextUntil(from, to); ok; t, ok = s.cron.NextUntil(t, to) {
+		due = append(due, t)
+	}
+
+	return due
+}
+
+// Claim : claims the run of a schedule due at a time, so only one
+// gateway runs it. Every replica saves its claim, and the run belongs to
+// the first claim stored
+func (r *ScheduleRun) Claim() (bool, error) {
+	var claims []ScheduleRun
+
+	r.Replica = replicaID
+	r.Status = "claimed"
+	if err := r.Save(); err != nil {
+		return false, err
+	}
+
+	query := make(map[string]interface{})
+	query["env"] = r.Env
+	query["schedule"] = r.Schedule
+	query["scheduled_at"] = r.ScheduledAt
+	if err := NewBaseModel(r.getStore()).FindBy(query, &claims); err != nil {
+		return false, err
+	}
+
+	first := *r
+	for _, c := range claims {
+		if c.Status == "failed" {
+			continue
+		}
+		if c.ID < first.ID || (c.ID == first.ID && c.Replica < first.Replica) {
+			first = c
+		}
+	}
+
+	if first.Replica != replicaID {
+		// another gateway got it first
+		return false, r.Delete()
+	}
+
+	return true, nil
+}
+
+// Exists : checks if the run of a schedule due at a time has already
+// been claimed. Failed runs don't count, so they are retried
+func (r *ScheduleRun) Exists() (bool, error) {
+	var runs []ScheduleRun
+
+	query := make(map[string]interface{})
+	query["env"] = r.Env
+	query["schedule"] = r.Schedule
+	query["scheduled_at"] = r.ScheduledAt
+	if err := NewBaseModel(r.getStore()).FindBy(query, &runs); err != nil {
+		return false, err
+	}
+
+	for _, v := range runs {
+		if v.Status != "failed" {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Save : calls schedule_run.set with the marshalled current run
+func (r *ScheduleRun) Save() (err error) {
+	return NewBaseModel(r.getStore()).Save(r)
+}
+
+// Delete : deletes the run
+func (r *ScheduleRun) Delete() (err error) {
+	query := make(map[string]interface{})
+	query["id"] = r.ID
+	return NewBaseModel(r.getStore()).Delete(query)
+}
+
+// FindByEnv : Searches for the runs of an environment schedules, newest
+// first
+func (r *ScheduleRun) FindByEnv(env string, runs *[]ScheduleRun) (err error) {
+	query := make(map[string]interface{})
+	query["env"] = env
+	if err = NewBaseModel(r.getStore()).FindBy(query, runs); err != nil {
+		return err
+	}
+
+	sort.SliceStable(*runs, func(i, j int) bool {
+		return (*runs)[i].ScheduledAt > (*runs)[j].ScheduledAt
+	})
+
+	return nil
+}
+
+func (r *ScheduleRun) getStore() string {
+	return "schedule_run"
+}
+
+func newReplicaID() string {
+	host, _ := os.Hostname()
+
+	u, err := uuid.NewV4()
+	if err != nil {
+		return host
+	}
+
+	return host + "-" + u.String()
+}
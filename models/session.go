@@ -0,0 +1,146 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package models
+
+import (
+	"sync"
+	"time"
+)
+
+// SessionTouchInterval : minimum time between last seen updates of a
+// session
+var SessionTouchInterval = time.Minute
+
+var touched = struct {
+	sync.Mutex
+	sessions map[string]time.Time
+}{sessions: make(map[string]time.Time)}
+
+// Session holds a login session, shared by all the tokens issued on a
+// login and its refreshes
+type Session struct {
+	ID            int    `json:"id"`
+	SessionID     string `json:"session_id"`
+	Username      string `json:"username"`
+	UserAgent     string `json:"user_agent"`
+	ClientVersion string `json:"client_version,omitempty"`
+	IP            string `json:"ip"`
+	IssuedAt      int64  `json:"issued_at"`
+	IssuedAtMs    int64  `json:"issued_at_ms,omitempty"`
+	LastSeen      int64  `json:"last_seen"`
+	ExpiresAt     int64  `json:"expires_at"`
+	Current       bool   `json:"current,omitempty"`
+}
+
+// FindByUsername : Searches for all sessions of a user
+func (s *Session) FindByUsername(username string, sessions *[]Session) (err error) {
+	query := make(map[string]interface{})
+	query["username"] = username
+	return NewBaseModel(s.getStore()).FindBy(query, sessions)
+}
+
+// FindBySessionID : Gets a session by its session id
+func (s *Session) FindBySessionID(id string) (err error) {
+	query := make(map[string]interface{})
+	query["session_id"] = id
+	return NewBaseModel(s.getStore()).GetBy(query, s)
+}
+
+// FindActiveByUsername : Searches for the sessions of a user that
+// have neither expired nor been revoked
+func (s *Session) FindActiveByUsername(username string, sessions *[]Session) error {
+	var all []Session
+	var r Revocation
+
+	if err := s.FindByUsername(username, &all); err != nil {
+		return err
+	}
+
+	revocations, err := r.FindActiveByUsername(username)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	for _, v := range all {
+		if v.ExpiresAt > now && !v.isRevoked(revocations) {
+			*sessions = append(*sessions, v)
+		}
+	}
+
+	return nil
+}
+
+// Save : calls session.set with the marshalled current session
+func (s *Session) Save() (err error) {
+	return NewBaseModel(s.getStore()).Save(s)
+}
+
+// Delete : will delete a session by its id
+func (s *Session) Delete() (err error) {
+	query := make(map[string]interface{})
+	query["id"] = s.ID
+	return NewBaseModel(s.getStore()).Delete(query)
+}
+
+// Touch : updates the last time a session was seen, at most once every
+// SessionTouchInterval
+func (s *Session) Touch(id string) error {
+	now := time.Now()
+
+	touched.Lock()
+	last, ok := touched.sessions[id]
+	if ok && now.Sub(last) < SessionTouchInterval {
+		touched.Unlock()
+		return nil
+	}
+	touched.sessions[id] = now
+	for k, v := range touched.sessions {
+		if now.Sub(v) > SessionTouchInterval {
+			delete(touched.sessions, k)
+		}
+	}
+	touched.Unlock()
+
+	if err := s.FindBySessionID(id); err != nil {
+		return err
+	}
+
+	s.LastSeen = now.Unix()
+
+	return s.Save()
+}
+
+func (s *Session) isRevoked(revocations []Revocation) bool {
+	issuedAt := s.IssuedAtMs
+	if issuedAt == 0 {
+		issuedAt = s.IssuedAt * 1000
+	}
+
+	for _, r := range revocations {
+		if r.revokes(issuedAt, s.SessionID) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Extend : updates the expiry time of a session after its tokens have
+// been refreshed
+func (s *Session) Extend(id string, expiresAt int64) error {
+	if err := s.FindBySessionID(id); err != nil {
+		return err
+	}
+
+	s.LastSeen = time.Now().Unix()
+	s.ExpiresAt = expiresAt
+
+	return s.Save()
+}
+
+func (s *Session) getStore() string {
+	return "session"
+}
@@ -0,0 +1,190 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package models
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	// KeyActive : status of the key signing new tokens
+	KeyActive = "active"
+	// KeyVerify : status of rotated keys, only used to verify tokens
+	KeyVerify = "verify"
+	// KeyRetired : status of keys no longer accepted
+	KeyRetired = "retired"
+)
+
+// SigningKey holds a key used to sign authentication tokens
+type SigningKey struct {
+	ID        int         `json:"id"`
+	KID       string      `json:"kid"`
+	Algorithm string      `json:"algorithm"`
+	Key       string      `json:"key,omitempty"`
+	Status    string      `json:"status"`
+	CreatedAt int64       `json:"created_at"`
+	RotatedAt int64       `json:"rotated_at,omitempty"`
+	signKey   interface{} `json:"-"`
+	verifyKey interface{} `json:"-"`
+}
+
+// FindAll : Searches for all signing keys
+func (k *SigningKey) FindAll(keys *[]SigningKey) (err error) {
+	query := make(map[string]interface{})
+	return NewBaseModel(k.getStore()).FindBy(query, keys)
+}
+
+// Save : calls signing_key.set with the marshalled current key
+func (k *SigningKey) Save() (err error) {
+	return NewBaseModel(k.getStore()).Save(k)
+}
+
+// Generate : generates new key material for the given algorithm
+func (k *SigningKey) Generate(alg string) error {
+	var material []byte
+
+	kid := make([]byte, 8)
+	if _, err := rand.Read(kid); err != nil {
+		return err
+	}
+
+	switch alg {
+	case "HS256":
+		secret := make([]byte, 64)
+		if _, err := rand.Read(secret); err != nil {
+			return err
+		}
+		material = []byte(base64.StdEncoding.EncodeToString(secret))
+	case "RS256":
+		pk, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return err
+		}
+		material = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(pk)})
+	case "ES256":
+		pk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return err
+		}
+		der, err := x509.MarshalECPrivateKey(pk)
+		if err != nil {
+			return err
+		}
+		material = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	default:
+		return errors.New("Signing algorithm accepted values are ['HS256', 'RS256', 'ES256']")
+	}
+
+	encrypted, err := crypt(string(material))
+	if err != nil {
+		return err
+	}
+
+	k.KID = hex.EncodeToString(kid)
+	k.Algorithm = alg
+	k.Key = encrypted
+	k.Status = KeyActive
+	k.CreatedAt = time.Now().Unix()
+
+	return k.parse()
+}
+
+// Method : gets the jwt signing method of the key
+func (k *SigningKey) Method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+// JWK : gets the public key as a json web key, asymmetric keys only
+func (k *SigningKey) JWK() map[string]string {
+	switch pub := k.verifyKey.(type) {
+	case *rsa.PublicKey:
+		return map[string]string{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": k.Algorithm,
+			"kid": k.KID,
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}
+	case *ecdsa.PublicKey:
+		return map[string]string{
+			"kty": "EC",
+			"use": "sig",
+			"alg": k.Algorithm,
+			"kid": k.KID,
+			"crv": "P-256",
+			"x":   base64.RawURLEncoding.EncodeToString(padded(pub.X.Bytes(), 32)),
+			"y":   base64.RawURLEncoding.EncodeToString(padded(pub.Y.Bytes(), 32)),
+		}
+	}
+
+	return nil
+}
+
+// Redact : removes the key material
+func (k *SigningKey) Redact() {
+	k.Key = ""
+}
+
+// parse : decrypts the key material and loads the signing and
+// verification keys
+func (k *SigningKey) parse() error {
+	material, err := decrypt(k.Key)
+	if err != nil {
+		return err
+	}
+
+	switch k.Algorithm {
+	case "HS256":
+		secret, err := base64.StdEncoding.DecodeString(material)
+		if err != nil {
+			return err
+		}
+		k.signKey = secret
+		k.verifyKey = secret
+	case "RS256":
+		pk, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(material))
+		if err != nil {
+			return err
+		}
+		k.signKey = pk
+		k.verifyKey = &pk.PublicKey
+	case "ES256":
+		pk, err := jwt.ParseECPrivateKeyFromPEM([]byte(material))
+		if err != nil {
+			return err
+		}
+		k.signKey = pk
+		k.verifyKey = &pk.PublicKey
+	default:
+		return errors.New("Unknown signing algorithm " + k.Algorithm)
+	}
+
+	return nil
+}
+
+func (k *SigningKey) getStore() string {
+	return "signing_key"
+}
+
+func padded(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+
+	return append(make([]byte, size-len(b)), b...)
+}
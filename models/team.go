@@ -0,0 +1,125 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package models
+
+import (
+	"encoding/json"
+	"errors"
+
+	h "github.com/ernestio/api-gateway/helpers"
+	"github.com/sirupsen/logrus"
+)
+
+// Team holds a group of users roles can be assigned to
+type Team struct {
+	ID          int      `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Members     []string `json:"members"`
+}
+
+// Validate : validates the team
+func (t *Team) Validate() error {
+	if t.Name == "" {
+		return errors.New("Team name is empty")
+	}
+
+	if !IsAlphaNumeric(t.Name) {
+		return errors.New("Team name contains invalid characters")
+	}
+
+	for _, m := range t.Members {
+		if m == "" || !IsAlphaNumeric(m) {
+			return errors.New("Team member '" + m + "' is not a valid username")
+		}
+	}
+
+	return nil
+}
+
+// Map : maps a team from a request's body and validates the input
+func (t *Team) Map(data []byte) error {
+	if err := json.Unmarshal(data, &t); err != nil {
+		h.L.WithFields(logrus.Fields{
+			"input": string(data),
+		}).Error("Couldn't unmarshal given input")
+		return NewError(InvalidInputCode, "Invalid input")
+	}
+
+	return nil
+}
+
+// FindAll : Searches for all teams on the system
+func (t *Team) FindAll(teams *[]Team) (err error) {
+	query := make(map[string]interface{})
+	return NewBaseModel(t.getStore()).FindBy(query, teams)
+}
+
+// FindByName : Gets a team by its name
+func (t *Team) FindByName(name string) (err error) {
+	query := make(map[string]interface{})
+	query["name"] = name
+	return NewBaseModel(t.getStore()).GetBy(query, t)
+}
+
+// FindByMember : Searches for all the teams a user is a member of
+func (t *Team) FindByMember(username string, teams *[]Team) error {
+	var found []Team
+
+	query := make(map[string]interface{})
+	query["member"] = username
+	if err := NewBaseModel(t.getStore()).FindBy(query, &found); err != nil {
+		return err
+	}
+
+	// teams are used to grant roles, never trust the store filtering
+	for _, v := range found {
+		if v.HasMember(username) {
+			*teams = append(*teams, v)
+		}
+	}
+
+	return nil
+}
+
+// HasMember : checks if the given user is a member of the team
+func (t *Team) HasMember(username string) bool {
+	for _, m := range t.Members {
+		if m == username {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RemoveMember : removes the given user from the team members
+func (t *Team) RemoveMember(username string) {
+	members := make([]string, 0, len(t.Members))
+
+	for _, m := range t.Members {
+		if m != username {
+			members = append(members, m)
+		}
+	}
+
+	t.Members = members
+}
+
+// Save : calls team.set with the marshalled current team
+func (t *Team) Save() (err error) {
+	return NewBaseModel(t.getStore()).Save(t)
+}
+
+// Delete : will delete a team by its id
+func (t *Team) Delete() (err error) {
+	query := make(map[string]interface{})
+	query["id"] = t.ID
+	return NewBaseModel(t.getStore()).Delete(query)
+}
+
+func (t *Team) getStore() string {
+	return "team"
+}
@@ -10,6 +10,7 @@ import (
 	"encoding/json"
 	"errors"
 	"log"
+	"net/mail"
 	"regexp"
 	"strconv"
 	"strings"
@@ -29,19 +30,25 @@ const (
 
 // User holds the user response from user-store
 type User struct {
-	ID                 int     `json:"id"`
-	Username           string  `json:"username"`
-	Password           *string `json:"password,omitempty"`
-	OldPassword        *string `json:"oldpassword,omitempty"`
-	Salt               string  `json:"salt,omitempty"`
-	Admin              *bool   `json:"admin,omitempty"`
-	MFA                *bool   `json:"mfa,omitempty"`
-	MFASecret          string  `json:"mfa_secret,omitempty"`
-	VerificationCode   string  `json:"verification_code,omitempty"`
-	EnvMemberships     []Role  `json:"env_memberships,omitempty"`
-	ProjectMemberships []Role  `json:"project_memberships,omitempty"`
-	Type               string  `json:"type,omitempty"`
-	Disabled           *bool   `json:"disabled,omitempty"`
+	ID                 int       `json:"id"`
+	Username           string    `json:"username"`
+	Email              string    `json:"email,omitempty"`
+	Password           *string   `json:"password,omitempty"`
+	OldPassword        *string   `json:"oldpassword,omitempty"`
+	Salt               string    `json:"salt,omitempty"`
+	Admin              *bool     `json:"admin,omitempty"`
+	MFA                *bool     `json:"mfa,omitempty"`
+	MFASecret          string    `json:"mfa_secret,omitempty"`
+	MFARecoveryCodes   []string  `json:"mfa_recovery_codes,omitempty"`
+	MFALastStep        int64     `json:"mfa_last_step,omitempty"`
+	PasswordHistory    []string  `json:"password_history,omitempty"`
+	VerificationCode   string    `json:"verification_code,omitempty"`
+	EnvMemberships     []Role    `json:"env_memberships,omitempty"`
+	ProjectMemberships []Role    `json:"project_memberships,omitempty"`
+	Type               string    `json:"type,omitempty"`
+	Disabled           *bool     `json:"disabled,omitempty"`
+	Scope              *APIToken `json:"-"`
+	grants             *grantCache
 }
 
 // AuthResponse : Describes an Authenticator service response
@@ -66,7 +73,21 @@ func (u *User) Authenticate() (*AuthResponse, error) {
 		return nil, errors.New("mfa required")
 	}
 
-	msg, err := N.Request("authentication.get", []byte(`{"username": "`+u.Username+`", "password": "`+*u.Password+`", "verification_code": "`+u.VerificationCode+`"}`), 10*time.Second)
+	var password string
+	if u.Password != nil {
+		password = *u.Password
+	}
+
+	data, err := json.Marshal(struct {
+		Username         string `json:"username"`
+		Password         string `json:"password"`
+		VerificationCode string `json:"verification_code"`
+	}{u.Username, password, u.VerificationCode})
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := N.Request("authentication.get", data, 10*time.Second)
 	if err != nil {
 		return nil, err
 	}
@@ -89,16 +110,19 @@ func (u *User) Validate() error {
 	if !r.MatchString(u.Username) {
 		return errors.New(`Username can only contain the following characters: a-z 0-9 @._-`)
 	}
-	if u.Password != nil {
-		if *u.Password == "" {
-			return errors.New("Password cannot be empty")
-		}
-		if len(*u.Password) < 8 {
-			return errors.New("Minimum password length is 8 characters")
+	if u.Email != "" {
+		if a, err := mail.ParseAddress(u.Email); err != nil || a.Address != u.Email {
+			return errors.New("Email is not a valid email address")
 		}
-		if !r.MatchString(*u.Password) {
-			return errors.New(`Password can only contain the following characters: a-z 0-9 @._-`)
+	}
+	if u.IsServiceAccount() {
+		if u.Password != nil {
+			return errors.New("Service accounts can't have a password")
 		}
+		return nil
+	}
+	if u.Password != nil && *u.Password == "" {
+		return errors.New("Password cannot be empty")
 	}
 	return nil
 }
@@ -145,6 +169,36 @@ func (u *User) FindByID(id string, user *User) (err error) {
 	return NewBaseModel("user").GetBy(query, user)
 }
 
+// FindOrProvision : finds a federated user of the given type, creating
+// it on its first login. Existing users of a different type are never
+// linked to the external identity
+func (u *User) FindOrProvision(name, userType string, user *User) error {
+	err := u.FindByUserName(name, user)
+	if err == nil {
+		if user.Type != userType {
+			return errors.New("User '" + name + "' already exists and is not a " + userType + " user")
+		}
+		return nil
+	}
+
+	// the user may exist when the store can't be reached
+	if err != h.ErrNotFound {
+		return err
+	}
+
+	*user = User{
+		Username: name,
+		Type:     userType,
+		Admin:    h.Bool(false),
+	}
+
+	if err := user.Validate(); err != nil {
+		return err
+	}
+
+	return user.Save()
+}
+
 // Save : calls user.set with the marshalled current user
 func (u *User) Save() (err error) {
 	return NewBaseModel("user").Save(u)
@@ -159,6 +213,85 @@ func (u *User) Delete(id string) (err error) {
 	return NewBaseModel("user").Delete(query)
 }
 
+// AuthenticateWithRecoveryCode : verifies the user password and consumes
+// one of its mfa recovery codes
+func (u *User) AuthenticateWithRecoveryCode(password, code string) (*AuthResponse, error) {
+	res := AuthResponse{Message: "Provided credentials are not valid"}
+
+	if !u.IsMFAEnabled() || u.Password == nil || !u.ValidPassword(password) {
+		return &res, nil
+	}
+
+	hash := hashRecoveryCode(code)
+
+	// used codes are blanked, so the list is never sent empty and
+	// ignored by the store
+	for i, v := range u.MFARecoveryCodes {
+		if v != "" && subtle.ConstantTimeCompare([]byte(v), []byte(hash)) == 1 {
+			u.MFARecoveryCodes[i] = ""
+			if err := u.SaveMFA(); err != nil {
+				return nil, err
+			}
+			res.OK = true
+			res.Message = ""
+			return &res, nil
+		}
+	}
+
+	return &res, nil
+}
+
+// HasRecoveryCode : checks if the given code is an unused recovery code
+func (u *User) HasRecoveryCode(code string) bool {
+	hash := hashRecoveryCode(code)
+
+	for _, v := range u.MFARecoveryCodes {
+		if v != "" && subtle.ConstantTimeCompare([]byte(v), []byte(hash)) == 1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AcceptTOTP : checks a verification code, rejecting the ones issued
+// for an already accepted time step so a code can't be replayed within
+// its window. The accepted step is kept on the user, to be saved along
+// with it
+func (u *User) AcceptTOTP(code string) bool {
+	step, ok := TOTPStep(u.MFASecret, code)
+	if !ok || step <= u.MFALastStep {
+		return false
+	}
+
+	u.MFALastStep = step
+
+	return true
+}
+
+// SaveMFA : saves the mfa settings of a user loaded from the store,
+// leaving its password untouched
+func (u *User) SaveMFA() error {
+	user := *u
+	user.Password = nil
+	user.OldPassword = nil
+	user.Salt = ""
+
+	return user.Save()
+}
+
+// SavePassword : sets a new password on a user loaded from the store,
+// keeping the given password history
+func (u *User) SavePassword(password string, history []string) error {
+	user := *u
+	user.Password = &password
+	user.OldPassword = nil
+	user.Salt = ""
+	user.PasswordHistory = history
+
+	return user.Save()
+}
+
 // Redact : removes all sensitive fields from the return
 // data before outputting to the user
 func (u *User) Redact(au User) {
@@ -166,6 +299,9 @@ func (u *User) Redact(au User) {
 	u.Password = &empty
 	u.Salt = ""
 	u.MFASecret = ""
+	u.MFARecoveryCodes = nil
+	u.MFALastStep = 0
+	u.PasswordHistory = nil
 
 	if !au.IsAdmin() {
 		u.Admin = nil
@@ -206,6 +342,32 @@ func (u *User) ValidPassword(pw string) bool {
 	return false
 }
 
+// UsedPassword : checks if the given password is the current password
+// of the user or one of the previous ones, up to n passwords
+func (u *User) UsedPassword(pw string, n int) bool {
+	if u.Password != nil && u.ValidPassword(pw) {
+		return true
+	}
+
+	for i, v := range u.PasswordHistory {
+		if i >= n-1 {
+			break
+		}
+
+		parts := strings.SplitN(v, "$", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		previous := User{Password: &parts[1], Salt: parts[0]}
+		if previous.ValidPassword(pw) {
+			return true
+		}
+	}
+
+	return false
+}
+
 // GetPolicies : Gets the related user policies if any
 func (u *User) GetPolicies() (ds []Policy, err error) {
 	var d Policy
@@ -213,8 +375,7 @@ func (u *User) GetPolicies() (ds []Policy, err error) {
 	if u.IsAdmin() {
 		err = d.FindAll(&ds)
 	} else {
-		var r Role
-		if names, err := r.FindAllIDsByUserAndType(u.GetID(), d.GetType()); err == nil {
+		if names, err := u.GrantedIDs(d.GetType()); err == nil {
 			if names == nil {
 				return ds, nil
 			}
@@ -235,7 +396,6 @@ func (u *User) GetProjects() ([]Project, error) {
 	var projects []Project
 	var err error
 	var p Project
-	var r Role
 
 	if u.IsAdmin() {
 		err := p.FindAll(*u, &projects)
@@ -246,7 +406,7 @@ func (u *User) GetProjects() ([]Project, error) {
 		return projects, nil
 	}
 
-	pidsRaw, err := r.FindAllIDsByUserAndType(u.GetID(), "project")
+	pidsRaw, err := u.GrantedIDs("project")
 	if err != nil {
 		return nil, err
 	}
@@ -333,34 +493,31 @@ func (u *User) EnvsBy(filters map[string]interface{}) ([]Env, error) {
 		return uEnvs, err
 	} else {
 		var envs []Env
-		var r Role
-		var roles []Role
 
 		err = e.Find(filters, &envs)
 		if err != nil {
 			return nil, err
 		}
 
-		err = r.FindAllByUser(u.Username, &roles)
-		if err != nil {
+		if len(envs) == 0 {
 			return nil, nil
 		}
 
-		for _, r := range roles {
-			if r.ResourceType != "project" && r.ResourceType != "environment" {
-				continue
-			}
+		// roles are resolved for every environment, so they are loaded
+		// once for all of them
+		c := *u
+		if c.grants == nil {
+			c.CacheGrants()
+		}
+
+		if _, err = c.Grants(); err != nil {
+			return nil, err
+		}
 
-			for _, e := range envs {
-				if r.ResourceType == "project" {
-					if r.ResourceID == strings.Split(e.Name, "/")[0] {
-						rEnvs = append(rEnvs, e)
-					}
-				} else {
-					if r.ResourceID == e.Name {
-						rEnvs = append(rEnvs, e)
-					}
-				}
+		for _, e := range envs {
+			res := c.ResolveRoles(e.GetType(), e.Name)
+			if len(res.Roles) > 0 && !res.Denied {
+				rEnvs = append(rEnvs, e)
 			}
 		}
 	}
@@ -368,6 +525,9 @@ func (u *User) EnvsBy(filters map[string]interface{}) ([]Env, error) {
 	m := make(map[string]bool)
 
 	for _, v := range rEnvs {
+		if u.Scope != nil && !u.Scope.Covers(v.GetType(), v.Name) {
+			continue
+		}
 		if _, ok := m[v.Name]; !ok {
 			uEnvs = append(uEnvs, v)
 			m[v.Name] = true
@@ -407,12 +567,12 @@ type resource interface {
 
 // SetOwner : ...
 func (u *User) SetOwner(o resource) error {
-	return u.setRole(o, "owner")
+	return u.setRole(o, OwnerRole)
 }
 
 // SetReader : ...
 func (u *User) SetReader(o resource) error {
-	return u.setRole(o, "reader")
+	return u.setRole(o, ReaderRole)
 }
 
 // setRole : ...
@@ -435,29 +595,34 @@ func (u *User) Owns(o resource) bool {
 
 // IsOwner : check if is the owner of a specific resource
 func (u *User) IsOwner(resourceType, resourceID string) bool {
-	owner := "owner"
-	reader := "reader"
+	if u.IsAdmin() {
+		return true
+	}
+
+	res := u.ResolveRoles(resourceType, resourceID)
 
+	return !res.Denied && hasRole(res.Names(), OwnerRole)
+}
+
+// CanGrant : check if the user can grant a role, which needs it to own
+// the resource for at least as long as the role lasts
+func (u *User) CanGrant(r *Role) bool {
 	if u.IsAdmin() {
 		return true
 	}
 
-	if role, err := u.getRole(resourceType, resourceID); err == nil {
-		if role == owner {
-			return true
-		}
-		if role == reader {
-			return false
-		}
+	res := u.ResolveRoles(r.ResourceType, r.ResourceID)
+	if res.Denied {
+		return false
 	}
-	if resourceType == "build" || resourceType == "environment" {
-		parts := strings.Split(resourceID, "/")
-		if len(parts) > 0 {
-			if role, err := u.getRole("project", parts[0]); err == nil {
-				if role == owner {
-					return true
-				}
-			}
+
+	for _, v := range res.Roles {
+		if v.Role != OwnerRole {
+			continue
+		}
+
+		if v.ExpiresAt == 0 || (r.ExpiresAt != 0 && r.ExpiresAt <= v.ExpiresAt) {
+			return true
 		}
 	}
 
@@ -466,41 +631,183 @@ func (u *User) IsOwner(resourceType, resourceID string) bool {
 
 // IsReader : check if has reader permissions on a specific resource
 func (u *User) IsReader(resourceType, resourceID string) bool {
-	owner := "owner"
-	reader := "reader"
+	if u.IsAdmin() {
+		return true
+	}
+
+	res := u.ResolveRoles(resourceType, resourceID)
 
+	return !res.Denied && hasRole(res.Names(), ReaderRole, OwnerRole)
+}
+
+// Can : check if the user has been granted a permission on a specific
+// resource, through the permission set of its role
+func (u *User) Can(permission, resourceType, resourceID string) bool {
 	if u.IsAdmin() {
 		return true
 	}
 
-	if role, err := u.getRole(resourceType, resourceID); err == nil {
-		if role == reader || role == owner {
-			return true
+	res := u.ResolveRoles(resourceType, resourceID)
+
+	return res.Grants(permission)
+}
+
+// ActiveRoles : gets the active roles the user holds on a resource,
+// directly or through the teams it is a member of
+func (u *User) ActiveRoles(resourceType, resourceID string) []Role {
+	var roles []Role
+
+	if u.grants != nil {
+		grants, _ := u.Grants()
+		for _, v := range grants {
+			if v.ResourceType == resourceType && v.ResourceID == resourceID {
+				roles = append(roles, v)
+			}
 		}
+
+		return roles
 	}
-	if resourceType == "build" || resourceType == "environment" {
-		parts := strings.Split(resourceID, "/")
-		if len(parts) > 0 {
-			if role, err := u.getRole("project", parts[0]); err == nil {
-				if role == reader || role == owner {
-					return true
-				}
+
+	grants := []Role{{UserID: u.GetID(), ResourceID: resourceID, ResourceType: resourceType}}
+	for _, t := range u.Teams() {
+		grants = append(grants, Role{TeamID: t, ResourceID: resourceID, ResourceType: resourceType})
+	}
+
+	// a principal can hold a permanent role along with time bound ones
+	for _, g := range grants {
+		existing, err := g.FindAllExisting()
+		if err != nil {
+			continue
+		}
+
+		for _, v := range existing {
+			if v.IsActive() {
+				roles = append(roles, v)
 			}
 		}
 	}
 
-	return false
+	return roles
+}
+
+// Teams : gets the names of the teams the user is a member of
+func (u *User) Teams() []string {
+	if u.grants != nil {
+		return u.grants.load(u).teams
+	}
+
+	return u.findTeams()
+}
+
+func (u *User) findTeams() []string {
+	var t Team
+	var teams []Team
+	var names []string
+
+	if err := t.FindByMember(u.GetID(), &teams); err != nil {
+		h.L.Debug("Couldn't get the teams of " + u.GetID() + ": " + err.Error())
+		return nil
+	}
+
+	for _, v := range teams {
+		names = append(names, v.Name)
+	}
+
+	return names
+}
+
+// Grants : gets all the active roles assigned to the user, directly or
+// through the teams it is a member of
+func (u *User) Grants() ([]Role, error) {
+	if u.grants != nil {
+		c := u.grants.load(u)
+		return c.roles, c.err
+	}
+
+	return u.findGrants(u.findTeams())
+}
+
+func (u *User) findGrants(teams []string) ([]Role, error) {
+	var r Role
+	var all []Role
+	var roles []Role
+
+	if err := r.FindAllByUser(u.GetID(), &all); err != nil {
+		return nil, err
+	}
+
+	for _, t := range teams {
+		var teamRoles []Role
+		if err := r.FindAllByTeam(t, &teamRoles); err != nil {
+			return nil, err
+		}
+		all = append(all, teamRoles...)
+	}
+
+	for _, v := range all {
+		if v.IsActive() {
+			roles = append(roles, v)
+		}
+	}
+
+	return roles, nil
+}
+
+// GrantedIDs : gets the ids of all the resources of a type the user has
+// been granted a role on
+func (u *User) GrantedIDs(resourceType string) (ids []string, err error) {
+	var r Role
+
+	if u.grants != nil {
+		roles, err := u.Grants()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, v := range roles {
+			if v.ResourceType == resourceType {
+				ids = append(ids, v.ResourceID)
+			}
+		}
+
+		return ids, nil
+	}
+
+	if ids, err = r.FindAllIDsByUserAndType(u.GetID(), resourceType); err != nil {
+		return nil, err
+	}
+
+	for _, t := range u.Teams() {
+		teamIDs, err := r.FindAllIDsByTeamAndType(t, resourceType)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, teamIDs...)
+	}
+
+	return ids, nil
 }
 
-func (u *User) getRole(resourceType, resourceID string) (string, error) {
-	var role Role
+func hasRole(roles []string, names ...string) bool {
+	for _, r := range roles {
+		for _, n := range names {
+			if r == n {
+				return true
+			}
+		}
+	}
+
+	return false
+}
 
-	existing, err := role.Get(u.GetID(), resourceID, resourceType)
-	if err != nil || existing == nil {
-		return "", errors.New("Not found")
+func rolesGrant(c *grantCache, roles []string, permission string) bool {
+	for _, r := range roles {
+		if c.roleGrants(r, permission) {
+			return true
+		}
 	}
 
-	return existing.Role, nil
+	return false
 }
 
 // IsAdmin : Check if a user is admin or not
@@ -511,6 +818,54 @@ func (u *User) IsAdmin() bool {
 	return false
 }
 
+// IsServiceAccount : Check if a user is a non human service account
+func (u *User) IsServiceAccount() bool {
+	return u.Type == "service"
+}
+
+// IsScoped : Check if the user is authenticated with a scoped api token
+func (u *User) IsScoped() bool {
+	return u.Scope != nil && u.Scope.IsScoped()
+}
+
+// InScope : Check if the user authentication allows to perform an action
+// on a specific resource
+func (u *User) InScope(action, resourceType, resourceID string) bool {
+	if u.Scope == nil {
+		return true
+	}
+
+	return u.Scope.Allows(action, resourceType, resourceID)
+}
+
+// IsLocal : Check if a user logs in with a password stored on ernest
+func (u *User) IsLocal() bool {
+	return u.Type == "" || u.Type == "local"
+}
+
+// IsOIDC : Check if a user logs in through an OpenID Connect provider
+func (u *User) IsOIDC() bool {
+	return u.Type == "oidc"
+}
+
+// IsLDAP : Check if a user authenticates against an ldap directory
+func (u *User) IsLDAP() bool {
+	return u.Type == "ldap"
+}
+
+// IsMFAEnabled : Check if a user has mfa switched on
+func (u *User) IsMFAEnabled() bool {
+	return u.MFA != nil && *u.MFA
+}
+
+// IsDisabled : Check if a user has been disabled
+func (u *User) IsDisabled() bool {
+	if u.Disabled != nil {
+		return *u.Disabled
+	}
+	return false
+}
+
 // IsMFA checks if a user has Multi-Factor authentication enabled
 func (u *User) IsMFA() (bool, error) {
 	msg, err := N.Request("user.get", []byte(`{"username": "`+u.Username+`"}`), time.Second)
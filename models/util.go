@@ -7,6 +7,7 @@ package models
 import (
 	"log"
 	"regexp"
+	"time"
 )
 
 func IsAlphaNumeric(s string) bool {
@@ -18,3 +19,8 @@ func IsAlphaNumeric(s string) bool {
 
 	return !r.MatchString(s)
 }
+
+// UnixMillis : returns the given time as milliseconds since the epoch
+func UnixMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
@@ -0,0 +1,269 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ernestio/api-gateway/controllers/audit"
+	"github.com/ernestio/api-gateway/models"
+	"github.com/nats-io/go-nats"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var sinkEntry = models.AuditEntry{
+	ID:           1,
+	RequestID:    "r1",
+	Actor:        "alice",
+	Action:       "PUT /api/teams/:team",
+	ResourceType: "team",
+	ResourceID:   "devs",
+	IP:           "10.0.0.1",
+	Status:       200,
+	Timestamp:    time.Now().Unix(),
+}
+
+// freePort gets a local tcp port nobody is listening on
+func freePort() int {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	port := l.Addr().(*net.TCPAddr).Port
+	_ = l.Close()
+
+	return port
+}
+
+// readSyslogFrames reads octet counted syslog messages until there are
+// no more
+func readSyslogFrames(conn net.Conn) []string {
+	var msgs []string
+
+	r := bufio.NewReader(conn)
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		size, err := r.ReadString(' ')
+		if err != nil {
+			return msgs
+		}
+
+		n, err := strconv.Atoi(strings.TrimSpace(size))
+		if err != nil {
+			return msgs
+		}
+
+		msg := make([]byte, n)
+		if _, err = io.ReadFull(r, msg); err != nil {
+			return msgs
+		}
+		msgs = append(msgs, string(msg))
+	}
+}
+
+func TestAuditSinks(t *testing.T) {
+	testsSetup()
+
+	Convey("Scenario: exporting audit entries", t, func() {
+		d := models.NewAuditDispatcher(10)
+		d.SpoolDir, _ = ioutil.TempDir("", "spool")
+		defer func() { _ = os.RemoveAll(d.SpoolDir) }()
+		defer d.Close()
+
+		Convey("Given a file sink", func() {
+			dir, _ := ioutil.TempDir("", "audit")
+			defer func() { _ = os.RemoveAll(dir) }()
+			path := filepath.Join(dir, "audit.log")
+			So(ioutil.WriteFile(path, make([]byte, 1024*1024), 0600), ShouldBeNil)
+
+			d.Set([]models.AuditSink{{Type: models.AuditSinkFile, Logfile: path, MaxSize: 1, MaxFiles: 2}})
+			d.Publish(sinkEntry)
+
+			Convey("It should rotate the full file and write the entry as a json line", func() {
+				var e models.AuditEntry
+				var data []byte
+
+				for i := 0; i < 20 && len(data) == 0; i++ {
+					time.Sleep(50 * time.Millisecond)
+					data, _ = ioutil.ReadFile(path)
+				}
+
+				So(json.Unmarshal(data, &e), ShouldBeNil)
+				So(e.RequestID, ShouldEqual, "r1")
+				So(strings.HasSuffix(string(data), "\n"), ShouldBeTrue)
+
+				info, err := os.Stat(path + ".1")
+				So(err, ShouldBeNil)
+				So(info.Size(), ShouldEqual, 1024*1024)
+			})
+		})
+
+		Convey("Given a udp syslog sink", func() {
+			conn, _ := net.ListenPacket("udp", "127.0.0.1:0")
+			defer func() { _ = conn.Close() }()
+			port := conn.LocalAddr().(*net.UDPAddr).Port
+
+			d.Set([]models.AuditSink{{Type: models.AuditSinkSyslog, Hostname: "127.0.0.1", Port: port}})
+			d.Publish(sinkEntry)
+
+			Convey("It should send the entry as a RFC 5424 message", func() {
+				buf := make([]byte, 4096)
+				_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+				n, _, err := conn.ReadFrom(buf)
+				So(err, ShouldBeNil)
+
+				msg := string(buf[:n])
+				So(msg, ShouldStartWith, "<110>1 ")
+				So(msg, ShouldContainSubstring, " api-gateway ")
+				So(msg, ShouldContainSubstring, ` audit [audit@32473 requestId="r1" actor="alice" action="PUT /api/teams/:team"`)
+				So(msg, ShouldEndWith, "}")
+			})
+		})
+
+		Convey("Given a tcp syslog sink that is down", func() {
+			port := freePort()
+			d.Set([]models.AuditSink{{Type: models.AuditSinkSyslog, Hostname: "127.0.0.1", Port: port, Protocol: "tcp"}})
+			d.Publish(sinkEntry)
+
+			Convey("It should deliver the entry once the sink is back", func() {
+				time.Sleep(200 * time.Millisecond)
+				l, err := net.Listen("tcp", "127.0.0.1:"+strconv.Itoa(port))
+				So(err, ShouldBeNil)
+				defer func() { _ = l.Close() }()
+
+				conn, err := l.Accept()
+				So(err, ShouldBeNil)
+				defer func() { _ = conn.Close() }()
+				_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+				size, err := bufio.NewReader(conn).ReadString(' ')
+				So(err, ShouldBeNil)
+				_, err = strconv.Atoi(strings.TrimSpace(size))
+				So(err, ShouldBeNil)
+			})
+
+			Convey("It should never block the requests", func() {
+				start := time.Now()
+				for i := 0; i < 1000; i++ {
+					d.Publish(sinkEntry)
+				}
+				So(time.Since(start), ShouldBeLessThan, time.Second)
+			})
+
+			Convey("And more entries than fit in its buffer are published", func() {
+				for i := 2; i <= 25; i++ {
+					e := sinkEntry
+					e.RequestID = "r" + strconv.Itoa(i)
+					d.Publish(e)
+				}
+
+				Convey("It should deliver all of them once the sink is back", func() {
+					l, err := net.Listen("tcp", "127.0.0.1:"+strconv.Itoa(port))
+					So(err, ShouldBeNil)
+					defer func() { _ = l.Close() }()
+
+					conn, err := l.Accept()
+					So(err, ShouldBeNil)
+					defer func() { _ = conn.Close() }()
+
+					msgs := readSyslogFrames(conn)
+					So(len(msgs), ShouldEqual, 25)
+					for i := 1; i <= 25; i++ {
+						So(strings.Join(msgs, "\n"), ShouldContainSubstring, `requestId="r`+strconv.Itoa(i)+`"`)
+					}
+				})
+			})
+
+			Convey("And the sinks are reloaded", func() {
+				for i := 2; i <= 5; i++ {
+					e := sinkEntry
+					e.RequestID = "r" + strconv.Itoa(i)
+					d.Publish(e)
+				}
+				time.Sleep(50 * time.Millisecond)
+				d.Set([]models.AuditSink{{Type: models.AuditSinkSyslog, Hostname: "127.0.0.1", Port: port, Protocol: "tcp"}})
+
+				Convey("It should not lose the buffered entries", func() {
+					l, err := net.Listen("tcp", "127.0.0.1:"+strconv.Itoa(port))
+					So(err, ShouldBeNil)
+					defer func() { _ = l.Close() }()
+
+					conn, err := l.Accept()
+					So(err, ShouldBeNil)
+					defer func() { _ = conn.Close() }()
+
+					So(len(readSyslogFrames(conn)), ShouldEqual, 5)
+				})
+			})
+		})
+
+		Convey("Given a nats sink", func() {
+			received := make(chan []byte, 1)
+			_, _ = models.N.Subscribe("audit.export", func(msg *nats.Msg) {
+				received <- msg.Data
+			})
+
+			d.Set([]models.AuditSink{{Type: models.AuditSinkNats, Subject: "audit.export"}})
+			d.Publish(sinkEntry)
+
+			Convey("It should publish the entry on the subject", func() {
+				var e models.AuditEntry
+				select {
+				case data := <-received:
+					So(json.Unmarshal(data, &e), ShouldBeNil)
+					So(e.Actor, ShouldEqual, "alice")
+				case <-time.After(2 * time.Second):
+					So("no entry published", ShouldBeEmpty)
+				}
+			})
+		})
+	})
+
+	Convey("Scenario: configuring audit sinks", t, func() {
+		au := models.User{ID: 1, Username: "admin"}
+
+		Convey("When a sink is added through another gateway", func() {
+			d := models.NewAuditDispatcher(10)
+			defer d.Close()
+			So(d.Subscribe(), ShouldBeNil)
+
+			received := make(chan []byte, 1)
+			_, _ = models.N.Subscribe("audit.changed.export", func(msg *nats.Msg) {
+				received <- msg.Data
+			})
+			_, _ = models.N.Subscribe("audit_sink.find", func(msg *nats.Msg) {
+				_ = models.N.Publish(msg.Reply, []byte(`[{"type":"nats","subject":"audit.changed.export"}]`))
+			})
+			So(models.N.Publish("audit_sink.changed", []byte(`{}`)), ShouldBeNil)
+			time.Sleep(50 * time.Millisecond)
+			d.Publish(sinkEntry)
+
+			Convey("It should reload the sinks and export the entries to it", func() {
+				select {
+				case data := <-received:
+					So(string(data), ShouldContainSubstring, `"actor":"alice"`)
+				case <-time.After(2 * time.Second):
+					So("no entry published", ShouldBeEmpty)
+				}
+			})
+		})
+
+		Convey("When the sink is not valid", func() {
+			st, _ := audit.CreateSink(au, []byte(`{"type":"syslog","hostname":"siem"}`))
+			So(st, ShouldEqual, 400)
+			st, _ = audit.CreateSink(au, []byte(`{"type":"kafka"}`))
+			So(st, ShouldEqual, 400)
+			st, _ = audit.CreateSink(au, []byte(`{"type":"file"}`))
+			So(st, ShouldEqual, 400)
+		})
+	})
+}
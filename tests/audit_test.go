@@ -0,0 +1,249 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/ernestio/api-gateway/controllers"
+	"github.com/ernestio/api-gateway/controllers/audit"
+	"github.com/ernestio/api-gateway/models"
+	"github.com/labstack/echo"
+	"github.com/nats-io/go-nats"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// auditServer serves a few routes behind the audit middleware, as the
+// given user
+func auditServer(username string) *echo.Echo {
+	e := echo.New()
+	e.Pre(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("user", &jwt.Token{Claims: jwt.MapClaims{"username": username, "admin": false}})
+			return next(c)
+		}
+	})
+
+	api := e.Group("/api")
+	api.Use(controllers.Audit)
+	api.GET("/teams/:team", func(c echo.Context) error {
+		return c.JSONBlob(http.StatusOK, []byte(`{}`))
+	})
+	api.PUT("/teams/:team", func(c echo.Context) error {
+		storedTeams[0].Members = append(storedTeams[0].Members, "bob")
+		return c.JSONBlob(http.StatusOK, []byte(`{}`))
+	})
+	api.DELETE("/teams/:team", func(c echo.Context) error {
+		return c.JSONBlob(http.StatusForbidden, []byte(`{"message":"no"}`))
+	})
+	api.GET("/tokens/:token", func(c echo.Context) error {
+		return c.JSONBlob(http.StatusOK, []byte(`{}`))
+	})
+	api.POST("/tokens/", func(c echo.Context) error {
+		return c.JSONBlob(http.StatusOK, []byte(`{"name":"ci","token":"abc","scopes":[{"secret":"x"}]}`))
+	})
+
+	return e
+}
+
+func auditRequest(e *echo.Echo, method, target string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(`{}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.RemoteAddr = "10.0.0.1:41234"
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	return rec
+}
+
+// auditedEntries captures the audit entries being saved
+func auditedEntries() chan models.AuditEntry {
+	entries := make(chan models.AuditEntry, 10)
+
+	_, _ = models.N.Subscribe("audit.set", func(msg *nats.Msg) {
+		var a models.AuditEntry
+		if err := json.Unmarshal(msg.Data, &a); err != nil {
+			log.Println(err)
+		}
+		entries <- a
+
+		if err := models.N.Publish(msg.Reply, msg.Data); err != nil {
+			log.Println(err)
+		}
+	})
+
+	return entries
+}
+
+func nextAuditEntry(entries chan models.AuditEntry) *models.AuditEntry {
+	select {
+	case a := <-entries:
+		return &a
+	case <-time.After(time.Second):
+		return nil
+	}
+}
+
+func TestAudit(t *testing.T) {
+	testsSetup()
+
+	Convey("Scenario: auditing mutating requests", t, func() {
+		storedTeams = []models.Team{{ID: 1, Name: "devs", Members: []string{"alice"}}}
+		storedTeamGrants = nil
+		teamStore("alice", "bob")
+		entries := auditedEntries()
+		e := auditServer("alice")
+
+		Convey("When updating a resource", func() {
+			rec := auditRequest(e, echo.PUT, "/api/teams/devs")
+			a := nextAuditEntry(entries)
+
+			Convey("It should record who changed what", func() {
+				So(a, ShouldNotBeNil)
+				So(a.Actor, ShouldEqual, "alice")
+				So(a.Action, ShouldEqual, "PUT /api/teams/:team")
+				So(a.ResourceType, ShouldEqual, "team")
+				So(a.ResourceID, ShouldEqual, "devs")
+				So(a.IP, ShouldEqual, "10.0.0.1")
+				So(a.Status, ShouldEqual, 200)
+				So(a.RequestID, ShouldNotBeEmpty)
+				So(rec.Header().Get(echo.HeaderXRequestID), ShouldEqual, a.RequestID)
+			})
+
+			Convey("It should record the resource before and after the change", func() {
+				So(a, ShouldNotBeNil)
+				So(a.Before.(map[string]interface{})["members"], ShouldResemble, []interface{}{"alice"})
+				So(a.After.(map[string]interface{})["members"], ShouldResemble, []interface{}{"alice", "bob"})
+			})
+		})
+
+		Convey("When deleting a resource fails", func() {
+			auditRequest(e, echo.DELETE, "/api/teams/devs")
+			a := nextAuditEntry(entries)
+
+			Convey("It should record the failure without an after snapshot", func() {
+				So(a, ShouldNotBeNil)
+				So(a.Status, ShouldEqual, 403)
+				So(a.Before, ShouldNotBeNil)
+				So(a.After, ShouldBeNil)
+			})
+		})
+
+		Convey("When creating a resource", func() {
+			auditRequest(e, echo.POST, "/api/tokens/")
+			a := nextAuditEntry(entries)
+
+			Convey("It should record the created resource redacted", func() {
+				So(a, ShouldNotBeNil)
+				So(a.ResourceType, ShouldEqual, "token")
+				So(a.ResourceID, ShouldEqual, "ci")
+				after := a.After.(map[string]interface{})
+				So(after["token"], ShouldEqual, models.AuditRedacted)
+				So(after["scopes"].([]interface{})[0].(map[string]interface{})["secret"], ShouldEqual, models.AuditRedacted)
+			})
+		})
+
+		Convey("When reading a resource", func() {
+			auditRequest(e, echo.GET, "/api/teams/devs")
+
+			Convey("It should not be audited", func() {
+				So(nextAuditEntry(entries), ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Scenario: querying the audit log", t, func() {
+		now := time.Now().Unix()
+		// the store filters by time and returns the requested page,
+		// newest first
+		stored := []models.AuditEntry{
+			{ID: 2, Actor: "alice", Timestamp: now - 60},
+			{ID: 3, Actor: "alice", Timestamp: now - 3600},
+			{ID: 1, Actor: "alice", Timestamp: now - 7200},
+		}
+		var queries []map[string]int64
+		matching := func(msg *nats.Msg) ([]models.AuditEntry, map[string]int64) {
+			var q map[string]int64
+			var found []models.AuditEntry
+			_ = json.Unmarshal(msg.Data, &q)
+			queries = append(queries, q)
+			for _, e := range stored {
+				if (q["from"] == 0 || e.Timestamp >= q["from"]) && (q["to"] == 0 || e.Timestamp <= q["to"]) {
+					found = append(found, e)
+				}
+			}
+			return found, q
+		}
+		_, _ = models.N.Subscribe("audit.count", func(msg *nats.Msg) {
+			found, _ := matching(msg)
+			data, _ := json.Marshal(map[string]int{"total": len(found)})
+			if err := models.N.Publish(msg.Reply, data); err != nil {
+				log.Println(err)
+			}
+		})
+		_, _ = models.N.Subscribe("audit.find", func(msg *nats.Msg) {
+			found, q := matching(msg)
+			page := []models.AuditEntry{}
+			start := int((q["page"] - 1) * q["per_page"])
+			for i := start; i >= 0 && i < len(found) && i < start+int(q["per_page"]); i++ {
+				page = append(page, found[i])
+			}
+			data, _ := json.Marshal(page)
+			if err := models.N.Publish(msg.Reply, data); err != nil {
+				log.Println(err)
+			}
+		})
+		au := models.User{ID: 1, Username: "admin"}
+
+		Convey("When listing a page of entries", func() {
+			st, res := audit.List(au, "alice", "", "", "", "", "1", "2")
+
+			Convey("It should return the newest entries first", func() {
+				var p models.AuditPage
+				So(st, ShouldEqual, 200)
+				So(json.Unmarshal(res, &p), ShouldBeNil)
+				So(p.Total, ShouldEqual, 3)
+				So(len(p.Entries), ShouldEqual, 2)
+				So(p.Entries[0].ID, ShouldEqual, 2)
+				So(p.Entries[1].ID, ShouldEqual, 3)
+			})
+
+			Convey("It should only get the page from the store", func() {
+				So(queries[len(queries)-1]["page"], ShouldEqual, 1)
+				So(queries[len(queries)-1]["per_page"], ShouldEqual, 2)
+			})
+		})
+
+		Convey("When filtering by time", func() {
+			from := time.Unix(now-5400, 0).UTC().Format(time.RFC3339)
+			st, res := audit.List(au, "", "", "", from, "", "", "")
+
+			Convey("It should only return the entries in range", func() {
+				var p models.AuditPage
+				So(st, ShouldEqual, 200)
+				So(json.Unmarshal(res, &p), ShouldBeNil)
+				So(p.Total, ShouldEqual, 2)
+				So(len(p.Entries), ShouldEqual, 2)
+				So(queries[len(queries)-1]["from"], ShouldEqual, now-5400)
+			})
+		})
+
+		Convey("When the pagination is not valid", func() {
+			st, _ := audit.List(au, "", "", "", "", "", "0", "")
+			So(st, ShouldEqual, 400)
+			st, _ = audit.List(au, "", "", "", "", "", "", "1000")
+			So(st, ShouldEqual, 400)
+			st, _ = audit.List(au, "", "", "", "yesterday", "", "", "")
+			So(st, ShouldEqual, 400)
+		})
+	})
+}
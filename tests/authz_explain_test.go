@@ -0,0 +1,111 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ernestio/api-gateway/controllers/authz"
+	"github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func explain(au models.User, username, endpoint, resourceType, resourceID string) (int, models.AuthzExplanation) {
+	var e models.AuthzExplanation
+
+	st, resp := authz.Explain(au, username, endpoint, resourceType, resourceID)
+	_ = json.Unmarshal(resp, &e)
+
+	return st, e
+}
+
+func lastStep(e models.AuthzExplanation) models.AuthzStep {
+	return e.Chain[len(e.Chain)-1]
+}
+
+func TestAuthzExplain(t *testing.T) {
+	testsSetup()
+	admin := models.User{ID: 1, Username: "admin", Admin: helpers.Bool(true)}
+	alice := models.User{ID: 2, Username: "alice"}
+
+	Convey("Scenario: explaining authorization decisions", t, func() {
+		storedTeams = nil
+		storedTeamGrants = []models.Role{
+			{ID: 1, UserID: "alice", ResourceType: "project", ResourceID: "p1", Role: "reader"},
+			{ID: 2, UserID: "alice", ResourceType: "environment", ResourceID: "p2/e1", Role: "owner"},
+		}
+		teamStore("admin", "alice")
+
+		Convey("When explaining an admin", func() {
+			st, e := explain(admin, "admin", helpers.DeleteEnv, "environment", "p1/e1")
+			Convey("It should be allowed by the admin flag", func() {
+				So(st, ShouldEqual, 200)
+				So(e.Decision, ShouldEqual, "allow")
+				So(lastStep(e).Check, ShouldEqual, models.ExplainAdmin)
+			})
+		})
+
+		Convey("When explaining a role inherited from the project", func() {
+			st, e := explain(admin, "alice", helpers.DeleteEnv, "environment", "p1/e1")
+			Convey("It should deny it with the project role", func() {
+				So(st, ShouldEqual, 200)
+				So(e.Decision, ShouldEqual, "deny")
+				So(e.Status, ShouldEqual, 403)
+				So(e.Message, ShouldContainSubstring, "please login as a resource owner")
+				So(lastStep(e).Check, ShouldEqual, models.ExplainInheritedRole)
+				So(lastStep(e).Roles[0].Role, ShouldEqual, "reader")
+			})
+		})
+
+		Convey("When explaining a direct role", func() {
+			_, e := explain(admin, "alice", helpers.DeleteEnv, "environment", "p2/e1")
+			Convey("It should allow it with the environment role", func() {
+				So(e.Decision, ShouldEqual, "allow")
+				So(lastStep(e).Check, ShouldEqual, models.ExplainRole)
+			})
+		})
+
+		Convey("When explaining a resource without roles", func() {
+			_, e := explain(admin, "alice", helpers.GetEnv, "environment", "p3/e1")
+			Convey("It should report no match", func() {
+				So(e.Decision, ShouldEqual, "deny")
+				So(lastStep(e).Check, ShouldEqual, models.ExplainNoMatch)
+			})
+		})
+
+		Convey("When explaining an admin only resource", func() {
+			_, e := explain(admin, "alice", "users/create", "", "")
+			Convey("It should be denied by the policy", func() {
+				So(e.Decision, ShouldEqual, "deny")
+				So(lastStep(e).Check, ShouldEqual, models.ExplainPolicy)
+			})
+		})
+
+		Convey("When explaining an unlicensed resource", func() {
+			_, e := explain(admin, "admin", "policies/create", "", "")
+			Convey("It should be denied by the license check", func() {
+				So(e.Decision, ShouldEqual, "deny")
+				So(e.Status, ShouldEqual, 405)
+				So(lastStep(e).Check, ShouldEqual, models.ExplainLicense)
+			})
+		})
+
+		Convey("When a user explains somebody else", func() {
+			st, _ := explain(alice, "admin", helpers.GetEnv, "environment", "p1/e1")
+			Convey("It should be forbidden", func() {
+				So(st, ShouldEqual, 403)
+			})
+		})
+
+		Convey("When explaining an unknown endpoint", func() {
+			st, _ := explain(admin, "alice", "fly", "environment", "p1/e1")
+			Convey("It should be rejected", func() {
+				So(st, ShouldEqual, 400)
+			})
+		})
+	})
+}
@@ -0,0 +1,154 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func writePolicy(content string) string {
+	f, _ := ioutil.TempFile("", "authz")
+	_, _ = f.WriteString(content)
+	_ = f.Close()
+	return f.Name()
+}
+
+func TestAuthzPolicy(t *testing.T) {
+	testsSetup()
+	user := models.User{ID: 1, Username: "test", Admin: helpers.Bool(false)}
+	admin := models.User{ID: 2, Username: "admin", Admin: helpers.Bool(true)}
+
+	Convey("Scenario: authorizing with the default policy", t, func() {
+		helpers.SetAuthzPolicy(&helpers.DefaultAuthzPolicy)
+
+		Convey("It should be valid", func() {
+			So(helpers.DefaultAuthzPolicy.Validate(), ShouldBeEmpty)
+		})
+
+		Convey("It should only allow admins on admin resources", func() {
+			st, resp := helpers.IsAuthorized(&user, "usages/report")
+			So(st, ShouldEqual, 403)
+			So(string(resp), ShouldEqual, string(helpers.AuthNonAdmin))
+			st, _ = helpers.IsAuthorized(&admin, "usages/report")
+			So(st, ShouldEqual, 200)
+		})
+
+		Convey("It should allow users on other resources", func() {
+			st, _ := helpers.IsAuthorized(&user, "projects/list")
+			So(st, ShouldEqual, 200)
+		})
+	})
+
+	Convey("Scenario: loading a policy file", t, func() {
+		Convey("Given a default deny policy", func() {
+			path := writePolicy(`
+default: deny
+rules:
+  - effect: allow
+    principals: ["*"]
+    resources: ["projects/*", "usages/report"]
+  - effect: allow
+    principals: [admin]
+    resources: ["*"]
+  - effect: deny
+    principals: ["*"]
+    resources: ["projects/delete"]
+`)
+			defer func() {
+				_ = os.Remove(path)
+			}()
+
+			p, err := helpers.LoadAuthzPolicy(path)
+			So(err, ShouldBeNil)
+			helpers.SetAuthzPolicy(p)
+
+			Convey("It should allow the resources granted by a rule", func() {
+				st, _ := helpers.IsAuthorized(&user, "usages/report")
+				So(st, ShouldEqual, 200)
+				st, _ = helpers.IsAuthorized(&user, "projects/create")
+				So(st, ShouldEqual, 200)
+			})
+
+			Convey("It should deny resources not granted by any rule", func() {
+				st, _ := helpers.IsAuthorized(&user, "envs/get")
+				So(st, ShouldEqual, 403)
+				st, _ = helpers.IsAuthorized(&admin, "envs/get")
+				So(st, ShouldEqual, 200)
+			})
+
+			Convey("It should let deny rules override allow rules", func() {
+				st, _ := helpers.IsAuthorized(&admin, "projects/delete")
+				So(st, ShouldEqual, 403)
+			})
+		})
+
+		Convey("Given a json policy referencing unknown resources", func() {
+			path := writePolicy(`{"default":"allow","owned":["fly"],"rules":[{"effect":"deny","principals":["user","robots"],"resources":["usage/report","users/*"]}]}`)
+			defer func() {
+				_ = os.Remove(path)
+			}()
+
+			p, err := helpers.LoadAuthzPolicy(path)
+
+			Convey("It should report every problem", func() {
+				So(err, ShouldNotBeNil)
+				problems := p.Validate()
+				So(problems, ShouldResemble, []string{
+					"owned references unknown permission 'fly'",
+					"owned or readable must list the permissions 'delete_project', 'update_project', 'delete_env', 'delete_env_force', 'update_env', 'sync_env', 'delete_build', 'reset_build', 'delete_policy', 'update_policy'",
+					"rule 1 references unknown principal 'robots'",
+					"rule 1 references unknown resource 'usage/report'",
+				})
+			})
+		})
+
+		Convey("Given a policy that doesn't list owned and readable permissions", func() {
+			path := writePolicy(`{"default":"allow","rules":[]}`)
+			defer func() {
+				_ = os.Remove(path)
+			}()
+
+			p, err := helpers.LoadAuthzPolicy(path)
+
+			Convey("It should check them against the built in roles", func() {
+				So(err, ShouldBeNil)
+				So(p.IsOwned(helpers.DeleteEnv), ShouldBeTrue)
+				So(p.IsReadable(helpers.GetEnv), ShouldBeTrue)
+			})
+		})
+
+		Convey("Given a policy that leaves out a permission", func() {
+			path := writePolicy(`{"default":"allow","owned":["delete_env"],"readable":["get_environment"],"rules":[]}`)
+			defer func() {
+				_ = os.Remove(path)
+			}()
+
+			_, err := helpers.LoadAuthzPolicy(path)
+
+			Convey("It should be rejected", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "'sync_env'")
+			})
+		})
+
+		Convey("Given a file that can't be parsed", func() {
+			path := writePolicy("default: [")
+			defer func() {
+				_ = os.Remove(path)
+			}()
+
+			_, err := helpers.LoadAuthzPolicy(path)
+			Convey("It should return an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
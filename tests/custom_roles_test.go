@@ -0,0 +1,216 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"testing"
+
+	"github.com/ernestio/api-gateway/controllers/customroles"
+	"github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+	"github.com/nats-io/go-nats"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var storedCustomRoles []models.CustomRole
+var storedGrants []models.Role
+
+// customRoleStore keeps the custom roles and role grants saved during
+// a test
+func customRoleStore() {
+	_, _ = models.N.Subscribe("custom_role.set", func(msg *nats.Msg) {
+		var r models.CustomRole
+		if err := json.Unmarshal(msg.Data, &r); err != nil {
+			log.Println(err)
+		}
+		if r.ID == 0 {
+			r.ID = len(storedCustomRoles) + 1
+			storedCustomRoles = append(storedCustomRoles, r)
+		}
+
+		data, _ := json.Marshal(r)
+		if err := models.N.Publish(msg.Reply, data); err != nil {
+			log.Println(err)
+		}
+	})
+
+	_, _ = models.N.Subscribe("custom_role.get", func(msg *nats.Msg) {
+		var q models.CustomRole
+		if err := json.Unmarshal(msg.Data, &q); err != nil {
+			log.Println(err)
+		}
+
+		data := []byte(`{"_error":"Not found"}`)
+		for _, r := range storedCustomRoles {
+			if r.Name == q.Name {
+				data, _ = json.Marshal(r)
+			}
+		}
+
+		if err := models.N.Publish(msg.Reply, data); err != nil {
+			log.Println(err)
+		}
+	})
+
+	_, _ = models.N.Subscribe("custom_role.find", func(msg *nats.Msg) {
+		data, _ := json.Marshal(storedCustomRoles)
+		if err := models.N.Publish(msg.Reply, data); err != nil {
+			log.Println(err)
+		}
+	})
+
+	_, _ = models.N.Subscribe("custom_role.del", func(msg *nats.Msg) {
+		var q models.CustomRole
+		var kept []models.CustomRole
+		if err := json.Unmarshal(msg.Data, &q); err != nil {
+			log.Println(err)
+		}
+
+		for _, r := range storedCustomRoles {
+			if r.ID != q.ID {
+				kept = append(kept, r)
+			}
+		}
+		storedCustomRoles = kept
+
+		if err := models.N.Publish(msg.Reply, []byte{}); err != nil {
+			log.Println(err)
+		}
+	})
+
+	_, _ = models.N.Subscribe("authorization.find", func(msg *nats.Msg) {
+		var q map[string]interface{}
+		found := []models.Role{}
+		if err := json.Unmarshal(msg.Data, &q); err != nil {
+			log.Println(err)
+		}
+
+		for _, r := range storedGrants {
+			fields := map[string]string{
+				"user_id":       r.UserID,
+				"resource_id":   r.ResourceID,
+				"resource_type": r.ResourceType,
+				"role":          r.Role,
+			}
+			match := true
+			for k, v := range q {
+				if s, ok := v.(string); ok && fields[k] != s {
+					match = false
+				}
+			}
+			if match {
+				found = append(found, r)
+			}
+		}
+
+		data, _ := json.Marshal(found)
+		if err := models.N.Publish(msg.Reply, data); err != nil {
+			log.Println(err)
+		}
+	})
+}
+
+func TestCustomRoles(t *testing.T) {
+	testsSetup()
+	admin := models.User{ID: 2, Username: "admin", Admin: helpers.Bool(true)}
+
+	Convey("Scenario: defining custom roles", t, func() {
+		storedCustomRoles = nil
+		storedGrants = nil
+		customRoleStore()
+
+		Convey("When creating a role with an unknown permission", func() {
+			st, resp := customroles.Create(admin, []byte(`{"name":"operator","permissions":["sync_env","fly"]}`))
+			Convey("It should return a validation error", func() {
+				So(st, ShouldEqual, 400)
+				So(string(resp), ShouldContainSubstring, "Role permission 'fly' is not valid")
+			})
+		})
+
+		Convey("When creating a role named as a built in role", func() {
+			st, resp := customroles.Create(admin, []byte(`{"name":"owner","permissions":["sync_env"]}`))
+			Convey("It should return a validation error", func() {
+				So(st, ShouldEqual, 400)
+				So(string(resp), ShouldContainSubstring, "Role 'owner' is a built in role")
+			})
+		})
+
+		Convey("Given an operator role", func() {
+			st, _ := customroles.Create(admin, []byte(`{"name":"operator","permissions":["sync_env","reset_build"]}`))
+			So(st, ShouldEqual, 200)
+
+			Convey("When creating it again", func() {
+				st, _ := customroles.Create(admin, []byte(`{"name":"operator","permissions":["sync_env"]}`))
+				Convey("It should return a conflict", func() {
+					So(st, ShouldEqual, 409)
+				})
+			})
+
+			Convey("When listing the roles", func() {
+				st, resp := customroles.List(admin)
+				Convey("It should list the built in roles first", func() {
+					var roles []models.CustomRole
+					So(st, ShouldEqual, 200)
+					So(json.Unmarshal(resp, &roles), ShouldBeNil)
+					So(len(roles), ShouldEqual, 4)
+					So(roles[0].Name, ShouldEqual, "owner")
+					So(roles[1].Name, ShouldEqual, "reader")
+					So(roles[2].Name, ShouldEqual, "deny")
+					So(roles[3].Name, ShouldEqual, "operator")
+				})
+			})
+
+			Convey("And a user assigned to it on a project", func() {
+				storedGrants = []models.Role{{ID: 1, UserID: "bob", ResourceType: "project", ResourceID: "p1", Role: "operator"}}
+				bob := models.User{ID: 4, Username: "bob"}
+
+				Convey("It should grant its permissions on the project environments", func() {
+					So(bob.Can(helpers.SyncEnv, "environment", "p1/e1"), ShouldBeTrue)
+					So(bob.Can(helpers.ResetBuild, "environment", "p1/e1"), ShouldBeTrue)
+					st, _ := helpers.IsAuthorizedToResource(&bob, helpers.SyncEnv, "environment", "p1/e1")
+					So(st, ShouldEqual, 200)
+				})
+
+				Convey("It should not grant any other permission", func() {
+					st, resp := helpers.IsAuthorizedToResource(&bob, helpers.DeleteEnv, "environment", "p1/e1")
+					So(st, ShouldEqual, 403)
+					So(string(resp), ShouldEqual, string(helpers.AuthNonOwner))
+					st, resp = helpers.IsAuthorizedToResource(&bob, helpers.SubmitBuild, "environment", "p1/e1")
+					So(st, ShouldEqual, 403)
+					So(string(resp), ShouldEqual, string(helpers.AuthNonReadable))
+				})
+
+				Convey("It should not grant anything on other projects", func() {
+					So(bob.Can(helpers.SyncEnv, "environment", "p2/e1"), ShouldBeFalse)
+				})
+
+				Convey("When a reader role is assigned on an environment", func() {
+					storedGrants = append(storedGrants, models.Role{ID: 2, UserID: "bob", ResourceType: "environment", ResourceID: "p1/e1", Role: "reader"})
+					Convey("It should take precedence over the project role", func() {
+						So(bob.Can(helpers.SyncEnv, "environment", "p1/e1"), ShouldBeFalse)
+						So(bob.Can(helpers.GetEnv, "environment", "p1/e1"), ShouldBeTrue)
+					})
+				})
+
+				Convey("When deleting the role", func() {
+					st, _ := customroles.Delete(admin, "operator")
+					Convey("It should be rejected while it is assigned", func() {
+						So(st, ShouldEqual, 409)
+					})
+				})
+			})
+
+			Convey("When deleting the unassigned role", func() {
+				st, _ := customroles.Delete(admin, "operator")
+				Convey("It should be deleted", func() {
+					So(st, ShouldEqual, 200)
+					So(len(storedCustomRoles), ShouldEqual, 0)
+				})
+			})
+		})
+	})
+}
@@ -0,0 +1,214 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"testing"
+
+	"github.com/ernestio/api-gateway/controllers/envs"
+	"github.com/ernestio/api-gateway/models"
+	"github.com/nats-io/go-nats"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var storedEnvs []models.Env
+
+// clonedBuild is the latest build of the cloned environment, if any
+var clonedBuild string
+
+// cloneStore keeps the environments saved during a test, on projects p1
+// and p2 of type aws and p3 of type azure
+func cloneStore() {
+	var expired []models.Role
+	roleExpiryStore(&expired)
+
+	projects := []models.Project{{ID: 1, Name: "p1", Type: "aws"}, {ID: 2, Name: "p2", Type: "aws"}, {ID: 3, Name: "p3", Type: "azure"}}
+
+	_, _ = models.N.Subscribe("datacenter.get", func(msg *nats.Msg) {
+		var q models.Project
+		if err := json.Unmarshal(msg.Data, &q); err != nil {
+			log.Println(err)
+		}
+
+		data := []byte(`{"_error":"Not found"}`)
+		for _, p := range projects {
+			if p.Name == q.Name {
+				data, _ = json.Marshal(p)
+			}
+		}
+
+		if err := models.N.Publish(msg.Reply, data); err != nil {
+			log.Println(err)
+		}
+	})
+
+	_, _ = models.N.Subscribe("environment.get", func(msg *nats.Msg) {
+		var q models.Env
+		if err := json.Unmarshal(msg.Data, &q); err != nil {
+			log.Println(err)
+		}
+
+		data := []byte(`{"_error":"Not found"}`)
+		for _, e := range storedEnvs {
+			if e.Name == q.Name {
+				data, _ = json.Marshal(e)
+			}
+		}
+
+		if err := models.N.Publish(msg.Reply, data); err != nil {
+			log.Println(err)
+		}
+	})
+
+	_, _ = models.N.Subscribe("environment.set", func(msg *nats.Msg) {
+		var e models.Env
+		if err := json.Unmarshal(msg.Data, &e); err != nil {
+			log.Println(err)
+		}
+		e.ID = len(storedEnvs) + 1
+		storedEnvs = append(storedEnvs, e)
+
+		data, _ := json.Marshal(e)
+		if err := models.N.Publish(msg.Reply, data); err != nil {
+			log.Println(err)
+		}
+	})
+
+	_, _ = models.N.Subscribe("build.get", func(msg *nats.Msg) {
+		data := []byte(`{"_error":"Not found"}`)
+		if clonedBuild != "" {
+			data = []byte(clonedBuild)
+		}
+
+		if err := models.N.Publish(msg.Reply, data); err != nil {
+			log.Println(err)
+		}
+	})
+}
+
+func cloneAction(name, project string, members, apply bool) *models.Action {
+	var a models.Action
+
+	a.Type = "clone"
+	a.Options.Name = name
+	a.Options.Project = project
+	a.Options.Members = members
+	a.Options.Apply = apply
+
+	return &a
+}
+
+func TestCloneEnv(t *testing.T) {
+	testsSetup()
+	alice := models.User{ID: 2, Username: "alice"}
+
+	Convey("Scenario: cloning an environment", t, func() {
+		storedTeams = nil
+		storedEnvs = []models.Env{{
+			ID:          1,
+			ProjectID:   1,
+			Name:        "p1/staging",
+			Type:        "aws",
+			Options:     map[string]interface{}{"sync_interval": float64(5)},
+			Schedules:   map[string]interface{}{"nightly": "destroy"},
+			Credentials: map[string]interface{}{"aws_secret_access_key": "secret"},
+		}}
+		storedTeamGrants = []models.Role{
+			{ID: 1, UserID: "alice", ResourceType: "project", ResourceID: "p1", Role: "owner"},
+			{ID: 2, UserID: "alice", ResourceType: "project", ResourceID: "p2", Role: "owner"},
+			{ID: 3, UserID: "alice", ResourceType: "project", ResourceID: "p3", Role: "owner"},
+			{ID: 4, UserID: "bob", ResourceType: "environment", ResourceID: "p1/staging", Role: "reader"},
+			{ID: 5, TeamID: "qa", ResourceType: "environment", ResourceID: "p1/staging", Role: "owner"},
+		}
+		cloneStore()
+
+		Convey("When cloning on the same project", func() {
+			st, res := envs.Clone(alice, "p1/staging", cloneAction("staging-feature-x", "", false, false), "")
+
+			Convey("It should create a copy of the environment", func() {
+				var a models.Action
+				So(st, ShouldEqual, 200)
+				So(json.Unmarshal(res, &a), ShouldBeNil)
+				So(a.ResourceType, ShouldEqual, "environment")
+				So(a.ResourceID, ShouldEqual, "p1/staging-feature-x")
+				So(len(storedEnvs), ShouldEqual, 2)
+
+				c := storedEnvs[1]
+				So(c.ProjectID, ShouldEqual, 1)
+				So(c.Options, ShouldResemble, storedEnvs[0].Options)
+				So(c.Schedules, ShouldResemble, storedEnvs[0].Schedules)
+				So(c.Credentials, ShouldResemble, storedEnvs[0].Credentials)
+			})
+
+			Convey("It should not copy the members", func() {
+				var r models.Role
+				var roles []models.Role
+				So(r.FindAllByResource("p1/staging-feature-x", "environment", &roles), ShouldBeNil)
+				So(len(roles), ShouldEqual, 1)
+				So(roles[0].UserID, ShouldEqual, "alice")
+			})
+		})
+
+		Convey("When cloning with its members", func() {
+			st, _ := envs.Clone(alice, "p1/staging", cloneAction("copy", "", true, false), "")
+
+			Convey("It should grant the same roles on the copy", func() {
+				var r models.Role
+				var roles []models.Role
+				So(st, ShouldEqual, 200)
+				So(r.FindAllByResource("p1/copy", "environment", &roles), ShouldBeNil)
+				So(len(roles), ShouldEqual, 3)
+			})
+		})
+
+		Convey("When cloning into a project of the same type", func() {
+			st, _ := envs.Clone(alice, "p1/staging", cloneAction("staging", "p2", false, false), "")
+			So(st, ShouldEqual, 200)
+			So(storedEnvs[1].Name, ShouldEqual, "p2/staging")
+			So(storedEnvs[1].ProjectID, ShouldEqual, 2)
+		})
+
+		Convey("When cloning into a project of another type", func() {
+			st, _ := envs.Clone(alice, "p1/staging", cloneAction("staging", "p3", false, false), "")
+			So(st, ShouldEqual, 400)
+			So(len(storedEnvs), ShouldEqual, 1)
+		})
+
+		Convey("When the target environment exists", func() {
+			st, _ := envs.Clone(alice, "p1/staging", cloneAction("staging", "", false, false), "")
+			So(st, ShouldEqual, 409)
+		})
+
+		Convey("When the user can't update the environment", func() {
+			bob := models.User{ID: 3, Username: "bob"}
+			st, _ := envs.Clone(bob, "p1/staging", cloneAction("copy", "", false, false), "")
+			So(st, ShouldEqual, 403)
+			So(len(storedEnvs), ShouldEqual, 1)
+		})
+
+		Convey("When applying a build without any previous build", func() {
+			st, _ := envs.Clone(alice, "p1/staging", cloneAction("copy", "", false, true), "")
+
+			Convey("It should not create the copy", func() {
+				So(st, ShouldEqual, 404)
+				So(len(storedEnvs), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When applying a build with a definition that is not valid", func() {
+			clonedBuild = `{"id":"b1","environment_id":1}`
+			defer func() { clonedBuild = "" }()
+			foundSubscriber("build.get.definition", `name: [`, 1)
+			st, _ := envs.Clone(alice, "p1/staging", cloneAction("copy", "", false, true), "")
+
+			Convey("It should not create the copy", func() {
+				So(st, ShouldEqual, 400)
+				So(len(storedEnvs), ShouldEqual, 1)
+			})
+		})
+	})
+}
@@ -0,0 +1,219 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ernestio/api-gateway/controllers/envs"
+	"github.com/ernestio/api-gateway/controllers/schedules"
+	"github.com/ernestio/api-gateway/models"
+	"github.com/nats-io/go-nats"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEnvExpiry(t *testing.T) {
+	testsSetup()
+	alice := models.User{ID: 2, Username: "alice"}
+	now := time.Now()
+	hours := func(n int) int64 {
+		return now.Add(time.Duration(n) * time.Hour).Unix()
+	}
+
+	Convey("Scenario: setting an environment ttl", t, func() {
+		Convey("It should accept durations and days", func() {
+			d, err := models.ParseTTL("36h")
+			So(err, ShouldBeNil)
+			So(d, ShouldEqual, 36*time.Hour)
+			d, err = models.ParseTTL("7d")
+			So(err, ShouldBeNil)
+			So(d, ShouldEqual, 7*24*time.Hour)
+			_, err = models.ParseTTL("-1h")
+			So(err, ShouldNotBeNil)
+			_, err = models.ParseTTL("a week")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("It should set the expiry from the ttl", func() {
+			e := models.Env{Name: "p1/e1", TTL: "2d"}
+			So(e.SetExpiry(now), ShouldBeNil)
+			So(e.ExpiresAt, ShouldEqual, hours(48))
+		})
+
+		Convey("It should remove the expiry with a ttl of zero", func() {
+			e := models.Env{Name: "p1/e1", TTL: "0", ExpiresAt: hours(1)}
+			So(e.SetExpiry(now), ShouldBeNil)
+			So(e.ExpiresAt, ShouldEqual, 0)
+			So(e.TTL, ShouldEqual, "")
+		})
+
+		Convey("It should reject an expiry in the past", func() {
+			e := models.Env{Name: "p1/e1", ExpiresAt: hours(-1)}
+			So(e.SetExpiry(now), ShouldNotBeNil)
+		})
+	})
+
+	Convey("Scenario: expiring environments", t, func() {
+		var warnings []models.NotificationMessage
+
+		storedRuns = nil
+		storedLocks = nil
+		storedFreezes = nil
+		storedTeams = nil
+		storedTeamGrants = []models.Role{
+			{ID: 1, UserID: "alice", ResourceType: "project", ResourceID: "p1", Role: "owner"},
+			{ID: 2, UserID: "bob", ResourceType: "environment", ResourceID: "p1/soon", Role: "owner"},
+			{ID: 3, UserID: "carol", ResourceType: "environment", ResourceID: "p1/soon", Role: "reader"},
+		}
+		teamStore("alice")
+		lockStore()
+		scheduleStore([]models.Env{
+			{ID: 1, Name: "p1/expired", TTL: "1d", ExpiresAt: hours(-1)},
+			{ID: 2, Name: "p1/soon", TTL: "1d", ExpiresAt: hours(2)},
+			{ID: 3, Name: "p1/later", TTL: "30d", ExpiresAt: hours(24 * 20)},
+			{ID: 4, Name: "p2/soon", ExpiresAt: hours(3)},
+			{ID: 5, Name: "p1/forever"},
+		})
+
+		_, _ = models.N.Subscribe("environment.set", func(msg *nats.Msg) {
+			_ = models.N.Publish(msg.Reply, msg.Data)
+		})
+
+		_, _ = models.N.Subscribe("notification.send", func(msg *nats.Msg) {
+			var w models.NotificationMessage
+			_ = json.Unmarshal(msg.Data, &w)
+			warnings = append(warnings, w)
+			_ = models.N.Publish(msg.Reply, []byte(`{}`))
+		})
+
+		_, _ = models.N.Subscribe("notification.find", func(msg *nats.Msg) {
+			_ = models.N.Publish(msg.Reply, []byte(`[{"id":1,"name":"ops","type":"slack","sources":["p1"]}]`))
+		})
+
+		_, _ = models.N.Subscribe("user.get", func(msg *nats.Msg) {
+			var u models.User
+			_ = json.Unmarshal(msg.Data, &u)
+			data, _ := json.Marshal(models.User{Username: u.Username, Email: u.Username + "@example.com"})
+			_ = models.N.Publish(msg.Reply, data)
+		})
+
+		Convey("When the expiries are checked", func() {
+			storedLocks = []models.EnvLock{{ID: 1, Env: "p1/expired", Reason: "demo", Username: "alice"}}
+			ran := schedules.Expire(now, 72*time.Hour)
+
+			Convey("It should warn the owners of the environments about to expire", func() {
+				So(ran, ShouldEqual, 3)
+				So(len(warnings), ShouldEqual, 2)
+				So(warnings[0].Subject, ShouldEqual, "Environment p1/soon is about to expire")
+				So(warnings[0].To, ShouldResemble, []string{"alice@example.com", "bob@example.com"})
+				So(len(warnings[0].Notifications), ShouldEqual, 1)
+				So(warnings[0].Notifications[0].Name, ShouldEqual, "ops")
+				So(warnings[1].Subject, ShouldEqual, "Environment p2/soon is about to expire")
+				So(warnings[1].Notifications, ShouldBeEmpty)
+			})
+
+			Convey("It should destroy the expired environments as any deletion", func() {
+				So(storedRuns[0].Env, ShouldEqual, "p1/expired")
+				So(storedRuns[0].Schedule, ShouldEqual, models.ExpiryDestroy)
+				So(storedRuns[0].Action, ShouldEqual, models.ScheduleDestroy)
+				So(storedRuns[0].Status, ShouldEqual, "failed")
+				So(storedRuns[0].Error, ShouldEqual, "Environment is locked: demo (alice)")
+			})
+
+			Convey("It should only warn once, and retry the failed destroys", func() {
+				So(schedules.Expire(now.Add(time.Minute), 72*time.Hour), ShouldEqual, 1)
+				So(len(warnings), ShouldEqual, 2)
+				So(len(storedRuns), ShouldEqual, 4)
+				So(storedRuns[3].Env, ShouldEqual, "p1/expired")
+				So(storedRuns[3].Status, ShouldEqual, "failed")
+			})
+		})
+
+		Convey("When extending an environment", func() {
+			st, res := envs.Extend(alice, "p1/soon", []byte(`{"ttl":"3d"}`))
+
+			Convey("It should push its expiry back", func() {
+				var e models.Env
+				So(st, ShouldEqual, 200)
+				So(json.Unmarshal(res, &e), ShouldBeNil)
+				So(e.ExpiresAt, ShouldEqual, hours(2+72))
+			})
+		})
+
+		Convey("When extending an environment by its own ttl", func() {
+			st, res := envs.Extend(alice, "p1/expired", nil)
+
+			Convey("It should count from now once expired", func() {
+				var e models.Env
+				So(st, ShouldEqual, 200)
+				So(json.Unmarshal(res, &e), ShouldBeNil)
+				So(e.ExpiresAt, ShouldBeBetweenOrEqual, hours(24), hours(24)+2)
+			})
+		})
+
+		Convey("When updating an environment", func() {
+			_, _ = models.N.Subscribe("datacenter.get", func(msg *nats.Msg) {
+				_ = models.N.Publish(msg.Reply, []byte(`{"id":1,"name":"p1"}`))
+			})
+			update := func(body string) models.Env {
+				var e models.Env
+				st, res := envs.Update(alice, "p1/soon", []byte(body))
+				So(st, ShouldEqual, 200)
+				So(json.Unmarshal(res, &e), ShouldBeNil)
+				return e
+			}
+
+			Convey("It should keep its expiry unless given", func() {
+				e := update(`{"name":"p1/soon","options":{"sync_interval":10}}`)
+				So(e.TTL, ShouldEqual, "1d")
+				So(e.ExpiresAt, ShouldEqual, hours(2))
+			})
+
+			Convey("It should set the expiry from the given ttl", func() {
+				e := update(`{"name":"p1/soon","ttl":"3d"}`)
+				So(e.TTL, ShouldEqual, "3d")
+				So(e.ExpiresAt, ShouldBeBetweenOrEqual, hours(72), hours(72)+2)
+			})
+
+			Convey("It should remove the expiry with a ttl of zero", func() {
+				e := update(`{"name":"p1/soon","ttl":"0"}`)
+				So(e.ExpiresAt, ShouldEqual, 0)
+			})
+		})
+
+		Convey("When extending an environment without expiry", func() {
+			st, _ := envs.Extend(alice, "p1/forever", []byte(`{"ttl":"1d"}`))
+			So(st, ShouldEqual, 400)
+		})
+
+		Convey("When listing the environments expiring soon", func() {
+			st, res := envs.Expiring(alice, "")
+
+			Convey("It should list the readable ones, soonest first", func() {
+				var list []models.Env
+				So(st, ShouldEqual, 200)
+				So(json.Unmarshal(res, &list), ShouldBeNil)
+				So(len(list), ShouldEqual, 2)
+				So(list[0].Name, ShouldEqual, "p1/expired")
+				So(list[1].Name, ShouldEqual, "p1/soon")
+			})
+
+			Convey("It should include the ones expiring in the given days", func() {
+				var list []models.Env
+				_, res := envs.Expiring(alice, "30")
+				So(json.Unmarshal(res, &list), ShouldBeNil)
+				So(len(list), ShouldEqual, 3)
+				So(list[2].Name, ShouldEqual, "p1/later")
+			})
+
+			Convey("It should reject an invalid period", func() {
+				st, _ := envs.Expiring(alice, "-2")
+				So(st, ShouldEqual, 400)
+			})
+		})
+	})
+}
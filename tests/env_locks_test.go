@@ -0,0 +1,289 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/ernestio/api-gateway/controllers/builds"
+	"github.com/ernestio/api-gateway/controllers/envs"
+	"github.com/ernestio/api-gateway/controllers/freezes"
+	"github.com/ernestio/api-gateway/controllers/schedules"
+	"github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+	"github.com/nats-io/go-nats"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var storedLocks []models.EnvLock
+var storedFreezes []models.Freeze
+var storedOverrides []models.LockOverride
+
+// lockStore keeps the environment locks, freezes and lock overrides
+// saved during a test
+func lockStore() {
+	reply := func(msg *nats.Msg, v interface{}) {
+		data, _ := json.Marshal(v)
+		if err := models.N.Publish(msg.Reply, data); err != nil {
+			log.Println(err)
+		}
+	}
+
+	_, _ = models.N.Subscribe("env_lock.find", func(msg *nats.Msg) {
+		var q models.EnvLock
+		found := []models.EnvLock{}
+		_ = json.Unmarshal(msg.Data, &q)
+		for _, l := range storedLocks {
+			if l.Env == q.Env {
+				found = append(found, l)
+			}
+		}
+		reply(msg, found)
+	})
+
+	_, _ = models.N.Subscribe("env_lock.set", func(msg *nats.Msg) {
+		var l models.EnvLock
+		_ = json.Unmarshal(msg.Data, &l)
+		for i := range storedLocks {
+			if l.ID != 0 && storedLocks[i].ID == l.ID {
+				storedLocks[i] = l
+				reply(msg, l)
+				return
+			}
+		}
+		l.ID = len(storedLocks) + 1
+		storedLocks = append(storedLocks, l)
+		reply(msg, l)
+	})
+
+	_, _ = models.N.Subscribe("env_lock.del", func(msg *nats.Msg) {
+		var q models.EnvLock
+		var kept []models.EnvLock
+		_ = json.Unmarshal(msg.Data, &q)
+		for _, l := range storedLocks {
+			if l.Env != q.Env {
+				kept = append(kept, l)
+			}
+		}
+		storedLocks = kept
+		reply(msg, map[string]string{})
+	})
+
+	_, _ = models.N.Subscribe("freeze.find", func(msg *nats.Msg) {
+		found := []models.Freeze{}
+		reply(msg, append(found, storedFreezes...))
+	})
+
+	_, _ = models.N.Subscribe("freeze.get", func(msg *nats.Msg) {
+		var q models.Freeze
+		_ = json.Unmarshal(msg.Data, &q)
+		for _, f := range storedFreezes {
+			if f.Name == q.Name {
+				reply(msg, f)
+				return
+			}
+		}
+		reply(msg, map[string]string{"_error": "Not found"})
+	})
+
+	_, _ = models.N.Subscribe("freeze.set", func(msg *nats.Msg) {
+		var f models.Freeze
+		_ = json.Unmarshal(msg.Data, &f)
+		f.ID = len(storedFreezes) + 1
+		storedFreezes = append(storedFreezes, f)
+		reply(msg, f)
+	})
+
+	_, _ = models.N.Subscribe("lock_override.set", func(msg *nats.Msg) {
+		var o models.LockOverride
+		_ = json.Unmarshal(msg.Data, &o)
+		o.ID = len(storedOverrides) + 1
+		storedOverrides = append(storedOverrides, o)
+		reply(msg, o)
+	})
+}
+
+func syncAction() *models.Action {
+	var a models.Action
+	a.Type = "sync"
+	return &a
+}
+
+func TestEnvLocks(t *testing.T) {
+	testsSetup()
+	alice := models.User{ID: 2, Username: "alice"}
+	admin := models.User{ID: 1, Username: "admin", Admin: helpers.Bool(true)}
+	now := time.Now()
+
+	Convey("Scenario: locking an environment", t, func() {
+		storedLocks = nil
+		storedFreezes = nil
+		storedOverrides = nil
+		storedTeams = nil
+		storedTeamGrants = []models.Role{
+			{ID: 1, UserID: "alice", ResourceType: "project", ResourceID: "p1", Role: "owner"},
+		}
+		teamStore("alice")
+		scheduleStore([]models.Env{{ID: 1, Name: "p1/e1"}})
+		lockStore()
+
+		Convey("When locking it without a reason", func() {
+			st, _ := envs.Lock(alice, "p1/e1", []byte(`{"duration":"1h"}`))
+			So(st, ShouldEqual, 400)
+		})
+
+		Convey("When locking it with a duration", func() {
+			st, res := envs.Lock(alice, "p1/e1", []byte(`{"reason":"release","duration":"1h"}`))
+
+			Convey("It should store the lock with its expiry", func() {
+				var l models.EnvLock
+				So(st, ShouldEqual, 200)
+				So(json.Unmarshal(res, &l), ShouldBeNil)
+				So(l.Env, ShouldEqual, "p1/e1")
+				So(l.Username, ShouldEqual, "alice")
+				So(l.ExpiresAt, ShouldBeGreaterThan, now.Unix())
+				So(l.Duration, ShouldEqual, "")
+			})
+
+			Convey("It should block any change with a 423", func() {
+				st, res := envs.Sync(alice, "p1/e1", syncAction(), "")
+				So(st, ShouldEqual, 423)
+				So(string(res), ShouldContainSubstring, "release (alice)")
+			})
+
+			Convey("It should list the lock", func() {
+				var locks []models.EnvLock
+				st, res := envs.Locks(alice, "p1/e1")
+				So(st, ShouldEqual, 200)
+				So(json.Unmarshal(res, &locks), ShouldBeNil)
+				So(len(locks), ShouldEqual, 1)
+			})
+
+			Convey("And unlocking it", func() {
+				st, res := envs.Unlock(alice, "p1/e1")
+				So(st, ShouldEqual, 200)
+				So(string(res), ShouldEqual, `{"status": "Environment successfully unlocked"}`)
+				st, _ = envs.Sync(alice, "p1/e1", syncAction(), "")
+				So(st, ShouldEqual, 200)
+			})
+		})
+
+		Convey("When the lock has expired", func() {
+			storedLocks = []models.EnvLock{{ID: 1, Env: "p1/e1", Reason: "release", ExpiresAt: now.Add(-time.Minute).Unix()}}
+
+			Convey("It should not block changes", func() {
+				st, _ := envs.Sync(alice, "p1/e1", syncAction(), "")
+				So(st, ShouldEqual, 200)
+				So(len(storedOverrides), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When changing it with a justification", func() {
+			storedLocks = []models.EnvLock{{ID: 1, Env: "p1/e1", Reason: "release", Username: "alice"}}
+			st, _ := envs.Sync(alice, "p1/e1", syncAction(), "hotfix for incident 42")
+
+			Convey("It should allow it and record the override", func() {
+				So(st, ShouldEqual, 200)
+				So(len(storedOverrides), ShouldEqual, 1)
+				So(storedOverrides[0].BuildID, ShouldEqual, "sync-1")
+				So(storedOverrides[0].Username, ShouldEqual, "alice")
+				So(storedOverrides[0].Justification, ShouldEqual, "hotfix for incident 42")
+				So(storedOverrides[0].Locks, ShouldResemble, []string{"release (alice)"})
+			})
+		})
+
+		Convey("When changing a lock set by another user with a justification", func() {
+			storedLocks = []models.EnvLock{{ID: 1, Env: "p1/e1", Reason: "release", Username: "bob"}}
+			st, _ := envs.Sync(alice, "p1/e1", syncAction(), "hotfix for incident 42")
+
+			Convey("It should only be allowed to admins", func() {
+				So(st, ShouldEqual, 423)
+				So(len(storedOverrides), ShouldEqual, 0)
+
+				st, _ = envs.Sync(admin, "p1/e1", syncAction(), "hotfix for incident 42")
+				So(st, ShouldEqual, 200)
+				So(len(storedOverrides), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When reviewing a build on a locked environment", func() {
+			storedLocks = []models.EnvLock{{ID: 1, Env: "p1/e1", Reason: "release", Username: "bob"}}
+			st, _ := builds.Review(alice, "p1/e1", syncAction(), "")
+			So(st, ShouldEqual, 423)
+		})
+
+		Convey("When submitting a build to a locked environment", func() {
+			storedLocks = []models.EnvLock{{ID: 1, Env: "p1/e1", Reason: "release", Username: "bob"}}
+			e := models.Env{ID: 1, Name: "p1/e1", Options: map[string]interface{}{"submissions": true}}
+			st, res := builds.Submission(alice, &e, nil, nil, "false", "")
+			So(st, ShouldEqual, 423)
+			So(string(res), ShouldContainSubstring, "release (bob)")
+		})
+
+		Convey("When a user can't update it", func() {
+			bob := models.User{ID: 3, Username: "bob"}
+			st, _ := envs.Lock(bob, "p1/e1", []byte(`{"reason":"release"}`))
+			So(st, ShouldEqual, 403)
+		})
+	})
+
+	Convey("Scenario: freezing changes", t, func() {
+		storedLocks = nil
+		storedFreezes = nil
+		storedRuns = nil
+		lockStore()
+		scheduleStore([]models.Env{{
+			ID:        1,
+			Name:      "p1/e1",
+			Schedules: map[string]interface{}{"nightly": map[string]interface{}{"action": "apply", "interval": "* * * * *"}},
+		}})
+
+		Convey("When creating a freeze ending before it starts", func() {
+			st, _ := freezes.Create(admin, []byte(`{"name":"xmas","reason":"holidays","starts_at":20,"ends_at":10}`))
+			So(st, ShouldEqual, 400)
+		})
+
+		Convey("When a freeze is in effect", func() {
+			body, _ := json.Marshal(models.Freeze{Name: "xmas", Reason: "holidays", StartsAt: now.Add(-time.Hour).Unix(), EndsAt: now.Add(time.Hour).Unix()})
+			st, _ := freezes.Create(admin, body)
+			So(st, ShouldEqual, 200)
+			e := models.Env{ID: 1, Name: "p1/e1"}
+
+			Convey("It should block applies by non admin users", func() {
+				_, err := e.CheckLocks(alice, "", true)
+				So(err, ShouldHaveSameTypeAs, &models.LockedError{})
+				So(err.Error(), ShouldEqual, "Changes are frozen: xmas")
+			})
+
+			Convey("It should not block other changes", func() {
+				o, err := e.CheckLocks(alice, "", false)
+				So(err, ShouldBeNil)
+				So(o, ShouldBeNil)
+			})
+
+			Convey("It should not block admins", func() {
+				o, err := e.CheckLocks(admin, "", true)
+				So(err, ShouldBeNil)
+				So(o, ShouldBeNil)
+			})
+
+			Convey("It should hold scheduled applies", func() {
+				So(schedules.Run(now.Add(-time.Minute), now), ShouldEqual, 1)
+				So(storedRuns[0].Status, ShouldEqual, "failed")
+				So(storedRuns[0].Error, ShouldEqual, "Changes are frozen: xmas")
+			})
+		})
+
+		Convey("When a freeze has ended", func() {
+			storedFreezes = []models.Freeze{{ID: 1, Name: "xmas", StartsAt: now.Add(-2 * time.Hour).Unix(), EndsAt: now.Add(-time.Hour).Unix()}}
+			e := models.Env{ID: 1, Name: "p1/e1"}
+			_, err := e.CheckLocks(alice, "", true)
+			So(err, ShouldBeNil)
+		})
+	})
+}
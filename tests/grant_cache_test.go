@@ -0,0 +1,144 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/ernestio/api-gateway/controllers/envs"
+	"github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+	"github.com/nats-io/go-nats"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var roleQueries []map[string]interface{}
+
+// countRoleLookups counts the requests made to the role store, keeping
+// their queries
+func countRoleLookups(count *int) {
+	var mu sync.Mutex
+
+	_, _ = models.N.Subscribe("authorization.find", func(msg *nats.Msg) {
+		var q map[string]interface{}
+		found := []models.Role{}
+		if err := json.Unmarshal(msg.Data, &q); err != nil {
+			log.Println(err)
+		}
+
+		mu.Lock()
+		*count++
+		roleQueries = append(roleQueries, q)
+		mu.Unlock()
+		for _, r := range storedTeamGrants {
+			if matchesGrant(r, q) {
+				found = append(found, r)
+			}
+		}
+
+		data, _ := json.Marshal(found)
+		if err := models.N.Publish(msg.Reply, data); err != nil {
+			log.Println(err)
+		}
+	})
+}
+
+func TestGrantCache(t *testing.T) {
+	testsSetup()
+
+	Convey("Scenario: looking up the roles of a user", t, func() {
+		var lookups int
+		storedTeams = []models.Team{{ID: 1, Name: "devs", Members: []string{"alice"}}}
+		storedTeamGrants = []models.Role{
+			{ID: 1, UserID: "alice", ResourceType: "project", ResourceID: "p1", Role: "reader"},
+			{ID: 2, TeamID: "devs", ResourceType: "environment", ResourceID: "p2/e1", Role: "owner"},
+			{ID: 3, UserID: "bob", ResourceType: "environment", ResourceID: "p1/e1", Role: "owner"},
+			{ID: 4, UserID: "bob", ResourceType: "environment", ResourceID: "p3/e1", Role: "owner"},
+		}
+		roleQueries = nil
+		teamStore("admin", "alice", "bob")
+		countRoleLookups(&lookups)
+
+		Convey("When the user caches its grants", func() {
+			alice := models.User{ID: 2, Username: "alice"}
+			alice.CacheGrants()
+
+			So(alice.IsReader("environment", "p1/e1"), ShouldBeTrue)
+			So(alice.IsOwner("environment", "p1/e1"), ShouldBeFalse)
+			So(alice.IsOwner("environment", "p2/e1"), ShouldBeTrue)
+			So(alice.Can(helpers.SyncEnv, "environment", "p2/e1"), ShouldBeTrue)
+			So(alice.IsReader("project", "p3"), ShouldBeFalse)
+			envList, err := alice.EnvsBy(map[string]interface{}{})
+			So(err, ShouldBeNil)
+
+			Convey("It should look its roles up once", func() {
+				So(len(envList), ShouldEqual, 2)
+				So(lookups, ShouldEqual, 2)
+			})
+		})
+
+		Convey("When the role store fails while listing environments", func() {
+			foundSubscriber("authorization.find", `{"_error":"Internal error"}`, 1)
+			alice := models.User{ID: 2, Username: "alice"}
+			envList, err := alice.EnvsBy(map[string]interface{}{})
+
+			Convey("It should return the error", func() {
+				So(err, ShouldNotBeNil)
+				So(envList, ShouldBeNil)
+			})
+		})
+
+		Convey("When the user checks the permissions of a custom role", func() {
+			var customLookups int
+			storedTeamGrants = append(storedTeamGrants, models.Role{ID: 5, UserID: "alice", ResourceType: "environment", ResourceID: "p3/e2", Role: "operator"})
+			_, _ = models.N.Subscribe("custom_role.get", func(msg *nats.Msg) {
+				customLookups++
+				if err := models.N.Publish(msg.Reply, []byte(`{"id":1,"name":"operator","permissions":["sync_env"]}`)); err != nil {
+					log.Println(err)
+				}
+			})
+
+			alice := models.User{ID: 2, Username: "alice"}
+			alice.CacheGrants()
+
+			So(alice.Can(helpers.SyncEnv, "environment", "p3/e2"), ShouldBeTrue)
+			So(alice.Can(helpers.DeleteEnv, "environment", "p3/e2"), ShouldBeFalse)
+			So(alice.Can(helpers.SyncEnv, "build", "p3/e2/b1"), ShouldBeTrue)
+
+			Convey("It should look the custom role up once", func() {
+				So(customLookups, ShouldEqual, 1)
+			})
+		})
+
+		Convey("When listing environments", func() {
+			admin := models.User{ID: 1, Username: "admin", Admin: helpers.Bool(true)}
+			st, resp := envs.List(admin, nil)
+
+			var list []models.Env
+			So(json.Unmarshal(resp, &list), ShouldBeNil)
+
+			Convey("It should look the members up once per listed resource", func() {
+				So(st, ShouldEqual, 200)
+				So(lookups, ShouldEqual, 4)
+				So(len(list), ShouldEqual, 2)
+				So(len(list[0].Members), ShouldEqual, 2)
+				So(len(list[1].TeamMembers), ShouldEqual, 1)
+			})
+
+			Convey("It should only look up the members of the listed resources", func() {
+				var ids []string
+				for _, q := range roleQueries {
+					ids = append(ids, q["resource_type"].(string)+":"+q["resource_id"].(string))
+				}
+				sort.Strings(ids)
+				So(ids, ShouldResemble, []string{"environment:p1/e1", "environment:p2/e1", "project:p1", "project:p2"})
+			})
+		})
+	})
+}
@@ -0,0 +1,171 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/ernestio/api-gateway/controllers"
+	"github.com/ernestio/api-gateway/controllers/keys"
+	"github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+	"github.com/nats-io/go-nats"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var storedKeys []models.SigningKey
+
+// signingKeyStore keeps the signing keys saved during a test
+func signingKeyStore() {
+	_, _ = models.N.Subscribe("signing_key.find", func(msg *nats.Msg) {
+		data, _ := json.Marshal(storedKeys)
+		if err := models.N.Publish(msg.Reply, data); err != nil {
+			log.Println(err)
+		}
+	})
+
+	_, _ = models.N.Subscribe("signing_key.set", func(msg *nats.Msg) {
+		var k models.SigningKey
+		if err := json.Unmarshal(msg.Data, &k); err != nil {
+			log.Println(err)
+		}
+
+		found := false
+		for i := range storedKeys {
+			if storedKeys[i].KID == k.KID {
+				storedKeys[i] = k
+				found = true
+			}
+		}
+		if !found {
+			k.ID = len(storedKeys) + 1
+			storedKeys = append(storedKeys, k)
+		}
+
+		data, _ := json.Marshal(k)
+		if err := models.N.Publish(msg.Reply, data); err != nil {
+			log.Println(err)
+		}
+	})
+}
+
+func signedToken() string {
+	t, _ := controllers.Keys.Sign(jwt.MapClaims{"username": "test"})
+	return t
+}
+
+func validToken(t string) bool {
+	token, err := jwt.Parse(t, controllers.Keys.Keyfunc)
+	return err == nil && token.Valid
+}
+
+func TestSigningKeyRotation(t *testing.T) {
+	testsSetup()
+	signingKeyStore()
+	admin := models.User{ID: 2, Username: "admin", Admin: helpers.Bool(true)}
+
+	Convey("Scenario: rotating the signing keys", t, func() {
+		storedKeys = nil
+		controllers.Keys = models.NewKeyring(controllers.Secret)
+		legacy := signedToken()
+
+		Convey("Given no signing keys have been generated", func() {
+			token, _ := jwt.Parse(legacy, controllers.Keys.Keyfunc)
+			Convey("It should sign tokens with the jwt secret", func() {
+				So(token.Valid, ShouldBeTrue)
+				So(token.Header["kid"], ShouldBeNil)
+			})
+
+			Convey("It should not allow retiring the jwt secret", func() {
+				st, _ := keys.Delete(admin, controllers.Keys, models.LegacyKID)
+				So(st, ShouldEqual, 400)
+				So(validToken(legacy), ShouldBeTrue)
+			})
+		})
+
+		Convey("When rotating to an asymmetric key", func() {
+			st, resp := keys.Rotate(admin, controllers.Keys, []byte(`{"algorithm":"RS256"}`))
+			var rsa models.SigningKey
+			So(json.Unmarshal(resp, &rsa), ShouldBeNil)
+			rsaToken := signedToken()
+
+			Convey("It should sign new tokens with the new key", func() {
+				So(st, ShouldEqual, 200)
+				So(rsa.Key, ShouldBeBlank)
+				token, _ := jwt.Parse(rsaToken, controllers.Keys.Keyfunc)
+				So(token.Valid, ShouldBeTrue)
+				So(token.Header["kid"], ShouldEqual, rsa.KID)
+				So(token.Method.Alg(), ShouldEqual, "RS256")
+			})
+
+			Convey("It should keep accepting tokens signed with the jwt secret", func() {
+				So(validToken(legacy), ShouldBeTrue)
+			})
+
+			Convey("It should publish the public key", func() {
+				jwks := controllers.Keys.JWKS()
+				So(len(jwks["keys"]), ShouldEqual, 1)
+				So(jwks["keys"][0]["kid"], ShouldEqual, rsa.KID)
+				So(jwks["keys"][0]["kty"], ShouldEqual, "RSA")
+			})
+
+			Convey("And rotating it again", func() {
+				st, _ := keys.Rotate(admin, controllers.Keys, []byte(`{"algorithm":"ES256"}`))
+				So(st, ShouldEqual, 200)
+
+				Convey("It should keep accepting tokens signed with the previous key", func() {
+					So(validToken(rsaToken), ShouldBeTrue)
+					So(validToken(signedToken()), ShouldBeTrue)
+					So(len(controllers.Keys.JWKS()["keys"]), ShouldEqual, 2)
+				})
+
+				Convey("And retiring the previous key", func() {
+					st, _ := keys.Delete(admin, controllers.Keys, rsa.KID)
+					Convey("It should reject the tokens it signed", func() {
+						So(st, ShouldEqual, 200)
+						So(validToken(rsaToken), ShouldBeFalse)
+						So(validToken(signedToken()), ShouldBeTrue)
+					})
+				})
+			})
+
+			Convey("And retiring the legacy secret", func() {
+				st, _ := keys.Delete(admin, controllers.Keys, models.LegacyKID)
+				Convey("It should reject the tokens signed with the jwt secret", func() {
+					So(st, ShouldEqual, 200)
+					So(validToken(legacy), ShouldBeFalse)
+					So(validToken(rsaToken), ShouldBeTrue)
+				})
+
+				Convey("It should be retired on every gateway", func() {
+					other := models.NewKeyring("secret")
+					So(other.Load(), ShouldBeNil)
+					_, err := jwt.Parse(legacy, other.Keyfunc)
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey("And retiring the active key", func() {
+				st, _ := keys.Delete(admin, controllers.Keys, rsa.KID)
+				Convey("It should fail", func() {
+					So(st, ShouldEqual, 400)
+				})
+			})
+
+			Convey("And a token is signed with the public key as an hmac secret", func() {
+				pub := controllers.Keys.JWKS()["keys"][0]["n"]
+				forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"username": "admin"})
+				forged.Header["kid"] = rsa.KID
+				ft, _ := forged.SignedString([]byte(pub))
+				Convey("It should reject the token", func() {
+					So(validToken(ft), ShouldBeFalse)
+				})
+			})
+		})
+	})
+}
@@ -0,0 +1,97 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/ernestio/api-gateway/controllers/users"
+	"github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+	"github.com/labstack/echo"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLDAPAuthentication(t *testing.T) {
+	testsSetup()
+	d := newMockDirectory()
+	defer func() {
+		_ = d.listener.Close()
+	}()
+
+	d.addUser("alice", "alicepass", "devs")
+
+	_ = os.Setenv("LDAP_URL", d.URL())
+	_ = os.Setenv("LDAP_BASE_DN", "dc=example")
+	_ = os.Setenv("LDAP_BIND_DN", "cn=admin,dc=example")
+	_ = os.Setenv("LDAP_BIND_PASSWORD", "adminpass")
+	_ = os.Setenv("LDAP_GROUP_MAPPINGS", `[{"group":"devs","resource_type":"project","resource_id":"fake","role":"member"}]`)
+	defer func() {
+		_ = os.Unsetenv("LDAP_URL")
+		_ = os.Unsetenv("LDAP_BASE_DN")
+		_ = os.Unsetenv("LDAP_BIND_DN")
+		_ = os.Unsetenv("LDAP_BIND_PASSWORD")
+		_ = os.Unsetenv("LDAP_GROUP_MAPPINGS")
+	}()
+
+	Convey("Scenario: logging in as an ldap user", t, func() {
+		Convey("Given the user exists on the directory", func() {
+			notFoundSubscriber("user.get", 2)
+			setUserSubscriber()
+			foundSubscriber("authorization.find", `[]`, 1)
+			foundSubscriber("authorization.set", `{"id":1}`, 1)
+
+			rec, err := authRequest(`{"username":"alice","password":"alicepass"}`)
+			Convey("It should provision the user and issue a token", func() {
+				var res map[string]string
+				So(err, ShouldBeNil)
+				So(rec.Code, ShouldEqual, 200)
+				So(json.Unmarshal(rec.Body.Bytes(), &res), ShouldBeNil)
+				So(res["token"], ShouldNotBeBlank)
+			})
+		})
+
+		Convey("Given the password is not valid", func() {
+			notFoundSubscriber("user.get", 1)
+
+			_, err := authRequest(`{"username":"alice","password":"wrongpass"}`)
+			Convey("It should reject the login", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*echo.HTTPError).Code, ShouldEqual, 403)
+			})
+		})
+	})
+
+	Convey("Scenario: dry-running an ldap group sync", t, func() {
+		admin := models.User{ID: 2, Username: "admin", Admin: helpers.Bool(true)}
+
+		Convey("Given the user has no mapped roles", func() {
+			foundSubscriber("authorization.find", `[{"id":2,"user_id":"alice","resource_type":"project","resource_id":"other","role":"owner"}]`, 1)
+
+			st, resp := users.LDAPSyncPlan(admin, "alice")
+			Convey("It should list the roles to be granted", func() {
+				var res struct {
+					Groups  []string            `json:"groups"`
+					Changes []models.RoleChange `json:"changes"`
+				}
+				So(st, ShouldEqual, 200)
+				So(json.Unmarshal(resp, &res), ShouldBeNil)
+				So(res.Groups, ShouldResemble, []string{"devs"})
+				So(len(res.Changes), ShouldEqual, 1)
+				So(res.Changes[0].Action, ShouldEqual, models.RoleChangeAdd)
+				So(res.Changes[0].Role.ResourceID, ShouldEqual, "fake")
+			})
+		})
+
+		Convey("Given the user doesn't exist on the directory", func() {
+			st, _ := users.LDAPSyncPlan(admin, "bob")
+			Convey("It should return a not found error", func() {
+				So(st, ShouldEqual, 404)
+			})
+		})
+	})
+}
@@ -0,0 +1,151 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ernestio/api-gateway/controllers"
+	"github.com/ernestio/api-gateway/controllers/lockouts"
+	"github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+	"github.com/labstack/echo"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLoginLockout(t *testing.T) {
+	testsSetup()
+	admin := models.User{ID: 2, Username: "admin", Admin: helpers.Bool(true)}
+
+	Convey("Scenario: failing to log in repeatedly", t, func() {
+		controllers.Throttle = models.NewLoginThrottle()
+		controllers.Throttle.MaxFailures = 3
+		controllers.Throttle.Backoff = time.Millisecond
+		controllers.Throttle.MaxBackoff = time.Millisecond
+
+		foundSubscriber("user.get", `{"id":1,"username":"test"}`, 10)
+		foundSubscriber("authentication.get", `{"ok":false,"message":"Provided credentials are not valid"}`, 10)
+
+		for i := 0; i < 3; i++ {
+			_, err := authRequest(`{"username":"test","password":"wrongpass"}`)
+			So(err.(*echo.HTTPError).Code, ShouldEqual, 403)
+		}
+
+		Convey("When trying to log in again", func() {
+			rec, err := authRequest(`{"username":"test","password":"test1234"}`)
+			Convey("It should be rejected until the lockout expires", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*echo.HTTPError).Code, ShouldEqual, 429)
+				wait, _ := strconv.Atoi(rec.Header().Get("Retry-After"))
+				So(wait, ShouldBeBetweenOrEqual, 898, 900)
+			})
+		})
+
+		Convey("When listing the lockouts", func() {
+			st, resp := lockouts.List(controllers.Throttle)
+			Convey("It should list the locked username", func() {
+				var l []models.Lockout
+				So(st, ShouldEqual, 200)
+				So(json.Unmarshal(resp, &l), ShouldBeNil)
+				So(len(l), ShouldEqual, 2)
+				So(l[1].ID, ShouldEqual, "username:test")
+				So(l[1].Failures, ShouldEqual, 3)
+				So(l[1].Locked, ShouldBeTrue)
+				So(l[0].Type, ShouldEqual, "ip")
+				So(l[0].Locked, ShouldBeFalse)
+			})
+		})
+
+		Convey("When an admin clears the lockout", func() {
+			st, _ := lockouts.Delete(admin, controllers.Throttle, "username:test")
+			Convey("It should allow logging in again", func() {
+				So(st, ShouldEqual, 200)
+				So(controllers.Throttle.Check("test", "192.0.2.1"), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When clearing a lockout that doesn't exist", func() {
+			st, _ := lockouts.Delete(admin, controllers.Throttle, "username:other")
+			Convey("It should return a not found error", func() {
+				So(st, ShouldEqual, 404)
+			})
+		})
+	})
+
+	Convey("Scenario: failing to log in with forwarded client ips", t, func() {
+		controllers.Throttle = models.NewLoginThrottle()
+		controllers.Throttle.MaxIPFailures = 2
+		controllers.Throttle.Backoff = time.Millisecond
+		controllers.Throttle.MaxBackoff = time.Millisecond
+
+		foundSubscriber("user.get", `{"id":1,"username":"test"}`, 10)
+		foundSubscriber("authentication.get", `{"ok":false,"message":"Provided credentials are not valid"}`, 10)
+
+		login := func(user, forwarded string) error {
+			e := echo.New()
+			req := httptest.NewRequest(echo.POST, "/auth/", strings.NewReader(`{"username":"`+user+`","password":"wrongpass"}`))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.Header.Set(echo.HeaderXForwardedFor, forwarded)
+			return controllers.AuthenticateHandler(e.NewContext(req, httptest.NewRecorder()))
+		}
+
+		Convey("When the client is not behind a trusted proxy", func() {
+			_ = login("u1", "198.51.100.1")
+			_ = login("u2", "198.51.100.2")
+			err := login("u3", "198.51.100.3")
+
+			Convey("It should lock out its own address", func() {
+				So(err.(*echo.HTTPError).Code, ShouldEqual, 429)
+				So(controllers.Throttle.Check("other", "192.0.2.1"), ShouldBeGreaterThan, 0)
+			})
+		})
+
+		Convey("When the client is behind a trusted proxy", func() {
+			_, proxy, _ := net.ParseCIDR("192.0.2.0/24")
+			controllers.TrustedProxies = []*net.IPNet{proxy}
+			_ = login("u1", "198.51.100.1, 192.0.2.5")
+			_ = login("u2", "203.0.113.9, 198.51.100.1")
+			err := login("u3", "198.51.100.2")
+
+			Convey("It should lock out the forwarded address", func() {
+				So(err.(*echo.HTTPError).Code, ShouldEqual, 403)
+				So(controllers.Throttle.Check("other", "198.51.100.1"), ShouldBeGreaterThan, 0)
+				So(controllers.Throttle.Check("other", "192.0.2.1"), ShouldEqual, 0)
+			})
+		})
+	})
+
+	Convey("Scenario: failing to log in through several gateways", t, func() {
+		gw1 := models.NewLoginThrottle()
+		gw1.MaxFailures = 2
+		gw2 := models.NewLoginThrottle()
+		gw2.MaxFailures = 2
+		So(gw2.Subscribe(), ShouldBeNil)
+
+		gw1.Fail("carol", "192.0.2.7")
+		gw1.Fail("carol", "192.0.2.7")
+		time.Sleep(50 * time.Millisecond)
+
+		Convey("It should lock the username out on every gateway", func() {
+			So(gw2.Check("carol", "192.0.2.8"), ShouldBeGreaterThan, 14*time.Minute)
+			So(len(gw2.List()), ShouldEqual, 2)
+		})
+
+		Convey("When an admin clears the lockout on one of them", func() {
+			So(gw1.Clear("username:carol", "admin"), ShouldBeNil)
+			time.Sleep(50 * time.Millisecond)
+
+			Convey("It should be cleared on every gateway", func() {
+				So(gw2.Check("carol", "192.0.2.8"), ShouldEqual, 0)
+			})
+		})
+	})
+}
@@ -0,0 +1,203 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/ernestio/api-gateway/controllers"
+	"github.com/ernestio/api-gateway/controllers/users"
+	"github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+	"github.com/labstack/echo"
+	"github.com/nats-io/go-nats"
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/crypto/scrypt"
+)
+
+var mfaUser models.User
+
+// mfaUserStore keeps the changes saved to a single user
+func mfaUserStore(password string) {
+	salt := []byte("mfa-test-salt")
+	hash, _ := scrypt.Key([]byte(password), salt, 16384, 8, 1, models.HashSize)
+	encoded := base64.StdEncoding.EncodeToString(hash)
+
+	mfaUser = models.User{
+		ID:       1,
+		Username: "test",
+		Type:     "local",
+		Password: &encoded,
+		Salt:     base64.StdEncoding.EncodeToString(salt),
+	}
+
+	_, _ = models.N.Subscribe("user.get", func(msg *nats.Msg) {
+		data, _ := json.Marshal(mfaUser)
+		if err := models.N.Publish(msg.Reply, data); err != nil {
+			log.Println(err)
+		}
+	})
+
+	_, _ = models.N.Subscribe("user.set", func(msg *nats.Msg) {
+		var u models.User
+		if err := json.Unmarshal(msg.Data, &u); err != nil {
+			log.Println(err)
+		}
+
+		mfaUser.MFA = u.MFA
+		mfaUser.MFASecret = u.MFASecret
+		mfaUser.MFALastStep = u.MFALastStep
+		if u.MFARecoveryCodes != nil {
+			mfaUser.MFARecoveryCodes = u.MFARecoveryCodes
+		}
+
+		if err := models.N.Publish(msg.Reply, msg.Data); err != nil {
+			log.Println(err)
+		}
+	})
+}
+
+func TestMFAEnrollment(t *testing.T) {
+	testsSetup()
+	au := models.User{ID: 1, Username: "test"}
+	admin := models.User{ID: 2, Username: "admin", Admin: helpers.Bool(true)}
+
+	Convey("Scenario: enrolling mfa", t, func() {
+		controllers.Throttle = models.NewLoginThrottle()
+		controllers.Throttle.Backoff = time.Nanosecond
+		mfaUserStore("test1234")
+
+		st, resp := users.EnrollMFA(au, "test")
+		var enrollment map[string]string
+		So(json.Unmarshal(resp, &enrollment), ShouldBeNil)
+
+		Convey("When starting the enrollment", func() {
+			Convey("It should return a secret without enabling mfa", func() {
+				So(st, ShouldEqual, 200)
+				So(enrollment["secret"], ShouldNotBeBlank)
+				So(enrollment["otpauth_uri"], ShouldStartWith, "otpauth://totp/Ernest:test?")
+				So(enrollment["otpauth_uri"], ShouldContainSubstring, "secret="+enrollment["secret"])
+				So(mfaUser.IsMFAEnabled(), ShouldBeFalse)
+			})
+		})
+
+		Convey("When another user starts the enrollment", func() {
+			st, _ := users.EnrollMFA(admin, "test")
+			Convey("It should be forbidden", func() {
+				So(st, ShouldEqual, 403)
+			})
+		})
+
+		Convey("When verifying an invalid code", func() {
+			st, _ := users.VerifyMFA(au, "test", []byte(`{"verification_code":"000000x"}`), controllers.Throttle, "192.0.2.1")
+			Convey("It should not enable mfa", func() {
+				So(st, ShouldEqual, 400)
+				So(mfaUser.IsMFAEnabled(), ShouldBeFalse)
+			})
+
+			Convey("It should count as a failed login attempt", func() {
+				l := controllers.Throttle.List()
+				So(len(l), ShouldEqual, 2)
+				So(l[1].ID, ShouldEqual, "username:test")
+				So(l[1].Failures, ShouldEqual, 1)
+			})
+		})
+
+		Convey("When verifying a valid code", func() {
+			code, _ := models.TOTPCode(enrollment["secret"], time.Now())
+			st, resp := users.VerifyMFA(au, "test", []byte(`{"verification_code":"`+code+`"}`), controllers.Throttle, "192.0.2.1")
+
+			var res map[string][]string
+			So(json.Unmarshal(resp, &res), ShouldBeNil)
+
+			Convey("It should enable mfa and return the recovery codes", func() {
+				So(st, ShouldEqual, 200)
+				So(mfaUser.IsMFAEnabled(), ShouldBeTrue)
+				So(len(res["recovery_codes"]), ShouldEqual, models.RecoveryCodeCount)
+				So(mfaUser.MFARecoveryCodes, ShouldNotContain, res["recovery_codes"][0])
+			})
+
+			Convey("And logging in with a recovery code", func() {
+				recovery := res["recovery_codes"][0]
+				login := func() error {
+					_, err := authRequest(`{"username":"test","password":"test1234","verification_code":"` + recovery + `"}`)
+					return err
+				}
+
+				Convey("It should only accept the code once", func() {
+					So(login(), ShouldBeNil)
+					err := login()
+					So(err, ShouldNotBeNil)
+					So(err.(*echo.HTTPError).Code, ShouldEqual, 403)
+				})
+			})
+
+			Convey("And logging in with the same code", func() {
+				foundSubscriber("authentication.get", `{"ok":true}`, 1)
+				_, err := authRequest(`{"username":"test","password":"test1234","verification_code":"` + code + `"}`)
+				Convey("It should reject the replayed code", func() {
+					So(err, ShouldNotBeNil)
+					So(err.(*echo.HTTPError).Code, ShouldEqual, 403)
+				})
+			})
+
+			Convey("And disabling mfa with the same code", func() {
+				st, _ := users.DisableMFA(au, "test", []byte(`{"verification_code":"`+code+`"}`), controllers.Throttle, "192.0.2.1")
+				Convey("It should reject the replayed code", func() {
+					So(st, ShouldEqual, 400)
+					So(mfaUser.IsMFAEnabled(), ShouldBeTrue)
+				})
+			})
+
+			Convey("And updating the user with its own mfa settings", func() {
+				st, _ := users.Update(au, "test", []byte(`{"username":"test","mfa":true,"mfa_secret":"GEZDGNBVGY3TQOJQ","mfa_recovery_codes":["x"],"mfa_last_step":1,"password_history":["x"]}`))
+				Convey("It should keep the stored ones", func() {
+					So(st, ShouldEqual, 200)
+					So(mfaUser.MFASecret, ShouldEqual, enrollment["secret"])
+					So(mfaUser.MFARecoveryCodes, ShouldNotContain, "x")
+					So(mfaUser.MFALastStep, ShouldBeGreaterThan, 1)
+				})
+			})
+
+			Convey("And disabling mfa with a recovery code", func() {
+				st, _ := users.DisableMFA(au, "test", []byte(`{"verification_code":"`+res["recovery_codes"][1]+`"}`), controllers.Throttle, "192.0.2.1")
+				Convey("It should disable mfa", func() {
+					So(st, ShouldEqual, 200)
+					So(mfaUser.IsMFAEnabled(), ShouldBeFalse)
+					So(mfaUser.MFASecret, ShouldBeBlank)
+				})
+			})
+
+			Convey("And an admin resets mfa", func() {
+				st, _ := users.ResetMFA(admin, "test")
+				Convey("It should disable mfa", func() {
+					So(st, ShouldEqual, 200)
+					So(mfaUser.IsMFAEnabled(), ShouldBeFalse)
+				})
+			})
+
+			Convey("And a non admin resets mfa", func() {
+				st, _ := users.ResetMFA(au, "test")
+				Convey("It should be forbidden", func() {
+					So(st, ShouldEqual, 403)
+					So(mfaUser.IsMFAEnabled(), ShouldBeTrue)
+				})
+			})
+		})
+	})
+}
+
+func TestTOTPCode(t *testing.T) {
+	Convey("Scenario: generating totp codes", t, func() {
+		// RFC 6238 test vector for the sha1 secret "12345678901234567890"
+		code, err := models.TOTPCode("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", time.Unix(59, 0))
+		So(err, ShouldBeNil)
+		So(code, ShouldEqual, "287082")
+	})
+}
@@ -0,0 +1,215 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ernestio/api-gateway/controllers"
+	"github.com/ernestio/api-gateway/models"
+	"github.com/labstack/echo"
+	"github.com/nats-io/go-nats"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// oidcCookies : cookies set by the last login started, sent back on
+// every following request as a browser would
+var oidcCookies []*http.Cookie
+
+func oidcRequest(e *echo.Echo, h handle, target string) (*httptest.ResponseRecorder, error) {
+	req := httptest.NewRequest(echo.GET, target, nil)
+	for _, c := range oidcCookies {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	return rec, h(e.NewContext(req, rec))
+}
+
+func oidcLogin(e *echo.Echo) (state, nonce string) {
+	oidcCookies = nil
+	rec, _ := oidcRequest(e, controllers.OIDCLoginHandler, "/auth/oidc/")
+	oidcCookies = (&http.Response{Header: rec.Header()}).Cookies()
+	loc, _ := url.Parse(rec.Header().Get("Location"))
+	return loc.Query().Get("state"), loc.Query().Get("nonce")
+}
+
+func TestOIDCLogin(t *testing.T) {
+	testsSetup()
+	idp := newMockIdP()
+	defer idp.server.Close()
+
+	e := echo.New()
+
+	_ = os.Setenv("OIDC_ISSUER", idp.server.URL)
+	_ = os.Setenv("OIDC_CLIENT_ID", "ernest")
+	_ = os.Setenv("OIDC_REDIRECT_URL", "http://ernest/auth/oidc/callback/")
+	_ = os.Setenv("OIDC_GROUP_MAPPINGS", `[{"group":"devs","resource_type":"project","resource_id":"fake","role":"member"}]`)
+	defer func() {
+		_ = os.Unsetenv("OIDC_ISSUER")
+		_ = os.Unsetenv("OIDC_CLIENT_ID")
+		_ = os.Unsetenv("OIDC_REDIRECT_URL")
+		_ = os.Unsetenv("OIDC_GROUP_MAPPINGS")
+	}()
+
+	Convey("Scenario: logging in through an OIDC provider", t, func() {
+		Convey("When starting a login", func() {
+			rec, err := oidcRequest(e, controllers.OIDCLoginHandler, "/auth/oidc/")
+			Convey("It should redirect to the identity provider", func() {
+				So(err, ShouldBeNil)
+				So(rec.Code, ShouldEqual, 302)
+				loc, _ := url.Parse(rec.Header().Get("Location"))
+				So(loc.Path, ShouldEqual, "/authorize")
+				So(loc.Query().Get("client_id"), ShouldEqual, "ernest")
+				So(loc.Query().Get("state"), ShouldNotBeBlank)
+				So(loc.Query().Get("nonce"), ShouldNotBeBlank)
+			})
+
+			Convey("It should bind the login to the browser", func() {
+				cookies := (&http.Response{Header: rec.Header()}).Cookies()
+				So(len(cookies), ShouldEqual, 1)
+				So(cookies[0].Value, ShouldNotBeBlank)
+				So(cookies[0].HttpOnly, ShouldBeTrue)
+				So(cookies[0].SameSite, ShouldEqual, http.SameSiteLaxMode)
+			})
+		})
+
+		Convey("Given a new user logs in on the identity provider", func() {
+			var granted models.Role
+
+			state, nonce := oidcLogin(e)
+			idp.login("alice", nonce, "devs")
+
+			notFoundSubscriber("user.get", 1)
+			setUserSubscriber()
+			foundSubscriber("authorization.find", `[]`, 1)
+			sub, _ := models.N.Subscribe("authorization.set", func(msg *nats.Msg) {
+				if err := json.Unmarshal(msg.Data, &granted); err != nil {
+					log.Println(err)
+				}
+				if err := models.N.Publish(msg.Reply, msg.Data); err != nil {
+					log.Println(err)
+				}
+			})
+			_ = sub.AutoUnsubscribe(1)
+
+			rec, err := oidcRequest(e, controllers.OIDCCallbackHandler, "/auth/oidc/callback/?code=valid&state="+state)
+			Convey("It should provision the user and issue a token", func() {
+				var res map[string]string
+				So(err, ShouldBeNil)
+				So(rec.Code, ShouldEqual, 200)
+				So(json.Unmarshal(rec.Body.Bytes(), &res), ShouldBeNil)
+				So(res["token"], ShouldNotBeBlank)
+				So(res["refresh_token"], ShouldNotBeBlank)
+			})
+			Convey("It should map its groups to roles", func() {
+				So(granted.UserID, ShouldEqual, "alice")
+				So(granted.ResourceType, ShouldEqual, "project")
+				So(granted.ResourceID, ShouldEqual, "fake")
+				So(granted.Role, ShouldEqual, "member")
+			})
+		})
+
+		Convey("Given the id token nonce doesn't match the login", func() {
+			state, _ := oidcLogin(e)
+			idp.login("alice", "other", "devs")
+
+			_, err := oidcRequest(e, controllers.OIDCCallbackHandler, "/auth/oidc/callback/?code=valid&state="+state)
+			Convey("It should reject the login", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*echo.HTTPError).Code, ShouldEqual, 401)
+			})
+		})
+
+		Convey("Given the login was started from another browser", func() {
+			state, nonce := oidcLogin(e)
+			idp.login("alice", nonce)
+			oidcCookies = nil
+
+			_, err := oidcRequest(e, controllers.OIDCCallbackHandler, "/auth/oidc/callback/?code=valid&state="+state)
+			Convey("It should reject the login", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*echo.HTTPError).Code, ShouldEqual, 400)
+			})
+		})
+
+		Convey("Given the browser holds the cookie of another login", func() {
+			state, nonce := oidcLogin(e)
+			idp.login("alice", nonce)
+			oidcLogin(e)
+
+			_, err := oidcRequest(e, controllers.OIDCCallbackHandler, "/auth/oidc/callback/?code=valid&state="+state)
+			Convey("It should reject the login", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*echo.HTTPError).Code, ShouldEqual, 400)
+			})
+		})
+
+		Convey("Given the login state has been tampered", func() {
+			state, nonce := oidcLogin(e)
+			idp.login("alice", nonce)
+
+			_, err := oidcRequest(e, controllers.OIDCCallbackHandler, "/auth/oidc/callback/?code=valid&state="+state+"x")
+			Convey("It should reject the login", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*echo.HTTPError).Code, ShouldEqual, 400)
+			})
+		})
+
+		Convey("Given a user logs in again", func() {
+			state, nonce := oidcLogin(e)
+			idp.login("test-oidc", nonce)
+			foundSubscriber("user.get", `{"id":3,"username":"test-oidc","type":"oidc"}`, 1)
+			foundSubscriber("authorization.find", `[]`, 1)
+
+			fetches := atomic.LoadInt32(&idp.fetches)
+			_, err := oidcRequest(e, controllers.OIDCCallbackHandler, "/auth/oidc/callback/?code=valid&state="+state)
+			Convey("It should use the cached provider metadata and keys", func() {
+				So(err, ShouldBeNil)
+				So(atomic.LoadInt32(&idp.fetches), ShouldEqual, fetches)
+			})
+		})
+
+		Convey("Given the user store can't be reached", func() {
+			provisioned := false
+
+			state, nonce := oidcLogin(e)
+			idp.login("alice", nonce)
+
+			sub, _ := models.N.Subscribe("user.get", func(msg *nats.Msg) {})
+			_ = sub.AutoUnsubscribe(1)
+			sub, _ = models.N.Subscribe("user.set", func(msg *nats.Msg) {
+				provisioned = true
+			})
+			_ = sub.AutoUnsubscribe(1)
+
+			_, err := oidcRequest(e, controllers.OIDCCallbackHandler, "/auth/oidc/callback/?code=valid&state="+state)
+			Convey("It should not provision the user", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*echo.HTTPError).Code, ShouldEqual, 500)
+				So(provisioned, ShouldBeFalse)
+			})
+		})
+
+		Convey("Given the identity matches an existing local user", func() {
+			state, nonce := oidcLogin(e)
+			idp.login("test", nonce)
+
+			getUserSubscriber(1)
+
+			_, err := oidcRequest(e, controllers.OIDCCallbackHandler, "/auth/oidc/callback/?code=valid&state="+state)
+			Convey("It should not link the identity to the user", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*echo.HTTPError).Code, ShouldEqual, 403)
+			})
+		})
+	})
+}
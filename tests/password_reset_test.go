@@ -0,0 +1,288 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ernestio/api-gateway/controllers"
+	"github.com/ernestio/api-gateway/controllers/users"
+	"github.com/ernestio/api-gateway/models"
+	"github.com/labstack/echo"
+	"github.com/nats-io/go-nats"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type sentMail struct {
+	to, subject, body string
+}
+
+// mailStandIn keeps the messages sent instead of delivering them
+type mailStandIn struct {
+	sent []sentMail
+}
+
+func (m *mailStandIn) Send(to, subject, body string) error {
+	m.sent = append(m.sent, sentMail{to, subject, body})
+	return nil
+}
+
+// token : gets the password reset token from the last message sent
+func (m *mailStandIn) token() string {
+	if len(m.sent) == 0 {
+		return ""
+	}
+
+	for _, l := range strings.Split(m.sent[len(m.sent)-1].body, "\n") {
+		if strings.HasPrefix(l, "ey") {
+			return l
+		}
+	}
+
+	return ""
+}
+
+var storedResets []models.PasswordReset
+
+// passwordResetStore keeps the password resets saved during a test
+func passwordResetStore() {
+	_, _ = models.N.Subscribe("password_reset.set", func(msg *nats.Msg) {
+		var r models.PasswordReset
+		if err := json.Unmarshal(msg.Data, &r); err != nil {
+			log.Println(err)
+		}
+		r.ID = len(storedResets) + 1
+		storedResets = append(storedResets, r)
+
+		data, _ := json.Marshal(r)
+		if err := models.N.Publish(msg.Reply, data); err != nil {
+			log.Println(err)
+		}
+	})
+
+	_, _ = models.N.Subscribe("password_reset.get", func(msg *nats.Msg) {
+		var q models.PasswordReset
+		if err := json.Unmarshal(msg.Data, &q); err != nil {
+			log.Println(err)
+		}
+
+		data := []byte(`{"_error":"Not found"}`)
+		for _, r := range storedResets {
+			if r.TokenID == q.TokenID {
+				data, _ = json.Marshal(r)
+			}
+		}
+
+		if err := models.N.Publish(msg.Reply, data); err != nil {
+			log.Println(err)
+		}
+	})
+
+	_, _ = models.N.Subscribe("password_reset.del", func(msg *nats.Msg) {
+		var q models.PasswordReset
+		var kept []models.PasswordReset
+		if err := json.Unmarshal(msg.Data, &q); err != nil {
+			log.Println(err)
+		}
+
+		for _, r := range storedResets {
+			if r.ID != q.ID {
+				kept = append(kept, r)
+			}
+		}
+		storedResets = kept
+
+		if err := models.N.Publish(msg.Reply, []byte{}); err != nil {
+			log.Println(err)
+		}
+	})
+}
+
+func resetRequest(path, body string) *httptest.ResponseRecorder {
+	e := echo.New()
+	req := httptest.NewRequest(echo.POST, path, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	var err error
+	if path == "/auth/reset/" {
+		err = controllers.RequestPasswordResetHandler(e.NewContext(req, rec))
+	} else {
+		err = controllers.ResetPasswordHandler(e.NewContext(req, rec))
+	}
+	if err != nil {
+		log.Println(err)
+	}
+
+	return rec
+}
+
+func TestPasswordReset(t *testing.T) {
+	testsSetup()
+
+	Convey("Scenario: resetting a forgotten password", t, func() {
+		var saved models.User
+
+		mail := &mailStandIn{}
+		controllers.Mail = mail
+		controllers.Throttle = models.NewLoginThrottle()
+		controllers.ResetThrottle = models.NewPasswordResetThrottle()
+		controllers.ResetThrottle.Backoff = time.Nanosecond
+		storedResets = nil
+		storedRevocations = nil
+		passwordResetStore()
+		sessionStore()
+		mfaUserStore("forgotten-password")
+		mfaUser.Email = "test@example.com"
+		_, _ = models.N.Subscribe("user.set", func(msg *nats.Msg) {
+			if err := json.Unmarshal(msg.Data, &saved); err != nil {
+				log.Println(err)
+			}
+			if err := models.N.Publish(msg.Reply, msg.Data); err != nil {
+				log.Println(err)
+			}
+		})
+
+		rec := resetRequest("/auth/reset/", `{"username":"test"}`)
+		So(rec.Code, ShouldEqual, 202)
+		token := mail.token()
+
+		Convey("It should email a single use token to the user", func() {
+			So(len(mail.sent), ShouldEqual, 1)
+			So(mail.sent[0].to, ShouldEqual, "test@example.com")
+			So(mail.sent[0].subject, ShouldEqual, "Ernest password reset")
+			So(token, ShouldNotBeBlank)
+			So(len(storedResets), ShouldEqual, 1)
+			So(storedResets[0].Username, ShouldEqual, "test")
+		})
+
+		Convey("When using the token to access the api", func() {
+			e := echo.New()
+			req := httptest.NewRequest(echo.GET, "/api/session/", nil)
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+			err := controllers.ValidateToken(controllers.CheckRevocation(func(c echo.Context) error {
+				return nil
+			}))(e.NewContext(req, httptest.NewRecorder()))
+			Convey("It should be rejected", func() {
+				So(err, ShouldEqual, echo.ErrUnauthorized)
+			})
+		})
+
+		Convey("When setting a password that is not valid", func() {
+			rec := resetRequest("/auth/reset/confirm/", `{"token":"`+token+`","password":"short"}`)
+			Convey("It should be rejected without consuming the token", func() {
+				So(rec.Code, ShouldEqual, 400)
+				So(rec.Body.String(), ShouldContainSubstring, "Minimum password length is 8 characters")
+				So(len(storedResets), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When setting a new password", func() {
+			rec := resetRequest("/auth/reset/confirm/", `{"token":"`+token+`","password":"remembered-password"}`)
+			Convey("It should set the password and revoke all the user sessions", func() {
+				So(rec.Code, ShouldEqual, 200)
+				So(*saved.Password, ShouldEqual, "remembered-password")
+				So(saved.Salt, ShouldBeBlank)
+				So(len(storedRevocations), ShouldEqual, 1)
+				So(storedRevocations[0].Username, ShouldEqual, "test")
+				So(storedRevocations[0].TokenID, ShouldBeBlank)
+			})
+
+			Convey("And using the token again", func() {
+				rec := resetRequest("/auth/reset/confirm/", `{"token":"`+token+`","password":"another-password"}`)
+				Convey("It should be rejected", func() {
+					So(rec.Code, ShouldEqual, 400)
+					So(rec.Body.String(), ShouldContainSubstring, "Invalid or expired password reset token")
+				})
+			})
+		})
+
+		Convey("When using a token that is not signed", func() {
+			rec := resetRequest("/auth/reset/confirm/", `{"token":"not-a-token","password":"remembered-password"}`)
+			Convey("It should be rejected", func() {
+				So(rec.Code, ShouldEqual, 400)
+			})
+		})
+
+		Convey("When requesting a reset for an unknown user", func() {
+			notFoundSubscriber("user.get", 1)
+			rec := resetRequest("/auth/reset/", `{"username":"unknown"}`)
+			Convey("It should respond the same without sending anything", func() {
+				So(rec.Code, ShouldEqual, 202)
+				So(len(mail.sent), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When requesting too many resets", func() {
+			controllers.ResetThrottle.MaxFailures = 2
+			resetRequest("/auth/reset/", `{"username":"test"}`)
+			rec := resetRequest("/auth/reset/", `{"username":"test"}`)
+
+			Convey("It should be rejected by the reset throttle", func() {
+				So(rec.Code, ShouldEqual, 429)
+				So(rec.Header().Get("Retry-After"), ShouldNotBeBlank)
+				So(len(mail.sent), ShouldEqual, 2)
+			})
+
+			Convey("It should not lock the user out of logging in", func() {
+				So(controllers.Throttle.Check("test", "192.0.2.1"), ShouldEqual, 0)
+				So(controllers.Throttle.List(), ShouldBeEmpty)
+			})
+		})
+
+		Convey("When delivering the reset through the notification service", func() {
+			var delivered models.NotificationMessage
+			controllers.Mail = &models.NotificationMailer{}
+			_, _ = models.N.Subscribe("notification.send", func(msg *nats.Msg) {
+				if err := json.Unmarshal(msg.Data, &delivered); err != nil {
+					log.Println(err)
+				}
+				if err := models.N.Publish(msg.Reply, []byte(`{}`)); err != nil {
+					log.Println(err)
+				}
+			})
+			rec := resetRequest("/auth/reset/", `{"username":"test"}`)
+
+			Convey("It should request the notification service to email it", func() {
+				So(rec.Code, ShouldEqual, 202)
+				So(delivered.To, ShouldResemble, []string{"test@example.com"})
+				So(delivered.Subject, ShouldEqual, "Ernest password reset")
+			})
+		})
+
+		Convey("When changing the email of a user", func() {
+			au := models.User{ID: 1, Username: "test"}
+
+			Convey("It should require the current password", func() {
+				st, _ := users.Update(au, "test", []byte(`{"id":1,"username":"test","email":"other@example.com"}`))
+				So(st, ShouldEqual, 403)
+				st, _ = users.Update(au, "test", []byte(`{"id":1,"username":"test","email":"other@example.com","oldpassword":"wrong-password"}`))
+				So(st, ShouldEqual, 403)
+				So(len(storedRevocations), ShouldEqual, 0)
+			})
+
+			Convey("It should revoke all the user sessions", func() {
+				st, _ := users.Update(au, "test", []byte(`{"id":1,"username":"test","email":"other@example.com","oldpassword":"forgotten-password"}`))
+				So(st, ShouldEqual, 200)
+				So(saved.Email, ShouldEqual, "other@example.com")
+				So(len(storedRevocations), ShouldEqual, 1)
+				So(storedRevocations[0].Username, ShouldEqual, "test")
+			})
+		})
+
+		Convey("When password resets are not configured", func() {
+			controllers.Mail = nil
+			rec := resetRequest("/auth/reset/", `{"username":"test"}`)
+			Convey("It should return an error", func() {
+				So(rec.Code, ShouldEqual, 501)
+			})
+		})
+	})
+}
@@ -0,0 +1,130 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/ernestio/api-gateway/controllers/users"
+	"github.com/ernestio/api-gateway/models"
+	"github.com/nats-io/go-nats"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	testsSetup()
+
+	Convey("Scenario: validating passwords", t, func() {
+		p := models.PasswordPolicy{
+			MinLength:        12,
+			RequireUppercase: true,
+			RequireLowercase: true,
+			RequireDigit:     true,
+			RequireSymbol:    true,
+		}
+
+		Convey("Given a password failing several rules", func() {
+			err := p.Validate("short")
+			Convey("It should list every rule that failed", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "Minimum password length is 12 characters, Password must contain an uppercase letter, Password must contain a digit, Password must contain a symbol")
+			})
+		})
+
+		Convey("Given a passphrase with spaces and unicode characters", func() {
+			err := p.Validate("Correct hörse battery st4ple")
+			Convey("It should be valid", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("Given a password with non printable characters", func() {
+			err := p.Validate("Correct horse\tbattery st4ple")
+			Convey("It should be rejected", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "Password can only contain printable characters")
+			})
+		})
+
+		Convey("Given a breached password list", func() {
+			f, _ := ioutil.TempFile("", "breached")
+			defer func() {
+				_ = os.Remove(f.Name())
+			}()
+			_, _ = f.WriteString("password1234\nCorrect Horse Battery Staple1!\n")
+			_ = f.Close()
+
+			So(p.LoadBreached(f.Name()), ShouldBeNil)
+
+			Convey("When the password is on the list", func() {
+				err := p.Validate("correct horse battery staple1!")
+				Convey("It should be rejected regardless of its case", func() {
+					So(err, ShouldNotBeNil)
+					So(err.Error(), ShouldContainSubstring, "Password has appeared in a data breach")
+					So(err.Error(), ShouldContainSubstring, "Password must contain an uppercase letter")
+				})
+			})
+
+			Convey("When the password is not on the list", func() {
+				err := p.Validate("Correct Horse Battery Staple2!")
+				Convey("It should be valid", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+		})
+	})
+
+	Convey("Scenario: changing a password with a password history", t, func() {
+		var saved models.User
+
+		models.Passwords = &models.PasswordPolicy{MinLength: 8, History: 3}
+		mfaUserStore("first-password")
+		_, _ = models.N.Subscribe("user.set", func(msg *nats.Msg) {
+			if err := json.Unmarshal(msg.Data, &saved); err != nil {
+				log.Println(err)
+			}
+			if err := models.N.Publish(msg.Reply, msg.Data); err != nil {
+				log.Println(err)
+			}
+		})
+		au := models.User{ID: 1, Username: "test"}
+
+		Convey("When reusing the current password", func() {
+			st, resp := users.Update(au, "test", []byte(`{"id": 1, "username": "test", "password": "first-password"}`))
+			Convey("It should be rejected", func() {
+				So(st, ShouldEqual, 400)
+				So(string(resp), ShouldEqual, `{"message":"Password can't be any of the last 3 passwords"}`)
+			})
+		})
+
+		Convey("When reusing a previous password", func() {
+			previous := *mfaUser.Password
+			mfaUser.PasswordHistory = []string{mfaUser.Salt + "$" + previous}
+			mfaUserStore("second-password")
+			mfaUser.PasswordHistory = []string{mfaUser.Salt + "$" + previous}
+
+			st, resp := users.Update(au, "test", []byte(`{"id": 1, "username": "test", "password": "first-password"}`))
+			Convey("It should be rejected", func() {
+				So(st, ShouldEqual, 400)
+				So(string(resp), ShouldContainSubstring, "Password can't be any of the last 3 passwords")
+			})
+		})
+
+		Convey("When setting a new password", func() {
+			current := mfaUser.Salt + "$" + *mfaUser.Password
+			mfaUser.PasswordHistory = []string{"a$1", "b$2", "c$3"}
+
+			st, _ := users.Update(au, "test", []byte(`{"id": 1, "username": "test", "password": "new-password"}`))
+			Convey("It should keep the replaced password on the history", func() {
+				So(st, ShouldEqual, 200)
+				So(saved.PasswordHistory, ShouldResemble, []string{current, "a$1"})
+			})
+		})
+	})
+}
@@ -0,0 +1,200 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"testing"
+
+	"github.com/ernestio/api-gateway/controllers/builds"
+	"github.com/ernestio/api-gateway/models"
+	"github.com/ghodss/yaml"
+	"github.com/nats-io/go-nats"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const promotedDefinition = `
+name: app
+project: dev
+instances:
+  - name: web
+    count: 1
+    image: ami-1
+    network: web
+  - name: db
+    count: 1
+networks:
+  - name: web
+    subnet: 10.1.0.0/24
+`
+
+// promotionStore serves the builds of the dev/app environment and the
+// promotions recorded
+func promotionStore(promotions []models.Promotion) {
+	_, _ = models.N.Subscribe("build.get", func(msg *nats.Msg) {
+		var q map[string]interface{}
+		if err := json.Unmarshal(msg.Data, &q); err != nil {
+			log.Println(err)
+		}
+
+		data := []byte(`{"_error":"Not found"}`)
+		if q["id"] == "b1" || q["environment_id"] == float64(1) {
+			data = []byte(`{"id":"b1","environment_id":1}`)
+		} else if q["id"] == "b2" {
+			data = []byte(`{"id":"b2","environment_id":2}`)
+		}
+
+		if err := models.N.Publish(msg.Reply, data); err != nil {
+			log.Println(err)
+		}
+	})
+
+	_, _ = models.N.Subscribe("build.get.definition", func(msg *nats.Msg) {
+		if err := models.N.Publish(msg.Reply, []byte(promotedDefinition)); err != nil {
+			log.Println(err)
+		}
+	})
+
+	_, _ = models.N.Subscribe("promotion.find", func(msg *nats.Msg) {
+		var q map[string]interface{}
+		found := []models.Promotion{}
+		if err := json.Unmarshal(msg.Data, &q); err != nil {
+			log.Println(err)
+		}
+
+		for _, p := range promotions {
+			if q["target_env"] == p.TargetEnv || q["source_env"] == p.SourceEnv {
+				found = append(found, p)
+			}
+		}
+
+		data, _ := json.Marshal(found)
+		if err := models.N.Publish(msg.Reply, data); err != nil {
+			log.Println(err)
+		}
+	})
+}
+
+func promoteAction(project, name, build string) *models.Action {
+	var a models.Action
+
+	a.Type = "promote"
+	a.Options.Project = project
+	a.Options.Name = name
+	a.Options.BuildID = build
+
+	return &a
+}
+
+func TestPromote(t *testing.T) {
+	testsSetup()
+	alice := models.User{ID: 2, Username: "alice"}
+
+	Convey("Scenario: overriding a promoted definition", t, func() {
+		var def map[string]interface{}
+		So(yaml.Unmarshal([]byte(promotedDefinition), &def), ShouldBeNil)
+
+		var overrides map[string]interface{}
+		So(yaml.Unmarshal([]byte(`
+instances:
+  - name: web
+    count: 3
+  - name: cache
+    count: 1
+networks:
+  - name: web
+    subnet: 10.3.0.0/24
+`), &overrides), ShouldBeNil)
+
+		def = models.MergeDefinition(def, overrides)
+
+		Convey("It should merge the named items", func() {
+			instances := def["instances"].([]interface{})
+			So(len(instances), ShouldEqual, 3)
+			web := instances[0].(map[string]interface{})
+			So(web["count"], ShouldEqual, 3)
+			So(web["image"], ShouldEqual, "ami-1")
+			So(instances[1].(map[string]interface{})["count"], ShouldEqual, 1)
+			So(instances[2].(map[string]interface{})["name"], ShouldEqual, "cache")
+			So(def["networks"].([]interface{})[0].(map[string]interface{})["subnet"], ShouldEqual, "10.3.0.0/24")
+			So(def["project"], ShouldEqual, "dev")
+		})
+
+		Convey("When the target environment has promotion overrides", func() {
+			t := models.Env{Name: "prod/app", Options: map[string]interface{}{
+				models.PromotionOverrides: map[string]interface{}{
+					"instances": []interface{}{map[string]interface{}{"name": "web", "count": float64(5), "image": "ami-2"}},
+				},
+			}}
+			promoted, err := t.PromoteDefinition(def, overrides)
+
+			Convey("It should apply them before the given ones", func() {
+				So(err, ShouldBeNil)
+				web := promoted["instances"].([]interface{})[0].(map[string]interface{})
+				So(web["image"], ShouldEqual, "ami-2")
+				So(web["count"], ShouldEqual, 3)
+				So(promoted["project"], ShouldEqual, "prod")
+				So(promoted["name"], ShouldEqual, "app")
+			})
+		})
+
+		Convey("When the promotion overrides are not valid", func() {
+			t := models.Env{Name: "prod/app", Options: map[string]interface{}{models.PromotionOverrides: "count: 3"}}
+			_, err := t.PromoteDefinition(def, overrides)
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Scenario: promoting a build", t, func() {
+		storedTeams = nil
+		storedEnvs = []models.Env{
+			{ID: 1, Name: "dev/app", Type: "aws"},
+			{ID: 2, Name: "staging/app", Type: "aws"},
+		}
+		storedTeamGrants = []models.Role{
+			{ID: 1, UserID: "alice", ResourceType: "project", ResourceID: "dev", Role: "owner"},
+			{ID: 2, UserID: "alice", ResourceType: "project", ResourceID: "staging", Role: "owner"},
+		}
+		cloneStore()
+		promotionStore([]models.Promotion{
+			{ID: 1, SourceEnv: "dev/app", SourceBuild: "b1", TargetEnv: "staging/app", TargetBuild: "b3"},
+		})
+
+		Convey("When the target environment doesn't exist", func() {
+			st, _ := builds.Promote(alice, "dev/app", promoteAction("prod", "", ""), "")
+			So(st, ShouldEqual, 404)
+		})
+
+		Convey("When promoting an environment onto itself", func() {
+			st, _ := builds.Promote(alice, "dev/app", promoteAction("", "", ""), "")
+			So(st, ShouldEqual, 400)
+		})
+
+		Convey("When promoting a build of another environment", func() {
+			st, _ := builds.Promote(alice, "dev/app", promoteAction("staging", "", "b2"), "")
+			So(st, ShouldEqual, 404)
+		})
+
+		Convey("When the user can't read the source environment", func() {
+			bob := models.User{ID: 3, Username: "bob"}
+			st, _ := builds.Promote(bob, "dev/app", promoteAction("staging", "", ""), "")
+			So(st, ShouldEqual, 403)
+		})
+
+		Convey("When listing the promotions of an environment", func() {
+			st, res := builds.Promotions(alice, "staging/app")
+
+			Convey("It should link the source and target builds", func() {
+				var promotions []models.Promotion
+				So(st, ShouldEqual, 200)
+				So(json.Unmarshal(res, &promotions), ShouldBeNil)
+				So(len(promotions), ShouldEqual, 1)
+				So(promotions[0].SourceBuild, ShouldEqual, "b1")
+				So(promotions[0].TargetBuild, ShouldEqual, "b3")
+			})
+		})
+	})
+}
@@ -0,0 +1,394 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"testing"
+
+	"github.com/ernestio/api-gateway/controllers/envs"
+	"github.com/ernestio/api-gateway/controllers/projects"
+	"github.com/ernestio/api-gateway/models"
+	"github.com/nats-io/go-nats"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var storedProjects []models.Project
+var storedNotifications []models.Notification
+var storedPolicies []models.Policy
+var storedAPITokens []models.APIToken
+var storedPromotions []models.Promotion
+
+// rejectedEnvName makes saving an environment with that name fail
+var rejectedEnvName string
+
+// renameStore keeps the projects, environments, roles, notifications,
+// policies, api tokens, schedule runs and promotions updated during a
+// test. Saving policies fails if asked to
+func renameStore(failPolicies *bool) {
+	teamStore("alice")
+
+	reply := func(msg *nats.Msg, v interface{}) {
+		data, _ := json.Marshal(v)
+		if err := models.N.Publish(msg.Reply, data); err != nil {
+			log.Println(err)
+		}
+	}
+
+	_, _ = models.N.Subscribe("datacenter.get", func(msg *nats.Msg) {
+		var q models.Project
+		_ = json.Unmarshal(msg.Data, &q)
+		for _, p := range storedProjects {
+			if p.Name == q.Name {
+				reply(msg, p)
+				return
+			}
+		}
+		reply(msg, map[string]string{"_error": "Not found"})
+	})
+
+	_, _ = models.N.Subscribe("datacenter.set", func(msg *nats.Msg) {
+		var p models.Project
+		_ = json.Unmarshal(msg.Data, &p)
+		for i := range storedProjects {
+			if storedProjects[i].ID == p.ID {
+				storedProjects[i] = p
+			}
+		}
+		reply(msg, p)
+	})
+
+	_, _ = models.N.Subscribe("environment.get", func(msg *nats.Msg) {
+		var q models.Env
+		_ = json.Unmarshal(msg.Data, &q)
+		for _, e := range storedEnvs {
+			if e.Name == q.Name {
+				reply(msg, e)
+				return
+			}
+		}
+		reply(msg, map[string]string{"_error": "Not found"})
+	})
+
+	_, _ = models.N.Subscribe("environment.find", func(msg *nats.Msg) {
+		var q models.Env
+		found := []models.Env{}
+		_ = json.Unmarshal(msg.Data, &q)
+		for _, e := range storedEnvs {
+			if e.ProjectID == q.ProjectID {
+				found = append(found, e)
+			}
+		}
+		reply(msg, found)
+	})
+
+	_, _ = models.N.Subscribe("environment.set", func(msg *nats.Msg) {
+		var e models.Env
+		_ = json.Unmarshal(msg.Data, &e)
+		if e.Name == rejectedEnvName {
+			reply(msg, map[string]string{"_error": "Environment store is down"})
+			return
+		}
+		for i := range storedEnvs {
+			if storedEnvs[i].ID == e.ID {
+				storedEnvs[i] = e
+			}
+		}
+		reply(msg, e)
+	})
+
+	_, _ = models.N.Subscribe("authorization.set", func(msg *nats.Msg) {
+		var r models.Role
+		_ = json.Unmarshal(msg.Data, &r)
+		for i := range storedTeamGrants {
+			if storedTeamGrants[i].ID == r.ID {
+				storedTeamGrants[i] = r
+			}
+		}
+		reply(msg, r)
+	})
+
+	_, _ = models.N.Subscribe("notification.find", func(msg *nats.Msg) {
+		reply(msg, storedNotifications)
+	})
+
+	_, _ = models.N.Subscribe("notification.set", func(msg *nats.Msg) {
+		var n models.Notification
+		_ = json.Unmarshal(msg.Data, &n)
+		for i := range storedNotifications {
+			if storedNotifications[i].ID == n.ID {
+				storedNotifications[i] = n
+			}
+		}
+		reply(msg, n)
+	})
+
+	_, _ = models.N.Subscribe("api_token.find", func(msg *nats.Msg) {
+		reply(msg, storedAPITokens)
+	})
+
+	_, _ = models.N.Subscribe("api_token.set", func(msg *nats.Msg) {
+		var t models.APIToken
+		_ = json.Unmarshal(msg.Data, &t)
+		for i := range storedAPITokens {
+			if storedAPITokens[i].ID == t.ID {
+				storedAPITokens[i] = t
+			}
+		}
+		reply(msg, t)
+	})
+
+	_, _ = models.N.Subscribe("schedule_run.find", func(msg *nats.Msg) {
+		var q models.ScheduleRun
+		found := []models.ScheduleRun{}
+		_ = json.Unmarshal(msg.Data, &q)
+		for _, r := range storedRuns {
+			if r.Env == q.Env {
+				found = append(found, r)
+			}
+		}
+		reply(msg, found)
+	})
+
+	_, _ = models.N.Subscribe("schedule_run.set", func(msg *nats.Msg) {
+		var r models.ScheduleRun
+		_ = json.Unmarshal(msg.Data, &r)
+		for i := range storedRuns {
+			if storedRuns[i].ID == r.ID {
+				storedRuns[i] = r
+			}
+		}
+		reply(msg, r)
+	})
+
+	_, _ = models.N.Subscribe("promotion.find", func(msg *nats.Msg) {
+		var q map[string]interface{}
+		found := []models.Promotion{}
+		_ = json.Unmarshal(msg.Data, &q)
+		for _, p := range storedPromotions {
+			if q["target_env"] == p.TargetEnv || q["source_env"] == p.SourceEnv {
+				found = append(found, p)
+			}
+		}
+		reply(msg, found)
+	})
+
+	_, _ = models.N.Subscribe("promotion.set", func(msg *nats.Msg) {
+		var p models.Promotion
+		_ = json.Unmarshal(msg.Data, &p)
+		for i := range storedPromotions {
+			if storedPromotions[i].ID == p.ID {
+				storedPromotions[i] = p
+			}
+		}
+		reply(msg, p)
+	})
+
+	_, _ = models.N.Subscribe("policy.find", func(msg *nats.Msg) {
+		reply(msg, storedPolicies)
+	})
+
+	_, _ = models.N.Subscribe("policy.set", func(msg *nats.Msg) {
+		var p models.Policy
+		_ = json.Unmarshal(msg.Data, &p)
+		if *failPolicies {
+			reply(msg, map[string]string{"_error": "Policy store is down"})
+			return
+		}
+		for i := range storedPolicies {
+			if storedPolicies[i].ID == p.ID {
+				storedPolicies[i] = p
+			}
+		}
+		reply(msg, p)
+	})
+}
+
+func TestRename(t *testing.T) {
+	testsSetup()
+	alice := models.User{ID: 1, Username: "alice"}
+
+	Convey("Scenario: renaming environments and projects", t, func() {
+		failPolicies := false
+		rejectedEnvName = ""
+		storedOverrides = nil
+		storedTeams = nil
+		storedProjects = []models.Project{{ID: 1, Name: "p1", Type: "aws"}}
+		storedEnvs = []models.Env{
+			{ID: 1, ProjectID: 1, Name: "p1/e1", Type: "aws"},
+			{ID: 2, ProjectID: 1, Name: "p1/e2", Type: "aws"},
+		}
+		storedTeamGrants = []models.Role{
+			{ID: 1, UserID: "alice", ResourceType: "project", ResourceID: "p1", Role: "owner"},
+			{ID: 2, UserID: "bob", ResourceType: "environment", ResourceID: "p1/e1", Role: "reader"},
+			{ID: 3, UserID: "bob", ResourceType: "build", ResourceID: "p1/e1/b1", Role: "reader"},
+		}
+		storedNotifications = []models.Notification{
+			{ID: 1, Name: "slack", Sources: []string{"p1/e1", "p1/e2"}},
+			{ID: 2, Name: "email", Sources: []string{"p1"}},
+		}
+		storedPolicies = []models.Policy{{ID: 1, Name: "pci", Environments: []string{"p1/e1"}}}
+		storedLocks = []models.EnvLock{{ID: 1, Env: "p1/e1", Reason: "release", Username: "alice"}}
+		storedAPITokens = []models.APIToken{
+			{ID: 1, Username: "alice", Environments: []string{"p1/e1"}},
+			{ID: 2, Username: "alice", Projects: []string{"p1"}},
+		}
+		storedRuns = []models.ScheduleRun{{ID: 1, Env: "p1/e1", Schedule: "nightly", Action: "sync", Status: "done"}}
+		storedPromotions = []models.Promotion{
+			{ID: 1, SourceEnv: "p1/e1", TargetEnv: "p1/e2"},
+			{ID: 2, SourceEnv: "p1/e2", TargetEnv: "p1/e1"},
+		}
+		renameStore(&failPolicies)
+		lockStore()
+
+		Convey("When renaming an environment", func() {
+			st, _ := envs.Rename(alice, "p1/e1", []byte(`{"name":"web"}`), "renaming for the release")
+
+			Convey("It should move everything referring to it", func() {
+				So(st, ShouldEqual, 200)
+				So(storedEnvs[0].Name, ShouldEqual, "p1/web")
+				So(storedTeamGrants[1].ResourceID, ShouldEqual, "p1/web")
+				So(storedTeamGrants[2].ResourceID, ShouldEqual, "p1/web/b1")
+				So(storedNotifications[0].Sources, ShouldResemble, []string{"p1/web", "p1/e2"})
+				So(storedPolicies[0].Environments, ShouldResemble, []string{"p1/web"})
+				So(storedLocks[0].Env, ShouldEqual, "p1/web")
+				So(storedAPITokens[0].Environments, ShouldResemble, []string{"p1/web"})
+				So(storedRuns[0].Env, ShouldEqual, "p1/web")
+				So(storedPromotions[0].SourceEnv, ShouldEqual, "p1/web")
+				So(storedPromotions[0].TargetEnv, ShouldEqual, "p1/e2")
+				So(storedPromotions[1].SourceEnv, ShouldEqual, "p1/e2")
+				So(storedPromotions[1].TargetEnv, ShouldEqual, "p1/web")
+			})
+
+			Convey("It should record the lock override", func() {
+				So(len(storedOverrides), ShouldEqual, 1)
+				So(storedOverrides[0].Env, ShouldEqual, "p1/e1")
+				So(storedOverrides[0].Justification, ShouldEqual, "renaming for the release")
+			})
+		})
+
+		Convey("When renaming a locked environment without a justification", func() {
+			st, res := envs.Rename(alice, "p1/e1", []byte(`{"name":"web"}`), "")
+
+			Convey("It should not rename it", func() {
+				So(st, ShouldEqual, 423)
+				So(string(res), ShouldContainSubstring, "release (alice)")
+				So(storedEnvs[0].Name, ShouldEqual, "p1/e1")
+			})
+		})
+
+		Convey("When renaming an environment locked by another user", func() {
+			storedLocks[0].Username = "bob"
+			st, _ := envs.Rename(alice, "p1/e1", []byte(`{"name":"web"}`), "renaming for the release")
+			So(st, ShouldEqual, 423)
+			So(storedEnvs[0].Name, ShouldEqual, "p1/e1")
+		})
+
+		Convey("When renaming an environment fails half way", func() {
+			failPolicies = true
+			st, _ := envs.Rename(alice, "p1/e1", []byte(`{"name":"web"}`), "renaming for the release")
+
+			Convey("It should roll back the changes done", func() {
+				So(st, ShouldEqual, 500)
+				So(storedEnvs[0].Name, ShouldEqual, "p1/e1")
+				So(storedTeamGrants[1].ResourceID, ShouldEqual, "p1/e1")
+				So(storedTeamGrants[2].ResourceID, ShouldEqual, "p1/e1/b1")
+				So(storedNotifications[0].Sources, ShouldResemble, []string{"p1/e1", "p1/e2"})
+				So(storedPolicies[0].Environments, ShouldResemble, []string{"p1/e1"})
+				So(storedLocks[0].Env, ShouldEqual, "p1/e1")
+				So(storedAPITokens[0].Environments, ShouldResemble, []string{"p1/e1"})
+				So(storedRuns[0].Env, ShouldEqual, "p1/e1")
+				So(storedPromotions[0].SourceEnv, ShouldEqual, "p1/e1")
+				So(storedPromotions[1].TargetEnv, ShouldEqual, "p1/e1")
+			})
+		})
+
+		Convey("When renaming an environment fails and can't be rolled back", func() {
+			failPolicies = true
+			rejectedEnvName = "p1/e1"
+			st, res := envs.Rename(alice, "p1/e1", []byte(`{"name":"web"}`), "renaming for the release")
+
+			Convey("It should say the changes could not be undone", func() {
+				So(st, ShouldEqual, 500)
+				So(string(res), ShouldContainSubstring, "some of the changes could not be undone")
+				So(string(res), ShouldNotContainSubstring, "no changes were made")
+			})
+		})
+
+		Convey("When the new environment name is taken", func() {
+			st, _ := envs.Rename(alice, "p1/e1", []byte(`{"name":"e2"}`), "renaming for the release")
+			So(st, ShouldEqual, 409)
+		})
+
+		Convey("When a build is in progress", func() {
+			storedEnvs[0].Status = "in_progress"
+			st, _ := envs.Rename(alice, "p1/e1", []byte(`{"name":"web"}`), "renaming for the release")
+			So(st, ShouldEqual, 409)
+		})
+
+		Convey("When the user can't update the environment", func() {
+			bob := models.User{ID: 2, Username: "bob"}
+			st, _ := envs.Rename(bob, "p1/e1", []byte(`{"name":"web"}`), "")
+			So(st, ShouldEqual, 403)
+		})
+
+		Convey("When renaming a project", func() {
+			st, _ := projects.Rename(alice, "p1", []byte(`{"name":"shop"}`), "renaming for the release")
+
+			Convey("It should move its environments and everything referring to them", func() {
+				So(st, ShouldEqual, 200)
+				So(storedProjects[0].Name, ShouldEqual, "shop")
+				So(storedEnvs[0].Name, ShouldEqual, "shop/e1")
+				So(storedEnvs[1].Name, ShouldEqual, "shop/e2")
+				So(storedTeamGrants[0].ResourceID, ShouldEqual, "shop")
+				So(storedTeamGrants[1].ResourceID, ShouldEqual, "shop/e1")
+				So(storedNotifications[0].Sources, ShouldResemble, []string{"shop/e1", "shop/e2"})
+				So(storedNotifications[1].Sources, ShouldResemble, []string{"shop"})
+				So(storedPolicies[0].Environments, ShouldResemble, []string{"shop/e1"})
+				So(storedAPITokens[0].Environments, ShouldResemble, []string{"shop/e1"})
+				So(storedAPITokens[1].Projects, ShouldResemble, []string{"shop"})
+				So(storedPromotions[0].TargetEnv, ShouldEqual, "shop/e2")
+			})
+		})
+
+		Convey("When renaming a project with a locked environment", func() {
+			st, res := projects.Rename(alice, "p1", []byte(`{"name":"shop"}`), "")
+
+			Convey("It should not rename it", func() {
+				So(st, ShouldEqual, 423)
+				So(string(res), ShouldContainSubstring, "p1/e1")
+				So(storedProjects[0].Name, ShouldEqual, "p1")
+				So(storedEnvs[1].Name, ShouldEqual, "p1/e2")
+			})
+		})
+
+		Convey("When renaming a project fails half way", func() {
+			failPolicies = true
+			st, _ := projects.Rename(alice, "p1", []byte(`{"name":"shop"}`), "renaming for the release")
+
+			Convey("It should roll back the changes done", func() {
+				So(st, ShouldEqual, 500)
+				So(storedProjects[0].Name, ShouldEqual, "p1")
+				So(storedEnvs[0].Name, ShouldEqual, "p1/e1")
+				So(storedTeamGrants[0].ResourceID, ShouldEqual, "p1")
+				So(storedTeamGrants[1].ResourceID, ShouldEqual, "p1/e1")
+				So(storedNotifications[0].Sources, ShouldResemble, []string{"p1/e1", "p1/e2"})
+				So(storedAPITokens[1].Projects, ShouldResemble, []string{"p1"})
+			})
+		})
+
+		Convey("When renaming a project fails and can't be rolled back", func() {
+			failPolicies = true
+			rejectedEnvName = "p1/e1"
+			st, res := projects.Rename(alice, "p1", []byte(`{"name":"shop"}`), "renaming for the release")
+
+			Convey("It should say the changes could not be undone", func() {
+				So(st, ShouldEqual, 500)
+				So(string(res), ShouldContainSubstring, "some of the changes could not be undone")
+			})
+		})
+	})
+}
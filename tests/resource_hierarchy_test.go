@@ -0,0 +1,125 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"testing"
+
+	"github.com/ernestio/api-gateway/controllers/policies"
+	"github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+	"github.com/nats-io/go-nats"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// policyStore serves a policy attached to the given environments
+func policyStore(name string, envs ...string) {
+	_, _ = models.N.Subscribe("policy.get", func(msg *nats.Msg) {
+		var q models.Policy
+		if err := json.Unmarshal(msg.Data, &q); err != nil {
+			log.Println(err)
+		}
+
+		data := []byte(`{"_error":"Not found"}`)
+		if q.Name == name {
+			data, _ = json.Marshal(models.Policy{ID: 1, Name: name, Environments: envs})
+		}
+
+		if err := models.N.Publish(msg.Reply, data); err != nil {
+			log.Println(err)
+		}
+	})
+}
+
+func TestResourceHierarchy(t *testing.T) {
+	testsSetup()
+	alice := models.User{ID: 2, Username: "alice"}
+
+	Convey("Scenario: inheriting roles down the resource hierarchy", t, func() {
+		storedTeams = nil
+		storedTeamGrants = []models.Role{
+			{ID: 1, UserID: "alice", ResourceType: "project", ResourceID: "p1", Role: "owner"},
+		}
+		teamStore("alice")
+		policyStore("pci", "p2/e1")
+
+		Convey("Given an owner role on a project", func() {
+			Convey("It should be inherited by its environments and builds", func() {
+				So(alice.IsOwner("environment", "p1/e1"), ShouldBeTrue)
+				So(alice.IsOwner("build", "p1/e1/b1"), ShouldBeTrue)
+				So(alice.Can(helpers.DeleteBuild, "build", "p1/e1/b1"), ShouldBeTrue)
+			})
+
+			Convey("When a deny grant is set on an environment", func() {
+				storedTeamGrants = append(storedTeamGrants, models.Role{ID: 2, UserID: "alice", ResourceType: "environment", ResourceID: "p1/prod", Role: "deny"})
+
+				Convey("It should stop the inheritance on that environment only", func() {
+					So(alice.IsReader("environment", "p1/prod"), ShouldBeFalse)
+					So(alice.IsOwner("build", "p1/prod/b1"), ShouldBeFalse)
+					So(alice.Can(helpers.GetEnv, "environment", "p1/prod"), ShouldBeFalse)
+					So(alice.IsOwner("environment", "p1/e1"), ShouldBeTrue)
+				})
+
+				Convey("It should hide the environment", func() {
+					_, _ = models.N.Subscribe("environment.find", func(msg *nats.Msg) {
+						data, _ := json.Marshal([]models.Env{{ID: 1, Name: "p1/e1"}, {ID: 2, Name: "p1/prod"}})
+						if err := models.N.Publish(msg.Reply, data); err != nil {
+							log.Println(err)
+						}
+					})
+
+					envs, err := alice.EnvsBy(map[string]interface{}{})
+					So(err, ShouldBeNil)
+					So(len(envs), ShouldEqual, 1)
+					So(envs[0].Name, ShouldEqual, "p1/e1")
+				})
+			})
+
+			Convey("When the deny grant comes from a team", func() {
+				storedTeams = []models.Team{{ID: 1, Name: "contractors", Members: []string{"alice"}}}
+				storedTeamGrants = append(storedTeamGrants, models.Role{ID: 2, TeamID: "contractors", ResourceType: "project", ResourceID: "p1", Role: "deny"})
+
+				Convey("It should override the other roles on the same resource", func() {
+					So(alice.IsReader("environment", "p1/e1"), ShouldBeFalse)
+				})
+			})
+		})
+
+		Convey("Given a reader role on a policy", func() {
+			storedTeamGrants = []models.Role{
+				{ID: 1, UserID: "alice", ResourceType: "policy", ResourceID: "pci", Role: "reader"},
+			}
+
+			Convey("It should be inherited by the attached environments", func() {
+				So(alice.IsReader("environment", "p2/e1"), ShouldBeTrue)
+				So(alice.IsOwner("environment", "p2/e1"), ShouldBeFalse)
+				So(alice.IsReader("environment", "p2/e2"), ShouldBeFalse)
+			})
+
+			Convey("It should explain where the role comes from", func() {
+				res := alice.ResolveRoles("environment", "p2/e1")
+				So(res.Inherited, ShouldBeTrue)
+				So(res.Resources, ShouldResemble, []models.ResourceRef{{Type: "policy", ID: "pci"}})
+			})
+		})
+
+		Convey("When attaching a policy to an environment the user can't update", func() {
+			storedTeamGrants = append(storedTeamGrants, models.Role{ID: 2, UserID: "alice", ResourceType: "policy", ResourceID: "pci", Role: "owner"})
+
+			Convey("It should not let the user create it", func() {
+				st, _ := policies.Create(alice, []byte(`{"name":"mine","environments":["prod/app"]}`))
+				So(st, ShouldEqual, 403)
+			})
+
+			Convey("It should not let the user attach it", func() {
+				st, _ := policies.Update(alice, "pci", []byte(`{"name":"pci","environments":["p2/e1","prod/app"]}`))
+				So(st, ShouldEqual, 403)
+				So(alice.IsOwner("environment", "prod/app"), ShouldBeFalse)
+			})
+		})
+	})
+}
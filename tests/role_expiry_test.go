@@ -0,0 +1,222 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/ernestio/api-gateway/controllers/roles"
+	"github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+	"github.com/nats-io/go-nats"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var storedExpiries []models.RoleExpiry
+
+// roleExpiryStore keeps the role grants and expiries saved during a
+// test, and collects the expired role events
+func roleExpiryStore(expired *[]models.Role) {
+	teamStore("admin", "alice")
+
+	_, _ = models.N.Subscribe("datacenter.get", func(msg *nats.Msg) {
+		if err := models.N.Publish(msg.Reply, []byte(`{"id":1,"name":"p1"}`)); err != nil {
+			log.Println(err)
+		}
+	})
+
+	_, _ = models.N.Subscribe("authorization.set", func(msg *nats.Msg) {
+		var r models.Role
+		if err := json.Unmarshal(msg.Data, &r); err != nil {
+			log.Println(err)
+		}
+		r.ID = uint(len(storedTeamGrants) + 1)
+		storedTeamGrants = append(storedTeamGrants, r)
+
+		data, _ := json.Marshal(r)
+		if err := models.N.Publish(msg.Reply, data); err != nil {
+			log.Println(err)
+		}
+	})
+
+	_, _ = models.N.Subscribe("role_expiry.set", func(msg *nats.Msg) {
+		var r models.RoleExpiry
+		if err := json.Unmarshal(msg.Data, &r); err != nil {
+			log.Println(err)
+		}
+		if r.ID == 0 {
+			r.ID = len(storedExpiries) + 1
+			storedExpiries = append(storedExpiries, r)
+		}
+		for i := range storedExpiries {
+			if storedExpiries[i].ID == r.ID {
+				storedExpiries[i] = r
+			}
+		}
+
+		data, _ := json.Marshal(r)
+		if err := models.N.Publish(msg.Reply, data); err != nil {
+			log.Println(err)
+		}
+	})
+
+	_, _ = models.N.Subscribe("role_expiry.find", func(msg *nats.Msg) {
+		var q models.RoleExpiry
+		found := []models.RoleExpiry{}
+		if err := json.Unmarshal(msg.Data, &q); err != nil {
+			log.Println(err)
+		}
+		for _, r := range storedExpiries {
+			if r.RoleID == q.RoleID && r.ExpiresAt == q.ExpiresAt {
+				found = append(found, r)
+			}
+		}
+
+		data, _ := json.Marshal(found)
+		if err := models.N.Publish(msg.Reply, data); err != nil {
+			log.Println(err)
+		}
+	})
+
+	_, _ = models.N.Subscribe("authorization.expired", func(msg *nats.Msg) {
+		var r models.Role
+		if err := json.Unmarshal(msg.Data, &r); err != nil {
+			log.Println(err)
+		}
+		*expired = append(*expired, r)
+	})
+}
+
+func TestRoleExpiry(t *testing.T) {
+	testsSetup()
+	admin := models.User{ID: 1, Username: "admin", Admin: helpers.Bool(true)}
+	alice := models.User{ID: 2, Username: "alice"}
+
+	Convey("Scenario: granting temporary roles", t, func() {
+		var expired []models.Role
+		storedTeams = nil
+		storedTeamGrants = nil
+		storedExpiries = nil
+		roleExpiryStore(&expired)
+		now := time.Now().Unix()
+
+		Convey("When granting a role for 8 hours", func() {
+			st, resp := roles.Create(admin, []byte(`{"user_id":"alice","resource_type":"project","resource_id":"p1","role":"owner","duration":"8h"}`))
+			var r models.Role
+			So(json.Unmarshal(resp, &r), ShouldBeNil)
+
+			Convey("It should expire in 8 hours", func() {
+				So(st, ShouldEqual, 200)
+				So(r.Duration, ShouldBeBlank)
+				So(r.ExpiresAt, ShouldBeBetweenOrEqual, now+8*3600, now+8*3600+1)
+				So(alice.IsOwner("environment", "p1/e1"), ShouldBeTrue)
+			})
+		})
+
+		Convey("When granting a role for 8 hours on top of a permanent one", func() {
+			storedTeamGrants = []models.Role{{ID: 1, UserID: "alice", ResourceType: "project", ResourceID: "p1", Role: "reader"}}
+			st, _ := roles.Create(admin, []byte(`{"user_id":"alice","resource_type":"project","resource_id":"p1","role":"owner","duration":"8h"}`))
+
+			Convey("It should keep the permanent one", func() {
+				So(st, ShouldEqual, 200)
+				So(len(storedTeamGrants), ShouldEqual, 2)
+				So(storedTeamGrants[0].Role, ShouldEqual, "reader")
+				So(storedTeamGrants[0].ExpiresAt, ShouldEqual, 0)
+				So(storedTeamGrants[1].Role, ShouldEqual, "owner")
+				So(alice.IsOwner("project", "p1"), ShouldBeTrue)
+			})
+		})
+
+		Convey("Given an owner role that expires in an hour", func() {
+			storedTeamGrants = []models.Role{{ID: 1, UserID: "alice", ResourceType: "project", ResourceID: "p1", Role: "owner", ExpiresAt: now + 3600}}
+
+			Convey("When granting a role for 30 minutes", func() {
+				st, _ := roles.Create(alice, []byte(`{"user_id":"admin","resource_type":"project","resource_id":"p1","role":"reader","duration":"30m"}`))
+				Convey("It should be granted", func() {
+					So(st, ShouldEqual, 200)
+					So(len(storedTeamGrants), ShouldEqual, 2)
+				})
+			})
+
+			Convey("When granting a role for 8 hours", func() {
+				st, resp := roles.Create(alice, []byte(`{"user_id":"admin","resource_type":"project","resource_id":"p1","role":"reader","duration":"8h"}`))
+				Convey("It should be rejected", func() {
+					So(st, ShouldEqual, 403)
+					So(string(resp), ShouldContainSubstring, "Role can't outlast the role you own the resource with")
+					So(len(storedTeamGrants), ShouldEqual, 1)
+				})
+			})
+
+			Convey("When granting a permanent role", func() {
+				st, _ := roles.Create(alice, []byte(`{"user_id":"admin","resource_type":"project","resource_id":"p1","role":"reader"}`))
+				Convey("It should be rejected", func() {
+					So(st, ShouldEqual, 403)
+					So(len(storedTeamGrants), ShouldEqual, 1)
+				})
+			})
+		})
+
+		Convey("When granting a role with an invalid duration", func() {
+			st, resp := roles.Create(admin, []byte(`{"user_id":"alice","resource_type":"project","resource_id":"p1","role":"owner","duration":"soon"}`))
+			Convey("It should be rejected", func() {
+				So(st, ShouldEqual, 400)
+				So(string(resp), ShouldContainSubstring, "Role duration is not a valid duration")
+			})
+		})
+
+		Convey("Given a role that has expired", func() {
+			storedTeamGrants = []models.Role{{ID: 1, UserID: "alice", ResourceType: "project", ResourceID: "p1", Role: "owner", ExpiresAt: now - 60}}
+
+			Convey("It should be ignored", func() {
+				So(alice.IsOwner("environment", "p1/e1"), ShouldBeFalse)
+				So(alice.IsReader("project", "p1"), ShouldBeFalse)
+				ids, err := alice.GrantedIDs("project")
+				So(err, ShouldBeNil)
+				So(ids, ShouldBeEmpty)
+			})
+
+			Convey("When the sweeper runs", func() {
+				storedTeamGrants = append(storedTeamGrants, models.Role{ID: 2, UserID: "alice", ResourceType: "project", ResourceID: "p2", Role: "reader", ExpiresAt: now + 60})
+				swept, err := models.SweepExpiredRoles()
+				time.Sleep(10 * time.Millisecond)
+
+				Convey("It should delete it and announce it", func() {
+					So(err, ShouldBeNil)
+					So(swept, ShouldEqual, 1)
+					So(len(storedExpiries), ShouldEqual, 1)
+					So(storedExpiries[0].RoleID, ShouldEqual, 1)
+					So(storedExpiries[0].Status, ShouldEqual, "done")
+					So(len(storedTeamGrants), ShouldEqual, 1)
+					So(storedTeamGrants[0].ResourceID, ShouldEqual, "p2")
+					So(len(expired), ShouldEqual, 1)
+					So(expired[0].ResourceID, ShouldEqual, "p1")
+				})
+
+				Convey("And another gateway sweeps it too", func() {
+					storedTeamGrants = append(storedTeamGrants, models.Role{ID: 1, UserID: "alice", ResourceType: "project", ResourceID: "p1", Role: "owner", ExpiresAt: now - 60})
+					swept, err := models.SweepExpiredRoles()
+					time.Sleep(10 * time.Millisecond)
+
+					Convey("It should only be announced once", func() {
+						So(err, ShouldBeNil)
+						So(swept, ShouldEqual, 0)
+						So(len(expired), ShouldEqual, 1)
+					})
+				})
+			})
+		})
+
+		Convey("Given a role that has not started yet", func() {
+			storedTeamGrants = []models.Role{{ID: 1, UserID: "alice", ResourceType: "project", ResourceID: "p1", Role: "owner", StartsAt: now + 3600}}
+
+			Convey("It should be ignored", func() {
+				So(alice.IsOwner("project", "p1"), ShouldBeFalse)
+			})
+		})
+	})
+}
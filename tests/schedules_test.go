@@ -0,0 +1,235 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/ernestio/api-gateway/controllers/schedules"
+	"github.com/ernestio/api-gateway/models"
+	"github.com/nats-io/go-nats"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var storedRuns []models.ScheduleRun
+
+// scheduleStore serves the given environments and keeps the schedule
+// runs saved during a test
+func scheduleStore(list []models.Env) {
+	reply := func(msg *nats.Msg, v interface{}) {
+		data, _ := json.Marshal(v)
+		if err := models.N.Publish(msg.Reply, data); err != nil {
+			log.Println(err)
+		}
+	}
+
+	_, _ = models.N.Subscribe("environment.find", func(msg *nats.Msg) {
+		reply(msg, list)
+	})
+
+	_, _ = models.N.Subscribe("environment.get", func(msg *nats.Msg) {
+		var q models.Env
+		_ = json.Unmarshal(msg.Data, &q)
+		for _, e := range list {
+			if e.Name == q.Name {
+				reply(msg, e)
+				return
+			}
+		}
+		reply(msg, map[string]string{"_error": "Not found"})
+	})
+
+	_, _ = models.N.Subscribe("schedule_run.set", func(msg *nats.Msg) {
+		var r models.ScheduleRun
+		_ = json.Unmarshal(msg.Data, &r)
+		if r.ID == 0 {
+			r.ID = len(storedRuns) + 1
+			storedRuns = append(storedRuns, r)
+		}
+		for i := range storedRuns {
+			if storedRuns[i].ID == r.ID {
+				storedRuns[i] = r
+			}
+		}
+		reply(msg, r)
+	})
+
+	_, _ = models.N.Subscribe("schedule_run.find", func(msg *nats.Msg) {
+		var q models.ScheduleRun
+		found := []models.ScheduleRun{}
+		_ = json.Unmarshal(msg.Data, &q)
+		for _, r := range storedRuns {
+			if r.Env == q.Env && (q.Schedule == "" || (r.Schedule == q.Schedule && r.ScheduledAt == q.ScheduledAt)) {
+				found = append(found, r)
+			}
+		}
+		reply(msg, found)
+	})
+
+	_, _ = models.N.Subscribe("schedule_run.del", func(msg *nats.Msg) {
+		var q models.ScheduleRun
+		_ = json.Unmarshal(msg.Data, &q)
+		var kept []models.ScheduleRun
+		for _, r := range storedRuns {
+			if r.ID != q.ID {
+				kept = append(kept, r)
+			}
+		}
+		storedRuns = kept
+		reply(msg, map[string]string{})
+	})
+
+	_, _ = models.N.Subscribe("environment.sync", func(msg *nats.Msg) {
+		reply(msg, map[string]string{"id": "sync-1"})
+	})
+
+	_, _ = models.N.Subscribe("environment.power_off", func(msg *nats.Msg) {
+		reply(msg, map[string]string{"_error": "Provider does not support powering off"})
+	})
+}
+
+func TestCron(t *testing.T) {
+	Convey("Scenario: parsing cron expressions", t, func() {
+		at := func(v string) time.Time {
+			t, _ := time.Parse(time.RFC3339, v)
+			return t
+		}
+
+		Convey("It should match lists, ranges, steps and names", func() {
+			c, err := models.ParseCron("*/15 9-17 * * mon-fri", "")
+			So(err, ShouldBeNil)
+			So(c.Matches(at("2017-07-03T09:30:00Z")), ShouldBeTrue)
+			So(c.Matches(at("2017-07-03T09:31:00Z")), ShouldBeFalse)
+			So(c.Matches(at("2017-07-03T18:00:00Z")), ShouldBeFalse)
+			So(c.Matches(at("2017-07-02T09:30:00Z")), ShouldBeFalse)
+		})
+
+		Convey("It should evaluate the expression on its time zone", func() {
+			c, err := models.ParseCron("0 8 * * *", "Europe/London")
+			So(err, ShouldBeNil)
+			So(c.Matches(at("2017-07-03T07:00:00Z")), ShouldBeTrue)
+			So(c.Matches(at("2017-01-03T08:00:00Z")), ShouldBeTrue)
+			next, ok := c.Next(at("2017-07-03T07:00:00Z"))
+			So(ok, ShouldBeTrue)
+			So(next.UTC(), ShouldResemble, at("2017-07-04T07:00:00Z"))
+		})
+
+		Convey("It should only look for due times up to the end of the range", func() {
+			s := models.Schedule{Action: "sync", Interval: "0 0 29 2 *"}
+			So(s.Validate(), ShouldBeNil)
+
+			So(s.Due(at("2017-07-03T07:00:00Z"), at("2017-07-03T08:00:00Z")), ShouldBeEmpty)
+			So(s.Due(at("2020-02-28T07:00:00Z"), at("2020-03-01T00:00:00Z")), ShouldResemble, []time.Time{at("2020-02-29T00:00:00Z")})
+		})
+
+		Convey("It should match any of the days when both are set", func() {
+			c, err := models.ParseCron("0 0 1 * 7", "")
+			So(err, ShouldBeNil)
+			So(c.Matches(at("2017-08-01T00:00:00Z")), ShouldBeTrue)
+			So(c.Matches(at("2017-07-02T00:00:00Z")), ShouldBeTrue)
+			So(c.Matches(at("2017-07-03T00:00:00Z")), ShouldBeFalse)
+		})
+
+		Convey("It should reject invalid expressions", func() {
+			_, err := models.ParseCron("61 * * * *", "")
+			So(err, ShouldNotBeNil)
+			_, err = models.ParseCron("* * * *", "")
+			So(err, ShouldNotBeNil)
+			_, err = models.ParseCron("@daily", "Mars/Olympus")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestSchedules(t *testing.T) {
+	testsSetup()
+	from := time.Date(2017, 7, 3, 7, 59, 30, 0, time.UTC)
+	to := from.Add(time.Minute)
+
+	Convey("Scenario: running environment schedules", t, func() {
+		storedRuns = nil
+		storedLocks = nil
+		storedFreezes = nil
+		storedTeams = nil
+		storedTeamGrants = []models.Role{
+			{ID: 1, UserID: "alice", ResourceType: "environment", ResourceID: "p1/e1", Role: "reader"},
+		}
+		teamStore("alice")
+		lockStore()
+		scheduleStore([]models.Env{{
+			ID:   1,
+			Name: "p1/e1",
+			Schedules: map[string]interface{}{
+				"morning-sync": map[string]interface{}{"action": "sync", "interval": "0 8 * * 1-5"},
+				"weekend-off":  map[string]interface{}{"action": "power_off", "interval": "0 8 * * 0,6"},
+			},
+		}})
+
+		Convey("When a schedule is due", func() {
+			ran := schedules.Run(from, to)
+
+			Convey("It should run its action and record it", func() {
+				So(ran, ShouldEqual, 1)
+				So(len(storedRuns), ShouldEqual, 1)
+				So(storedRuns[0].Schedule, ShouldEqual, "morning-sync")
+				So(storedRuns[0].Status, ShouldEqual, "done")
+				So(storedRuns[0].BuildID, ShouldEqual, "sync-1")
+				So(storedRuns[0].ScheduledAt, ShouldEqual, to.Truncate(time.Minute).Unix())
+			})
+		})
+
+		Convey("When another gateway claimed the run first", func() {
+			storedRuns = []models.ScheduleRun{{ID: 1, Env: "p1/e1", Schedule: "morning-sync", ScheduledAt: to.Truncate(time.Minute).Unix(), Status: "claimed", Replica: "other"}}
+			ran := schedules.Run(from, to)
+
+			Convey("It should not run it again", func() {
+				So(ran, ShouldEqual, 0)
+				So(len(storedRuns), ShouldEqual, 1)
+				So(storedRuns[0].Replica, ShouldEqual, "other")
+			})
+		})
+
+		Convey("When the action fails", func() {
+			weekend := from.AddDate(0, 0, 5)
+			ran := schedules.Run(weekend, weekend.Add(time.Minute))
+
+			Convey("It should record the failure", func() {
+				So(ran, ShouldEqual, 1)
+				So(storedRuns[0].Schedule, ShouldEqual, "weekend-off")
+				So(storedRuns[0].Status, ShouldEqual, "failed")
+				So(storedRuns[0].Error, ShouldEqual, "Provider does not support powering off")
+			})
+		})
+
+		Convey("When listing the runs", func() {
+			storedRuns = []models.ScheduleRun{
+				{ID: 1, Env: "p1/e1", Schedule: "morning-sync", ScheduledAt: 100, Status: "done"},
+				{ID: 2, Env: "p1/e1", Schedule: "morning-sync", ScheduledAt: 200, Status: "failed"},
+			}
+
+			Convey("It should return the newest first", func() {
+				var runs []models.ScheduleRun
+				st, res := schedules.Runs(models.User{ID: 2, Username: "alice"}, "p1/e1")
+				So(st, ShouldEqual, 200)
+				So(json.Unmarshal(res, &runs), ShouldBeNil)
+				So(runs[0].ID, ShouldEqual, 2)
+			})
+
+			Convey("It should only be allowed to readers", func() {
+				st, _ := schedules.Runs(models.User{ID: 3, Username: "bob"}, "p1/e1")
+				So(st, ShouldEqual, 403)
+			})
+		})
+
+		Convey("When a schedule is not valid", func() {
+			e := models.Env{Schedules: map[string]interface{}{"bad": map[string]interface{}{"action": "reboot", "interval": "@daily"}}}
+			_, err := e.GetSchedules()
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
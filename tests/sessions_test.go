@@ -0,0 +1,381 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ernestio/api-gateway/controllers"
+	"github.com/ernestio/api-gateway/controllers/sessions"
+	"github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+	"github.com/labstack/echo"
+	"github.com/nats-io/go-nats"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var storedSessions []models.Session
+var storedRevocations []models.Revocation
+var revocationLookups int
+
+// sessionStore keeps the sessions and revocations saved during a test
+func sessionStore() {
+	_, _ = models.N.Subscribe("session.set", func(msg *nats.Msg) {
+		var s models.Session
+		if err := json.Unmarshal(msg.Data, &s); err != nil {
+			log.Println(err)
+		}
+
+		if s.ID == 0 {
+			s.ID = len(storedSessions) + 1
+			storedSessions = append(storedSessions, s)
+		} else {
+			for i := range storedSessions {
+				if storedSessions[i].ID == s.ID {
+					storedSessions[i] = s
+				}
+			}
+		}
+
+		data, _ := json.Marshal(s)
+		if err := models.N.Publish(msg.Reply, data); err != nil {
+			log.Println(err)
+		}
+	})
+
+	_, _ = models.N.Subscribe("session.get", func(msg *nats.Msg) {
+		var q models.Session
+		if err := json.Unmarshal(msg.Data, &q); err != nil {
+			log.Println(err)
+		}
+
+		data := []byte(`{"_error":"Not found"}`)
+		for _, s := range storedSessions {
+			if s.SessionID == q.SessionID {
+				data, _ = json.Marshal(s)
+			}
+		}
+
+		if err := models.N.Publish(msg.Reply, data); err != nil {
+			log.Println(err)
+		}
+	})
+
+	_, _ = models.N.Subscribe("session.find", func(msg *nats.Msg) {
+		var q models.Session
+		var found []models.Session
+		if err := json.Unmarshal(msg.Data, &q); err != nil {
+			log.Println(err)
+		}
+
+		for _, s := range storedSessions {
+			if s.Username == q.Username {
+				found = append(found, s)
+			}
+		}
+
+		data, _ := json.Marshal(found)
+		if err := models.N.Publish(msg.Reply, data); err != nil {
+			log.Println(err)
+		}
+	})
+
+	_, _ = models.N.Subscribe("session.del", func(msg *nats.Msg) {
+		var q models.Session
+		var kept []models.Session
+		if err := json.Unmarshal(msg.Data, &q); err != nil {
+			log.Println(err)
+		}
+
+		for _, s := range storedSessions {
+			if s.ID != q.ID {
+				kept = append(kept, s)
+			}
+		}
+		storedSessions = kept
+
+		if err := models.N.Publish(msg.Reply, []byte{}); err != nil {
+			log.Println(err)
+		}
+	})
+
+	_, _ = models.N.Subscribe("revocation.set", func(msg *nats.Msg) {
+		var r models.Revocation
+		if err := json.Unmarshal(msg.Data, &r); err != nil {
+			log.Println(err)
+		}
+		r.ID = len(storedRevocations) + 1
+		storedRevocations = append(storedRevocations, r)
+
+		if err := models.N.Publish(msg.Reply, msg.Data); err != nil {
+			log.Println(err)
+		}
+	})
+
+	_, _ = models.N.Subscribe("revocation.find", func(msg *nats.Msg) {
+		revocationLookups++
+		data, _ := json.Marshal(storedRevocations)
+		if storedRevocations == nil {
+			data = []byte(`[]`)
+		}
+		if err := models.N.Publish(msg.Reply, data); err != nil {
+			log.Println(err)
+		}
+	})
+
+	_, _ = models.N.Subscribe("revocation.del", func(msg *nats.Msg) {
+		var q models.Revocation
+		var kept []models.Revocation
+		if err := json.Unmarshal(msg.Data, &q); err != nil {
+			log.Println(err)
+		}
+
+		for _, r := range storedRevocations {
+			if r.ID != q.ID {
+				kept = append(kept, r)
+			}
+		}
+		storedRevocations = kept
+
+		if err := models.N.Publish(msg.Reply, []byte{}); err != nil {
+			log.Println(err)
+		}
+	})
+}
+
+func TestSessions(t *testing.T) {
+	testsSetup()
+	user := models.User{ID: 1, Username: "test", Admin: helpers.Bool(false)}
+	other := models.User{ID: 3, Username: "other", Admin: helpers.Bool(false)}
+	admin := models.User{ID: 2, Username: "admin", Admin: helpers.Bool(true)}
+
+	Convey("Scenario: logging in", t, func() {
+		_, proxy, _ := net.ParseCIDR("192.0.2.1/32")
+		controllers.TrustedProxies = []*net.IPNet{proxy}
+		defer func() {
+			controllers.TrustedProxies = nil
+		}()
+		storedSessions = nil
+		storedRevocations = nil
+		sessionStore()
+		foundSubscriber("user.get", `{"id":1,"username":"test"}`, 1)
+		foundSubscriber("authentication.get", `{"ok":true}`, 1)
+
+		e := echo.New()
+		req := httptest.NewRequest(echo.POST, "/auth/", strings.NewReader(`{"username":"test","password":"test1234"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("User-Agent", "Ernest/2.5.0")
+		req.Header.Set(echo.HeaderXForwardedFor, "192.0.2.10")
+		rec := httptest.NewRecorder()
+
+		err := controllers.AuthenticateHandler(e.NewContext(req, rec))
+		So(err, ShouldBeNil)
+		So(len(storedSessions), ShouldEqual, 1)
+		sid := storedSessions[0].SessionID
+
+		Convey("It should record the session", func() {
+			s := storedSessions[0]
+			So(s.Username, ShouldEqual, "test")
+			So(s.UserAgent, ShouldEqual, "Ernest/2.5.0")
+			So(s.ClientVersion, ShouldEqual, "2.5.0")
+			So(s.IP, ShouldEqual, "192.0.2.10")
+			So(s.IssuedAt, ShouldBeGreaterThan, 0)
+			So(s.LastSeen, ShouldEqual, s.IssuedAt)
+			So(s.ExpiresAt, ShouldBeGreaterThan, s.IssuedAt)
+		})
+
+		Convey("When listing the user sessions", func() {
+			st, resp := sessions.List(user, "", sid)
+			Convey("It should return the current session", func() {
+				var l []models.Session
+				So(st, ShouldEqual, 200)
+				So(json.Unmarshal(resp, &l), ShouldBeNil)
+				So(len(l), ShouldEqual, 1)
+				So(l[0].SessionID, ShouldEqual, sid)
+				So(l[0].Current, ShouldBeTrue)
+			})
+		})
+
+		Convey("When another user lists the user sessions", func() {
+			st, _ := sessions.List(other, "test", "")
+			Convey("It should return a forbidden error", func() {
+				So(st, ShouldEqual, 403)
+			})
+		})
+
+		Convey("When an admin lists the user sessions", func() {
+			st, resp := sessions.List(admin, "test", "")
+			Convey("It should return the user sessions", func() {
+				var l []models.Session
+				So(st, ShouldEqual, 200)
+				So(json.Unmarshal(resp, &l), ShouldBeNil)
+				So(len(l), ShouldEqual, 1)
+				So(l[0].Current, ShouldBeFalse)
+			})
+		})
+
+		Convey("When another user revokes the session", func() {
+			st, _ := sessions.Delete(other, sid)
+			Convey("It should not find it", func() {
+				So(st, ShouldEqual, 404)
+				So(len(storedRevocations), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When the user revokes the session", func() {
+			st, _ := sessions.Delete(user, sid)
+			Convey("It should revoke the session tokens", func() {
+				So(st, ShouldEqual, 200)
+				So(len(storedRevocations), ShouldEqual, 1)
+				So(storedRevocations[0].TokenID, ShouldEqual, sid)
+				So(storedRevocations[0].Username, ShouldEqual, "test")
+				So(len(storedSessions), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When all the user tokens have been revoked", func() {
+			storedRevocations = []models.Revocation{{Username: "test", CreatedAt: storedSessions[0].IssuedAt}}
+			st, resp := sessions.List(admin, "test", "")
+			Convey("It should not list the session", func() {
+				So(st, ShouldEqual, 200)
+				So(string(resp), ShouldEqual, "[]")
+			})
+		})
+	})
+
+	Convey("Scenario: refreshing tokens", t, func() {
+		storedSessions = nil
+		storedRevocations = nil
+		sessionStore()
+		foundSubscriber("user.get", `{"id":1,"username":"test"}`, 3)
+		foundSubscriber("authentication.get", `{"ok":true}`, 1)
+
+		tokens := sessionRequest(controllers.AuthenticateHandler, `{"username":"test","password":"test1234"}`)
+		So(tokens["refresh_token"], ShouldNotBeBlank)
+		sid := storedSessions[0].SessionID
+
+		access := func(token string) error {
+			e := echo.New()
+			req := httptest.NewRequest(echo.GET, "/api/session/", nil)
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+			return controllers.ValidateToken(controllers.CheckRevocation(func(c echo.Context) error {
+				return nil
+			}))(e.NewContext(req, httptest.NewRecorder()))
+		}
+
+		Convey("When refreshing the tokens", func() {
+			refreshed := sessionRequest(controllers.RefreshHandler, `{"refresh_token":"`+tokens["refresh_token"]+`"}`)
+
+			Convey("It should rotate the refresh token", func() {
+				So(refreshed["token"], ShouldNotBeBlank)
+				So(refreshed["refresh_token"], ShouldNotBeBlank)
+				So(refreshed["refresh_token"], ShouldNotEqual, tokens["refresh_token"])
+				So(len(storedRevocations), ShouldEqual, 1)
+				So(storedRevocations[0].TokenID, ShouldNotEqual, sid)
+				So(access(refreshed["token"]), ShouldBeNil)
+			})
+
+			Convey("And reusing the previous refresh token", func() {
+				reused := sessionRequest(controllers.RefreshHandler, `{"refresh_token":"`+tokens["refresh_token"]+`"}`)
+
+				Convey("It should revoke the whole session", func() {
+					So(reused["token"], ShouldBeBlank)
+					So(len(storedRevocations), ShouldEqual, 2)
+					So(storedRevocations[1].TokenID, ShouldEqual, sid)
+					So(access(refreshed["token"]), ShouldNotBeNil)
+				})
+			})
+		})
+
+		Convey("When all the user tokens are revoked", func() {
+			var r models.Revocation
+			So(access(tokens["token"]), ShouldBeNil)
+			// revocations apply to the tokens issued on an earlier millisecond
+			time.Sleep(2 * time.Millisecond)
+			So(r.RevokeAll("test"), ShouldBeNil)
+
+			Convey("It should reject the tokens already issued", func() {
+				So(access(tokens["token"]), ShouldNotBeNil)
+				refreshed := sessionRequest(controllers.RefreshHandler, `{"refresh_token":"`+tokens["refresh_token"]+`"}`)
+				So(refreshed["token"], ShouldBeBlank)
+			})
+
+			Convey("It should not expire, as api tokens may never expire", func() {
+				So(storedRevocations[0].ExpiresAt, ShouldEqual, 0)
+				So(access(tokens["token"]), ShouldNotBeNil)
+				So(len(storedRevocations), ShouldEqual, 1)
+			})
+
+			Convey("And the user logs in again right away", func() {
+				foundSubscriber("user.get", `{"id":1,"username":"test"}`, 1)
+				foundSubscriber("authentication.get", `{"ok":true}`, 1)
+				again := sessionRequest(controllers.AuthenticateHandler, `{"username":"test","password":"test1234"}`)
+
+				Convey("It should accept the new tokens", func() {
+					So(again["token"], ShouldNotBeBlank)
+					So(access(again["token"]), ShouldBeNil)
+				})
+			})
+
+			Convey("And they are revoked again", func() {
+				time.Sleep(2 * time.Millisecond)
+				var again models.Revocation
+				So(again.RevokeAll("test"), ShouldBeNil)
+
+				Convey("It should prune the revocation it replaces", func() {
+					So(access(tokens["token"]), ShouldNotBeNil)
+					So(len(storedRevocations), ShouldEqual, 1)
+					So(storedRevocations[0].CreatedAtMs, ShouldEqual, again.CreatedAtMs)
+				})
+			})
+		})
+
+		Convey("When the revocations are cached", func() {
+			models.RevocationCacheTTL = time.Minute
+			defer func() { models.RevocationCacheTTL = 0 }()
+			var r models.Revocation
+			So(r.RevokeToken("test", "expired", time.Now().Add(-time.Minute).Unix()), ShouldBeNil)
+			revocationLookups = 0
+
+			Convey("It should only fetch them once, pruning the expired ones", func() {
+				So(access(tokens["token"]), ShouldBeNil)
+				So(access(tokens["token"]), ShouldBeNil)
+				So(revocationLookups, ShouldEqual, 1)
+				So(len(storedRevocations), ShouldEqual, 0)
+			})
+
+			Convey("It should drop them when a token is revoked", func() {
+				So(access(tokens["token"]), ShouldBeNil)
+				So(r.RevokeToken("test", sid, time.Now().Add(time.Hour).Unix()), ShouldBeNil)
+				So(access(tokens["token"]), ShouldNotBeNil)
+				So(revocationLookups, ShouldEqual, 2)
+			})
+		})
+	})
+}
+
+// sessionRequest posts the given body to an authentication handler,
+// returning the tokens it responds with
+func sessionRequest(handler echo.HandlerFunc, body string) map[string]string {
+	var tokens map[string]string
+
+	e := echo.New()
+	req := httptest.NewRequest(echo.POST, "/auth/", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	if err := handler(e.NewContext(req, rec)); err != nil {
+		return nil
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &tokens)
+
+	return tokens
+}
@@ -109,7 +109,7 @@ func serviceResetSubscriber() {
 
 func notFoundSubscriber(subject string, max int) {
 	sub, _ := models.N.Subscribe(subject, func(msg *nats.Msg) {
-		if err := models.N.Publish(msg.Reply, []byte(`{"_error","Not found"}`)); err != nil {
+		if err := models.N.Publish(msg.Reply, []byte(`{"_error":"Not found"}`)); err != nil {
 			log.Println(err)
 		}
 	})
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"net"
+	"strings"
+
+	"gopkg.in/asn1-ber.v1"
+)
+
+const (
+	ldapBindRequest    = 0
+	ldapBindResponse   = 1
+	ldapUnbindRequest  = 2
+	ldapSearchRequest  = 3
+	ldapSearchEntry    = 4
+	ldapSearchDone     = 5
+	ldapEqualityFilter = 3
+)
+
+// mockDirectory is a minimal in-process ldap server, supporting simple
+// binds and searches with equality filters
+type mockDirectory struct {
+	listener  net.Listener
+	passwords map[string]string
+	users     map[string]string
+	groups    map[string][]string
+}
+
+func newMockDirectory() *mockDirectory {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+
+	d := &mockDirectory{
+		listener:  l,
+		passwords: map[string]string{"cn=admin,dc=example": "adminpass"},
+		users:     map[string]string{},
+		groups:    map[string][]string{},
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go d.serve(conn)
+		}
+	}()
+
+	return d
+}
+
+// URL : returns the ldap url the directory listens on
+func (d *mockDirectory) URL() string {
+	return "ldap://" + d.listener.Addr().String()
+}
+
+func (d *mockDirectory) addUser(uid, password string, groups ...string) {
+	dn := "uid=" + uid + ",ou=people,dc=example"
+	d.users[uid] = dn
+	d.passwords[dn] = password
+	for _, g := range groups {
+		d.groups[g] = append(d.groups[g], dn)
+	}
+}
+
+func (d *mockDirectory) serve(conn net.Conn) {
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	for {
+		p, err := ber.ReadPacket(conn)
+		if err != nil || len(p.Children) < 2 {
+			return
+		}
+
+		id := p.Children[0].Value
+		op := p.Children[1]
+
+		switch op.Tag {
+		case ldapBindRequest:
+			dn := op.Children[1].Data.String()
+			code := 49
+			if pw, ok := d.passwords[dn]; ok && pw == op.Children[2].Data.String() {
+				code = 0
+			}
+			d.reply(conn, id, ldapResult(ldapBindResponse, code))
+		case ldapSearchRequest:
+			for dn, attrs := range d.search(op.Children[6]) {
+				d.reply(conn, id, ldapEntry(dn, attrs))
+			}
+			d.reply(conn, id, ldapResult(ldapSearchDone, 0))
+		case ldapUnbindRequest:
+			return
+		}
+	}
+}
+
+func (d *mockDirectory) search(filter *ber.Packet) map[string]map[string]string {
+	res := make(map[string]map[string]string)
+
+	if filter.Tag != ldapEqualityFilter || len(filter.Children) != 2 {
+		return res
+	}
+
+	attr := strings.ToLower(filter.Children[0].Data.String())
+	value := filter.Children[1].Data.String()
+
+	switch attr {
+	case "uid":
+		if dn, ok := d.users[value]; ok {
+			res[dn] = map[string]string{"uid": value}
+		}
+	case "member":
+		for g, members := range d.groups {
+			for _, m := range members {
+				if m == value {
+					res["cn="+g+",ou=groups,dc=example"] = map[string]string{"cn": g}
+				}
+			}
+		}
+	}
+
+	return res
+}
+
+func (d *mockDirectory) reply(conn net.Conn, id interface{}, op *ber.Packet) {
+	p := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+	p.AppendChild(op)
+	_, _ = conn.Write(p.Bytes())
+}
+
+func ldapResult(tag ber.Tag, code int) *ber.Packet {
+	p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "ResultCode"))
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "MatchedDN"))
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Message"))
+	return p
+}
+
+func ldapEntry(dn string, attrs map[string]string) *ber.Packet {
+	p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldapSearchEntry, nil, "Entry")
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, "DN"))
+
+	list := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for k, v := range attrs {
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, k, "Type"))
+		vals := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		vals.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "Value"))
+		attr.AppendChild(vals)
+		list.AppendChild(attr)
+	}
+	p.AppendChild(list)
+
+	return p
+}
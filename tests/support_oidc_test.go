@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// mockIdP is a minimal OpenID Connect identity provider
+type mockIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	claims jwt.MapClaims
+	// fetches counts the metadata and key set requests
+	fetches int32
+}
+
+func newMockIdP() *mockIdP {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	m := &mockIdP{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&m.fetches, 1)
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.server.URL,
+			"authorization_endpoint": m.server.URL + "/authorize",
+			"token_endpoint":         m.server.URL + "/token",
+			"jwks_uri":               m.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&m.fetches, 1)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test",
+				"n":   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "valid" {
+			w.WriteHeader(400)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"id_token": m.idToken()})
+	})
+
+	m.server = httptest.NewServer(mux)
+
+	return m
+}
+
+// login : sets the claims of the next id token issued
+func (m *mockIdP) login(username, nonce string, groups ...string) {
+	m.claims = jwt.MapClaims{
+		"iss":                m.server.URL,
+		"aud":                "ernest",
+		"sub":                "sub-" + username,
+		"preferred_username": username,
+		"groups":             groups,
+		"nonce":              nonce,
+		"iat":                time.Now().Unix(),
+		"exp":                time.Now().Add(time.Minute).Unix(),
+	}
+}
+
+func (m *mockIdP) idToken() string {
+	t := jwt.NewWithClaims(jwt.SigningMethodRS256, m.claims)
+	t.Header["kid"] = "test"
+	s, _ := t.SignedString(m.key)
+	return s
+}
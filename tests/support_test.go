@@ -9,6 +9,7 @@ import (
 	"os"
 
 	"github.com/ernestio/api-gateway/controllers"
+	"github.com/ernestio/api-gateway/helpers"
 	"github.com/ernestio/api-gateway/models"
 	"github.com/labstack/echo"
 	"github.com/r3labs/akira"
@@ -27,5 +28,13 @@ func testsSetup() {
 	c := models.Config{}
 	secret, _ := c.GetJWTToken()
 	controllers.Secret = secret
+	controllers.Keys = models.NewKeyring(secret)
+	controllers.Throttle = models.NewLoginThrottle()
+	controllers.ResetThrottle = models.NewPasswordResetThrottle()
+	controllers.TrustedProxies = nil
+	models.Passwords = &models.PasswordPolicy{MinLength: 8}
+	models.RevocationCacheTTL = 0
+	controllers.Mail = nil
+	helpers.SetAuthzPolicy(&helpers.DefaultAuthzPolicy)
 	models.N = akira.NewFakeConnector()
 }
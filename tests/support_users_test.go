@@ -3,8 +3,12 @@ package main
 import (
 	"encoding/json"
 	"log"
+	"net/http/httptest"
+	"strings"
 
+	"github.com/ernestio/api-gateway/controllers"
 	"github.com/ernestio/api-gateway/models"
+	"github.com/labstack/echo"
 	"github.com/nats-io/go-nats"
 )
 
@@ -145,3 +149,12 @@ func deleteUserSubscriber() {
 		log.Println(err)
 	}
 }
+
+// authRequest : calls the authentication handler with the given payload
+func authRequest(body string) (*httptest.ResponseRecorder, error) {
+	e := echo.New()
+	req := httptest.NewRequest(echo.POST, "/auth/", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	return rec, controllers.AuthenticateHandler(e.NewContext(req, rec))
+}
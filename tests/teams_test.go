@@ -0,0 +1,290 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"testing"
+
+	"github.com/ernestio/api-gateway/controllers/teams"
+	"github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+	"github.com/nats-io/go-nats"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var storedTeams []models.Team
+var storedTeamGrants []models.Role
+var teamQueries []map[string]interface{}
+
+// teamStore keeps the teams and role grants saved during a test, and
+// knows about the given users
+func teamStore(usernames ...string) {
+	_, _ = models.N.Subscribe("user.get", func(msg *nats.Msg) {
+		var q models.User
+		if err := json.Unmarshal(msg.Data, &q); err != nil {
+			log.Println(err)
+		}
+
+		data := []byte(`{"_error":"Not found"}`)
+		for i, name := range usernames {
+			if name == q.Username {
+				data, _ = json.Marshal(models.User{ID: i + 1, Username: name})
+			}
+		}
+
+		if err := models.N.Publish(msg.Reply, data); err != nil {
+			log.Println(err)
+		}
+	})
+
+	_, _ = models.N.Subscribe("team.set", func(msg *nats.Msg) {
+		var t models.Team
+		if err := json.Unmarshal(msg.Data, &t); err != nil {
+			log.Println(err)
+		}
+		if t.ID == 0 {
+			t.ID = len(storedTeams) + 1
+			storedTeams = append(storedTeams, t)
+		} else {
+			for i := range storedTeams {
+				if storedTeams[i].ID == t.ID {
+					storedTeams[i] = t
+				}
+			}
+		}
+
+		data, _ := json.Marshal(t)
+		if err := models.N.Publish(msg.Reply, data); err != nil {
+			log.Println(err)
+		}
+	})
+
+	_, _ = models.N.Subscribe("team.get", func(msg *nats.Msg) {
+		var q models.Team
+		if err := json.Unmarshal(msg.Data, &q); err != nil {
+			log.Println(err)
+		}
+
+		data := []byte(`{"_error":"Not found"}`)
+		for _, t := range storedTeams {
+			if t.Name == q.Name {
+				data, _ = json.Marshal(t)
+			}
+		}
+
+		if err := models.N.Publish(msg.Reply, data); err != nil {
+			log.Println(err)
+		}
+	})
+
+	_, _ = models.N.Subscribe("team.find", func(msg *nats.Msg) {
+		var q map[string]interface{}
+		found := []models.Team{}
+		_ = json.Unmarshal(msg.Data, &q)
+		teamQueries = append(teamQueries, q)
+
+		for _, t := range storedTeams {
+			if m, ok := q["member"].(string); !ok || t.HasMember(m) {
+				found = append(found, t)
+			}
+		}
+
+		data, _ := json.Marshal(found)
+		if err := models.N.Publish(msg.Reply, data); err != nil {
+			log.Println(err)
+		}
+	})
+
+	_, _ = models.N.Subscribe("team.del", func(msg *nats.Msg) {
+		var q models.Team
+		var kept []models.Team
+		if err := json.Unmarshal(msg.Data, &q); err != nil {
+			log.Println(err)
+		}
+
+		for _, t := range storedTeams {
+			if t.ID != q.ID {
+				kept = append(kept, t)
+			}
+		}
+		storedTeams = kept
+
+		if err := models.N.Publish(msg.Reply, []byte{}); err != nil {
+			log.Println(err)
+		}
+	})
+
+	_, _ = models.N.Subscribe("authorization.find", func(msg *nats.Msg) {
+		var q map[string]interface{}
+		found := []models.Role{}
+		if err := json.Unmarshal(msg.Data, &q); err != nil {
+			log.Println(err)
+		}
+
+		for _, r := range storedTeamGrants {
+			if matchesGrant(r, q) {
+				found = append(found, r)
+			}
+		}
+
+		data, _ := json.Marshal(found)
+		if err := models.N.Publish(msg.Reply, data); err != nil {
+			log.Println(err)
+		}
+	})
+
+	_, _ = models.N.Subscribe("authorization.del", func(msg *nats.Msg) {
+		var q map[string]interface{}
+		var kept []models.Role
+		if err := json.Unmarshal(msg.Data, &q); err != nil {
+			log.Println(err)
+		}
+
+		for _, r := range storedTeamGrants {
+			if !matchesGrant(r, q) {
+				kept = append(kept, r)
+			}
+		}
+		storedTeamGrants = kept
+
+		if err := models.N.Publish(msg.Reply, []byte{}); err != nil {
+			log.Println(err)
+		}
+	})
+
+	_, _ = models.N.Subscribe("environment.find", func(msg *nats.Msg) {
+		envs := []models.Env{{ID: 1, Name: "p1/e1"}, {ID: 2, Name: "p2/e1"}}
+		data, _ := json.Marshal(envs)
+		if err := models.N.Publish(msg.Reply, data); err != nil {
+			log.Println(err)
+		}
+	})
+}
+
+func matchesGrant(r models.Role, q map[string]interface{}) bool {
+	fields := map[string]string{
+		"user_id":       r.UserID,
+		"team_id":       r.TeamID,
+		"resource_id":   r.ResourceID,
+		"resource_type": r.ResourceType,
+		"role":          r.Role,
+	}
+
+	for k, v := range q {
+		if s, ok := v.(string); ok && fields[k] != s {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestTeams(t *testing.T) {
+	testsSetup()
+	admin := models.User{ID: 1, Username: "admin", Admin: helpers.Bool(true)}
+	alice := models.User{ID: 2, Username: "alice"}
+	carol := models.User{ID: 4, Username: "carol"}
+
+	Convey("Scenario: managing teams", t, func() {
+		storedTeams = nil
+		storedTeamGrants = nil
+		teamStore("admin", "alice", "bob", "carol")
+
+		Convey("When creating a team with an unknown member", func() {
+			st, resp := teams.Create(admin, []byte(`{"name":"devs","members":["alice","mallory"]}`))
+			Convey("It should be rejected", func() {
+				So(st, ShouldEqual, 404)
+				So(string(resp), ShouldContainSubstring, "Specified user 'mallory' not found")
+				So(len(storedTeams), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When a non admin creates a team", func() {
+			st, _ := helpers.IsAuthorized(&alice, "teams/create")
+			Convey("It should be forbidden", func() {
+				So(st, ShouldEqual, 403)
+			})
+		})
+
+		Convey("Given a devs team", func() {
+			st, _ := teams.Create(admin, []byte(`{"name":"devs","members":["alice","bob","alice"]}`))
+			So(st, ShouldEqual, 200)
+			So(storedTeams[0].Members, ShouldResemble, []string{"alice", "bob"})
+
+			Convey("When creating it again", func() {
+				st, _ := teams.Create(admin, []byte(`{"name":"devs","members":[]}`))
+				Convey("It should return a conflict", func() {
+					So(st, ShouldEqual, 409)
+				})
+			})
+
+			Convey("And a reader role granted to the team on a project", func() {
+				storedTeamGrants = []models.Role{{ID: 1, TeamID: "devs", ResourceType: "project", ResourceID: "p1", Role: "reader"}}
+
+				Convey("Its members should be readers of the project environments", func() {
+					So(alice.IsReader("environment", "p1/e1"), ShouldBeTrue)
+					So(alice.IsOwner("environment", "p1/e1"), ShouldBeFalse)
+					So(alice.IsReader("environment", "p2/e1"), ShouldBeFalse)
+				})
+
+				Convey("Other users should not", func() {
+					So(carol.IsReader("environment", "p1/e1"), ShouldBeFalse)
+				})
+
+				Convey("Its members should list the project environments", func() {
+					envs, err := alice.EnvsBy(map[string]interface{}{})
+					So(err, ShouldBeNil)
+					So(len(envs), ShouldEqual, 1)
+					So(envs[0].Name, ShouldEqual, "p1/e1")
+				})
+
+				Convey("When a member is also an owner of the project", func() {
+					storedTeamGrants = append(storedTeamGrants, models.Role{ID: 2, UserID: "alice", ResourceType: "project", ResourceID: "p1", Role: "owner"})
+					Convey("It should combine both grants", func() {
+						So(alice.IsOwner("environment", "p1/e1"), ShouldBeTrue)
+					})
+				})
+
+				Convey("When a member is removed from the team", func() {
+					st, _ := teams.Update(admin, "devs", []byte(`{"members":["bob"]}`))
+					So(st, ShouldEqual, 200)
+					Convey("It should lose the team grants", func() {
+						So(alice.IsReader("environment", "p1/e1"), ShouldBeFalse)
+					})
+				})
+
+				Convey("When deleting the team", func() {
+					st, _ := teams.Delete(admin, "devs")
+					Convey("It should delete the team and its grants", func() {
+						So(st, ShouldEqual, 200)
+						So(len(storedTeams), ShouldEqual, 0)
+						So(len(storedTeamGrants), ShouldEqual, 0)
+					})
+				})
+			})
+		})
+
+		Convey("When splitting the grants of a resource", func() {
+			users, teams := models.SplitGrants([]models.Role{
+				{ID: 1, UserID: "alice", Role: "owner"},
+				{ID: 2, TeamID: "devs", Role: "reader"},
+			})
+			Convey("It should keep team grants apart", func() {
+				So(len(users), ShouldEqual, 1)
+				So(len(teams), ShouldEqual, 1)
+				So(teams[0].Principal(), ShouldEqual, "team:devs")
+			})
+		})
+
+		Convey("When assigning a role to both a user and a team", func() {
+			r := models.Role{UserID: "alice", TeamID: "devs", ResourceType: "project", ResourceID: "p1", Role: "reader"}
+			Convey("It should be invalid", func() {
+				So(r.Validate(), ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,210 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/ernestio/api-gateway/controllers"
+	"github.com/ernestio/api-gateway/controllers/users"
+	"github.com/ernestio/api-gateway/helpers"
+	"github.com/ernestio/api-gateway/models"
+	"github.com/labstack/echo"
+	"github.com/nats-io/go-nats"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var tokenHolder *models.User
+
+// tokenStore keeps the api tokens of a single user, which is not found
+// once tokenHolder is nil
+func tokenStore() {
+	reply := func(msg *nats.Msg, v interface{}) {
+		data, _ := json.Marshal(v)
+		if err := models.N.Publish(msg.Reply, data); err != nil {
+			log.Println(err)
+		}
+	}
+
+	_, _ = models.N.Subscribe("user.get", func(msg *nats.Msg) {
+		if tokenHolder == nil {
+			reply(msg, map[string]string{"_error": "Not found"})
+			return
+		}
+		reply(msg, tokenHolder)
+	})
+
+	_, _ = models.N.Subscribe("user.set", func(msg *nats.Msg) {
+		var u models.User
+		_ = json.Unmarshal(msg.Data, &u)
+		tokenHolder = &u
+		reply(msg, u)
+	})
+
+	_, _ = models.N.Subscribe("api_token.get", func(msg *nats.Msg) {
+		var q models.APIToken
+		_ = json.Unmarshal(msg.Data, &q)
+		for _, t := range storedAPITokens {
+			if t.TokenID == q.TokenID {
+				reply(msg, t)
+				return
+			}
+		}
+		reply(msg, map[string]string{"_error": "Not found"})
+	})
+
+	_, _ = models.N.Subscribe("api_token.find", func(msg *nats.Msg) {
+		var q models.APIToken
+		found := []models.APIToken{}
+		_ = json.Unmarshal(msg.Data, &q)
+		for _, t := range storedAPITokens {
+			if t.Username == q.Username {
+				found = append(found, t)
+			}
+		}
+		reply(msg, found)
+	})
+
+	_, _ = models.N.Subscribe("api_token.del", func(msg *nats.Msg) {
+		var q models.APIToken
+		var kept []models.APIToken
+		_ = json.Unmarshal(msg.Data, &q)
+		for _, t := range storedAPITokens {
+			if t.ID != q.ID {
+				kept = append(kept, t)
+			}
+		}
+		storedAPITokens = kept
+		reply(msg, map[string]string{})
+	})
+}
+
+func TestAPITokens(t *testing.T) {
+	testsSetup()
+
+	Convey("Scenario: using an api token", t, func() {
+		storedSessions = nil
+		storedRevocations = nil
+		storedAPITokens = []models.APIToken{{ID: 1, TokenID: "t1", Name: "ci", Username: "admin", CreatedAt: time.Now().Unix()}}
+		tokenHolder = &models.User{ID: 2, Username: "admin", Admin: helpers.Bool(true)}
+		sessionStore()
+		tokenStore()
+
+		// tokens signed before the admin claim was dropped still carry it
+		token, err := controllers.Keys.Sign(jwt.MapClaims{
+			"type":     "api",
+			"jti":      "t1",
+			"username": "admin",
+			"admin":    true,
+			"iat":      time.Now().Unix(),
+		})
+		So(err, ShouldBeNil)
+
+		access := func() (*models.User, error) {
+			var au *models.User
+
+			e := echo.New()
+			req := httptest.NewRequest(echo.GET, "/api/envs/", nil)
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+			err := controllers.ValidateToken(controllers.CheckRevocation(func(c echo.Context) error {
+				u := controllers.AuthenticatedUser(c)
+				au = &u
+				return nil
+			}))(e.NewContext(req, httptest.NewRecorder()))
+
+			return au, err
+		}
+
+		Convey("When its user is an admin", func() {
+			au, err := access()
+			Convey("It should grant admin access", func() {
+				So(err, ShouldBeNil)
+				So(au.IsAdmin(), ShouldBeTrue)
+			})
+		})
+
+		Convey("When its user is no longer an admin", func() {
+			tokenHolder.Admin = helpers.Bool(false)
+			au, err := access()
+			Convey("It should not grant admin access", func() {
+				So(err, ShouldBeNil)
+				So(au.IsAdmin(), ShouldBeFalse)
+			})
+		})
+
+		Convey("When its user has been disabled", func() {
+			tokenHolder.Disabled = helpers.Bool(true)
+			_, err := access()
+			Convey("It should be rejected", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*echo.HTTPError).Code, ShouldEqual, 401)
+			})
+		})
+
+		Convey("When its user has been deleted", func() {
+			tokenHolder = nil
+			_, err := access()
+			Convey("It should be rejected", func() {
+				So(err, ShouldNotBeNil)
+				So(err.(*echo.HTTPError).Code, ShouldEqual, 401)
+			})
+		})
+
+		Convey("When an admin disables its user", func() {
+			st, _ := users.Update(models.User{ID: 3, Username: "root", Admin: helpers.Bool(true)}, "admin", []byte(`{"username":"admin","disabled":true}`))
+			Convey("It should delete the user tokens", func() {
+				So(st, ShouldEqual, 200)
+				So(storedAPITokens, ShouldBeEmpty)
+			})
+		})
+	})
+
+	Convey("Scenario: using a scoped token", t, func() {
+		scope := models.APIToken{Name: "ci", Projects: []string{"p1"}, Environments: []string{"p2/e1"}}
+		scoped := models.User{ID: 1, Username: "test", Scope: &scope}
+
+		Convey("It should cover the resources inside its scope", func() {
+			So(scope.Covers("project", "p1"), ShouldBeTrue)
+			So(scope.Covers("environment", "p1/any"), ShouldBeTrue)
+			So(scope.Covers("environment", "p2/e1"), ShouldBeTrue)
+			So(scope.Covers("build", "p2/e1/b1"), ShouldBeTrue)
+			So(scoped.InScope("get_environment", "environment", "p2/e1"), ShouldBeTrue)
+		})
+
+		Convey("It should not cover the resources outside its scope", func() {
+			So(scope.Covers("project", "p2"), ShouldBeFalse)
+			So(scope.Covers("environment", "p2/e2"), ShouldBeFalse)
+			So(scope.Covers("build", "p2/e2/b1"), ShouldBeFalse)
+			So(scope.Covers("policy", "pci"), ShouldBeFalse)
+			So(scoped.InScope("get_environment", "environment", "p3/e1"), ShouldBeFalse)
+		})
+
+		Convey("It should only allow the actions it lists", func() {
+			scope.Actions = []string{"get_environment"}
+			So(scope.Validate(), ShouldBeNil)
+			So(scoped.InScope("get_environment", "environment", "p2/e1"), ShouldBeTrue)
+			So(scoped.InScope("delete_env", "environment", "p2/e1"), ShouldBeFalse)
+		})
+
+		Convey("It should only accept permissions as actions", func() {
+			scope.Actions = []string{"envs/get"}
+			So(scope.Validate(), ShouldNotBeNil)
+		})
+
+		Convey("It should not manage sessions", func() {
+			st, _ := helpers.IsAuthorized(&scoped, "sessions/list")
+			So(st, ShouldEqual, 403)
+			st, _ = helpers.IsAuthorized(&scoped, "sessions/revoke")
+			So(st, ShouldEqual, 403)
+			st, _ = helpers.IsAuthorized(&models.User{ID: 1, Username: "test"}, "sessions/list")
+			So(st, ShouldEqual, 200)
+		})
+	})
+}
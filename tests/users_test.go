@@ -6,11 +6,13 @@ package main
 
 import (
 	"encoding/json"
+	"log"
 	"testing"
 
 	"github.com/ernestio/api-gateway/controllers/users"
 	"github.com/ernestio/api-gateway/helpers"
 	"github.com/ernestio/api-gateway/models"
+	"github.com/nats-io/go-nats"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -166,11 +168,11 @@ func TestCreateUser(t *testing.T) {
 						})
 					})
 					Convey("With a password using invalid characters", func() {
-						invalidData := []byte(`{"group_id": 1, "username": "new-test", "password": "test^1234"}`)
+						invalidData := []byte(`{"group_id": 1, "username": "new-test", "password": "test\u00071234"}`)
 						st, resp := users.Create(admin, invalidData)
 						Convey("It should return an error message with a 400 repsonse", func() {
 							So(st, ShouldEqual, 400)
-							So(string(resp), ShouldContainSubstring, "Password can only contain the following characters: a-z 0-9 @._-")
+							So(string(resp), ShouldContainSubstring, "Password can only contain printable characters")
 						})
 					})
 					Convey("With no username", func() {
@@ -273,11 +275,11 @@ func TestUpdateUser(t *testing.T) {
 					})
 					Convey("With a password using invalid characters", func() {
 						getUserSubscriber(1)
-						data := []byte(`{"id": 1, "username": "test", "password": "new^password"}`)
+						data := []byte(`{"id": 1, "username": "test", "password": "new\u0007password"}`)
 						st, resp := users.Update(admin, "test", data)
 						Convey("It should return an error message with a 400 repsonse", func() {
 							So(st, ShouldEqual, 400)
-							So(string(resp), ShouldContainSubstring, "Password can only contain the following characters: a-z 0-9 @._-")
+							So(string(resp), ShouldContainSubstring, "Password can only contain printable characters")
 						})
 					})
 					Convey("With no password", func() {
@@ -297,13 +299,9 @@ func TestUpdateUser(t *testing.T) {
 						data := []byte(`{"id": 1, "username": "test", "mfa": true}`)
 						st, resp := users.Update(admin, "test", data)
 
-						Convey("It should update the user and return the correct set of data", func() {
-							var u models.User
-							err = json.Unmarshal(resp, &u)
-							So(st, ShouldEqual, 200)
-							So(u.Username, ShouldEqual, "test")
-							So(*u.MFA, ShouldEqual, true)
-							So(u.MFASecret, ShouldNotBeBlank)
+						Convey("It should require enabling MFA through the mfa endpoints", func() {
+							So(st, ShouldEqual, 400)
+							So(string(resp), ShouldContainSubstring, "MFA can only be changed through /users/test/mfa/")
 						})
 					})
 					Convey("With a payload disabling MFA", func() {
@@ -351,13 +349,9 @@ func TestUpdateUser(t *testing.T) {
 						data := []byte(`{"id": 1, "username": "test", "mfa": true}`)
 						st, resp := users.Update(admin, "test", data)
 
-						Convey("It should update the user and return the correct set of data", func() {
-							var u models.User
-							err = json.Unmarshal(resp, &u)
-							So(st, ShouldEqual, 200)
-							So(u.Username, ShouldEqual, "test")
-							So(*u.MFA, ShouldEqual, true)
-							So(u.MFASecret, ShouldNotBeBlank)
+						Convey("It should require enabling MFA through the mfa endpoints", func() {
+							So(st, ShouldEqual, 400)
+							So(string(resp), ShouldContainSubstring, "MFA can only be changed through /users/test/mfa/")
 						})
 					})
 					Convey("With a payload disabling MFA", func() {
@@ -405,6 +399,23 @@ func TestDeleteUser(t *testing.T) {
 	admin := models.User{ID: 2, Username: "admin", Admin: helpers.Bool(true)}
 
 	Convey("Scenario: deleting a user", t, func() {
+		storedTeams = []models.Team{
+			{ID: 1, Name: "devs", Members: []string{"test", "test2"}},
+			{ID: 2, Name: "ops", Members: []string{"test2"}},
+		}
+		storedAPITokens = []models.APIToken{{ID: 1, Username: "test"}, {ID: 2, Username: "test2"}}
+		storedTeamGrants = []models.Role{
+			{ID: 1, UserID: "test", ResourceType: "project", ResourceID: "p1", Role: "owner"},
+			{ID: 2, UserID: "test2", ResourceType: "project", ResourceID: "p1", Role: "reader"},
+			{ID: 3, TeamID: "devs", ResourceType: "project", ResourceID: "p2", Role: "reader"},
+		}
+		storedSessions = []models.Session{{ID: 1, SessionID: "s1", Username: "test"}, {ID: 2, SessionID: "s2", Username: "test2"}}
+		storedRevocations = nil
+		teamQueries = nil
+		teamStore()
+		tokenStore()
+		sessionStore()
+		getUserSubscriber(1)
 		deleteUserSubscriber()
 
 		Convey("Given existing users on the store", func() {
@@ -415,6 +426,31 @@ func TestDeleteUser(t *testing.T) {
 					Convey("It should delete the user and return a 200 ok", func() {
 						So(st, ShouldEqual, 200)
 					})
+
+					Convey("It should delete its api tokens", func() {
+						So(len(storedAPITokens), ShouldEqual, 1)
+						So(storedAPITokens[0].Username, ShouldEqual, "test2")
+					})
+
+					Convey("It should delete its direct roles", func() {
+						So(len(storedTeamGrants), ShouldEqual, 2)
+						So(storedTeamGrants[0].UserID, ShouldEqual, "test2")
+						So(storedTeamGrants[1].TeamID, ShouldEqual, "devs")
+					})
+
+					Convey("It should revoke and delete its sessions", func() {
+						So(len(storedRevocations), ShouldEqual, 1)
+						So(storedRevocations[0].Username, ShouldEqual, "test")
+						So(storedRevocations[0].TokenID, ShouldBeBlank)
+						So(len(storedSessions), ShouldEqual, 1)
+						So(storedSessions[0].Username, ShouldEqual, "test2")
+					})
+
+					Convey("It should remove the user from its teams", func() {
+						So(teamQueries, ShouldResemble, []map[string]interface{}{{"member": "test"}})
+						So(storedTeams[0].Members, ShouldResemble, []string{"test2"})
+						So(storedTeams[1].Members, ShouldResemble, []string{"test2"})
+					})
 				})
 			})
 		})
@@ -429,3 +465,33 @@ func TestDeleteUser(t *testing.T) {
 		})
 	})
 }
+
+func TestAuthenticateUser(t *testing.T) {
+	testsSetup()
+
+	Convey("Scenario: authenticating a user", t, func() {
+		var sent map[string]string
+		foundSubscriber("user.get", `{"id":1,"username":"test"}`, 1)
+		_, _ = models.N.Subscribe("authentication.get", func(msg *nats.Msg) {
+			if err := json.Unmarshal(msg.Data, &sent); err != nil {
+				log.Println(err)
+			}
+			if err := models.N.Publish(msg.Reply, []byte(`{"ok":true}`)); err != nil {
+				log.Println(err)
+			}
+		})
+
+		Convey("When the password holds json characters", func() {
+			password := `pass"word\", "admin": "true`
+			u := models.User{Username: "test", Password: &password}
+			res, err := u.Authenticate()
+			Convey("It should send the credentials unchanged", func() {
+				So(err, ShouldBeNil)
+				So(res.OK, ShouldBeTrue)
+				So(sent["username"], ShouldEqual, "test")
+				So(sent["password"], ShouldEqual, password)
+				So(sent, ShouldNotContainKey, "admin")
+			})
+		})
+	})
+}